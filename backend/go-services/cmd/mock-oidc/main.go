@@ -0,0 +1,95 @@
+// Command mock-oidc runs the oidctest provider as a standalone server, so the auth
+// service can be developed without Keycloak:
+//
+//	go run ./cmd/mock-oidc -addr :8090
+//	KEYCLOAK_URL=http://localhost:8090 KEYCLOAK_REALM=gogotex go run .
+//
+// It is NOT secure (see package oidctest) and must never face real users.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gogotex/gogotex/backend/go-services/internal/oidc/oidctest"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+)
+
+// defaultUsers are served unless -users is given
+var defaultUsers = []oidctest.User{
+	{
+		Username: "alice",
+		Password: "alice",
+		Sub:      "mock-alice",
+		Claims: map[string]interface{}{
+			"email":          "alice@example.com",
+			"email_verified": true,
+			"name":           "Alice Example",
+			"realm_access":   map[string]interface{}{"roles": []string{"student"}},
+		},
+	},
+	{
+		Username: "bob",
+		Password: "bob",
+		Sub:      "mock-bob",
+		Claims: map[string]interface{}{
+			"email":          "bob@example.com",
+			"email_verified": true,
+			"name":           "Bob Example",
+			"realm_access":   map[string]interface{}{"roles": []string{"teacher", "admin"}},
+		},
+	},
+}
+
+func main() {
+	addr := flag.String("addr", ":8090", "listen address")
+	baseURL := flag.String("url", "", "public base URL (default http://localhost<addr>)")
+	realm := flag.String("realm", oidctest.DefaultRealm, "realm name")
+	usersFile := flag.String("users", "", "JSON file with the accounts to serve ([{username, password, sub, claims}])")
+	client := flag.String("client", "", "register a client as id:secret (default: accept any client)")
+	flag.Parse()
+	logger.Init(os.Getenv("LOG_LEVEL"))
+
+	if *baseURL == "" {
+		host := *addr
+		if strings.HasPrefix(host, ":") {
+			host = "localhost" + host
+		}
+		*baseURL = "http://" + host
+	}
+
+	accounts := defaultUsers
+	if *usersFile != "" {
+		b, err := os.ReadFile(*usersFile)
+		if err != nil {
+			logger.Fatalf("reading users: %v", err)
+		}
+		if err := json.Unmarshal(b, &accounts); err != nil {
+			logger.Fatalf("parsing %s: %v", *usersFile, err)
+		}
+	}
+	opts := []oidctest.Option{oidctest.WithRealm(*realm)}
+	for _, u := range accounts {
+		opts = append(opts, oidctest.WithUser(u))
+	}
+	if *client != "" {
+		id, secret, _ := strings.Cut(*client, ":")
+		opts = append(opts, oidctest.WithClient(id, secret))
+	}
+
+	p, err := oidctest.NewProvider(*baseURL, opts...)
+	if err != nil {
+		logger.Fatalf("creating provider: %v", err)
+	}
+	for _, u := range accounts {
+		logger.Infof("user %s (sub %s)", u.Username, u.Sub)
+	}
+	logger.Infof("mock OIDC provider listening on %s: issuer %s", *addr, p.Issuer())
+	logger.Infof("point the auth service at it with KEYCLOAK_URL=%s KEYCLOAK_REALM=%s", p.URL(), p.Realm())
+	if err := http.ListenAndServe(*addr, p); err != nil {
+		logger.Fatalf("mock OIDC provider: %v", err)
+	}
+}
@@ -4,30 +4,40 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/authflow"
+	"github.com/gogotex/gogotex/backend/go-services/internal/clients"
 	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/device"
+	"github.com/gogotex/gogotex/backend/go-services/internal/httpclient"
+	"github.com/gogotex/gogotex/backend/go-services/internal/lockout"
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
 	"github.com/gogotex/gogotex/backend/go-services/internal/oidc"
 	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
 	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
 	"github.com/gogotex/gogotex/backend/go-services/internal/users"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/metrics"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
 )
 
 // LoginRequest used for password-mode login (dev/testing)
 type LoginRequest struct {
-	Mode        string `json:"mode" binding:"required"` // "password" | "auth_code"
+	Mode        string `json:"mode" binding:"required"` // "password" | "auth_code" (only without a flow store)
 	Username    string `json:"username"`
 	Password    string `json:"password"`
 	Code        string `json:"code"`         // authorization code
 	RedirectURI string `json:"redirect_uri"` // redirect uri used in auth code flow
+	Provider    string `json:"provider"`     // identity provider name; empty selects the primary one
 }
 
 // AuthHandler holds dependencies
@@ -35,18 +45,83 @@ type AuthHandler struct {
 	cfg        *config.Config
 	usersSvc   *users.Service
 	sessionsSvc *sessions.Service
+	flows       authflow.Store
+	// device authorization grant (see device.go)
+	devices        device.Store
+	deviceVerifier middleware.Verifier
+	// token introspection (see introspect.go)
+	clients            *clients.Registry
+	introspectVerifier middleware.Verifier
+	// client_credentials grant (see client_credentials.go)
+	tokenClients *clients.Registry
+	// OIDC back-channel logout (see backchannel.go)
+	logoutVerifier middleware.Verifier
+	// ID-token verifiers of the identity providers (see providers.go)
+	providers *oidc.Registry
+	// outbound client for token-endpoint calls
+	httpClient *httpclient.Client
+	// new-device sign-in notifications
+	knownDevices *sessions.DeviceTracker
+	// brute-force protection of password-mode logins
+	loginGuard *lockout.Guard
 }
 
-func NewAuthHandler(cfg *config.Config, u *users.Service, s *sessions.Service) *AuthHandler {
-	return &AuthHandler{cfg: cfg, usersSvc: u, sessionsSvc: s}
+// Option configures optional AuthHandler dependencies
+type Option func(*AuthHandler)
+
+// WithAuthFlowStore enables the server-side authorization-code flow
+// (GET /auth/authorize and GET /auth/callback).
+func WithAuthFlowStore(st authflow.Store) Option {
+	return func(h *AuthHandler) { h.flows = st }
+}
+
+// WithHTTPClient sets the client used for calls to the identity providers' token
+// endpoints; the default has the httpclient package defaults.
+func WithHTTPClient(c *httpclient.Client) Option {
+	return func(h *AuthHandler) { h.httpClient = c }
+}
+
+// WithDeviceTracker remembers the devices users sign in from and notifies them of
+// logins from new ones.
+func WithDeviceTracker(t *sessions.DeviceTracker) Option {
+	return func(h *AuthHandler) { h.knownDevices = t }
+}
+
+// WithLoginGuard locks usernames and client IPs out of password-mode login after
+// repeated failures.
+func WithLoginGuard(g *lockout.Guard) Option {
+	return func(h *AuthHandler) { h.loginGuard = g }
+}
+
+func NewAuthHandler(cfg *config.Config, u *users.Service, s *sessions.Service, opts ...Option) *AuthHandler {
+	h := &AuthHandler{cfg: cfg, usersSvc: u, sessionsSvc: s}
+	for _, o := range opts {
+		o(h)
+	}
+	if h.httpClient == nil {
+		h.httpClient = httpclient.New("keycloak")
+	}
+	if h.providers == nil {
+		h.providers = oidc.NewRegistry(cfg.IdentityProviders())
+	}
+	return h
 }
 
 // Register routes under /auth
 func (h *AuthHandler) Register(rg *gin.RouterGroup) {
 	a := rg.Group("/auth")
 	a.POST("/login", h.Login)
-	a.POST("/refresh", h.Refresh)
-	a.POST("/logout", h.Logout)
+	// cookie-authenticated requests must pass the double-submit CSRF check
+	csrf := middleware.CSRFMiddleware(RefreshCookieName)
+	a.POST("/refresh", csrf, h.Refresh)
+	a.POST("/logout", csrf, h.Logout)
+	a.GET("/authorize", h.Authorize)
+	a.GET("/callback", h.Callback)
+	h.registerDevice(a)
+	a.POST("/token", h.Token)
+	a.POST("/introspect", h.Introspect)
+	a.POST("/revoke", h.Revoke)
+	a.POST("/backchannel-logout", h.BackchannelLogout)
 }
 
 // Login implements a minimal login: password grant (dev/testing) and authorization-code exchange
@@ -60,22 +135,52 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported mode"})
 		return
 	}
-	host := h.cfg.Keycloak.URL
-	realm := h.cfg.Keycloak.Realm
-	if host == "" || realm == "" {
+	// a posted code carries no state, nonce or PKCE binding; when the flow store is
+	// available browsers must go through /auth/authorize and /auth/callback instead
+	if req.Mode == "auth_code" && h.flows != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "auth_code mode is disabled; use /auth/authorize"})
+		return
+	}
+	if len(h.cfg.IdentityProviders()) == 0 {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Keycloak not configured"})
 		return
 	}
+	p, ok := h.cfg.Provider(req.Provider)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown provider"})
+		return
+	}
+	ep, err := h.providerEndpoints(p)
+	if err != nil {
+		logger.Errorf("identity provider %s unavailable: %v", p.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
+		return
+	}
 
 	var tokenResp *tokenResponse
-	var err error
 	if req.Mode == "password" {
-		// password grant
-		tokenResp, err = requestPasswordToken(c.Request.Context(), host, realm, h.cfg.Keycloak.ClientID, h.cfg.Keycloak.ClientSecret, req.Username, req.Password, h.cfg)
+		// password grant, unless the username or client IP is locked out
+		if !h.checkLoginLockout(c, req.Username) {
+			return
+		}
+		tokenResp, err = requestPasswordToken(c.Request.Context(), h.httpClient, ep.Token, p.ClientID, p.ClientSecret, req.Username, req.Password, h.cfg)
+		var rejected *tokenEndpointError
+		if errors.As(err, &rejected) && rejected.Status < http.StatusInternalServerError {
+			logger.Infof("password login failed for %q from %s: %v", req.Username, c.ClientIP(), err)
+			h.recordLoginFailure(c, req.Username)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication failed"})
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication failed", "details": err.Error()})
+			logger.Errorf("password grant at %s failed: %v", p.Name, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
 			return
 		}
+		if h.loginGuard != nil {
+			if err := h.loginGuard.Succeed(c.Request.Context(), req.Username); err != nil {
+				logger.Warnf("failed to reset login failures of %q: %v", req.Username, err)
+			}
+		}
 	} else {
 		// authorization code exchange
 		if req.Code == "" || req.RedirectURI == "" {
@@ -84,56 +189,194 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		}
 		// log a safe, truncated diagnostic to help CI debugging (do not log full secrets)
 		logger.Debugf("Login(auth_code): received code length=%d redirect_uri=%s", len(req.Code), req.RedirectURI)
-		tokenResp, err = requestAuthCodeToken(c.Request.Context(), host, realm, h.cfg.Keycloak.ClientID, h.cfg.Keycloak.ClientSecret, req.Code, req.RedirectURI)
+		tokenResp, err = requestAuthCodeToken(c.Request.Context(), h.httpClient, ep.Token, p.ClientID, p.ClientSecret, req.Code, req.RedirectURI, "")
 		if err != nil {
 			// log token exchange error with redirect URI for easier debugging in CI/integration runs
 			logger.Errorf("auth-code token exchange error (redirect_uri=%q): %v", req.RedirectURI, err)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication failed", "details": err.Error(), "redirect_uri_used": req.RedirectURI})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication failed"})
 			return
 		}
 	}
 	// verify id_token and upsert user
-	claims, err := verifyIDToken(c.Request.Context(), tokenResp.IDToken, h.cfg)
+	claims, err := h.verifyIDToken(c.Request.Context(), p, tokenResp.IDToken)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid id token", "details": err.Error()})
 		return
 	}
+	res, ok := h.completeLogin(c, p.ClientID, claims, tokenResp.IDToken)
+	if !ok {
+		return
+	}
+	// Return camelCase response to match frontend `LoginResponse` shape
+	c.JSON(http.StatusOK, h.loginResponse(res))
+}
+
+// checkLoginLockout writes a 429 response with Retry-After and returns false while
+// username or the client IP is locked out of password login
+func (h *AuthHandler) checkLoginLockout(c *gin.Context, username string) bool {
+	if h.loginGuard == nil {
+		return true
+	}
+	wait, err := h.loginGuard.Check(c.Request.Context(), username, c.ClientIP())
+	if err != nil {
+		logger.Errorf("login lockout check failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login lockout check failed"})
+		return false
+	}
+	if wait > 0 {
+		metrics.LoginFailures.WithLabelValues("locked").Inc()
+		tooManyLoginAttempts(c, wait)
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure counts a rejected password login against username and the
+// client IP
+func (h *AuthHandler) recordLoginFailure(c *gin.Context, username string) {
+	metrics.LoginFailures.WithLabelValues("invalid_credentials").Inc()
+	if h.loginGuard == nil {
+		return
+	}
+	wait, err := h.loginGuard.Fail(c.Request.Context(), username, c.ClientIP())
+	if err != nil {
+		logger.Warnf("failed to record login failure of %q: %v", username, err)
+		return
+	}
+	if wait > 0 {
+		logger.Warnf("password login locked for %s: username=%q ip=%s", wait, username, c.ClientIP())
+	}
+}
+
+func tooManyLoginAttempts(c *gin.Context, wait time.Duration) {
+	retryAfter := int((wait + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed login attempts", "retryAfter": retryAfter})
+}
+
+// loginResponse renders the login JSON body. In cookie mode the refresh token is
+// only delivered as a cookie (set by completeLogin) and omitted from the body.
+func (h *AuthHandler) loginResponse(res *loginResult) gin.H {
+	body := gin.H{"accessToken": res.AccessToken, "user": res.User, "expiresIn": res.ExpiresIn}
+	if !h.cfg.Cookies.Enabled {
+		body["refreshToken"] = res.RefreshToken
+	}
+	return body
+}
+
+// loginResult holds the tokens issued after a successful upstream authentication
+type loginResult struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+	User         *models.User
+}
+
+// defaults for configurations without JWT lifetimes
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultSessionLifetime = 7 * 24 * time.Hour
+)
+
+// lifetimes returns the access-token TTL, idle timeout and absolute session lifetime
+// for a login of u through clientID (see config.SessionPolicy)
+func (h *AuthHandler) lifetimes(clientID string, u *models.User) config.SessionPolicy {
+	lt := h.cfg.SessionLifetimes(clientID, u.Roles)
+	if lt.AccessTokenTTL <= 0 {
+		lt.AccessTokenTTL = defaultAccessTokenTTL
+	}
+	if lt.MaxLifetime <= 0 {
+		lt.MaxLifetime = defaultSessionLifetime
+	}
+	return lt
+}
+
+// completeLogin upserts the user from verified ID-token claims, creates a refresh
+// session and issues an access token. clientID is the OAuth client the user signed
+// in through; it selects the session lifetimes. The raw idToken is kept with the
+// session for RP-initiated logout. On failure it writes the error response and
+// returns ok=false.
+func (h *AuthHandler) completeLogin(c *gin.Context, clientID string, claims map[string]interface{}, idToken string) (*loginResult, bool) {
 	u, err := h.usersSvc.UpsertFromClaims(c.Request.Context(), claims)
+	if errors.Is(err, users.ErrIdentityConflict) {
+		logger.Warnf("login refused: %v (iss=%v sub=%v)", err, claims["iss"], claims["sub"])
+		c.JSON(http.StatusConflict, gin.H{"error": "account conflicts with an existing user"})
+		return nil, false
+	}
 	if err != nil {
 		logger.Errorf("user upsert error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "user upsert failed", "details": err.Error()})
-		return
+		return nil, false
 	}
 	if u == nil {
 		logger.Errorf("user upsert returned nil user (claims missing 'sub')")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "user upsert failed", "details": "no user returned from upsert"})
-		return
+		return nil, false
+	}
+	// create refresh session, remembering the Keycloak session for back-channel logout
+	// and the ID token for RP-initiated logout
+	lt := h.lifetimes(clientID, u)
+	opts := []sessions.Option{clientInfo(c), sessions.WithDevice(h.deviceID(c)), sessions.WithIDToken(idToken), sessions.WithClientID(clientID), sessions.WithIdleTimeout(lt.IdleTimeout)}
+	if sid, _ := claims["sid"].(string); sid != "" {
+		iss, _ := claims["iss"].(string)
+		opts = append(opts, sessions.WithProviderSession(iss, sid))
 	}
-	// create refresh session
-	rft, err := h.sessionsSvc.CreateSession(c.Request.Context(), u.Sub, 7*24*time.Hour)
+	sess, err := h.sessionsSvc.OpenSession(c.Request.Context(), u.Sub, lt.MaxLifetime, opts...)
 	if err != nil {
 		logger.Errorf("failed to create session: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session", "details": err.Error()})
-		return
+		return nil, false
+	}
+	if h.cfg.Cookies.Enabled {
+		if err := h.setSessionCookies(c, sess.RefreshToken, time.Until(sess.ExpiresAt)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set session cookie"})
+			return nil, false
+		}
 	}
 	// create access token
-	access, err := tokens.GenerateAccessToken(h.cfg, u, 15*time.Minute)
+	access, err := tokens.GenerateAccessToken(h.cfg, u, lt.AccessTokenTTL, tokens.WithSessionID(sess.FamilyID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create access token"})
+		return nil, false
+	}
+	h.trackDevice(c, u, sess)
+	return &loginResult{AccessToken: access, RefreshToken: sess.RefreshToken, ExpiresIn: int(lt.AccessTokenTTL.Seconds()), User: u}, true
+}
+
+// trackDevice records the device of a new session and notifies the user when it was
+// not seen before. It runs in the background so that mail delivery never delays the
+// login.
+func (h *AuthHandler) trackDevice(c *gin.Context, u *models.User, sess *sessions.Session) {
+	if h.knownDevices == nil {
 		return
 	}
-	// Return camelCase response to match frontend `LoginResponse` shape
-	c.JSON(http.StatusOK, gin.H{"accessToken": access, "refreshToken": rft, "user": u, "expiresIn": 900})
+	ctx := context.WithoutCancel(c.Request.Context())
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		if _, err := h.knownDevices.Track(ctx, u, sess); err != nil {
+			logger.Warnf("new device check failed for sub=%s: %v", u.Sub, err)
+		}
+	}()
 }
 
-// Refresh accepts a refresh token and returns a new access token
+// Refresh accepts a refresh token (JSON body or refresh cookie) and returns a new
+// access token together with a rotated refresh token. The presented refresh token is
+// invalidated; replaying it revokes every session of its token family. Each refresh
+// restarts the session's idle window, up to its absolute lifetime; the response
+// reports both the access-token lifetime (expires_in) and the time left until the
+// session ends without another refresh (refresh_expires_in).
 func (h *AuthHandler) Refresh(c *gin.Context) {
-	var req struct{ RefreshToken string `json:"refresh_token" binding:"required"` }
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	presented, ok := refreshTokenFromRequest(c)
+	if !ok {
+		return
+	}
+	rft, sess, err := h.sessionsSvc.Rotate(c.Request.Context(), presented, clientInfo(c))
+	if errors.Is(err, sessions.ErrRefreshTokenReused) {
+		logger.Warnf("refresh token reuse detected: sub=%s family=%s; session family revoked", sess.Sub, sess.FamilyID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
 		return
 	}
-	sess, err := h.sessionsSvc.ValidateRefresh(c.Request.Context(), req.RefreshToken)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "validation failed"})
 		return
@@ -148,52 +391,107 @@ func (h *AuthHandler) Refresh(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "user lookup failed"})
 		return
 	}
-	access, err := tokens.GenerateAccessToken(h.cfg, u, 15*time.Minute)
+	lt := h.lifetimes(sess.ClientID, u)
+	access, err := tokens.GenerateAccessToken(h.cfg, u, lt.AccessTokenTTL, tokens.WithSessionID(sess.FamilyID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create access token"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"access_token": access, "expires_in": 900})
+	expiresIn, refreshExpiresIn := int(lt.AccessTokenTTL.Seconds()), int(time.Until(sess.ExpiresAt).Seconds())
+	if h.cfg.Cookies.Enabled {
+		if err := h.setSessionCookies(c, rft, time.Until(sess.ExpiresAt)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set session cookie"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"access_token": access, "expires_in": expiresIn, "refresh_expires_in": refreshExpiresIn})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"access_token": access, "refresh_token": rft, "expires_in": expiresIn, "refresh_expires_in": refreshExpiresIn})
 }
 
-// Logout invalidates the refresh token and (optionally) blacklists the current access token
+// Logout invalidates the refresh token (JSON body or refresh cookie) and (optionally)
+// blacklists the current access token. When Keycloak is configured the response
+// carries endSessionUrl; the client navigates there so the Keycloak SSO session ends
+// as well and the next login asks for credentials again.
 func (h *AuthHandler) Logout(c *gin.Context) {
-	var req struct{ RefreshToken string `json:"refresh_token" binding:"required"` }
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	refresh, ok := refreshTokenFromRequest(c)
+	if !ok {
+		return
+	}
+	sess, err := h.sessionsSvc.ValidateRefresh(c.Request.Context(), refresh)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load session"})
 		return
 	}
-	// If the client supplied an Authorization Bearer token, attempt to blacklist it
+	// If the client supplied an Authorization Bearer token, revoke it by jti. As in
+	// Revoke, only tokens we signed are blacklisted: others could fill the blacklist
+	// with forged jtis or revoke another user's token.
 	auth := c.GetHeader("Authorization")
 	if auth != "" {
 		var at string
 		if n, _ := fmt.Sscanf(auth, "Bearer %s", &at); n == 1 {
-			if exp, err := parseExpFromJWT(at); err == nil {
-				ttl := time.Until(exp)
-				if ttl > 0 {
-					if err := sessions.BlacklistAccessToken(c.Request.Context(), at, ttl); err != nil {
-						c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to blacklist access token"})
-						return
-					}
-				}
+			if _, err := tokens.NewVerifier(h.cfg).Verify(c.Request.Context(), at); err != nil {
+				at = ""
+			}
+			if err := revokeAccessToken(c.Request.Context(), at); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to blacklist access token"})
+				return
 			}
 		}
 	}
 
-	if err := h.sessionsSvc.DeleteRefresh(c.Request.Context(), req.RefreshToken); err != nil {
+	if err := h.sessionsSvc.DeleteRefresh(c.Request.Context(), refresh); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove session"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+	h.clearSessionCookies(c)
+	body := gin.H{"message": "logged out"}
+	idToken := ""
+	if sess != nil {
+		idToken = sess.IDToken
+	}
+	if u := h.endSessionURL(idToken); u != "" {
+		body["endSessionUrl"] = u
+	}
+	c.JSON(http.StatusOK, body)
 }
 
-// parseExpFromJWT decodes the JWT payload and returns the `exp` claim as time.Time.
-// This performs payload-only parsing (no signature verification) and is suitable
-// for computing remaining TTLs for blacklisting purposes.
-func parseExpFromJWT(tok string) (time.Time, error) {
+// endSessionURL builds the end_session_endpoint URL (RP-initiated logout) of the
+// provider that issued idToken, or of the primary provider when there is no ID
+// token. Without an ID token hint the provider asks the user to confirm the logout.
+func (h *AuthHandler) endSessionURL(idToken string) string {
+	p, ok := h.cfg.Provider("")
+	if idToken != "" {
+		if claims, err := unverifiedClaims(idToken); err == nil {
+			iss, _ := claims["iss"].(string)
+			if ip, found := h.cfg.ProviderByIssuer(iss); found {
+				p, ok = ip, true
+			}
+		}
+	}
+	if !ok {
+		return ""
+	}
+	ep, err := h.providerEndpoints(p)
+	if err != nil || ep.EndSession == "" {
+		return ""
+	}
+	q := url.Values{}
+	q.Set("client_id", p.ClientID)
+	if idToken != "" {
+		q.Set("id_token_hint", idToken)
+	}
+	if h.cfg.Keycloak.PostLogoutRedirect != "" {
+		q.Set("post_logout_redirect_uri", h.cfg.Keycloak.PostLogoutRedirect)
+	}
+	return ep.EndSession + "?" + q.Encode()
+}
+
+// unverifiedClaims decodes the JWT payload without verifying the signature.
+func unverifiedClaims(tok string) (map[string]interface{}, error) {
 	parts := strings.Split(tok, ".")
 	if len(parts) < 2 {
-		return time.Time{}, fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
 	payload := parts[1]
 	b, err := base64.RawURLEncoding.DecodeString(payload)
@@ -201,11 +499,22 @@ func parseExpFromJWT(tok string) (time.Time, error) {
 		// try standard base64 (pad) as a fallback
 		b, err = base64.StdEncoding.DecodeString(payload)
 		if err != nil {
-			return time.Time{}, err
+			return nil, err
 		}
 	}
 	var claims map[string]interface{}
 	if err := json.Unmarshal(b, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// parseExpFromJWT decodes the JWT payload and returns the `exp` claim as time.Time.
+// This performs payload-only parsing (no signature verification) and is suitable
+// for computing remaining TTLs for blacklisting purposes.
+func parseExpFromJWT(tok string) (time.Time, error) {
+	claims, err := unverifiedClaims(tok)
+	if err != nil {
 		return time.Time{}, err
 	}
 	v, ok := claims["exp"]
@@ -233,7 +542,31 @@ func parseExpFromJWT(tok string) (time.Time, error) {
 	}
 }
 
-// The functions requestPasswordToken and verifyIDToken are lightweight helpers implemented in the same package file
+// revokeAccessToken blacklists the token's `jti` for the rest of its lifetime. The
+// caller must have verified tok. Tokens without jti or exp, and already expired
+// tokens, are ignored.
+func revokeAccessToken(ctx context.Context, tok string) error {
+	claims, err := unverifiedClaims(tok)
+	if err != nil {
+		return nil
+	}
+	jti, _ := claims["jti"].(string)
+	exp, err := parseExpFromJWT(tok)
+	if jti == "" || err != nil {
+		return nil
+	}
+	ttl := time.Until(exp)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := sessions.BlacklistJTI(ctx, jti, ttl); err != nil {
+		return err
+	}
+	middleware.NoteRevoked(jti, exp)
+	return nil
+}
+
+// The functions requestPasswordToken and requestAuthCodeToken are lightweight helpers implemented in the same package file
 // to keep the handler tidy. They use HTTP requests and the OIDC verifier.
 
 // NOTE: to avoid cyclic imports we keep the implementation local and simple.
@@ -243,10 +576,7 @@ type tokenResponse struct {
 	IDToken     string `json:"id_token"`
 }
 
-func requestPasswordToken(ctx context.Context, host, realm, clientID, clientSecret, username, password string, cfg *config.Config) (*tokenResponse, error) {
-	// direct HTTP POST
-	tokenURL := host + "/realms/" + realm + "/protocol/openid-connect/token"
-	// Use net/http
+func requestPasswordToken(ctx context.Context, client *httpclient.Client, tokenURL, clientID, clientSecret, username, password string, cfg *config.Config) (*tokenResponse, error) {
 	form := urlValues(map[string]string{
 		"grant_type": "password",
 		"client_id":  clientID,
@@ -254,14 +584,20 @@ func requestPasswordToken(ctx context.Context, host, realm, clientID, clientSecr
 		"username": username,
 		"password": password,
 	})
-	resp, err := http.Post(tokenURL, "application/x-www-form-urlencoded", form)
+	req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, form)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// a password grant has no side effects at the provider, so it may be retried
+	resp, err := client.Do(httpclient.Idempotent(req))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, string(b))
+		return nil, &tokenEndpointError{Status: resp.StatusCode, Body: string(b)}
 	}
 	var tr tokenResponse
 	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
@@ -270,9 +606,23 @@ func requestPasswordToken(ctx context.Context, host, realm, clientID, clientSecr
 	return &tr, nil
 }
 
-func requestAuthCodeToken(ctx context.Context, host, realm, clientID, clientSecret, code, redirectURI string) (*tokenResponse, error) {
+// tokenEndpointError is a non-200 answer of an identity provider's token endpoint.
+// Its body is only logged, never returned to clients.
+type tokenEndpointError struct {
+	Status int
+	Body   string
+}
+
+func (e *tokenEndpointError) Error() string {
+	return fmt.Sprintf("token endpoint returned %d: %s", e.Status, e.Body)
+}
+
+// requestAuthCodeToken exchanges an authorization code. codeVerifier is the PKCE
+// verifier bound to the authorization request (empty when PKCE was not used).
+// Codes are single-use, so the exchange is not marked idempotent and is not retried
+// by the HTTP client.
+func requestAuthCodeToken(ctx context.Context, client *httpclient.Client, tokenURL, clientID, clientSecret, code, redirectURI, codeVerifier string) (*tokenResponse, error) {
 	// token exchange for authorization code
-	tokenURL := host + "/realms/" + realm + "/protocol/openid-connect/token"
 	formValues := map[string]string{
 		"grant_type":    "authorization_code",
 		"client_id":     clientID,
@@ -280,25 +630,28 @@ func requestAuthCodeToken(ctx context.Context, host, realm, clientID, clientSecr
 		"code":          code,
 		"redirect_uri":  redirectURI,
 	}
+	if codeVerifier != "" {
+		formValues["code_verifier"] = codeVerifier
+	}
+	post := func(basicAuth bool) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, urlValues(formValues))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if basicAuth {
+			req.SetBasicAuth(clientID, clientSecret)
+		}
+		return client.Do(req)
+	}
 
 	// Try the token exchange; if we get a transient 'Code not valid' we retry once (reduces flakiness in CI)
 	logger.Infof("requestAuthCodeToken: tokenURL=%s client_id=%s client_secret_set=%t redirect_uri=%s", tokenURL, clientID, clientSecret != "", redirectURI)
 	for attempt := 1; attempt <= 2; attempt++ {
-		// Use HTTP Basic auth for client authentication (more robust across Keycloak configs)
-		form := urlValues(formValues)
-		req, err := http.NewRequestWithContext(ctx, "POST", tokenURL, form)
-		if err != nil {
-			if attempt == 2 {
-				return nil, err
-			}
-			time.Sleep(100 * time.Millisecond)
-			continue
-		}
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		// Diagnostic: log the outgoing token request (without secrets) to aid CI debugging
 		fv := map[string]string{}
 		for k, v := range formValues {
-			if k == "client_secret" {
+			if k == "client_secret" || k == "code_verifier" {
 				fv[k] = "<redacted>"
 			} else if k == "code" {
 				fv[k] = fmt.Sprintf("<len=%d>", len(v))
@@ -311,28 +664,16 @@ func requestAuthCodeToken(ctx context.Context, host, realm, clientID, clientSecr
 		// parameters even when DEBUG logs are filtered.
 		logger.Infof("requestAuthCodeToken: outgoing-form-redacted=%v", fv)
 		// Primary attempt: use client_secret in form body (client_secret_post).
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := post(false)
 		if err == nil && resp.StatusCode == http.StatusUnauthorized {
 			// If Keycloak rejects client credentials for client_secret_post, retry using HTTP Basic auth.
 			b, _ := io.ReadAll(resp.Body)
 			_ = resp.Body.Close()
-			bodyStr := string(b)
-			logger.Warnf("requestAuthCodeToken: primary exchange returned 401, retrying with HTTP Basic; keycloak_resp=%s", strings.TrimSpace(bodyStr))
-			// build a new request and try Basic auth
-			form2 := urlValues(formValues)
-			req2, err2 := http.NewRequestWithContext(ctx, "POST", tokenURL, form2)
-			if err2 == nil {
-				req2.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-				req2.SetBasicAuth(clientID, clientSecret)
-				resp, err = http.DefaultClient.Do(req2)
-			}
+			logger.Warnf("requestAuthCodeToken: primary exchange returned 401, retrying with HTTP Basic; keycloak_resp=%s", strings.TrimSpace(string(b)))
+			resp, err = post(true)
 		}
 		if err != nil {
-			if attempt == 2 {
-				return nil, err
-			}
-			time.Sleep(100 * time.Millisecond)
-			continue
+			return nil, err
 		}
 		defer resp.Body.Close()
 		if resp.StatusCode != http.StatusOK {
@@ -340,7 +681,6 @@ func requestAuthCodeToken(ctx context.Context, host, realm, clientID, clientSecr
 			bodyStr := string(b)
 			// If Keycloak responded with Code not valid, allow one quick retry
 			if resp.StatusCode == http.StatusBadRequest && strings.Contains(bodyStr, "Code not valid") && attempt == 1 {
-				time.Sleep(150 * time.Millisecond)
 				continue
 			}
 			return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, bodyStr)
@@ -354,38 +694,6 @@ func requestAuthCodeToken(ctx context.Context, host, realm, clientID, clientSecr
 	return nil, fmt.Errorf("token exchange failed after retries")
 }
 
-func verifyIDToken(ctx context.Context, idToken string, cfg *config.Config) (map[string]interface{}, error) {
-	// Use the OIDC verifier if available, otherwise fall back to insecure parsing when allowed
-	// We perform a minimal parse: when ALLOW_INSECURE_TOKEN=true we just decode payload
-	// Normalize issuer
-	issuer := strings.TrimRight(cfg.Keycloak.URL, "/") + "/realms/" + cfg.Keycloak.Realm
-	ver, err := oidc.NewVerifier(ctx, issuer, cfg.Keycloak.ClientID)
-	if err != nil {
-		if strings.ToLower(strings.TrimSpace(os.Getenv("ALLOW_INSECURE_TOKEN"))) == "true" {
-			iv := oidc.NewInsecureVerifier()
-			tkn, err := iv.Verify(ctx, idToken)
-			if err != nil {
-				return nil, err
-			}
-			var claims map[string]interface{}
-			if err := tkn.Claims(&claims); err != nil {
-				return nil, err
-			}
-			return claims, nil
-		}
-		return nil, err
-	}
-	idt, err := ver.Verify(ctx, idToken)
-	if err != nil {
-		return nil, err
-	}
-	var claims map[string]interface{}
-	if err := idt.Claims(&claims); err != nil {
-		return nil, err
-	}
-	return claims, nil
-}
-
 // small helpers below
 
 // (helpers implemented inline below)
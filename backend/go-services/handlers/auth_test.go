@@ -4,36 +4,51 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/httpclient"
 	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/gogotex/gogotex/backend/go-services/internal/notify"
+	"github.com/gogotex/gogotex/backend/go-services/internal/oidc"
+	"github.com/gogotex/gogotex/backend/go-services/internal/oidc/oidctest"
 	"github.com/gogotex/gogotex/backend/go-services/internal/users"
 	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
 	mr "github.com/alicebob/miniredis/v2"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // fake user repo
 type fakeUserRepo struct{}
 
-func (f *fakeUserRepo) UpsertBySub(ctx context.Context, u *models.User) (*models.User, error) {
+func (f *fakeUserRepo) UpsertByIdentity(ctx context.Context, u *models.User) (*models.User, error) {
 	u.CreatedAt = time.Now().UTC()
 	u.UpdatedAt = u.CreatedAt
 	return u, nil
 }
 
+func (f *fakeUserRepo) GetByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	return &models.User{Sub: subject, Issuer: issuer, OIDCId: subject}, nil
+}
+
 func (f *fakeUserRepo) GetBySub(ctx context.Context, sub string) (*models.User, error) {
 	return &models.User{Sub: sub, Email: "a@b.c", Name: "Alice"}, nil
 }
 
+func (f *fakeUserRepo) SetTokensValidAfter(ctx context.Context, sub string, t time.Time) error {
+	return nil
+}
+
 // fake sessions repo
 type fakeSessionsRepo struct {
 	store map[string]*sessions.Session
@@ -53,41 +68,81 @@ func (f *fakeSessionsRepo) DeleteByRefresh(ctx context.Context, refresh string)
 	delete(f.store, refresh)
 	return nil
 }
+func (f *fakeSessionsRepo) MarkRotated(ctx context.Context, refresh string) (bool, error) {
+	s, ok := f.store[refresh]
+	if !ok || s.Rotated { return false, nil }
+	s.Rotated = true
+	return true, nil
+}
+func (f *fakeSessionsRepo) DeleteByFamily(ctx context.Context, familyID string) error {
+	for k, s := range f.store {
+		if s.FamilyID == familyID { delete(f.store, k) }
+	}
+	return nil
+}
 
-func TestLoginAuthCodeSuccess(t *testing.T) {
-	// craft an id_token with payload claims
-	claims := map[string]interface{}{"sub": "test-sub", "email": "a@b.c", "name": "Alice"}
-	b, _ := json.Marshal(claims)
-	payload := base64.RawURLEncoding.EncodeToString(b)
-	idToken := "hdr." + payload + ".sig"
+func (f *fakeSessionsRepo) ListBySub(ctx context.Context, sub string) ([]*sessions.Session, error) {
+	out := []*sessions.Session{}
+	for _, s := range f.store {
+		if s.Sub == sub && !s.Rotated && time.Now().Before(s.ExpiresAt) {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
 
-	// token server
-	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_ = r.ParseForm()
-		// return token response
-		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "id_token": idToken})
-	}))
-	defer tokenSrv.Close()
+func (f *fakeSessionsRepo) DeleteByID(ctx context.Context, sub, id string) (bool, error) {
+	deleted := false
+	for k, s := range f.store {
+		if s.Sub == sub && s.FamilyID == id {
+			delete(f.store, k)
+			deleted = true
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeSessionsRepo) DeleteBySub(ctx context.Context, sub string) error {
+	for k, s := range f.store {
+		if s.Sub == sub {
+			delete(f.store, k)
+		}
+	}
+	return nil
+}
+
+func (f *fakeSessionsRepo) DeleteByProviderSID(ctx context.Context, iss, sub, sid string) error {
+	for k, s := range f.store {
+		if s.ProviderIss == iss && s.ProviderSID == sid && (sub == "" || s.Sub == sub) {
+			delete(f.store, k)
+		}
+	}
+	return nil
+}
+
+func (f *fakeSessionsRepo) FamilyActive(ctx context.Context, familyID string) (bool, error) {
+	for _, s := range f.store {
+		if s.FamilyID == familyID && !s.Rotated && time.Now().Before(s.ExpiresAt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
 
+func TestLoginAuthCodeSuccess(t *testing.T) {
 	cfg := &config.Config{}
-	cfg.Keycloak.URL = tokenSrv.URL
-	cfg.Keycloak.Realm = "realm"
-	cfg.Keycloak.ClientID = "cid"
 	cfg.Keycloak.ClientSecret = "csecret"
+	idp := newTestIdP(t, cfg, oidctest.WithClient(testClientID, "csecret"))
 
 	uSvc := users.NewService(&fakeUserRepo{})
 	sSvc := sessions.NewService(&fakeSessionsRepo{})
 	h := NewAuthHandler(cfg, uSvc, sSvc)
 
-	// enable insecure token parsing
-	_ = os.Setenv("ALLOW_INSECURE_TOKEN", "true")
-	defer os.Unsetenv("ALLOW_INSECURE_TOKEN")
-
 	r := gin.New()
 	rg := r.Group("/")
 	h.Register(rg)
 
-	reqBody := `{"mode":"auth_code","code":"abc","redirect_uri":"http://localhost/cb"}`
+	reqBody, _ := authCodeLogin(t, idp, "alice")
 	req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(reqBody))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
@@ -97,8 +152,8 @@ func TestLoginAuthCodeSuccess(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 	var got map[string]interface{}
 	_ = json.NewDecoder(resp.Body).Decode(&got)
-	assert.NotEmpty(t, got["access_token"])
-	assert.NotEmpty(t, got["refresh_token"])
+	assert.NotEmpty(t, got["accessToken"])
+	assert.NotEmpty(t, got["refreshToken"])
 }
 
 // Ensure CORS headers are present for browser-origin requests (preflight + actual POST)
@@ -161,7 +216,7 @@ func TestRequestAuthCodeToken_Success(t *testing.T) {
 	}))
 	defer tokenSrv.Close()
 
-	tr, err := requestAuthCodeToken(context.Background(), tokenSrv.URL, "gogotex", "cid", "csecret", "code", "http://cb")
+	tr, err := requestAuthCodeToken(context.Background(), httpclient.New("test"), keycloakEndpoints(tokenSrv.URL, "gogotex").Token, "cid", "csecret", "code", "http://cb", "")
 	assert.NoError(t, err)
 	assert.Equal(t, "at", tr.AccessToken)
 	assert.Equal(t, "idtok", tr.IDToken)
@@ -176,7 +231,7 @@ func TestRequestAuthCodeToken_Error(t *testing.T) {
 	}))
 	defer tokenSrv.Close()
 
-	_, err := requestAuthCodeToken(context.Background(), tokenSrv.URL, "gogotex", "cid", "csecret", "bad", "http://cb")
+	_, err := requestAuthCodeToken(context.Background(), httpclient.New("test"), keycloakEndpoints(tokenSrv.URL, "gogotex").Token, "cid", "csecret", "bad", "http://cb", "")
 	if assert.Error(t, err) {
 		assert.Contains(t, err.Error(), "token endpoint returned 400")
 	}
@@ -198,7 +253,7 @@ func TestRequestAuthCodeToken_RetrySucceeds(t *testing.T) {
 	}))
 	defer tokenSrv.Close()
 
-	tr, err := requestAuthCodeToken(context.Background(), tokenSrv.URL, "gogotex", "cid", "csecret", "code", "http://cb")
+	tr, err := requestAuthCodeToken(context.Background(), httpclient.New("test"), keycloakEndpoints(tokenSrv.URL, "gogotex").Token, "cid", "csecret", "code", "http://cb", "")
 	assert.NoError(t, err)
 	assert.Equal(t, "ok", tr.AccessToken)
 }
@@ -218,7 +273,7 @@ func TestRequestAuthCodeToken_FallbackToBasic(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	tr, err := requestAuthCodeToken(context.Background(), srv.URL, "gogotex", "cid", "csecret", "code", "http://cb")
+	tr, err := requestAuthCodeToken(context.Background(), httpclient.New("test"), keycloakEndpoints(srv.URL, "gogotex").Token, "cid", "csecret", "code", "http://cb", "")
 	if assert.NoError(t, err) {
 		assert.Equal(t, "basic-ok", tr.AccessToken)
 	}
@@ -258,6 +313,84 @@ func TestRefresh_Success(t *testing.T) {
 	if got["access_token"] == nil {
 		t.Fatalf("expected access_token in response")
 	}
+	if got["refresh_token"] == nil || got["refresh_token"] == rt {
+		t.Fatalf("expected a rotated refresh_token in response, got %v", got["refresh_token"])
+	}
+}
+
+func TestRefresh_UsesConfiguredLifetimes(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "refresh-test-secret-32-bytes-xxxx"
+	cfg.JWT.AccessTokenTTL = 10 * time.Minute
+	cfg.JWT.SessionPolicies = []config.SessionPolicy{{Name: "cli", ClientID: "gogotex-cli", AccessTokenTTL: 2 * time.Minute}}
+	sSvc := sessions.NewService(&fakeSessionsRepo{})
+	h := NewAuthHandler(cfg, users.NewService(&fakeUserRepo{}), sSvc)
+	rg := gin.New()
+	rg.POST("/auth/refresh", h.Refresh)
+
+	refresh := func(rt string) map[string]interface{} {
+		req := httptest.NewRequest("POST", "/auth/refresh", strings.NewReader(fmt.Sprintf(`{"refresh_token":"%s"}`, rt)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		rg.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200 got %d", w.Code)
+		}
+		var got map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &got)
+		return got
+	}
+
+	web, _ := sSvc.OpenSession(context.Background(), "sub-web", 24*time.Hour, sessions.WithIdleTimeout(30*time.Minute))
+	got := refresh(web.RefreshToken)
+	if got["expires_in"] != float64(600) {
+		t.Fatalf("expected the configured access-token TTL, got %v", got["expires_in"])
+	}
+	if left, _ := got["refresh_expires_in"].(float64); left < 1790 || left > 1800 {
+		t.Fatalf("expected the idle window to start over, got %v", got["refresh_expires_in"])
+	}
+
+	cli, _ := sSvc.OpenSession(context.Background(), "sub-cli", 24*time.Hour, sessions.WithClientID("gogotex-cli"))
+	got = refresh(cli.RefreshToken)
+	if got["expires_in"] != float64(120) {
+		t.Fatalf("expected the client policy's access-token TTL, got %v", got["expires_in"])
+	}
+}
+
+func TestRefresh_ReplayedTokenRevokesFamily(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "refresh-test-secret-32-bytes-xxxx"
+
+	uSvc := users.NewService(&fakeUserRepo{})
+	repo := &fakeSessionsRepo{}
+	sSvc := sessions.NewService(repo)
+	h := NewAuthHandler(cfg, uSvc, sSvc)
+
+	rt, err := sSvc.CreateSession(context.Background(), "sub-replay", time.Hour)
+	assert.NoError(t, err)
+
+	rg := gin.New()
+	rg.POST("/auth/refresh", h.Refresh)
+	refresh := func(tok string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("POST", "/auth/refresh", strings.NewReader(fmt.Sprintf(`{"refresh_token":"%s"}`, tok)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		rg.ServeHTTP(w, req)
+		var got map[string]interface{}
+		_ = json.NewDecoder(w.Result().Body).Decode(&got)
+		return w.Code, got
+	}
+
+	code, got := refresh(rt)
+	assert.Equal(t, http.StatusOK, code)
+	next, _ := got["refresh_token"].(string)
+	assert.NotEmpty(t, next)
+
+	// replaying the rotated-out token is rejected and kills the successor too
+	code, _ = refresh(rt)
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = refresh(next)
+	assert.Equal(t, http.StatusUnauthorized, code)
 }
 
 func TestRefresh_InvalidRefresh(t *testing.T) {
@@ -290,27 +423,90 @@ func TestLogout_BlacklistsAccessAndDeletesRefresh(t *testing.T) {
 	defer m.Close()
 	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
 	sessions.SetBlacklistClient(client)
+	defer sessions.SetBlacklistClient(nil)
 
 	cfg := &config.Config{}
+	cfg.JWT.Secret = "logout-test-secret-32-bytes-xxxxxx"
 	uSvc := users.NewService(&fakeUserRepo{})
 	frepo := &fakeSessionsRepo{}
 	sSvc := sessions.NewService(frepo)
 	h := NewAuthHandler(cfg, uSvc, sSvc)
 
-	// create a refresh session to be deleted
-	rt, err := sSvc.CreateSession(context.Background(), "sub-1", time.Hour)
-	assert.NoError(t, err)
-
-	// craft an access token with exp in the future
-	exp := time.Now().Add(2 * time.Minute).Unix()
-	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"sub-1","exp":%d}`, exp)))
-	access := "hdr." + payload + ".sig"
-
 	rp := gin.New()
 	rg := rp.Group("/")
 	h.Register(rg)
+	logout := func(access string) {
+		// create a refresh session to be deleted
+		rt, err := sSvc.CreateSession(context.Background(), "sub-1", time.Hour)
+		assert.NoError(t, err)
+		body := fmt.Sprintf(`{"refresh_token":"%s"}`, rt)
+		req := httptest.NewRequest("POST", "/auth/logout", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+access)
+		w := httptest.NewRecorder()
+		rp.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// refresh session should be deleted
+		sess, err := sSvc.ValidateRefresh(context.Background(), rt)
+		assert.NoError(t, err)
+		assert.Nil(t, sess)
+	}
 
-	body := fmt.Sprintf(`{"refresh_token":"%s"}`, rt)
+	// a token we did not sign is never blacklisted
+	exp := time.Now().Add(2 * time.Minute).Unix()
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"sub-1","jti":"logout-jti","exp":%d}`, exp)))
+	logout("hdr." + payload + ".sig")
+	assert.False(t, m.Exists("blacklist:jti:logout-jti"))
+
+	// our own access token is blacklisted in redis by jti
+	access, err := tokens.GenerateAccessToken(cfg, &models.User{Sub: "sub-1"}, 2*time.Minute)
+	assert.NoError(t, err)
+	claims, _ := unverifiedClaims(access)
+	logout(access)
+	assert.True(t, m.Exists("blacklist:jti:"+claims["jti"].(string)))
+}
+
+func TestLogout_ReturnsKeycloakEndSessionURL(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Keycloak.PostLogoutRedirect = "http://localhost:3000/login"
+	idp := newTestIdP(t, cfg)
+	h := NewAuthHandler(cfg, users.NewService(&fakeUserRepo{}), sessions.NewService(&fakeSessionsRepo{}))
+	r := gin.New()
+	h.Register(r.Group("/"))
+
+	body, sid := authCodeLogin(t, idp, "alice")
+	req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var login map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+
+	req = httptest.NewRequest("POST", "/auth/logout", strings.NewReader(fmt.Sprintf(`{"refresh_token":"%s"}`, login["refreshToken"])))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var got map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+
+	u, err := url.Parse(got["endSessionUrl"])
+	require.NoError(t, err)
+	require.Equal(t, idp.Issuer()+"/protocol/openid-connect/logout", u.Scheme+"://"+u.Host+u.Path)
+	// the hint is the ID token of the provider session being ended
+	ver, err := oidc.NewVerifier(context.Background(), idp.Issuer(), testClientID)
+	require.NoError(t, err)
+	hint, err := ver.Verify(context.Background(), u.Query().Get("id_token_hint"))
+	require.NoError(t, err)
+	var hinted struct {
+		SID string `json:"sid"`
+	}
+	require.NoError(t, hint.Claims(&hinted))
+	require.Equal(t, sid, hinted.SID)
+	require.Equal(t, "cid", u.Query().Get("client_id"))
+	require.Equal(t, "http://localhost:3000/login", u.Query().Get("post_logout_redirect_uri"))
 }
 
 func TestParseExpFromJWT_VariousFormats(t *testing.T) {
@@ -336,22 +532,96 @@ func TestParseExpFromJWT_VariousFormats(t *testing.T) {
 	if _, err := parseExpFromJWT("not.a.jwt"); err == nil {
 		t.Fatalf("expected error for malformed token")
 	}
-}	req := httptest.NewRequest("POST", "/auth/logout", strings.NewReader(body))
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+access)
-	w := httptest.NewRecorder()
-	rp.ServeHTTP(w, req)
+}
 
-	resp := w.Result()
-	assert.Equal(t, http.StatusOK, resp.StatusCode)
+// signalingDevices is an in-memory sessions.DeviceRepository that reports every
+// remembered device, letting tests wait for the background device check
+type signalingDevices struct {
+	known      map[string]bool
+	remembered chan string
+}
 
-	// refresh session should be deleted
-	sess, err := sSvc.ValidateRefresh(context.Background(), rt)
-	assert.NoError(t, err)
-	assert.Nil(t, sess)
+func (f *signalingDevices) Remember(ctx context.Context, d *sessions.KnownDevice) (bool, error) {
+	isNew := !f.known[d.Sub+"/"+d.DeviceID]
+	f.known[d.Sub+"/"+d.DeviceID] = true
+	f.remembered <- d.DeviceID
+	return isNew, nil
+}
+
+func (f *signalingDevices) HasDevices(ctx context.Context, sub string) (bool, error) {
+	for k := range f.known {
+		if strings.HasPrefix(k, sub+"/") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type chanNotifier chan notify.Event
 
-	// access token should be blacklisted in redis
-	exists := m.Exists("blacklist:access:" + access)
-	assert.Equal(t, int64(1), exists)
+func (n chanNotifier) Notify(ctx context.Context, e notify.Event) error {
+	n <- e
+	return nil
 }
 
+func TestLogin_NotifiesSignInFromNewDevice(t *testing.T) {
+	cfg := &config.Config{}
+	idp := newTestIdP(t, cfg)
+	devices := &signalingDevices{known: map[string]bool{}, remembered: make(chan string, 1)}
+	notified := make(chanNotifier, 1)
+	sRepo := &fakeSessionsRepo{}
+	h := NewAuthHandler(cfg, users.NewService(&fakeUserRepo{}), sessions.NewService(sRepo),
+		WithDeviceTracker(sessions.NewDeviceTracker(devices, notified)))
+	r := gin.New()
+	h.Register(r.Group("/"))
+
+	login := func(deviceCookie string) *http.Response {
+		body, _ := authCodeLogin(t, idp, "alice")
+		req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+		if deviceCookie != "" {
+			req.AddCookie(&http.Cookie{Name: DeviceCookieName, Value: deviceCookie})
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Result()
+	}
+	deviceCookie := func(resp *http.Response) string {
+		for _, ck := range resp.Cookies() {
+			if ck.Name == DeviceCookieName {
+				require.True(t, ck.HttpOnly)
+				return ck.Value
+			}
+		}
+		return ""
+	}
+
+	// first sign-in: the browser gets a device cookie, recorded on the session
+	laptop := deviceCookie(login(""))
+	require.NotEmpty(t, laptop)
+	require.Equal(t, laptop, <-devices.remembered)
+	for _, s := range sRepo.store {
+		require.Equal(t, laptop, s.DeviceID)
+		require.Equal(t, "Firefox on Linux", s.Device)
+	}
+
+	// the same browser again keeps its cookie and is not reported
+	require.Empty(t, deviceCookie(login(laptop)))
+	require.Equal(t, laptop, <-devices.remembered)
+
+	// another browser is
+	phone := deviceCookie(login(""))
+	require.NotEqual(t, laptop, phone)
+	require.Equal(t, phone, <-devices.remembered)
+	select {
+	case e := <-notified:
+		require.Equal(t, notify.KindNewSignIn, e.Kind)
+		require.Equal(t, "a@b.c", e.Email)
+		require.Equal(t, "Firefox on Linux", e.Device)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no new sign-in notification")
+	}
+	require.Empty(t, notified)
+}
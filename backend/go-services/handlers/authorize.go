@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/authflow"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+)
+
+// authFlowTTL bounds how long a user may take to authenticate at Keycloak
+const authFlowTTL = 10 * time.Minute
+
+// Authorize starts the authorization-code flow: it stores state, nonce and a PKCE
+// code verifier server-side, binds the state to the browser with FlowCookieName and
+// redirects the browser to the identity provider.
+// Optional query parameters: `provider` (defaults to the primary provider) and
+// `return_to` (a relative path the browser is sent back to after login).
+func (h *AuthHandler) Authorize(c *gin.Context) {
+	if h.flows == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "authorization flow not configured"})
+		return
+	}
+	if len(h.cfg.IdentityProviders()) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Keycloak not configured"})
+		return
+	}
+	p, ok := h.cfg.Provider(c.Query("provider"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown provider"})
+		return
+	}
+	if p.RedirectURI == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "redirect URI not configured"})
+		return
+	}
+	ep, err := h.providerEndpoints(p)
+	if err != nil {
+		logger.Errorf("identity provider %s unavailable: %v", p.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
+		return
+	}
+	returnTo := c.Query("return_to")
+	if returnTo != "" && !isRelativePath(returnTo) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "return_to must be a relative path"})
+		return
+	}
+	fr, err := authflow.NewRequest(p.RedirectURI, returnTo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create authorization request"})
+		return
+	}
+	fr.Provider = p.Name
+	if err := h.flows.Save(c.Request.Context(), fr, authFlowTTL); err != nil {
+		logger.Errorf("failed to store authorization request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store authorization request"})
+		return
+	}
+	h.setFlowCookie(c, fr.State, authFlowTTL)
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", fr.RedirectURI)
+	q.Set("scope", "openid profile email")
+	q.Set("state", fr.State)
+	q.Set("nonce", fr.Nonce)
+	q.Set("code_challenge", fr.CodeChallenge())
+	q.Set("code_challenge_method", "S256")
+	c.Redirect(http.StatusFound, ep.Authorization+"?"+q.Encode())
+}
+
+// Callback completes the authorization-code flow started by Authorize. It checks the
+// state against the flow cookie (a callback URL carrying another browser's code is
+// refused) and against the stored flow, exchanges the code together with the PKCE verifier and requires the ID
+// token nonce to match before issuing our own tokens.
+// The browser then goes to PostLoginRedirect with return_to in the fragment, or
+// straight to return_to when that is a page of this service or no frontend is
+// configured; without either the tokens are returned as JSON.
+func (h *AuthHandler) Callback(c *gin.Context) {
+	if h.flows == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "authorization flow not configured"})
+		return
+	}
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication failed", "details": e})
+		return
+	}
+	state := c.Query("state")
+	code := c.Query("code")
+	if state == "" || code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "state and code required"})
+		return
+	}
+	if !h.flowCookieMatches(c, state) {
+		logger.Warnf("auth callback: state not bound to this browser")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired state"})
+		return
+	}
+	fr, err := h.flows.Take(c.Request.Context(), state)
+	if err != nil {
+		logger.Errorf("failed to load authorization request: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load authorization request"})
+		return
+	}
+	if fr == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired state"})
+		return
+	}
+
+	// flows stored before providers existed carry no provider name: the primary one
+	p, ok := h.cfg.Provider(fr.Provider)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown provider"})
+		return
+	}
+	ep, err := h.providerEndpoints(p)
+	if err != nil {
+		logger.Errorf("identity provider %s unavailable: %v", p.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"})
+		return
+	}
+	tokenResp, err := requestAuthCodeToken(c.Request.Context(), h.httpClient, ep.Token, p.ClientID, p.ClientSecret, code, fr.RedirectURI, fr.CodeVerifier)
+	if err != nil {
+		logger.Errorf("auth-code token exchange error (redirect_uri=%q): %v", fr.RedirectURI, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication failed"})
+		return
+	}
+	claims, err := h.verifyIDToken(c.Request.Context(), p, tokenResp.IDToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid id token", "details": err.Error()})
+		return
+	}
+	if nonce, _ := claims["nonce"].(string); nonce == "" || nonce != fr.Nonce {
+		logger.Warnf("auth callback: id token nonce mismatch")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid id token", "details": "nonce mismatch"})
+		return
+	}
+	res, ok := h.completeLogin(c, p.ClientID, claims, tokenResp.IDToken)
+	if !ok {
+		return
+	}
+
+	// pages of this service (the device page) and deployments without a frontend get
+	// the browser back at return_to itself; the frontend gets it in the fragment
+	target, returnTo := h.cfg.Keycloak.PostLoginRedirect, fr.ReturnTo
+	if !isRelativePath(returnTo) {
+		returnTo = ""
+	}
+	if returnTo != "" && (target == "" || isServicePath(returnTo)) {
+		target, returnTo = returnTo, ""
+	}
+	if target == "" {
+		c.JSON(http.StatusOK, h.loginResponse(res))
+		return
+	}
+	// deliver tokens in the fragment so they never reach server logs or Referer headers
+	frag := url.Values{}
+	frag.Set("access_token", res.AccessToken)
+	if !h.cfg.Cookies.Enabled {
+		frag.Set("refresh_token", res.RefreshToken)
+	}
+	frag.Set("expires_in", strconv.Itoa(res.ExpiresIn))
+	if returnTo != "" {
+		frag.Set("return_to", returnTo)
+	}
+	c.Redirect(http.StatusFound, target+"#"+frag.Encode())
+}
+
+// isServicePath reports whether p is served by this service rather than the frontend
+func isServicePath(p string) bool {
+	return strings.HasPrefix(p, "/auth/")
+}
+
+// isRelativePath accepts same-origin paths like "/projects/1" but rejects absolute
+// and scheme-relative URLs ("//evil.example") to avoid open redirects.
+func isRelativePath(p string) bool {
+	return strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//") && !strings.Contains(p, "\\")
+}
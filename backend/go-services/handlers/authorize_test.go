@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/authflow"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/oidc/oidctest"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/users"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+// newAuthFlowTestRouter wires an AuthHandler against a mock Keycloak, which
+// enforces PKCE and puts the nonce of the authorization request in the ID token
+func newAuthFlowTestRouter(t *testing.T) (*gin.Engine, *config.Config, *oidctest.Server) {
+	t.Helper()
+	m, err := mr.Run()
+	require.NoError(t, err)
+	t.Cleanup(m.Close)
+	store := authflow.NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), "")
+
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "authflow-test-secret-32-bytes-xxxx"
+	cfg.Keycloak.RedirectURI = "http://auth.local/auth/callback"
+	idp := newTestIdP(t, cfg)
+
+	h := NewAuthHandler(cfg, users.NewService(&fakeUserRepo{}), sessions.NewService(&fakeSessionsRepo{}), WithAuthFlowStore(store))
+	r := gin.New()
+	h.Register(r.Group("/"))
+	return r, cfg, idp
+}
+
+// authFlow is a login started by startFlow
+type authFlow struct {
+	q      url.Values   // the authorization request
+	code   string       // the code the provider sent back to the callback
+	cookie *http.Cookie // the flow cookie of the browser
+}
+
+// callback delivers code to the callback as the browser of the flow does
+func (f authFlow) callback(r *gin.Engine, code string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/auth/callback?code="+url.QueryEscape(code)+"&state="+url.QueryEscape(f.q.Get("state")), nil)
+	req.AddCookie(f.cookie)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// startFlow starts a login returning to /projects and signs alice in at the provider
+func startFlow(t *testing.T, r *gin.Engine) authFlow {
+	t.Helper()
+	return startFlowTo(t, r, "/projects")
+}
+
+// startFlowTo is startFlow with another return_to; "" omits it
+func startFlowTo(t *testing.T, r *gin.Engine, returnTo string) authFlow {
+	t.Helper()
+	target := "/auth/authorize"
+	if returnTo != "" {
+		target += "?return_to=" + url.QueryEscape(returnTo)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	ck := cookiesByName(w)[FlowCookieName]
+	require.NotNil(t, ck)
+	require.True(t, ck.HttpOnly)
+	require.Equal(t, http.SameSiteLaxMode, ck.SameSite)
+	loc, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(loc.Path, "/protocol/openid-connect/auth"))
+	q := loc.Query()
+	require.Equal(t, "S256", q.Get("code_challenge_method"))
+	require.NotEmpty(t, q.Get("state"))
+	require.NotEmpty(t, q.Get("nonce"))
+	require.Equal(t, "http://auth.local/auth/callback", q.Get("redirect_uri"))
+
+	hinted := loc.Query()
+	hinted.Set("login_hint", "alice")
+	loc.RawQuery = hinted.Encode()
+	noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noFollow.Get(loc.String())
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	cb, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, q.Get("state"), cb.Query().Get("state"))
+	return authFlow{q: q, code: cb.Query().Get("code"), cookie: ck}
+}
+
+func TestAuthorizeCallback_Success(t *testing.T) {
+	r, _, _ := newAuthFlowTestRouter(t)
+	f := startFlowTo(t, r, "")
+
+	w := f.callback(r, f.code)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.NotEmpty(t, got["accessToken"])
+	require.NotEmpty(t, got["refreshToken"])
+
+	// state is single-use
+	require.Equal(t, http.StatusBadRequest, f.callback(r, f.code).Code)
+}
+
+func TestAuthorizeCallback_RedirectsWithFragment(t *testing.T) {
+	r, cfg, _ := newAuthFlowTestRouter(t)
+	cfg.Keycloak.PostLoginRedirect = "http://app.local/auth/done"
+	f := startFlow(t, r)
+
+	w := f.callback(r, f.code)
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	loc, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	frag, err := url.ParseQuery(loc.Fragment)
+	require.NoError(t, err)
+	require.NotEmpty(t, frag.Get("access_token"))
+	require.Equal(t, "/projects", frag.Get("return_to"))
+}
+
+func TestAuthorizeCallback_RedirectsToReturnTo(t *testing.T) {
+	for name, tc := range map[string]struct {
+		postLogin, returnTo string
+	}{
+		"no frontend":  {"", "/projects"},
+		"service page": {"http://app.local/auth/done", "/auth/device?user_code=BCDFGHJK"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r, cfg, _ := newAuthFlowTestRouter(t)
+			cfg.Keycloak.PostLoginRedirect = tc.postLogin
+			f := startFlowTo(t, r, tc.returnTo)
+
+			w := f.callback(r, f.code)
+			require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+			loc, err := url.Parse(w.Header().Get("Location"))
+			require.NoError(t, err)
+			require.Empty(t, loc.Host)
+			require.Equal(t, tc.returnTo, (&url.URL{Path: loc.Path, RawQuery: loc.RawQuery}).String())
+			frag, err := url.ParseQuery(loc.Fragment)
+			require.NoError(t, err)
+			require.NotEmpty(t, frag.Get("access_token"))
+			require.Empty(t, frag.Get("return_to"))
+		})
+	}
+}
+
+func TestAuthorizeCallback_NonceMismatch(t *testing.T) {
+	r, _, idp := newAuthFlowTestRouter(t)
+	f := startFlow(t, r)
+
+	// a code injected from another authorization request carries its nonce
+	injected := url.Values{}
+	for k, v := range f.q {
+		injected[k] = v
+	}
+	injected.Set("nonce", "attacker-nonce")
+	code, _, err := idp.Code("alice", injected)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, f.callback(r, code).Code)
+}
+
+func TestAuthorizeCallback_RequiresFlowCookie(t *testing.T) {
+	r, _, _ := newAuthFlowTestRouter(t)
+	// an attacker starts a flow and sends the victim the callback URL
+	f := startFlow(t, r)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/callback?code="+f.code+"&state="+url.QueryEscape(f.q.Get("state")), nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	// nor does the victim's own flow cookie fit the attacker's state
+	victim := startFlow(t, r)
+	f.cookie = victim.cookie
+	require.Equal(t, http.StatusBadRequest, f.callback(r, f.code).Code)
+}
+
+func TestCallback_UnknownState(t *testing.T) {
+	r, _, _ := newAuthFlowTestRouter(t)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/callback?code=x&state=forged", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAuthorize_RejectsAbsoluteReturnTo(t *testing.T) {
+	r, _, _ := newAuthFlowTestRouter(t)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/authorize?return_to="+url.QueryEscape("//evil.example"), nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestLogin_RejectsAuthCodeWithFlowStore(t *testing.T) {
+	r, _, _ := newAuthFlowTestRouter(t)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(`{"mode":"auth_code","code":"c","redirect_uri":"http://evil.example/cb"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.NotContains(t, w.Body.String(), "evil.example")
+}
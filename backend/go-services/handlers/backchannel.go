@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/oidc"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+)
+
+// WithBackchannelLogout enables POST /auth/backchannel-logout, the OpenID Connect
+// back-channel logout receiver called by Keycloak when a user's session ends there.
+// ver must verify tokens issued by Keycloak for our client (see oidc.NewVerifier).
+func WithBackchannelLogout(ver middleware.Verifier) Option {
+	return func(h *AuthHandler) { h.logoutVerifier = ver }
+}
+
+// revokedProviderSessionTTL is how long an ended provider session is remembered; it
+// must outlive the access tokens the provider issues
+const revokedProviderSessionTTL = 24 * time.Hour
+
+// BackchannelLogout revokes the refresh sessions named by a Keycloak logout token.
+// Form parameter: logout_token. Tokens with a sid end the sessions created from that
+// Keycloak session of the token's issuer; tokens with only a sub end every session of
+// the user (the sub is the provider's subject, mapped to our user by issuer). Each
+// token is accepted once (by jti, until it expires). The ended provider session is
+// recorded (sub-only tokens move the user's token watermark instead), so
+// introspection refuses the provider's access tokens for it too. Other access tokens
+// stay valid until they expire, except for introspection, which checks the session.
+func (h *AuthHandler) BackchannelLogout(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	if h.logoutVerifier == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "back-channel logout not configured"})
+		return
+	}
+	raw := c.PostForm("logout_token")
+	if raw == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "logout_token required")
+		return
+	}
+	lt, err := oidc.VerifyLogoutToken(c.Request.Context(), h.logoutVerifier, raw)
+	if err != nil {
+		logger.Warnf("back-channel logout: rejected logout token: %v", err)
+		oauthError(c, http.StatusBadRequest, "invalid_request", "invalid logout token")
+		return
+	}
+	ctx := c.Request.Context()
+	// a logout token is accepted once: replaying it must not end later sessions
+	fresh, err := sessions.RecordLogoutToken(ctx, lt.Issuer, lt.JTI, time.Until(lt.Expiry))
+	if err != nil {
+		logger.Errorf("back-channel logout: replay check failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "replay check failed"})
+		return
+	}
+	if !fresh {
+		logger.Warnf("back-channel logout: replayed logout token (iss=%s jti=%s)", lt.Issuer, lt.JTI)
+		oauthError(c, http.StatusBadRequest, "invalid_request", "logout token already used")
+		return
+	}
+	sub := ""
+	if lt.Sub != "" {
+		u, err := h.usersSvc.GetByIdentity(ctx, lt.Issuer, lt.Sub)
+		if err != nil {
+			logger.Errorf("back-channel logout: user lookup failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user lookup failed"})
+			return
+		}
+		if u == nil && lt.SID == "" {
+			// never logged in here: nothing to revoke
+			c.Status(http.StatusOK)
+			return
+		}
+		if u != nil {
+			sub = u.Sub
+		}
+	}
+	if err := h.sessionsSvc.RevokeProviderSession(ctx, lt.Issuer, sub, lt.SID); err != nil {
+		logger.Errorf("back-channel logout: failed to revoke sessions (sub=%s sid=%s): %v", sub, lt.SID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+		return
+	}
+	if err := h.endProviderTokens(ctx, lt.Issuer, sub, lt.SID); err != nil {
+		logger.Errorf("back-channel logout: failed to revoke provider tokens (sub=%s sid=%s): %v", sub, lt.SID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+		return
+	}
+	logger.Infof("back-channel logout: iss=%s sub=%s sid=%s", lt.Issuer, sub, lt.SID)
+	c.Status(http.StatusOK)
+}
+
+// endProviderTokens makes introspection refuse the access tokens the provider issued
+// for session sid, or for any session of sub when the logout token names no sid
+func (h *AuthHandler) endProviderTokens(ctx context.Context, iss, sub, sid string) error {
+	if sid != "" {
+		return sessions.RevokeProviderSID(ctx, iss, sid, revokedProviderSessionTTL)
+	}
+	if sub == "" {
+		return nil
+	}
+	now := time.Now().UTC()
+	if err := h.usersSvc.SetTokensValidAfter(ctx, sub, now); err != nil {
+		return err
+	}
+	return sessions.CacheTokensValidAfter(ctx, sub, now)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/clients"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/oidc"
+	"github.com/gogotex/gogotex/backend/go-services/internal/oidc/oidctest"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/internal/users"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackchannelLogout_RevokesSessionsOfKeycloakSession(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "backchannel-test-secret-32-bytes-x"
+	idp := newTestIdP(t, cfg)
+	ver, err := oidc.NewVerifier(context.Background(), idp.Issuer(), testClientID)
+	require.NoError(t, err)
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	sessions.SetBlacklistClient(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	defer sessions.SetBlacklistClient(nil)
+	sSvc := sessions.NewService(&fakeSessionsRepo{store: map[string]*sessions.Session{}})
+	h := NewAuthHandler(cfg, users.NewService(&fakeUserRepo{}), sSvc, WithBackchannelLogout(ver))
+	r := gin.New()
+	h.Register(r.Group("/"))
+
+	login := func() (refreshToken, sid string) {
+		body, sid := authCodeLogin(t, idp, "alice")
+		req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var got map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+		return got["refreshToken"].(string), sid
+	}
+	laptop, laptopSID := login()
+	phone, _ := login()
+
+	logout := func(token string) *httptest.ResponseRecorder {
+		return doForm(r, "/auth/backchannel-logout", url.Values{"logout_token": {token}})
+	}
+
+	// ID tokens (no logout event) are refused
+	idToken, err := idp.IDToken("alice", testClientID, map[string]interface{}{"sid": laptopSID})
+	require.NoError(t, err)
+	w := logout(idToken)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	// so are logout tokens of another issuer
+	other := oidctest.NewServer(t)
+	forged, err := other.LogoutToken("alice-sub", laptopSID, testClientID)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, logout(forged).Code)
+
+	lt, err := idp.LogoutToken("alice-sub", laptopSID, testClientID)
+	require.NoError(t, err)
+	w = logout(lt)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	got, err := sSvc.ValidateRefresh(context.Background(), laptop)
+	require.NoError(t, err)
+	require.Nil(t, got)
+	got, err = sSvc.ValidateRefresh(context.Background(), phone)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+
+	// each logout token is accepted once
+	w = logout(lt)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "already used")
+
+	// a logout token with only sub ends every session of the user
+	lt, err = idp.LogoutToken("alice-sub", "", testClientID)
+	require.NoError(t, err)
+	w = logout(lt)
+	require.Equal(t, http.StatusOK, w.Code)
+	got, err = sSvc.ValidateRefresh(context.Background(), phone)
+	require.NoError(t, err)
+	require.Nil(t, got)
+}
+
+func doForm(r *gin.Engine, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestBackchannelLogout_EndsProviderTokensAtIntrospection(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "backchannel-test-secret-32-bytes-x"
+	cfg.JWT.Issuer = "gogotex-auth"
+	idp := newTestIdP(t, cfg)
+	ver, err := oidc.NewVerifier(context.Background(), idp.Issuer(), testClientID)
+	require.NoError(t, err)
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	sessions.SetBlacklistClient(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	defer sessions.SetBlacklistClient(nil)
+	reg := clients.NewRegistry(clients.Client{ID: "yjs-server", Secret: "yjs-secret"})
+	other := oidctest.NewServer(t, oidctest.WithUser(oidctest.User{Username: "alice", Sub: "alice-sub"}))
+	otherVer, err := oidc.NewVerifier(context.Background(), other.Issuer(), testClientID)
+	require.NoError(t, err)
+	introspectVer := middleware.NewCompositeVerifier(tokens.NewVerifier(cfg), ver, otherVer)
+	h := NewAuthHandler(cfg, users.NewService(&fakeUserRepo{}), sessions.NewService(&fakeSessionsRepo{store: map[string]*sessions.Session{}}),
+		WithBackchannelLogout(ver), WithIntrospection(reg, introspectVer))
+	r := gin.New()
+	h.Register(r.Group("/"))
+
+	active := func(token string) interface{} {
+		w := doForm(r, "/auth/introspect", url.Values{"token": {token}, "client_id": {"yjs-server"}, "client_secret": {"yjs-secret"}})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body["active"]
+	}
+	laptop, err := idp.IDToken("alice", testClientID, map[string]interface{}{"sid": "kc-laptop"})
+	require.NoError(t, err)
+	phone, err := idp.IDToken("alice", testClientID, map[string]interface{}{"sid": "kc-phone"})
+	require.NoError(t, err)
+	require.Equal(t, true, active(laptop))
+
+	lt, err := idp.LogoutToken("alice-sub", "kc-laptop", testClientID)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, doForm(r, "/auth/backchannel-logout", url.Values{"logout_token": {lt}}).Code)
+	require.Equal(t, false, active(laptop))
+	require.Equal(t, true, active(phone))
+
+	// the same sid at another issuer is a different session
+	foreign, err := other.IDToken("alice", testClientID, map[string]interface{}{"sid": "kc-laptop"})
+	require.NoError(t, err)
+	require.Equal(t, true, active(foreign))
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/clients"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+)
+
+// defaultClientTokenTTL applies when Clients.TokenTTL is not configured
+const defaultClientTokenTTL = 5 * time.Minute
+
+// WithClientCredentials enables the client_credentials grant on POST /auth/token
+// for the confidential clients in reg (compile workers, the yjs server, ...).
+func WithClientCredentials(reg *clients.Registry) Option {
+	return func(h *AuthHandler) { h.tokenClients = reg }
+}
+
+// Token is the OAuth 2.0 token endpoint for grants that involve no user. Form
+// parameters: grant_type (client_credentials), scope (optional, space separated;
+// defaults to every scope the client may request), and client credentials via HTTP
+// Basic or client_id/client_secret.
+func (h *AuthHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	if c.PostForm("grant_type") != "client_credentials" || h.tokenClients == nil {
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+	cl := authenticateClient(c, h.tokenClients)
+	if cl == nil {
+		return
+	}
+	scopes := strings.Fields(c.PostForm("scope"))
+	if len(scopes) == 0 {
+		scopes = cl.Scopes
+	}
+	for _, s := range scopes {
+		if !cl.AllowsScope(s) {
+			oauthError(c, http.StatusBadRequest, "invalid_scope", s)
+			return
+		}
+	}
+	ttl := h.cfg.Clients.TokenTTL
+	if ttl <= 0 {
+		ttl = defaultClientTokenTTL
+	}
+	access, err := tokens.GenerateClientToken(h.cfg, cl.ID, scopes, ttl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create access token"})
+		return
+	}
+	logger.Infof("client token issued: client=%s scope=%q", cl.ID, strings.Join(scopes, " "))
+	c.JSON(http.StatusOK, gin.H{"access_token": access, "token_type": "Bearer", "expires_in": int(ttl.Seconds()), "scope": strings.Join(scopes, " ")})
+}
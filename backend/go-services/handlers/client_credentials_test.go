@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/clients"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/internal/users"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToken_ClientCredentials(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "client-credentials-secret-32-bytes"
+	cfg.JWT.Issuer = "gogotex-auth"
+	reg := clients.NewRegistry(clients.Client{ID: "compile-worker", Secret: "cw-secret", Scopes: []string{"projects:read", "compile"}})
+	h := NewAuthHandler(cfg, users.NewService(&fakeUserRepo{}), sessions.NewService(&fakeSessionsRepo{}), WithClientCredentials(reg))
+	r := gin.New()
+	h.Register(r.Group("/"))
+
+	token := func(form url.Values) (int, map[string]interface{}) {
+		w := doForm(r, "/auth/token", form)
+		require.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		var body map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+	creds := url.Values{"grant_type": {"client_credentials"}, "client_id": {"compile-worker"}, "client_secret": {"cw-secret"}}
+
+	code, body := token(url.Values{"grant_type": {"client_credentials"}, "client_id": {"compile-worker"}, "client_secret": {"wrong"}})
+	require.Equal(t, http.StatusUnauthorized, code)
+	require.Equal(t, "invalid_client", body["error"])
+
+	code, body = token(url.Values{"grant_type": {"password"}, "client_id": {"compile-worker"}, "client_secret": {"cw-secret"}})
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, "unsupported_grant_type", body["error"])
+
+	withScope := url.Values{"scope": {"projects:write"}}
+	for k, v := range creds {
+		withScope[k] = v
+	}
+	code, body = token(withScope)
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, "invalid_scope", body["error"])
+
+	// no scope requested: every scope of the client is granted
+	code, body = token(creds)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "projects:read compile", body["scope"])
+	require.Nil(t, body["refresh_token"])
+
+	tok, err := tokens.NewVerifier(cfg).Verify(context.Background(), body["access_token"].(string))
+	require.NoError(t, err)
+	var claims map[string]interface{}
+	require.NoError(t, tok.Claims(&claims))
+	require.Equal(t, "compile-worker", claims["client_id"])
+	require.NotContains(t, claims, "sub")
+
+	// the token is a service principal
+	p := middleware.PrincipalFromClaims(claims)
+	require.True(t, p.IsService())
+	require.True(t, p.HasScope("compile"))
+
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+body["access_token"].(string))
+	me := gin.New()
+	me.GET("/me", middleware.AuthMiddleware(tokens.NewVerifier(cfg)), middleware.RequireUser(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	w := httptest.NewRecorder()
+	me.ServeHTTP(w, req)
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+)
+
+// RefreshCookieName holds the refresh token in cookie mode. It is HttpOnly and
+// scoped to /auth so it is only sent to the refresh/logout endpoints.
+const RefreshCookieName = "gogotex_refresh"
+
+// DeviceCookieName identifies a browser across sign-ins so that logins from new
+// devices can be reported (see sessions.DeviceTracker). It is not a credential.
+const DeviceCookieName = "gogotex_device"
+
+// FlowCookieName binds an authorization-code flow to the browser that started it:
+// Authorize stores the flow's state in it and Callback requires the state it
+// receives to match (login CSRF protection).
+const FlowCookieName = "gogotex_auth_flow"
+
+// deviceCookieMaxAge is the longest cookie lifetime browsers accept (400 days)
+const deviceCookieMaxAge = 400 * 24 * 60 * 60
+
+func (h *AuthHandler) sameSite() http.SameSite {
+	switch strings.ToLower(h.cfg.Cookies.SameSite) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
+
+// setSessionCookies stores the refresh token in an HttpOnly cookie and issues a
+// fresh double-submit CSRF token readable by the SPA.
+func (h *AuthHandler) setSessionCookies(c *gin.Context, refresh string, ttl time.Duration) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	maxAge := int(ttl.Seconds())
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     RefreshCookieName,
+		Value:    refresh,
+		Path:     "/auth",
+		Domain:   h.cfg.Cookies.Domain,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.cfg.Cookies.Secure,
+		SameSite: h.sameSite(),
+	})
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     middleware.CSRFCookieName,
+		Value:    base64.RawURLEncoding.EncodeToString(b),
+		Path:     "/",
+		Domain:   h.cfg.Cookies.Domain,
+		MaxAge:   maxAge,
+		Secure:   h.cfg.Cookies.Secure,
+		SameSite: h.sameSite(),
+	})
+	return nil
+}
+
+func (h *AuthHandler) clearSessionCookies(c *gin.Context) {
+	for _, ck := range []struct{ name, path string }{{RefreshCookieName, "/auth"}, {middleware.CSRFCookieName, "/"}} {
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     ck.name,
+			Path:     ck.path,
+			Domain:   h.cfg.Cookies.Domain,
+			MaxAge:   -1,
+			HttpOnly: ck.name == RefreshCookieName,
+			Secure:   h.cfg.Cookies.Secure,
+			SameSite: h.sameSite(),
+		})
+	}
+}
+
+// deviceID returns the device cookie of the request, issuing a new one to browsers
+// that have none. The cookie is at most SameSite=Lax: it must accompany the
+// redirect back from the identity provider to /auth/callback.
+func (h *AuthHandler) deviceID(c *gin.Context) string {
+	if v, err := c.Cookie(DeviceCookieName); err == nil {
+		if b, err := base64.RawURLEncoding.DecodeString(v); err == nil && len(b) == 16 {
+			return v
+		}
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     DeviceCookieName,
+		Value:    id,
+		Path:     "/auth",
+		Domain:   h.cfg.Cookies.Domain,
+		MaxAge:   deviceCookieMaxAge,
+		HttpOnly: true,
+		Secure:   h.cfg.Cookies.Secure,
+		SameSite: h.laxSameSite(),
+	})
+	return id
+}
+
+// laxSameSite is the configured SameSite mode relaxed to Lax, for cookies that must
+// accompany the top-level redirect back from the identity provider
+func (h *AuthHandler) laxSameSite() http.SameSite {
+	if s := h.sameSite(); s != http.SameSiteStrictMode {
+		return s
+	}
+	return http.SameSiteLaxMode
+}
+
+// setFlowCookie stores the state of a flow started by this browser
+func (h *AuthHandler) setFlowCookie(c *gin.Context, state string, ttl time.Duration) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     FlowCookieName,
+		Value:    state,
+		Path:     "/auth",
+		Domain:   h.cfg.Cookies.Domain,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   h.cfg.Cookies.Secure,
+		SameSite: h.laxSameSite(),
+	})
+}
+
+// flowCookieMatches reports whether the browser started the flow with state, and
+// clears the cookie: a flow completes at most once
+func (h *AuthHandler) flowCookieMatches(c *gin.Context, state string) bool {
+	v, err := c.Cookie(FlowCookieName)
+	if err != nil || v == "" {
+		return false
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     FlowCookieName,
+		Path:     "/auth",
+		Domain:   h.cfg.Cookies.Domain,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.cfg.Cookies.Secure,
+		SameSite: h.laxSameSite(),
+	})
+	return subtle.ConstantTimeCompare([]byte(v), []byte(state)) == 1
+}
+
+// refreshTokenFromRequest reads the refresh token from the JSON body
+// ({"refresh_token": ...}) or, when absent, from the refresh cookie. Writes a 400
+// response and returns ok=false when neither is present.
+func refreshTokenFromRequest(c *gin.Context) (string, bool) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	if req.RefreshToken != "" {
+		return req.RefreshToken, true
+	}
+	if v, err := c.Cookie(RefreshCookieName); err == nil && v != "" {
+		return v, true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token required"})
+	return "", false
+}
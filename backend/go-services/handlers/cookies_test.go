@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/oidc/oidctest"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/users"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func cookieModeRouter(t *testing.T) (*gin.Engine, *oidctest.Server) {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "cookie-test-secret-32-bytes-xxxxxx"
+	cfg.Cookies = config.CookieConfig{Enabled: true, Secure: true, SameSite: "strict"}
+	idp := newTestIdP(t, cfg)
+
+	h := NewAuthHandler(cfg, users.NewService(&fakeUserRepo{}), sessions.NewService(&fakeSessionsRepo{}))
+	r := gin.New()
+	h.Register(r.Group("/"))
+	return r, idp
+}
+
+func cookiesByName(w *httptest.ResponseRecorder) map[string]*http.Cookie {
+	out := map[string]*http.Cookie{}
+	for _, c := range w.Result().Cookies() {
+		out[c.Name] = c
+	}
+	return out
+}
+
+func TestCookieMode_LoginSetsCookiesAndOmitsRefreshToken(t *testing.T) {
+	r, idp := cookieModeRouter(t)
+	body, _ := authCodeLogin(t, idp, "alice")
+	req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.NotEmpty(t, got["accessToken"])
+	require.NotContains(t, got, "refreshToken")
+
+	ck := cookiesByName(w)
+	rc := ck[RefreshCookieName]
+	require.NotNil(t, rc)
+	require.True(t, rc.HttpOnly)
+	require.True(t, rc.Secure)
+	require.Equal(t, "/auth", rc.Path)
+	require.Equal(t, http.SameSiteStrictMode, rc.SameSite)
+	cc := ck[middleware.CSRFCookieName]
+	require.NotNil(t, cc)
+	require.False(t, cc.HttpOnly)
+	require.NotEmpty(t, cc.Value)
+}
+
+func TestCookieMode_RefreshAndLogoutRequireCSRF(t *testing.T) {
+	r, idp := cookieModeRouter(t)
+	body, _ := authCodeLogin(t, idp, "alice")
+	login := httptest.NewRequest("POST", "/auth/login", strings.NewReader(body))
+	login.Header.Set("Content-Type", "application/json")
+	lw := httptest.NewRecorder()
+	r.ServeHTTP(lw, login)
+	require.Equal(t, http.StatusOK, lw.Code)
+	ck := cookiesByName(lw)
+
+	// cookie without CSRF header -> rejected
+	req := httptest.NewRequest("POST", "/auth/refresh", nil)
+	req.AddCookie(ck[RefreshCookieName])
+	req.AddCookie(ck[middleware.CSRFCookieName])
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	// cookie with matching header -> rotated cookie, no refresh token in body
+	req = httptest.NewRequest("POST", "/auth/refresh", nil)
+	req.AddCookie(ck[RefreshCookieName])
+	req.AddCookie(ck[middleware.CSRFCookieName])
+	req.Header.Set(middleware.CSRFHeaderName, ck[middleware.CSRFCookieName].Value)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NotContains(t, w.Body.String(), "refresh_token")
+	rotated := cookiesByName(w)
+	require.NotEqual(t, ck[RefreshCookieName].Value, rotated[RefreshCookieName].Value)
+
+	// logout through the cookie clears both cookies
+	req = httptest.NewRequest("POST", "/auth/logout", nil)
+	req.AddCookie(rotated[RefreshCookieName])
+	req.AddCookie(rotated[middleware.CSRFCookieName])
+	req.Header.Set(middleware.CSRFHeaderName, rotated[middleware.CSRFCookieName].Value)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	cleared := cookiesByName(w)
+	require.Equal(t, -1, cleared[RefreshCookieName].MaxAge)
+}
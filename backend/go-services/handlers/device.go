@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/device"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+)
+
+// WithDeviceStore enables the OAuth 2.0 device authorization grant (RFC 8628) used by
+// the CLI and editor plugins. ver authenticates the user approving a code on the
+// verification page (POST /auth/device/approve).
+func WithDeviceStore(st device.Store, ver middleware.Verifier) Option {
+	return func(h *AuthHandler) {
+		h.devices = st
+		h.deviceVerifier = ver
+	}
+}
+
+// registerDevice adds the device grant routes under /auth/device. An approval turns
+// into a full refresh session, so only users signed in interactively may approve:
+// personal access tokens, guests and services are refused.
+func (h *AuthHandler) registerDevice(a *gin.RouterGroup) {
+	d := a.Group("/device")
+	d.POST("/code", h.DeviceCode)
+	d.POST("/token", h.DeviceToken)
+	d.GET("", h.DevicePage)
+	if h.deviceVerifier != nil {
+		d.POST("/approve", middleware.AuthMiddleware(h.deviceVerifier), middleware.RequireUser(), requireInteractiveLogin, h.DeviceApprove)
+	} else {
+		d.POST("/approve", h.DeviceApprove)
+	}
+}
+
+// oauthError writes an RFC 6749 style error response (also used by RFC 8628/7662 endpoints)
+func oauthError(c *gin.Context, status int, code, desc string) {
+	body := gin.H{"error": code}
+	if desc != "" {
+		body["error_description"] = desc
+	}
+	c.JSON(status, body)
+}
+
+func (h *AuthHandler) deviceClientAllowed(clientID string) bool {
+	for _, id := range h.cfg.Device.ClientIDs {
+		if id == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// verificationURI is the page users open to enter their code
+func (h *AuthHandler) verificationURI(c *gin.Context) string {
+	if h.cfg.Device.VerificationURI != "" {
+		return h.cfg.Device.VerificationURI
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/auth/device"
+}
+
+// DeviceCode starts a device login. Form parameters: client_id, scope (optional).
+// The response tells the device which code to display and how often to poll.
+func (h *AuthHandler) DeviceCode(c *gin.Context) {
+	if h.devices == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "device authorization not configured"})
+		return
+	}
+	clientID := c.PostForm("client_id")
+	if clientID == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "client_id required")
+		return
+	}
+	if !h.deviceClientAllowed(clientID) {
+		oauthError(c, http.StatusUnauthorized, "invalid_client", "")
+		return
+	}
+	interval := int(h.cfg.Device.PollInterval / time.Second)
+	if interval <= 0 {
+		interval = 5
+	}
+	ttl := h.cfg.Device.CodeTTL
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+	da, err := device.NewAuthorization(clientID, c.PostForm("scope"), ttl, interval)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create device code"})
+		return
+	}
+	if err := h.devices.Save(c.Request.Context(), da); err != nil {
+		logger.Errorf("failed to store device authorization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store device code"})
+		return
+	}
+	vu := h.verificationURI(c)
+	c.JSON(http.StatusOK, gin.H{
+		"device_code":               da.DeviceCode,
+		"user_code":                 da.UserCode,
+		"verification_uri":          vu,
+		"verification_uri_complete": vu + "?user_code=" + url.QueryEscape(da.UserCode),
+		"expires_in":                int(ttl / time.Second),
+		"interval":                  interval,
+	})
+}
+
+// DeviceToken is polled by the device until the user approved or denied the code.
+// Form parameters: grant_type (urn:ietf:params:oauth:grant-type:device_code),
+// device_code, client_id. On approval a regular refresh session is created.
+func (h *AuthHandler) DeviceToken(c *gin.Context) {
+	if h.devices == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "device authorization not configured"})
+		return
+	}
+	if c.PostForm("grant_type") != device.GrantType {
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+	code := c.PostForm("device_code")
+	if code == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "device_code required")
+		return
+	}
+	ctx := c.Request.Context()
+	da, err := h.devices.GetByDeviceCode(ctx, code)
+	if err != nil {
+		logger.Errorf("failed to load device authorization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load device code"})
+		return
+	}
+	if da == nil || time.Now().After(da.ExpiresAt) {
+		oauthError(c, http.StatusBadRequest, "expired_token", "")
+		return
+	}
+	if da.ClientID != c.PostForm("client_id") {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "")
+		return
+	}
+
+	switch da.Status {
+	case device.StatusDenied:
+		_, _ = h.devices.Delete(ctx, da)
+		oauthError(c, http.StatusBadRequest, "access_denied", "")
+		return
+	case device.StatusPending:
+		now := time.Now().UTC()
+		tooFast := !da.LastPollAt.IsZero() && now.Sub(da.LastPollAt) < time.Duration(da.Interval)*time.Second
+		if tooFast {
+			// RFC 8628 §3.5: the client must add 5 seconds to its polling interval
+			da.Interval += 5
+		}
+		da.LastPollAt = now
+		// the user may approve the code meanwhile: only the polling state is saved, and
+		// only while the code is still pending (the next poll sees the outcome)
+		if _, err := h.devices.SavePoll(ctx, da); err != nil {
+			logger.Errorf("failed to store device authorization: %v", err)
+		}
+		if tooFast {
+			oauthError(c, http.StatusBadRequest, "slow_down", "")
+			return
+		}
+		oauthError(c, http.StatusBadRequest, "authorization_pending", "")
+		return
+	}
+
+	// approved: device codes are single use
+	deleted, err := h.devices.Delete(ctx, da)
+	if err != nil {
+		logger.Errorf("failed to delete device authorization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to consume device code"})
+		return
+	}
+	if !deleted {
+		oauthError(c, http.StatusBadRequest, "invalid_grant", "device code already used")
+		return
+	}
+	u, err := h.usersSvc.GetBySub(ctx, da.Sub)
+	if err != nil || u == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user lookup failed"})
+		return
+	}
+	lt := h.lifetimes(da.ClientID, u)
+	sess, err := h.sessionsSvc.OpenSession(ctx, u.Sub, lt.MaxLifetime, clientInfo(c), sessions.WithClientID(da.ClientID), sessions.WithIdleTimeout(lt.IdleTimeout))
+	if err != nil {
+		logger.Errorf("failed to create session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
+		return
+	}
+	access, err := tokens.GenerateAccessToken(h.cfg, u, lt.AccessTokenTTL, tokens.WithSessionID(sess.FamilyID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create access token"})
+		return
+	}
+	logger.Infof("device login approved: sub=%s client=%s", u.Sub, da.ClientID)
+	c.JSON(http.StatusOK, gin.H{"access_token": access, "token_type": "Bearer", "refresh_token": sess.RefreshToken, "expires_in": int(lt.AccessTokenTTL.Seconds())})
+}
+
+// deviceApproveRequest is the body of POST /auth/device/approve
+type deviceApproveRequest struct {
+	UserCode string `json:"user_code" binding:"required"`
+	Approve  bool   `json:"approve"`
+}
+
+// DeviceApprove lets the signed-in user approve (or deny) a user code shown on a device.
+func (h *AuthHandler) DeviceApprove(c *gin.Context) {
+	if h.devices == nil || h.deviceVerifier == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "device authorization not configured"})
+		return
+	}
+	var req deviceApproveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	v, _ := c.Get("claims")
+	claims, _ := v.(map[string]interface{})
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing subject"})
+		return
+	}
+	ctx := c.Request.Context()
+	da, err := h.devices.GetByUserCode(ctx, device.NormalizeUserCode(req.UserCode))
+	if err != nil {
+		logger.Errorf("failed to load device authorization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load device code"})
+		return
+	}
+	if da == nil || da.Status != device.StatusPending || time.Now().After(da.ExpiresAt) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown or expired code"})
+		return
+	}
+	if !req.Approve {
+		da.Status = device.StatusDenied
+	} else {
+		// tokens from Keycloak may belong to users we have not seen yet
+		u, err := h.usersSvc.FromClaims(ctx, claims)
+		if err != nil || u == nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user lookup failed"})
+			return
+		}
+		da.Status = device.StatusApproved
+		da.Sub = u.Sub
+	}
+	if err := h.devices.Save(ctx, da); err != nil {
+		logger.Errorf("failed to store device authorization: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store device code"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": string(da.Status)})
+}
+
+// DevicePage renders the verification page, which calls POST /auth/device/approve.
+// It obtains an access token from the refresh cookie (cookie mode); users without
+// one are sent through /auth/authorize, whose callback returns them here with an
+// access token in the fragment.
+func (h *AuthHandler) DevicePage(c *gin.Context) {
+	code := device.NormalizeUserCode(c.Query("user_code"))
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	returnTo := "/auth/device"
+	if code != "" {
+		returnTo += "?user_code=" + url.QueryEscape(code)
+	}
+	_ = devicePageTemplate.Execute(c.Writer, map[string]string{
+		"UserCode":   code,
+		"LoginURL":   "/auth/authorize?return_to=" + url.QueryEscape(returnTo),
+		"CSRFName":   middleware.CSRFCookieName,
+		"CSRFHeader": middleware.CSRFHeaderName,
+	})
+}
+
+var devicePageTemplate = template.Must(template.New("device").Parse(strings.TrimSpace(`
+<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>gogotex – Connect a device</title>
+<style>
+body { font-family: sans-serif; max-width: 28rem; margin: 4rem auto; }
+input { font-size: 1.5rem; letter-spacing: .2rem; text-transform: uppercase; width: 12rem; }
+button { font-size: 1rem; margin-right: .5rem; }
+</style>
+</head>
+<body>
+<h1>Connect a device</h1>
+<p>Enter the code shown by your CLI or editor plugin.</p>
+<form id="f">
+<p><input id="code" name="user_code" value="{{.UserCode}}" autocomplete="off" required></p>
+<p><button type="submit" data-approve="true">Approve</button><button type="submit" data-approve="false">Deny</button></p>
+</form>
+<p id="msg" role="status"></p>
+<script>
+(function () {
+  var msg = document.getElementById("msg");
+  function cookie(name) {
+    var m = document.cookie.match("(?:^|; )" + name + "=([^;]*)");
+    return m ? decodeURIComponent(m[1]) : "";
+  }
+  // token delivered by /auth/callback after login; kept out of the address bar
+  var delivered = new URLSearchParams(window.location.hash.slice(1)).get("access_token");
+  if (delivered) {
+    history.replaceState(null, "", window.location.pathname + window.location.search);
+    msg.textContent = "Signed in. Approve or deny the device.";
+  }
+  function accessToken() {
+    if (delivered) {
+      return Promise.resolve(delivered);
+    }
+    var h = {};
+    h[{{.CSRFHeader}}] = cookie({{.CSRFName}});
+    return fetch("/auth/refresh", { method: "POST", credentials: "same-origin", headers: h })
+      .then(function (r) { return r.ok ? r.json() : Promise.reject(r.status); })
+      .then(function (j) { return j.access_token; });
+  }
+  document.getElementById("f").addEventListener("submit", function (e) {
+    e.preventDefault();
+    var approve = e.submitter && e.submitter.getAttribute("data-approve") === "true";
+    var code = document.getElementById("code").value;
+    accessToken().then(function (tok) {
+      return fetch("/auth/device/approve", {
+        method: "POST",
+        headers: { "Content-Type": "application/json", "Authorization": "Bearer " + tok },
+        body: JSON.stringify({ user_code: code, approve: approve })
+      });
+    }, function () {
+      window.location = {{.LoginURL}};
+      return Promise.reject();
+    }).then(function (r) {
+      if (r.status === 401 && delivered) {
+        // the delivered token expired while the page was open
+        window.location = {{.LoginURL}};
+        return;
+      }
+      msg.textContent = r.ok ? (approve ? "Device connected. You can close this window." : "Request denied.")
+        : "The code is unknown or has expired.";
+    }, function () {});
+  });
+})();
+</script>
+</body>
+</html>
+`)))
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/device"
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/gogotex/gogotex/backend/go-services/internal/pats"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/internal/users"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+// newDeviceTestRouter approves device codes with our access tokens and the tokens
+// accepted by extra
+func newDeviceTestRouter(t *testing.T, extra ...middleware.Verifier) (*gin.Engine, *config.Config) {
+	t.Helper()
+	m, err := mr.Run()
+	require.NoError(t, err)
+	t.Cleanup(m.Close)
+	store := device.NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), "")
+
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "device-test-secret-32-bytes-xxxxxx"
+	cfg.Device.ClientIDs = []string{"gogotex-cli"}
+	cfg.Device.CodeTTL = time.Minute
+	cfg.Device.PollInterval = time.Second
+
+	h := NewAuthHandler(cfg, users.NewService(&fakeUserRepo{}), sessions.NewService(&fakeSessionsRepo{}),
+		WithDeviceStore(store, middleware.NewCompositeVerifier(append([]middleware.Verifier{tokens.NewVerifier(cfg)}, extra...)...)))
+	r := gin.New()
+	h.Register(r.Group("/"))
+	return r, cfg
+}
+
+func postForm(r *gin.Engine, path string, form url.Values) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var body map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	return w, body
+}
+
+func pollDevice(r *gin.Engine, deviceCode string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	return postForm(r, "/auth/device/token", url.Values{
+		"grant_type":  {device.GrantType},
+		"device_code": {deviceCode},
+		"client_id":   {"gogotex-cli"},
+	})
+}
+
+func approveDevice(t *testing.T, r *gin.Engine, cfg *config.Config, userCode string, approve bool) *httptest.ResponseRecorder {
+	t.Helper()
+	at, err := tokens.GenerateAccessToken(cfg, &models.User{Sub: "approver", Email: "a@b.c"}, time.Minute)
+	require.NoError(t, err)
+	b, _ := json.Marshal(map[string]interface{}{"user_code": userCode, "approve": approve})
+	req := httptest.NewRequest("POST", "/auth/device/approve", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+at)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestDeviceFlow_ApproveAndPoll(t *testing.T) {
+	r, cfg := newDeviceTestRouter(t)
+
+	w, body := postForm(r, "/auth/device/code", url.Values{"client_id": {"gogotex-cli"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	dc := body["device_code"].(string)
+	uc := body["user_code"].(string)
+	require.Equal(t, "http://example.com/auth/device", body["verification_uri"])
+	require.Contains(t, body["verification_uri_complete"], url.QueryEscape(uc))
+
+	// pending until approved
+	w, body = pollDevice(r, dc)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "authorization_pending", body["error"])
+
+	// approval requires an authenticated user
+	req := httptest.NewRequest("POST", "/auth/device/approve", strings.NewReader(`{"user_code":"`+uc+`","approve":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	wa := httptest.NewRecorder()
+	r.ServeHTTP(wa, req)
+	require.Equal(t, http.StatusUnauthorized, wa.Code)
+
+	// user codes are accepted in lower case and without the dash
+	wa = approveDevice(t, r, cfg, strings.ToLower(strings.ReplaceAll(uc, "-", "")), true)
+	require.Equal(t, http.StatusOK, wa.Code, wa.Body.String())
+
+	w, body = pollDevice(r, dc)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NotEmpty(t, body["access_token"])
+	require.NotEmpty(t, body["refresh_token"])
+	require.Equal(t, "Bearer", body["token_type"])
+
+	// device codes are single use
+	w, body = pollDevice(r, dc)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "expired_token", body["error"])
+}
+
+func TestDeviceFlow_DenyAndSlowDown(t *testing.T) {
+	r, cfg := newDeviceTestRouter(t)
+	_, body := postForm(r, "/auth/device/code", url.Values{"client_id": {"gogotex-cli"}})
+	dc := body["device_code"].(string)
+	uc := body["user_code"].(string)
+
+	_, body = pollDevice(r, dc)
+	require.Equal(t, "authorization_pending", body["error"])
+	// polling faster than the advertised interval
+	_, body = pollDevice(r, dc)
+	require.Equal(t, "slow_down", body["error"])
+
+	require.Equal(t, http.StatusOK, approveDevice(t, r, cfg, uc, false).Code)
+	w, body := pollDevice(r, dc)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "access_denied", body["error"])
+}
+
+func TestDeviceApprove_RequiresInteractiveLogin(t *testing.T) {
+	patSvc := pats.NewService(&fakePatRepo{})
+	r, _ := newDeviceTestRouter(t, pats.NewVerifier(patSvc, nil))
+	_, body := postForm(r, "/auth/device/code", url.Values{"client_id": {"gogotex-cli"}})
+	dc := body["device_code"].(string)
+	uc := body["user_code"].(string)
+
+	// a narrowly scoped token must not mint a full session through a device
+	raw, _, err := patSvc.Create(context.Background(), "alice", "git", []string{pats.ScopeGit}, 0)
+	require.NoError(t, err)
+	w := doJSON(r, "POST", "/auth/device/approve", raw, `{"user_code":"`+uc+`","approve":true}`)
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	_, body = pollDevice(r, dc)
+	require.Equal(t, "authorization_pending", body["error"])
+}
+
+func TestDeviceCode_RejectsUnknownClient(t *testing.T) {
+	r, _ := newDeviceTestRouter(t)
+	w, body := postForm(r, "/auth/device/code", url.Values{"client_id": {"other"}})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.Equal(t, "invalid_client", body["error"])
+
+	w, body = postForm(r, "/auth/device/token", url.Values{"grant_type": {"password"}})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Equal(t, "unsupported_grant_type", body["error"])
+}
+
+func TestDevicePage_PrefillsUserCode(t *testing.T) {
+	r, _ := newDeviceTestRouter(t)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/auth/device?user_code=bcdfghjk", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	require.Contains(t, w.Body.String(), `value="BCDF-GHJK"`)
+	require.Contains(t, w.Body.String(), "/auth/authorize?return_to=")
+}
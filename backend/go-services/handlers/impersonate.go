@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/audit"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/internal/users"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+)
+
+// defaultImpersonationTTL applies when Authz.ImpersonationTTL is not configured
+const defaultImpersonationTTL = 10 * time.Minute
+
+// ImpersonationHandler lets administrators act as another user, e.g. to see a
+// project exactly as a student sees it
+type ImpersonationHandler struct {
+	cfg      *config.Config
+	usersSvc *users.Service
+	audit    *audit.Service
+}
+
+func NewImpersonationHandler(cfg *config.Config, u *users.Service, a *audit.Service) *ImpersonationHandler {
+	return &ImpersonationHandler{cfg: cfg, usersSvc: u, audit: a}
+}
+
+// Register routes under /admin of the given group; auth authenticates the caller.
+// - POST /admin/impersonate/:sub -> short-lived access token for sub with an `act` claim
+// Every request made with such a token is audited by AuthMiddleware (see
+// middleware.SetImpersonationAuditor).
+func (h *ImpersonationHandler) Register(rg *gin.RouterGroup, auth gin.HandlerFunc) {
+	a := rg.Group("/admin", auth, middleware.RequireUser(), middleware.RequireRole(adminRole(h.cfg)))
+	a.POST("/impersonate/:sub", h.Impersonate)
+}
+
+// adminRole is the role required for the /admin endpoints
+func adminRole(cfg *config.Config) string {
+	if cfg.Authz.AdminRole != "" {
+		return cfg.Authz.AdminRole
+	}
+	return "admin"
+}
+
+// Impersonate issues an access token for the user :sub on behalf of the calling
+// administrator. The token has no refresh token and cannot be used to impersonate
+// further, to manage the user's tokens or sessions, or to act as another admin.
+func (h *ImpersonationHandler) Impersonate(c *gin.Context) {
+	actor, _ := middleware.CurrentPrincipal(c)
+	if actor.IsImpersonated() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "already impersonating"})
+		return
+	}
+	target := c.Param("sub")
+	if target == actor.Subject {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot impersonate yourself"})
+		return
+	}
+	ctx := c.Request.Context()
+	u, err := h.usersSvc.GetBySub(ctx, target)
+	if err != nil {
+		logger.Errorf("impersonate: user lookup failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user lookup failed"})
+		return
+	}
+	if u == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	for _, r := range u.Roles {
+		if r == adminRole(h.cfg) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "cannot impersonate an administrator"})
+			return
+		}
+	}
+
+	// the impersonation is logged before any token exists
+	err = h.audit.Record(ctx, audit.Event{
+		Action:   audit.ActionImpersonationStart,
+		Actor:    actor.Subject,
+		Subject:  u.Sub,
+		Method:   c.Request.Method,
+		Route:    c.FullPath(),
+		Path:     c.Request.URL.Path,
+		Status:   http.StatusOK,
+		ClientIP: c.ClientIP(),
+	})
+	if err != nil {
+		logger.Errorf("impersonate: audit log write failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "audit log unavailable"})
+		return
+	}
+	ttl := h.cfg.Authz.ImpersonationTTL
+	if ttl <= 0 {
+		ttl = defaultImpersonationTTL
+	}
+	access, err := tokens.GenerateAccessToken(h.cfg, u, ttl, tokens.WithActor(actor.Subject))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create access token"})
+		return
+	}
+	logger.Infof("impersonation started: actor=%s sub=%s ttl=%s", actor.Subject, u.Sub, ttl)
+	c.JSON(http.StatusOK, gin.H{"accessToken": access, "expiresIn": int(ttl.Seconds()), "sub": u.Sub})
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/audit"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/device"
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/gogotex/gogotex/backend/go-services/internal/projects"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sharelinks"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/internal/users"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+// directoryUserRepo knows a fixed set of users
+type directoryUserRepo struct {
+	fakeUserRepo
+	users map[string]*models.User
+}
+
+func (f *directoryUserRepo) GetBySub(ctx context.Context, sub string) (*models.User, error) {
+	return f.users[sub], nil
+}
+
+type memoryAuditRepo struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (f *memoryAuditRepo) Insert(ctx context.Context, e *audit.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, *e)
+	return nil
+}
+
+func TestImpersonate(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "impersonate-test-secret-32-bytes-x"
+	cfg.JWT.Issuer = "gogotex-auth"
+	admin := &models.User{Sub: "staff-1", Roles: []string{"admin"}}
+	other := &models.User{Sub: "staff-2", Roles: []string{"admin"}}
+	student := &models.User{Sub: "student-1", Name: "Student", Roles: []string{"student"}}
+	repo := &directoryUserRepo{users: map[string]*models.User{admin.Sub: admin, other.Sub: other, student.Sub: student}}
+	uSvc := users.NewService(repo)
+	auditRepo := &memoryAuditRepo{}
+	auditSvc := audit.NewService(auditRepo)
+	middleware.SetImpersonationAuditor(auditSvc.RecordImpersonatedRequest)
+	defer middleware.SetImpersonationAuditor(nil)
+
+	auth := middleware.AuthMiddleware(tokens.NewVerifier(cfg))
+	r := gin.New()
+	NewImpersonationHandler(cfg, uSvc, auditSvc).Register(r.Group("/"), auth)
+	NewSessionsHandler(sessions.NewService(&fakeSessionsRepo{}), uSvc).Register(r.Group("/api/v1"), auth)
+	NewShareLinksHandler(cfg, sharelinks.NewService(&memoryShareLinks{}), permTable{"student-1/p1": projects.PermissionOwner}).Register(r.Group("/api/v1"), auth)
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	cfg.Device.ClientIDs = []string{"gogotex-cli"}
+	NewAuthHandler(cfg, uSvc, sessions.NewService(&fakeSessionsRepo{}),
+		WithDeviceStore(device.NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), ""), tokens.NewVerifier(cfg))).Register(r.Group("/"))
+	r.GET("/api/v1/projects/:id", auth, func(c *gin.Context) {
+		p, _ := middleware.CurrentPrincipal(c)
+		c.JSON(http.StatusOK, gin.H{"sub": p.Subject, "actor": p.Actor})
+	})
+
+	do := func(method, path string, u *models.User) *httptest.ResponseRecorder {
+		tok, err := tokens.GenerateAccessToken(cfg, u, time.Minute)
+		require.NoError(t, err)
+		return doBearer(r, method, path, tok)
+	}
+
+	require.Equal(t, http.StatusForbidden, do("POST", "/admin/impersonate/student-1", student).Code)
+	require.Equal(t, http.StatusForbidden, do("POST", "/admin/impersonate/staff-2", admin).Code)
+	require.Equal(t, http.StatusNotFound, do("POST", "/admin/impersonate/nobody", admin).Code)
+	require.Empty(t, auditRepo.events)
+
+	w := do("POST", "/admin/impersonate/student-1", admin)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	imp := got["accessToken"].(string)
+
+	// handlers see both identities
+	w = doBearer(r, "GET", "/api/v1/projects/p1", imp)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"sub":"student-1","actor":"staff-1"}`, w.Body.String())
+
+	// no nested impersonation, no managing the student's sessions
+	require.Equal(t, http.StatusForbidden, doBearer(r, "POST", "/admin/impersonate/student-1", imp).Code)
+	require.Equal(t, http.StatusForbidden, doBearer(r, "GET", "/api/v1/sessions", imp).Code)
+
+	require.Len(t, auditRepo.events, 4)
+	start := auditRepo.events[0]
+	require.Equal(t, audit.ActionImpersonationStart, start.Action)
+	require.Equal(t, "staff-1", start.Actor)
+	require.Equal(t, "student-1", start.Subject)
+	req := auditRepo.events[1]
+	require.Equal(t, audit.ActionImpersonationRequest, req.Action)
+	require.Equal(t, "/api/v1/projects/:id", req.Route)
+	require.Equal(t, "/api/v1/projects/p1", req.Path)
+	require.Equal(t, http.StatusOK, req.Status)
+	require.Equal(t, http.StatusForbidden, auditRepo.events[3].Status)
+
+	// nor lasting credentials for the student: a device session or a share link
+	_, body := postForm(r, "/auth/device/code", url.Values{"client_id": {"gogotex-cli"}})
+	w = doJSON(r, "POST", "/auth/device/approve", imp, `{"user_code":"`+body["user_code"].(string)+`","approve":true}`)
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	w = doJSON(r, "POST", "/api/v1/projects/p1/share-links", imp, `{"role":"viewer","expiresInDays":7}`)
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	w = doJSON(r, "GET", "/api/v1/projects/p1/share-links", imp, "")
+	require.Equal(t, http.StatusOK, w.Code, "support staff may still look at the links")
+}
+
+func doBearer(r *gin.Engine, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/clients"
+	"github.com/gogotex/gogotex/backend/go-services/internal/pats"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+)
+
+// WithIntrospection enables POST /auth/introspect (RFC 7662) for the confidential
+// clients in reg. ver must accept every token type the service honours (first-party
+// access tokens, Keycloak tokens and personal access tokens).
+func WithIntrospection(reg *clients.Registry, ver middleware.Verifier) Option {
+	return func(h *AuthHandler) {
+		h.clients = reg
+		h.introspectVerifier = ver
+	}
+}
+
+// clientCredentials reads client_secret_basic or client_secret_post credentials
+func clientCredentials(c *gin.Context) (string, string) {
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		return id, secret
+	}
+	return c.PostForm("client_id"), c.PostForm("client_secret")
+}
+
+// authenticateClient authenticates the calling confidential client against reg. On
+// failure it writes a 401 invalid_client response and returns nil.
+func authenticateClient(c *gin.Context, reg *clients.Registry) *clients.Client {
+	id, secret := clientCredentials(c)
+	cl, ok := reg.Authenticate(id, secret)
+	if !ok {
+		c.Header("WWW-Authenticate", `Basic realm="gogotex"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		return nil
+	}
+	return cl
+}
+
+// Introspect reports whether a token is currently active (RFC 7662). Form parameters:
+// token, token_type_hint (ignored). Invalid, expired, blacklisted and revoked tokens
+// all yield {"active": false}; details are never disclosed to the caller.
+func (h *AuthHandler) Introspect(c *gin.Context) {
+	if h.clients == nil || h.introspectVerifier == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "introspection not configured"})
+		return
+	}
+	caller := authenticateClient(c, h.clients)
+	if caller == nil {
+		return
+	}
+	raw := c.PostForm("token")
+	if raw == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "token required")
+		return
+	}
+	inactive := gin.H{"active": false}
+	ctx := c.Request.Context()
+
+	tok, err := h.introspectVerifier.Verify(ctx, raw)
+	if err != nil {
+		logger.Debugf("introspect (client=%s): token rejected: %v", caller.ID, err)
+		c.JSON(http.StatusOK, inactive)
+		return
+	}
+	var claims map[string]interface{}
+	if err := tok.Claims(&claims); err != nil {
+		c.JSON(http.StatusOK, inactive)
+		return
+	}
+	if jti, _ := claims["jti"].(string); jti != "" {
+		blacklisted, err := sessions.IsJTIBlacklisted(ctx, jti)
+		if err != nil {
+			logger.Errorf("introspect: blacklist check failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "blacklist check failed"})
+			return
+		}
+		if blacklisted {
+			c.JSON(http.StatusOK, inactive)
+			return
+		}
+	}
+
+	if sub := middleware.ApplicationSubject(claims); sub != "" {
+		wm, err := sessions.TokensValidAfter(ctx, sub)
+		if err != nil {
+			logger.Errorf("introspect: watermark lookup failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "token validity check failed"})
+			return
+		}
+		if iat, ok := claims["iat"].(float64); ok && sessions.IssuedBefore(time.Unix(int64(iat), 0), wm) {
+			c.JSON(http.StatusOK, inactive)
+			return
+		}
+	}
+
+	// first-party access tokens are bound to a refresh session; logout or refresh-token
+	// reuse revokes them before they expire. Provider tokens die with the provider
+	// session, which back-channel logout reports.
+	iss, _ := claims["iss"].(string)
+	if sid, _ := claims["sid"].(string); sid != "" && iss == h.cfg.JWT.Issuer {
+		active, err := h.sessionsSvc.SessionActive(ctx, sid)
+		if err != nil {
+			logger.Errorf("introspect: session lookup failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "session lookup failed"})
+			return
+		}
+		if !active {
+			c.JSON(http.StatusOK, inactive)
+			return
+		}
+	} else if sid != "" {
+		revoked, err := sessions.IsProviderSIDRevoked(ctx, iss, sid)
+		if err != nil {
+			logger.Errorf("introspect: provider session lookup failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "session lookup failed"})
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusOK, inactive)
+			return
+		}
+	}
+
+	// guest tokens die with the share link they were redeemed from
+	if linkID, _ := claims["share_link"].(string); linkID != "" {
+		active, err := middleware.ShareLinkActive(ctx, linkID)
+		if err != nil {
+			logger.Errorf("introspect: share link lookup failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "share link lookup failed"})
+			return
+		}
+		if !active {
+			c.JSON(http.StatusOK, inactive)
+			return
+		}
+	}
+
+	resp := gin.H{"active": true, "token_type": "Bearer"}
+	if tt := claims["token_type"]; tt == pats.TokenType || tt == tokens.GuestTokenType {
+		resp["token_type"] = tt
+	}
+	for _, k := range []string{"sub", "scope", "exp", "iat", "iss", "aud", "sid", "jti", "project_id", "share_link"} {
+		if v, ok := claims[k]; ok {
+			resp[k] = v
+		}
+	}
+	if v, ok := claims["email"]; ok {
+		resp["username"] = v
+	}
+	// client the token was issued to (Keycloak sets azp, client tokens client_id)
+	if v, ok := claims["azp"]; ok {
+		resp["client_id"] = v
+	} else if v, ok := claims["client_id"]; ok {
+		resp["client_id"] = v
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/clients"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/gogotex/gogotex/backend/go-services/internal/pats"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/internal/users"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+type introspectFixture struct {
+	r       *gin.Engine
+	cfg     *config.Config
+	sSvc    *sessions.Service
+	patsSvc *pats.Service
+}
+
+func newIntrospectFixture(t *testing.T) *introspectFixture {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "introspect-test-secret-32-bytes-xx"
+	cfg.JWT.Issuer = "gogotex-auth"
+	sSvc := sessions.NewService(&fakeSessionsRepo{})
+	patsSvc := pats.NewService(&fakePatRepo{})
+	ver := middleware.NewCompositeVerifier(tokens.NewVerifier(cfg), pats.NewVerifier(patsSvc, nil))
+	reg := clients.NewRegistry(clients.Client{ID: "yjs-server", Secret: "yjs-secret"})
+
+	h := NewAuthHandler(cfg, users.NewService(&fakeUserRepo{}), sSvc, WithIntrospection(reg, ver))
+	r := gin.New()
+	h.Register(r.Group("/"))
+	return &introspectFixture{r: r, cfg: cfg, sSvc: sSvc, patsSvc: patsSvc}
+}
+
+func (f *introspectFixture) introspect(t *testing.T, token string, basicAuth bool) (int, map[string]interface{}) {
+	t.Helper()
+	form := url.Values{"token": {token}}
+	if !basicAuth {
+		form.Set("client_id", "yjs-server")
+		form.Set("client_secret", "yjs-secret")
+	}
+	req := httptest.NewRequest("POST", "/auth/introspect", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if basicAuth {
+		req.SetBasicAuth("yjs-server", "yjs-secret")
+	}
+	w := httptest.NewRecorder()
+	f.r.ServeHTTP(w, req)
+	var body map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body
+}
+
+func TestIntrospect_RequiresClientCredentials(t *testing.T) {
+	f := newIntrospectFixture(t)
+	req := httptest.NewRequest("POST", "/auth/introspect", strings.NewReader("token=x"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("yjs-server", "wrong")
+	w := httptest.NewRecorder()
+	f.r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+}
+
+func TestIntrospect_FirstPartyTokenFollowsSession(t *testing.T) {
+	f := newIntrospectFixture(t)
+	ctx := context.Background()
+	sess, err := f.sSvc.OpenSession(ctx, "alice", time.Hour)
+	require.NoError(t, err)
+	at, err := tokens.GenerateAccessToken(f.cfg, &models.User{Sub: "alice", Email: "a@example.com"}, time.Minute, tokens.WithSessionID(sess.FamilyID))
+	require.NoError(t, err)
+
+	code, body := f.introspect(t, at, true)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, true, body["active"])
+	require.Equal(t, "alice", body["sub"])
+	require.Equal(t, "a@example.com", body["username"])
+	require.NotNil(t, body["exp"])
+
+	// logging out revokes the session and with it the access token
+	require.NoError(t, f.sSvc.DeleteRefresh(ctx, sess.RefreshToken))
+	_, body = f.introspect(t, at, false)
+	require.Equal(t, map[string]interface{}{"active": false}, body)
+}
+
+func TestIntrospect_BlacklistedAndInvalidTokens(t *testing.T) {
+	f := newIntrospectFixture(t)
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	sessions.SetBlacklistClient(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	defer sessions.SetBlacklistClient(nil)
+
+	at, _ := tokens.GenerateAccessToken(f.cfg, &models.User{Sub: "bob"}, time.Minute)
+	_, body := f.introspect(t, at, true)
+	require.Equal(t, true, body["active"])
+
+	claims, err := unverifiedClaims(at)
+	require.NoError(t, err)
+	require.NoError(t, sessions.BlacklistJTI(context.Background(), claims["jti"].(string), time.Minute))
+	_, body = f.introspect(t, at, true)
+	require.Equal(t, false, body["active"])
+
+	_, body = f.introspect(t, "not-a-token", true)
+	require.Equal(t, false, body["active"])
+}
+
+func TestIntrospect_PersonalAccessToken(t *testing.T) {
+	f := newIntrospectFixture(t)
+	raw, _, err := f.patsSvc.Create(context.Background(), "carol", "ci", []string{pats.ScopeGit}, 0)
+	require.NoError(t, err)
+
+	_, body := f.introspect(t, raw, true)
+	require.Equal(t, true, body["active"])
+	require.Equal(t, "carol", body["sub"])
+	require.Equal(t, "git", body["scope"])
+	require.Equal(t, pats.TokenType, body["token_type"])
+}
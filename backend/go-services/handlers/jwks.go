@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+)
+
+// RegisterJWKS publishes the public keys used to sign first-party access tokens
+// so other services can verify them without holding a signing secret.
+// - GET /.well-known/jwks.json -> JSON Web Key Set (active + recently retired keys)
+func RegisterJWKS(rg *gin.Engine, ks *tokens.KeySet) {
+	rg.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		// keep caches short so rotated keys propagate well within a token lifetime
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, ks.JWKS())
+	})
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKSEndpoint(t *testing.T) {
+	ks, err := tokens.NewKeySet(tokens.AlgRS256, "", time.Hour)
+	require.NoError(t, err)
+
+	g := gin.New()
+	RegisterJWKS(g, ks)
+
+	req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code)
+
+	var got tokens.JWKS
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.Len(t, got.Keys, 1)
+	require.Equal(t, ks.Active().KID, got.Keys[0].Kid)
+	require.Equal(t, "RSA", got.Keys[0].Kty)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/audit"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/lockout"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+)
+
+// LockoutHandler lets administrators lift password-login lockouts, e.g. for a user
+// who mistyped their password too often
+type LockoutHandler struct {
+	cfg   *config.Config
+	guard *lockout.Guard
+	audit *audit.Service
+}
+
+// NewLockoutHandler creates the handler; a nil audit service disables auditing.
+func NewLockoutHandler(cfg *config.Config, g *lockout.Guard, a *audit.Service) *LockoutHandler {
+	return &LockoutHandler{cfg: cfg, guard: g, audit: a}
+}
+
+// Register routes under /admin of the given group; auth authenticates the caller.
+// - DELETE /admin/lockouts/users/:username -> clear failed logins and lock of a username
+// - DELETE /admin/lockouts/ips/:ip -> clear failed logins and lock of a client IP
+func (h *LockoutHandler) Register(rg *gin.RouterGroup, auth gin.HandlerFunc) {
+	a := rg.Group("/admin/lockouts", auth, middleware.RequireUser(), middleware.RequireRole(adminRole(h.cfg)))
+	a.DELETE("/users/:username", h.UnlockUser)
+	a.DELETE("/ips/:ip", h.UnlockIP)
+}
+
+func (h *LockoutHandler) UnlockUser(c *gin.Context) {
+	username := c.Param("username")
+	if err := h.guard.UnlockUser(c.Request.Context(), username); err != nil {
+		logger.Errorf("lockout: failed to unlock user %q: %v", username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to clear lockout"})
+		return
+	}
+	h.record(c)
+	c.Status(http.StatusNoContent)
+}
+
+func (h *LockoutHandler) UnlockIP(c *gin.Context) {
+	ip := net.ParseIP(c.Param("ip"))
+	if ip == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid IP address"})
+		return
+	}
+	if err := h.guard.UnlockIP(c.Request.Context(), ip.String()); err != nil {
+		logger.Errorf("lockout: failed to unlock ip %s: %v", ip, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to clear lockout"})
+		return
+	}
+	h.record(c)
+	c.Status(http.StatusNoContent)
+}
+
+// record writes the unlock to the audit log; the path names the username or IP
+func (h *LockoutHandler) record(c *gin.Context) {
+	actor, _ := middleware.CurrentPrincipal(c)
+	logger.Infof("lockout cleared: actor=%s path=%s", actor.Subject, c.Request.URL.Path)
+	if h.audit == nil {
+		return
+	}
+	err := h.audit.Record(c.Request.Context(), audit.Event{
+		Action:   audit.ActionLockoutClear,
+		Actor:    actor.Subject,
+		Method:   c.Request.Method,
+		Route:    c.FullPath(),
+		Path:     c.Request.URL.Path,
+		Status:   http.StatusNoContent,
+		ClientIP: c.ClientIP(),
+	})
+	if err != nil {
+		logger.Errorf("lockout: audit log write failed: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/audit"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/lockout"
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/gogotex/gogotex/backend/go-services/internal/oidc/oidctest"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/internal/users"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordLogin_Lockout(t *testing.T) {
+	// a mock Keycloak that counts token requests and fails for the password "outage"
+	var idp *oidctest.Provider
+	calls := 0
+	idpSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/token") {
+			calls++
+			if r.PostFormValue("password") == "outage" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		idp.ServeHTTP(w, r)
+	}))
+	defer idpSrv.Close()
+	idp, err := oidctest.NewProvider(idpSrv.URL, oidctest.WithUser(oidctest.User{Username: "alice", Password: "right", Sub: "alice-sub"}))
+	require.NoError(t, err)
+
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	guard := lockout.NewGuard(redis.NewClient(&redis.Options{Addr: m.Addr()}), "", lockout.Policy{UserThreshold: 2, BaseDelay: 30 * time.Second})
+
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "lockout-test-secret-32-bytes-xxxx"
+	cfg.Keycloak.URL = idp.URL()
+	cfg.Keycloak.Realm = idp.Realm()
+	cfg.Keycloak.ClientID = testClientID
+	auditRepo := &memoryAuditRepo{}
+	r := gin.New()
+	NewAuthHandler(cfg, users.NewService(&fakeUserRepo{}), sessions.NewService(&fakeSessionsRepo{}), WithLoginGuard(guard)).Register(r.Group("/"))
+	NewLockoutHandler(cfg, guard, audit.NewService(auditRepo)).Register(r.Group("/"), middleware.AuthMiddleware(tokens.NewVerifier(cfg)))
+
+	login := func(username, password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"mode": "password", "username": username, "password": password})
+		req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// provider outages are not held against the user
+	require.Equal(t, http.StatusBadGateway, login("alice", "outage").Code)
+
+	w := login("alice", "wrong")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.NotContains(t, w.Body.String(), "Invalid user credentials", "the provider's error is not echoed")
+	require.NotContains(t, w.Body.String(), "details")
+	require.Equal(t, http.StatusUnauthorized, login("Alice", "wrong").Code)
+
+	// locked: even the right password is refused without asking the provider
+	before := calls
+	w = login("alice", "right")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "30", w.Header().Get("Retry-After"))
+	require.Equal(t, before, calls)
+
+	// only administrators lift the lock
+	do := func(u *models.User, path string) int {
+		tok, err := tokens.GenerateAccessToken(cfg, u, time.Minute)
+		require.NoError(t, err)
+		return doBearer(r, "DELETE", path, tok).Code
+	}
+	require.Equal(t, http.StatusForbidden, do(&models.User{Sub: "bob", Roles: []string{"student"}}, "/admin/lockouts/users/alice"))
+	admin := &models.User{Sub: "staff-1", Roles: []string{"admin"}}
+	require.Equal(t, http.StatusBadRequest, do(admin, "/admin/lockouts/ips/not-an-ip"))
+	require.Equal(t, http.StatusNoContent, do(admin, "/admin/lockouts/users/"+url.PathEscape("alice")))
+	require.Len(t, auditRepo.events, 1)
+	require.Equal(t, audit.ActionLockoutClear, auditRepo.events[0].Action)
+	require.Equal(t, "staff-1", auditRepo.events[0].Actor)
+
+	w = login("alice", "right")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
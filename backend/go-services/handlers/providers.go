@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/oidc"
+)
+
+// WithProviderRegistry shares the identity provider verifiers with the rest of the
+// service. Without it the handler creates its own registry from the configuration.
+func WithProviderRegistry(reg *oidc.Registry) Option {
+	return func(h *AuthHandler) { h.providers = reg }
+}
+
+// keycloakEndpoints returns the well-known endpoints of a Keycloak realm
+func keycloakEndpoints(host, realm string) oidc.Endpoints {
+	base := strings.TrimRight(host, "/") + "/realms/" + realm + "/protocol/openid-connect"
+	return oidc.Endpoints{
+		Authorization: base + "/auth",
+		Token:         base + "/token",
+		EndSession:    base + "/logout",
+	}
+}
+
+// providerEndpoints returns the endpoints of p: Keycloak realms use the fixed
+// Keycloak layout, other providers the endpoints from their discovery document.
+func (h *AuthHandler) providerEndpoints(p config.ProviderConfig) (oidc.Endpoints, error) {
+	if p.IsKeycloak() {
+		return keycloakEndpoints(p.URL, p.Realm), nil
+	}
+	v, err := h.providers.Verifier(p.Name)
+	if err != nil {
+		return oidc.Endpoints{}, err
+	}
+	return v.Endpoints()
+}
+
+// verifyIDToken verifies an ID token issued by p and returns its claims
+func (h *AuthHandler) verifyIDToken(ctx context.Context, p config.ProviderConfig, idToken string) (map[string]interface{}, error) {
+	ver, err := h.providers.Verifier(p.Name)
+	if err != nil {
+		return nil, fmt.Errorf("provider %s: %w", p.Name, err)
+	}
+	tok, err := ver.Verify(ctx, idToken)
+	if err != nil {
+		return nil, err
+	}
+	var claims map[string]interface{}
+	if err := tok.Claims(&claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
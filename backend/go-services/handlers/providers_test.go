@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/oidc/oidctest"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/internal/users"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// testClientID is the client the primary test provider issues tokens to
+const testClientID = "cid"
+
+// newTestIdP starts a mock Keycloak knowing the account alice (password "right")
+// and makes it the primary provider of cfg
+func newTestIdP(t *testing.T, cfg *config.Config, opts ...oidctest.Option) *oidctest.Server {
+	t.Helper()
+	alice := oidctest.User{Username: "alice", Password: "right", Sub: "alice-sub", Claims: map[string]interface{}{"email": "a@b.c", "name": "Alice"}}
+	idp := oidctest.NewServer(t, append([]oidctest.Option{oidctest.WithUser(alice)}, opts...)...)
+	cfg.Keycloak.URL = idp.URL()
+	cfg.Keycloak.Realm = idp.Realm()
+	cfg.Keycloak.ClientID = testClientID
+	return idp
+}
+
+// authCodeLogin returns a /auth/login body redeeming a fresh authorization code
+// of username, and the provider session the code belongs to
+func authCodeLogin(t *testing.T, idp *oidctest.Server, username string) (body, sid string) {
+	t.Helper()
+	code, sid, err := idp.Code(username, url.Values{"client_id": {testClientID}, "redirect_uri": {"http://localhost/cb"}})
+	require.NoError(t, err)
+	return `{"mode":"auth_code","code":"` + code + `","redirect_uri":"http://localhost/cb"}`, sid
+}
+
+// newFakeOIDCProvider serves discovery, JWKS and a token endpoint that issues ID
+// tokens signed with a real key. discoveries counts discovery requests.
+func newFakeOIDCProvider(t *testing.T, clientID, sub string) (*httptest.Server, *int32) {
+	t.Helper()
+	ks, err := tokens.NewKeySet(tokens.AlgRS256, "", time.Hour)
+	require.NoError(t, err)
+	var discoveries int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			atomic.AddInt32(&discoveries, 1)
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 srv.URL,
+				"authorization_endpoint": srv.URL + "/authorize",
+				"token_endpoint":         srv.URL + "/token",
+				"end_session_endpoint":   srv.URL + "/logout",
+				"jwks_uri":               srv.URL + "/jwks",
+			})
+		case "/jwks":
+			_ = json.NewEncoder(w).Encode(ks.JWKS())
+		case "/token":
+			tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+				"iss": srv.URL, "aud": clientID, "sub": sub, "email": "guest@partner.example",
+				"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+			})
+			tok.Header["kid"] = ks.Active().KID
+			idToken, err := tok.SignedString(ks.Active().Private)
+			require.NoError(t, err)
+			_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "id_token": idToken})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &discoveries
+}
+
+func TestLogin_SelectsProviderAndCachesVerifier(t *testing.T) {
+	idp, discoveries := newFakeOIDCProvider(t, "gogotex", "shared-sub")
+
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "providers-test-secret-32-bytes-xxx"
+	cfg.Keycloak.URL = "http://127.0.0.1:1"
+	cfg.Keycloak.Realm = "university"
+	cfg.Keycloak.ClientID = "gogotex"
+	cfg.Providers = []config.ProviderConfig{{Name: "partner", Issuer: idp.URL, ClientID: "gogotex"}}
+	uSvc := users.NewService(&fakeUserRepo{}, users.WithPrimaryIssuer("http://127.0.0.1:1/realms/university"))
+	h := NewAuthHandler(cfg, uSvc, sessions.NewService(&fakeSessionsRepo{}))
+	r := gin.New()
+	h.Register(r.Group("/"))
+
+	login := func(provider string) (int, map[string]interface{}) {
+		body := `{"mode":"auth_code","code":"c","redirect_uri":"http://localhost/cb","provider":"` + provider + `"}`
+		req := httptest.NewRequest("POST", "/auth/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var got map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &got)
+		return w.Code, got
+	}
+
+	for i := 0; i < 2; i++ {
+		code, got := login("partner")
+		require.Equal(t, http.StatusOK, code, got)
+		user := got["user"].(map[string]interface{})
+		require.Equal(t, idp.URL, user["issuer"])
+		require.Equal(t, "shared-sub", user["oidcId"])
+		// subjects of secondary providers are namespaced by issuer
+		require.Equal(t, uSvc.SubjectFor(idp.URL, "shared-sub"), user["sub"])
+	}
+	require.EqualValues(t, 1, atomic.LoadInt32(discoveries), "verifier should be cached per provider")
+
+	code, _ := login("unknown")
+	require.Equal(t, http.StatusBadRequest, code)
+}
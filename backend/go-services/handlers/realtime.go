@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/clients"
+	"github.com/gogotex/gogotex/backend/go-services/internal/projects"
+	"github.com/gogotex/gogotex/backend/go-services/internal/realtime"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+)
+
+// defaultTicketTTL applies when Realtime.TicketTTL is not configured
+const defaultTicketTTL = 30 * time.Second
+
+// RealtimeHandler issues WebSocket connection tickets for the realtime (yjs) server
+// and lets that server redeem them
+type RealtimeHandler struct {
+	tickets realtime.Store
+	perms   projects.Resolver
+	clients *clients.Registry
+	ttl     time.Duration
+}
+
+// NewRealtimeHandler creates the handler; reg holds the internal services allowed
+// to redeem tickets. ttl <= 0 uses the default ticket lifetime.
+func NewRealtimeHandler(st realtime.Store, perms projects.Resolver, reg *clients.Registry, ttl time.Duration) *RealtimeHandler {
+	if ttl <= 0 {
+		ttl = defaultTicketTTL
+	}
+	return &RealtimeHandler{tickets: st, perms: perms, clients: reg, ttl: ttl}
+}
+
+// Register routes under /realtime of the given (API) group; auth authenticates the caller.
+// - POST /realtime/ticket -> single-use ticket for one document
+func (h *RealtimeHandler) Register(rg *gin.RouterGroup, auth gin.HandlerFunc) {
+	rg.POST("/realtime/ticket", auth, middleware.RequireUser(), h.Ticket)
+}
+
+// RegisterInternal registers the service-to-service routes on rg (the router root).
+// - POST /internal/realtime/redeem -> identity and permission behind a ticket
+func (h *RealtimeHandler) RegisterInternal(rg *gin.RouterGroup) {
+	rg.POST("/internal/realtime/redeem", h.Redeem)
+}
+
+type ticketRequest struct {
+	DocumentID string `json:"documentId" binding:"required"`
+}
+
+// Ticket issues a ticket for the signed-in user and the requested document. The
+// user must be able to at least read the document.
+func (h *RealtimeHandler) Ticket(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	var req ticketRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	sub := currentSubject(c)
+	perm, err := h.perms.DocumentPermission(ctx, sub, req.DocumentID)
+	if errors.Is(err, projects.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return
+	}
+	if err != nil {
+		logger.Errorf("realtime ticket: permission lookup failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "permission lookup failed"})
+		return
+	}
+	if !perm.CanRead() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no access to document"})
+		return
+	}
+	raw, err := h.tickets.Issue(ctx, &realtime.Ticket{
+		Sub:        sub,
+		DocumentID: req.DocumentID,
+		Name:       claimString(c, "name"),
+		Email:      claimString(c, "email"),
+		IssuedAt:   time.Now().UTC(),
+	}, h.ttl)
+	if err != nil {
+		logger.Errorf("realtime ticket: store failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue ticket"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ticket": raw, "expiresIn": int(h.ttl.Seconds())})
+}
+
+type redeemRequest struct {
+	Ticket     string `json:"ticket" binding:"required"`
+	DocumentID string `json:"documentId" binding:"required"`
+}
+
+// Redeem exchanges a ticket for the user identity and the user's current permission
+// on the document. The caller authenticates with its client credentials (HTTP Basic
+// or client_id/client_secret) and names the document the connection is for; a
+// ticket is accepted once and only for the document it was issued for.
+func (h *RealtimeHandler) Redeem(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	caller := authenticateClient(c, h.clients)
+	if caller == nil {
+		return
+	}
+	var req redeemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	t, err := h.tickets.Redeem(ctx, req.Ticket)
+	if err != nil {
+		logger.Errorf("realtime redeem: store failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ticket lookup failed"})
+		return
+	}
+	if t == nil || t.DocumentID != req.DocumentID {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid ticket"})
+		return
+	}
+	// permissions may have changed since the ticket was issued
+	perm, err := h.perms.DocumentPermission(ctx, t.Sub, t.DocumentID)
+	if err != nil && !errors.Is(err, projects.ErrNotFound) {
+		logger.Errorf("realtime redeem: permission lookup failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "permission lookup failed"})
+		return
+	}
+	if !perm.CanRead() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "no access to document"})
+		return
+	}
+	logger.Debugf("realtime ticket redeemed: client=%s sub=%s doc=%s", caller.ID, t.Sub, t.DocumentID)
+	c.JSON(http.StatusOK, gin.H{
+		"sub":        t.Sub,
+		"name":       t.Name,
+		"email":      t.Email,
+		"documentId": t.DocumentID,
+		"permission": perm,
+	})
+}
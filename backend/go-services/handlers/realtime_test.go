@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/clients"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/gogotex/gogotex/backend/go-services/internal/projects"
+	"github.com/gogotex/gogotex/backend/go-services/internal/realtime"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+// permTable resolves permissions from a "sub/id" table (documents and projects alike);
+// the id "missing" is not found
+type permTable map[string]projects.Permission
+
+func (p permTable) DocumentPermission(ctx context.Context, sub, documentID string) (projects.Permission, error) {
+	if documentID == "missing" {
+		return projects.PermissionNone, projects.ErrNotFound
+	}
+	return p[sub+"/"+documentID], nil
+}
+
+func (p permTable) ProjectPermission(ctx context.Context, sub, projectID string) (projects.Permission, error) {
+	return p.DocumentPermission(ctx, sub, projectID)
+}
+
+func TestRealtimeTickets(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "realtime-test-secret-32-bytes-xxxx"
+	perms := permTable{"alice/doc-1": projects.PermissionWrite, "bob/doc-1": projects.PermissionRead}
+	reg := clients.NewRegistry(clients.Client{ID: "yjs-server", Secret: "yjs-secret"})
+	h := NewRealtimeHandler(realtime.NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), ""), perms, reg, 0)
+	r := gin.New()
+	h.Register(r.Group("/api/v1"), middleware.AuthMiddleware(tokens.NewVerifier(cfg)))
+	h.RegisterInternal(r.Group("/"))
+
+	ticket := func(sub, doc string) (int, map[string]interface{}) {
+		tok, err := tokens.GenerateAccessToken(cfg, &models.User{Sub: sub, Name: strings.ToUpper(sub)}, time.Minute)
+		require.NoError(t, err)
+		req := httptest.NewRequest("POST", "/api/v1/realtime/ticket", strings.NewReader(`{"documentId":"`+doc+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tok)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+	redeem := func(secret, raw, doc string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("POST", "/internal/realtime/redeem", strings.NewReader(`{"ticket":"`+raw+`","documentId":"`+doc+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.SetBasicAuth("yjs-server", secret)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	code, _ := ticket("carol", "doc-1")
+	require.Equal(t, http.StatusForbidden, code)
+	code, _ = ticket("alice", "missing")
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, body := ticket("alice", "doc-1")
+	require.Equal(t, http.StatusOK, code)
+	require.EqualValues(t, 30, body["expiresIn"])
+	raw := body["ticket"].(string)
+
+	code, _ = redeem("wrong", raw, "doc-1")
+	require.Equal(t, http.StatusUnauthorized, code)
+	// bound to the document it was issued for (and consumed by the attempt)
+	code, _ = redeem("yjs-secret", raw, "doc-2")
+	require.Equal(t, http.StatusUnauthorized, code)
+	code, _ = redeem("yjs-secret", raw, "doc-1")
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	_, body = ticket("alice", "doc-1")
+	raw = body["ticket"].(string)
+	code, body = redeem("yjs-secret", raw, "doc-1")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "alice", body["sub"])
+	require.Equal(t, "ALICE", body["name"])
+	require.Equal(t, "write", body["permission"])
+	code, _ = redeem("yjs-secret", raw, "doc-1")
+	require.Equal(t, http.StatusUnauthorized, code, "tickets are single-use")
+
+	// access removed between issuing and redeeming
+	_, body = ticket("bob", "doc-1")
+	delete(perms, "bob/doc-1")
+	code, _ = redeem("yjs-secret", body["ticket"].(string), "doc-1")
+	require.Equal(t, http.StatusForbidden, code)
+}
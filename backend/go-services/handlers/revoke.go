@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+)
+
+// Revoke implements RFC 7009 token revocation. Form parameters: token,
+// token_type_hint ("access_token" | "refresh_token", optional).
+//   - access tokens issued by this service are blacklisted by jti until they expire
+//   - refresh tokens revoke their session (token family)
+//
+// Public clients (SPA, CLI) only prove possession of the token; confidential clients
+// that send credentials must authenticate. Unknown or invalid tokens are answered with
+// 200 as required by the RFC so the endpoint cannot be used to probe tokens.
+func (h *AuthHandler) Revoke(c *gin.Context) {
+	if id, secret := clientCredentials(c); secret != "" {
+		if h.clients == nil {
+			oauthError(c, http.StatusUnauthorized, "invalid_client", "")
+			return
+		}
+		if _, ok := h.clients.Authenticate(id, secret); !ok {
+			c.Header("WWW-Authenticate", `Basic realm="gogotex"`)
+			oauthError(c, http.StatusUnauthorized, "invalid_client", "")
+			return
+		}
+	}
+	raw := c.PostForm("token")
+	if raw == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "token required")
+		return
+	}
+	ctx := c.Request.Context()
+
+	revokeAccess := func() (bool, error) {
+		// only tokens we signed are blacklisted; the signature check keeps callers from
+		// filling the blacklist with forged jtis
+		if _, err := tokens.NewVerifier(h.cfg).Verify(ctx, raw); err != nil {
+			return false, nil
+		}
+		return true, revokeAccessToken(ctx, raw)
+	}
+	revokeRefresh := func() (bool, error) {
+		sess, err := h.sessionsSvc.ValidateRefresh(ctx, raw)
+		if err != nil || sess == nil {
+			return false, err
+		}
+		return true, h.sessionsSvc.DeleteRefresh(ctx, raw)
+	}
+
+	order := []func() (bool, error){revokeAccess, revokeRefresh}
+	if c.PostForm("token_type_hint") == "refresh_token" {
+		order = []func() (bool, error){revokeRefresh, revokeAccess}
+	}
+	for _, revoke := range order {
+		done, err := revoke()
+		if err != nil {
+			// RFC 7009 §2.2.1: the client may retry later
+			logger.Errorf("token revocation failed: %v", err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "temporarily_unavailable"})
+			return
+		}
+		if done {
+			break
+		}
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/internal/users"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func newRevokeTestRouter(t *testing.T) (*gin.Engine, *config.Config, *sessions.Service, *mr.Miniredis) {
+	t.Helper()
+	m, err := mr.Run()
+	require.NoError(t, err)
+	t.Cleanup(m.Close)
+	sessions.SetBlacklistClient(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	t.Cleanup(func() { sessions.SetBlacklistClient(nil) })
+
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "revoke-test-secret-32-bytes-xxxxxx"
+	sSvc := sessions.NewService(&fakeSessionsRepo{})
+	r := gin.New()
+	NewAuthHandler(cfg, users.NewService(&fakeUserRepo{}), sSvc).Register(r.Group("/"))
+	r.GET("/protected", middleware.AuthMiddleware(tokens.NewVerifier(cfg)), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r, cfg, sSvc, m
+}
+
+func revoke(r *gin.Engine, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/auth/revoke", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRevoke_AccessTokenBlacklistsJTI(t *testing.T) {
+	r, cfg, _, m := newRevokeTestRouter(t)
+	at, err := tokens.GenerateAccessToken(cfg, &models.User{Sub: "alice"}, time.Minute)
+	require.NoError(t, err)
+	claims, _ := unverifiedClaims(at)
+
+	w := revoke(r, url.Values{"token": {at}, "token_type_hint": {"access_token"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, m.Exists("blacklist:jti:"+claims["jti"].(string)))
+	require.Greater(t, m.TTL("blacklist:jti:"+claims["jti"].(string)), time.Duration(0))
+
+	req := httptest.NewRequest("GET", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+at)
+	wp := httptest.NewRecorder()
+	r.ServeHTTP(wp, req)
+	require.Equal(t, http.StatusUnauthorized, wp.Code)
+}
+
+func TestRevoke_RefreshTokenWithWrongHint(t *testing.T) {
+	r, _, sSvc, _ := newRevokeTestRouter(t)
+	rt, err := sSvc.CreateSession(context.Background(), "alice", time.Hour)
+	require.NoError(t, err)
+
+	// a wrong hint still finds the refresh token
+	w := revoke(r, url.Values{"token": {rt}, "token_type_hint": {"access_token"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	sess, err := sSvc.ValidateRefresh(context.Background(), rt)
+	require.NoError(t, err)
+	require.Nil(t, sess)
+}
+
+func TestRevoke_UnknownAndForgedTokens(t *testing.T) {
+	r, cfg, _, m := newRevokeTestRouter(t)
+	require.Equal(t, http.StatusOK, revoke(r, url.Values{"token": {"unknown"}}).Code)
+	require.Equal(t, http.StatusBadRequest, revoke(r, url.Values{}).Code)
+
+	// tokens signed with another key are not blacklisted
+	other := *cfg
+	other.JWT.Secret = "someone-elses-secret-32-bytes-xxxx"
+	forged, _ := tokens.GenerateAccessToken(&other, &models.User{Sub: "x"}, time.Minute)
+	claims, _ := unverifiedClaims(forged)
+	require.Equal(t, http.StatusOK, revoke(r, url.Values{"token": {forged}}).Code)
+	require.False(t, m.Exists("blacklist:jti:"+claims["jti"].(string)))
+
+	// confidential clients must authenticate when sending credentials
+	w := revoke(r, url.Values{"token": {"x"}, "client_id": {"svc"}, "client_secret": {"guess"}})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/users"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+)
+
+// clientInfo records the request's client address and user agent on a session
+func clientInfo(c *gin.Context) sessions.Option {
+	return sessions.WithClient(c.ClientIP(), c.Request.UserAgent())
+}
+
+// SessionsHandler lets users list their sign-ins and end them remotely
+type SessionsHandler struct {
+	svc      *sessions.Service
+	usersSvc *users.Service
+}
+
+func NewSessionsHandler(svc *sessions.Service, u *users.Service) *SessionsHandler {
+	return &SessionsHandler{svc: svc, usersSvc: u}
+}
+
+// sessionView is the public representation of a session (never the refresh token)
+type sessionView struct {
+	ID           string    `json:"id"`
+	ClientID     string    `json:"clientId,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastUsedAt   time.Time `json:"lastUsedAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`    // ends here unless refreshed before
+	MaxExpiresAt time.Time `json:"maxExpiresAt"` // ends here at the latest
+	IP           string    `json:"ip,omitempty"`
+	UserAgent    string    `json:"userAgent,omitempty"`
+	Device       string    `json:"device,omitempty"` // e.g. "Firefox on Linux"
+	Current      bool      `json:"current"`          // the session the request's access token belongs to
+}
+
+// Register routes under /sessions of the given (API) group; auth authenticates the caller.
+// - GET    /sessions      -> list active sessions
+// - DELETE /sessions/:id  -> sign out a session
+// - DELETE /sessions      -> sign out everywhere (also invalidates issued access tokens)
+// Signing out stops the session's refresh tokens; access tokens already issued for
+// it expire on their own (introspection reports them inactive right away).
+func (h *SessionsHandler) Register(rg *gin.RouterGroup, auth gin.HandlerFunc) {
+	s := rg.Group("/sessions", auth, requireInteractiveLogin)
+	s.GET("", h.List)
+	s.DELETE("", h.DeleteAll)
+	s.DELETE("/:id", h.Delete)
+}
+
+func (h *SessionsHandler) List(c *gin.Context) {
+	list, err := h.svc.ListSessions(c.Request.Context(), currentSubject(c))
+	if err != nil {
+		logger.Errorf("failed to list sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list sessions"})
+		return
+	}
+	current := claimString(c, "sid")
+	out := make([]sessionView, 0, len(list))
+	for _, s := range list {
+		if s.FamilyID == "" {
+			continue
+		}
+		maxExp := s.MaxExpiresAt
+		if maxExp.IsZero() {
+			maxExp = s.ExpiresAt
+		}
+		out = append(out, sessionView{
+			ID:           s.FamilyID,
+			ClientID:     s.ClientID,
+			CreatedAt:    s.CreatedAt,
+			LastUsedAt:   s.LastUsedAt,
+			ExpiresAt:    s.ExpiresAt,
+			MaxExpiresAt: maxExp,
+			IP:           s.IP,
+			UserAgent:    s.UserAgent,
+			Device:       s.Device,
+			Current:      current != "" && current == s.FamilyID,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": out})
+}
+
+func (h *SessionsHandler) Delete(c *gin.Context) {
+	ok, err := h.svc.RevokeSession(c.Request.Context(), currentSubject(c), c.Param("id"))
+	if err != nil {
+		logger.Errorf("failed to revoke session: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteAll signs the user out everywhere: it moves the token-validity watermark to
+// now, so every access token issued so far is rejected, and deletes all refresh
+// sessions. Personal access tokens are not affected.
+func (h *SessionsHandler) DeleteAll(c *gin.Context) {
+	ctx := c.Request.Context()
+	sub := currentSubject(c)
+	now := time.Now().UTC()
+	if err := h.usersSvc.SetTokensValidAfter(ctx, sub, now); err != nil {
+		logger.Errorf("failed to store token watermark: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign out"})
+		return
+	}
+	if err := sessions.CacheTokensValidAfter(ctx, sub, now); err != nil {
+		// the cached copy would keep old tokens alive until it expires
+		logger.Errorf("failed to cache token watermark: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign out"})
+		return
+	}
+	if err := h.svc.RevokeAll(ctx, sub); err != nil {
+		logger.Errorf("failed to revoke sessions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign out"})
+		return
+	}
+	logger.Infof("signed out everywhere: sub=%s", sub)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/internal/users"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionsHandler_ListAndDelete(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "sessions-test-secret-32-bytes-xxxx"
+	sSvc := sessions.NewService(&fakeSessionsRepo{})
+	r := gin.New()
+	NewSessionsHandler(sSvc, users.NewService(&fakeUserRepo{})).Register(r.Group("/api/v1"), middleware.AuthMiddleware(tokens.NewVerifier(cfg)))
+
+	ctx := context.Background()
+	browser, err := sSvc.OpenSession(ctx, "alice", time.Hour, sessions.WithClient("192.0.2.1", "Firefox"))
+	require.NoError(t, err)
+	lab, err := sSvc.OpenSession(ctx, "alice", time.Hour, sessions.WithClient("192.0.2.99", "lab machine"))
+	require.NoError(t, err)
+	_, err = sSvc.OpenSession(ctx, "bob", time.Hour)
+	require.NoError(t, err)
+
+	access, err := tokens.GenerateAccessToken(cfg, &models.User{Sub: "alice"}, time.Minute, tokens.WithSessionID(browser.FamilyID))
+	require.NoError(t, err)
+
+	w := doJSON(r, "GET", "/api/v1/sessions", access, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NotContains(t, w.Body.String(), browser.RefreshToken)
+	var body struct {
+		Sessions []sessionView `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Sessions, 2)
+	for _, s := range body.Sessions {
+		require.Equal(t, s.ID == browser.FamilyID, s.Current)
+		require.False(t, s.CreatedAt.IsZero())
+		require.False(t, s.LastUsedAt.IsZero())
+		if s.ID == lab.FamilyID {
+			require.Equal(t, "192.0.2.99", s.IP)
+			require.Equal(t, "lab machine", s.UserAgent)
+		}
+	}
+
+	// sign out the lab machine remotely
+	w = doJSON(r, "DELETE", "/api/v1/sessions/"+lab.FamilyID, access, "")
+	require.Equal(t, http.StatusNoContent, w.Code)
+	got, err := sSvc.ValidateRefresh(ctx, lab.RefreshToken)
+	require.NoError(t, err)
+	require.Nil(t, got)
+
+	w = doJSON(r, "DELETE", "/api/v1/sessions/"+lab.FamilyID, access, "")
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// watermarkUserRepo keeps watermarks in memory
+type watermarkUserRepo struct {
+	fakeUserRepo
+	validAfter map[string]time.Time
+}
+
+func (f *watermarkUserRepo) GetBySub(ctx context.Context, sub string) (*models.User, error) {
+	return &models.User{Sub: sub, TokensValidAfter: f.validAfter[sub]}, nil
+}
+
+func (f *watermarkUserRepo) SetTokensValidAfter(ctx context.Context, sub string, t time.Time) error {
+	f.validAfter[sub] = t
+	return nil
+}
+
+func TestSessionsHandler_SignOutEverywhere(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	sessions.SetBlacklistClient(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	defer sessions.SetBlacklistClient(nil)
+
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "sessions-test-secret-32-bytes-xxxx"
+	userRepo := &watermarkUserRepo{validAfter: map[string]time.Time{}}
+	uSvc := users.NewService(userRepo)
+	sessions.SetWatermarkLoader(uSvc.TokensValidAfter)
+	defer sessions.SetWatermarkLoader(nil)
+	sSvc := sessions.NewService(&fakeSessionsRepo{})
+	r := gin.New()
+	NewSessionsHandler(sSvc, uSvc).Register(r.Group("/api/v1"), middleware.AuthMiddleware(tokens.NewVerifier(cfg)))
+
+	ctx := context.Background()
+	rt, err := sSvc.CreateSession(ctx, "alice", time.Hour)
+	require.NoError(t, err)
+	// tokens issued in an earlier second than the watermark
+	old, _ := tokens.GenerateAccessToken(cfg, &models.User{Sub: "alice"}, time.Minute)
+	stolen, _ := tokens.GenerateAccessToken(cfg, &models.User{Sub: "alice"}, time.Minute)
+	time.Sleep(1100 * time.Millisecond)
+
+	w := doJSON(r, "DELETE", "/api/v1/sessions", old, "")
+	require.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+	require.False(t, userRepo.validAfter["alice"].IsZero())
+
+	got, err := sSvc.ValidateRefresh(ctx, rt)
+	require.NoError(t, err)
+	require.Nil(t, got)
+
+	// tokens that are already out there stop working
+	w = doJSON(r, "GET", "/api/v1/sessions", stolen, "")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// newly issued tokens are accepted
+	time.Sleep(1100 * time.Millisecond)
+	fresh, _ := tokens.GenerateAccessToken(cfg, &models.User{Sub: "alice"}, time.Minute)
+	w = doJSON(r, "GET", "/api/v1/sessions", fresh, "")
+	require.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/projects"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sharelinks"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+)
+
+// defaultGuestTokenTTL applies when Sharing.GuestTokenTTL is not configured
+const defaultGuestTokenTTL = time.Hour
+
+// ShareLinksHandler lets project owners share a project with people who have no
+// account, and lets those guests redeem the links for a guest access token
+type ShareLinksHandler struct {
+	cfg   *config.Config
+	svc   *sharelinks.Service
+	perms projects.Resolver
+}
+
+func NewShareLinksHandler(cfg *config.Config, svc *sharelinks.Service, perms projects.Resolver) *ShareLinksHandler {
+	return &ShareLinksHandler{cfg: cfg, svc: svc, perms: perms}
+}
+
+// createShareLinkRequest is the body of POST /api/v1/projects/:id/share-links
+type createShareLinkRequest struct {
+	Role          sharelinks.Role `json:"role" binding:"required"`
+	ExpiresInDays int             `json:"expiresInDays" binding:"required"`
+	Password      string          `json:"password"` // empty = no password
+}
+
+// redeemShareLinkRequest is the body of POST /api/v1/share-links/redeem
+type redeemShareLinkRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password"`
+}
+
+// Register routes of the given (API) group; auth authenticates the caller.
+// - GET    /projects/:id/share-links          -> list the project's links (owner only)
+// - POST   /projects/:id/share-links          -> create a link; the secret is returned once
+// - DELETE /projects/:id/share-links/:linkId  -> revoke a link and lock out its guests
+// - POST   /share-links/redeem                -> guest access token (no authentication)
+//
+// Links outlive personal access and impersonation tokens, so neither may create them.
+func (h *ShareLinksHandler) Register(rg *gin.RouterGroup, auth gin.HandlerFunc) {
+	l := rg.Group("/projects/:id/share-links", auth, middleware.RequireUser(), h.requireOwner)
+	l.GET("", h.List)
+	l.POST("", requireInteractiveLogin, h.Create)
+	l.DELETE("/:linkId", h.Revoke)
+	rg.POST("/share-links/redeem", h.Redeem)
+}
+
+// requireOwner admits the owner of the project :id only
+func (h *ShareLinksHandler) requireOwner(c *gin.Context) {
+	perm, err := h.perms.ProjectPermission(c.Request.Context(), currentSubject(c), c.Param("id"))
+	if errors.Is(err, projects.ErrNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+	if err != nil {
+		logger.Errorf("share links: permission lookup failed: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "permission lookup failed"})
+		return
+	}
+	if perm != projects.PermissionOwner {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "only the project owner can manage share links"})
+		return
+	}
+	c.Next()
+}
+
+func (h *ShareLinksHandler) List(c *gin.Context) {
+	list, err := h.svc.List(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		logger.Errorf("failed to list share links: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list share links"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"links": list})
+}
+
+func (h *ShareLinksHandler) Create(c *gin.Context) {
+	var req createShareLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.Role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role", "details": req.Role, "allowed": []sharelinks.Role{sharelinks.RoleViewer, sharelinks.RoleCommenter}})
+		return
+	}
+	raw, link, err := h.svc.Create(c.Request.Context(), currentSubject(c), c.Param("id"), req.Role, time.Duration(req.ExpiresInDays)*24*time.Hour, req.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Infof("share link created: project=%s link=%s role=%s", link.ProjectID, link.ID, link.Role)
+	c.JSON(http.StatusCreated, gin.H{"token": raw, "link": link})
+}
+
+func (h *ShareLinksHandler) Revoke(c *gin.Context) {
+	ok, err := h.svc.Revoke(c.Request.Context(), c.Param("id"), c.Param("linkId"))
+	if err != nil {
+		logger.Errorf("failed to revoke share link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke share link"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "share link not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Redeem exchanges a share link secret (and the password of protected links) for a
+// guest access token. Guests have no account: the token carries no subject, only
+// the project, the link's role and the matching scopes, and expires with the link
+// at the latest.
+func (h *ShareLinksHandler) Redeem(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	var req redeemShareLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	link, err := h.svc.Redeem(c.Request.Context(), req.Token, req.Password)
+	switch {
+	case errors.Is(err, sharelinks.ErrInvalidLink), errors.Is(err, sharelinks.ErrLinkExpired):
+		c.JSON(http.StatusNotFound, gin.H{"error": "share link not found or expired"})
+		return
+	case errors.Is(err, sharelinks.ErrPasswordRequired):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "password required", "passwordRequired": true})
+		return
+	case errors.Is(err, sharelinks.ErrWrongPassword):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "wrong password", "passwordRequired": true})
+		return
+	case err != nil:
+		logger.Errorf("share link redeem failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to redeem share link"})
+		return
+	}
+	ttl := h.cfg.Sharing.GuestTokenTTL
+	if ttl <= 0 {
+		ttl = defaultGuestTokenTTL
+	}
+	if left := time.Until(link.ExpiresAt); left < ttl {
+		ttl = left
+	}
+	access, err := tokens.GenerateGuestToken(h.cfg, link.ID, link.ProjectID, string(link.Role), link.Role.Scopes(), ttl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create access token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"accessToken": access, "expiresIn": int(ttl.Seconds()), "projectId": link.ProjectID, "role": link.Role})
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/gogotex/gogotex/backend/go-services/internal/projects"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sharelinks"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryShareLinks implements sharelinks.Repository in memory
+type memoryShareLinks struct {
+	mu    sync.Mutex
+	links map[string]sharelinks.Link
+}
+
+func (f *memoryShareLinks) Create(ctx context.Context, l *sharelinks.Link) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.links == nil {
+		f.links = map[string]sharelinks.Link{}
+	}
+	f.links[l.ID] = *l
+	return nil
+}
+
+func (f *memoryShareLinks) GetByHash(ctx context.Context, hash string) (*sharelinks.Link, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, l := range f.links {
+		if l.Hash == hash {
+			return &l, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *memoryShareLinks) GetByID(ctx context.Context, id string) (*sharelinks.Link, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if l, ok := f.links[id]; ok {
+		return &l, nil
+	}
+	return nil, nil
+}
+
+func (f *memoryShareLinks) ListByProject(ctx context.Context, projectID string) ([]*sharelinks.Link, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := []*sharelinks.Link{}
+	for _, l := range f.links {
+		if l.ProjectID == projectID {
+			l := l
+			out = append(out, &l)
+		}
+	}
+	return out, nil
+}
+
+func (f *memoryShareLinks) DeleteByID(ctx context.Context, projectID, id string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if l, ok := f.links[id]; !ok || l.ProjectID != projectID {
+		return false, nil
+	}
+	delete(f.links, id)
+	return true, nil
+}
+
+func (f *memoryShareLinks) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	return nil
+}
+
+func TestShareLinks(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "sharelinks-test-secret-32-bytes-xx"
+	svc := sharelinks.NewService(&memoryShareLinks{})
+	middleware.SetShareLinkChecker(svc.Active)
+	defer middleware.SetShareLinkChecker(nil)
+	perms := permTable{"owner/p1": projects.PermissionOwner, "editor/p1": projects.PermissionWrite}
+
+	auth := middleware.AuthMiddleware(tokens.NewVerifier(cfg))
+	r := gin.New()
+	api := r.Group("/api/v1")
+	NewShareLinksHandler(cfg, svc, perms).Register(api, auth)
+	// a project route as other services would guard it
+	api.GET("/projects/:id/files", auth, middleware.RequireProjectAccess("id"), middleware.RequireScope(sharelinks.ScopeProjectsRead), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	api.GET("/me", auth, middleware.RequireUser(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	userToken := func(sub string) string {
+		tok, err := tokens.GenerateAccessToken(cfg, &models.User{Sub: sub}, time.Minute)
+		require.NoError(t, err)
+		return tok
+	}
+	doJSON := func(method, path, token, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var out map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &out)
+		return w.Code, out
+	}
+
+	// only the owner manages links
+	code, _ := doJSON("POST", "/api/v1/projects/p1/share-links", userToken("editor"), `{"role":"viewer","expiresInDays":7}`)
+	require.Equal(t, http.StatusForbidden, code)
+	code, _ = doJSON("POST", "/api/v1/projects/missing/share-links", userToken("owner"), `{"role":"viewer","expiresInDays":7}`)
+	require.Equal(t, http.StatusNotFound, code)
+	code, _ = doJSON("POST", "/api/v1/projects/p1/share-links", userToken("owner"), `{"role":"editor","expiresInDays":7}`)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	code, body := doJSON("POST", "/api/v1/projects/p1/share-links", userToken("owner"), `{"role":"viewer","expiresInDays":7,"password":"s3cret"}`)
+	require.Equal(t, http.StatusCreated, code)
+	raw := body["token"].(string)
+	link := body["link"].(map[string]interface{})
+	require.Equal(t, true, link["passwordProtected"])
+	require.NotContains(t, link, "passwordHash")
+
+	code, body = doJSON("POST", "/api/v1/share-links/redeem", "", `{"token":"`+raw+`"}`)
+	require.Equal(t, http.StatusUnauthorized, code)
+	require.Equal(t, true, body["passwordRequired"])
+	code, _ = doJSON("POST", "/api/v1/share-links/redeem", "", `{"token":"ggs_unknown"}`)
+	require.Equal(t, http.StatusNotFound, code)
+	code, body = doJSON("POST", "/api/v1/share-links/redeem", "", `{"token":"`+raw+`","password":"s3cret"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "viewer", body["role"])
+	guest := body["accessToken"].(string)
+
+	// guests are confined to their project and cannot act as users
+	code, _ = doJSON("GET", "/api/v1/projects/p1/files", guest, "")
+	require.Equal(t, http.StatusOK, code)
+	code, _ = doJSON("GET", "/api/v1/projects/p2/files", guest, "")
+	require.Equal(t, http.StatusForbidden, code)
+	code, _ = doJSON("GET", "/api/v1/me", guest, "")
+	require.Equal(t, http.StatusForbidden, code)
+	code, _ = doJSON("GET", "/api/v1/projects/p1/share-links", guest, "")
+	require.Equal(t, http.StatusForbidden, code)
+
+	// revoking the link locks its guests out
+	code, body = doJSON("GET", "/api/v1/projects/p1/share-links", userToken("owner"), "")
+	require.Equal(t, http.StatusOK, code)
+	links := body["links"].([]interface{})
+	require.Len(t, links, 1)
+	id := links[0].(map[string]interface{})["id"].(string)
+	code, _ = doJSON("DELETE", "/api/v1/projects/p1/share-links/"+id, userToken("owner"), "")
+	require.Equal(t, http.StatusNoContent, code)
+	code, _ = doJSON("GET", "/api/v1/projects/p1/files", guest, "")
+	require.Equal(t, http.StatusUnauthorized, code)
+}
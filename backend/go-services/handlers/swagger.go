@@ -47,19 +47,91 @@ const swaggerJSON = `{
     "/auth/login": {
       "post": {
         "summary": "Exchange authorization code / login",
-        "requestBody": { "content": { "application/json": { "schema": {"type":"object","properties":{"mode":{"type":"string"},"username":{"type":"string"},"password":{"type":"string"},"code":{"type":"string"},"redirect_uri":{"type":"string"}}}}}},
-        "responses": { "200": { "description": "tokens returned" } }
+        "requestBody": { "content": { "application/json": { "schema": {"type":"object","properties":{"mode":{"type":"string"},"username":{"type":"string"},"password":{"type":"string"},"code":{"type":"string"},"redirect_uri":{"type":"string"},"provider":{"type":"string","description":"identity provider name (default: primary Keycloak realm)"}}}}}},
+        "responses": { "200": { "description": "tokens returned" }, "400": { "description": "unknown provider, or mode auth_code while the authorization-code flow store is configured (use /auth/authorize)" }, "401": { "description": "authentication failed" }, "409": { "description": "account conflicts with an existing user" }, "429": { "description": "password login temporarily locked after repeated failures (Retry-After header, retryAfter seconds)" }, "502": { "description": "identity provider unavailable" } }
       }
     },
     "/auth/refresh": {
-      "post": { "summary": "Refresh access token", "requestBody": { "content": { "application/json": { "schema": {"type":"object","properties":{"refresh_token":{"type":"string"}}}}}}, "responses": { "200": { "description": "new access token" }, "401": { "description": "invalid refresh" } } }
+      "post": { "summary": "Refresh access token (rotates the refresh token; body or gogotex_refresh cookie + X-CSRF-Token)", "requestBody": { "content": { "application/json": { "schema": {"type":"object","properties":{"refresh_token":{"type":"string"}}}}}}, "responses": { "200": { "description": "new access token and rotated refresh token; expires_in and refresh_expires_in (seconds) follow the session policy of the client and role" }, "401": { "description": "invalid, idle-expired or reused refresh token" } } }
     },
     "/auth/logout": {
-      "post": { "summary": "Logout and invalidate refresh token", "requestBody": { "content": { "application/json": { "schema": {"type":"object","properties":{"refresh_token":{"type":"string"}}}}}}, "responses": { "200": { "description": "logged out" } } }
+      "post": { "summary": "Logout and invalidate refresh token (body or gogotex_refresh cookie + X-CSRF-Token)", "requestBody": { "content": { "application/json": { "schema": {"type":"object","properties":{"refresh_token":{"type":"string"}}}}}}, "responses": { "200": { "description": "logged out; endSessionUrl (Keycloak end-session endpoint with id_token_hint) is returned when Keycloak is configured" } } }
+    },
+    "/auth/authorize": {
+      "get": { "summary": "Start authorization-code login (PKCE); redirects to Keycloak", "parameters": [{"name":"provider","in":"query","schema":{"type":"string"}},{"name":"return_to","in":"query","schema":{"type":"string"}}], "responses": { "302": { "description": "redirect to identity provider; sets the gogotex_auth_flow cookie" } } }
+    },
+    "/auth/callback": {
+      "get": { "summary": "Authorization-code callback; verifies state/nonce and issues tokens", "parameters": [{"name":"code","in":"query","schema":{"type":"string"}},{"name":"state","in":"query","schema":{"type":"string"}}], "responses": { "200": { "description": "tokens returned" }, "302": { "description": "redirect with tokens in fragment: to the frontend (AUTH_POST_LOGIN_REDIRECT, return_to in the fragment), or to return_to when it is an /auth/ page or no frontend is configured" }, "400": { "description": "invalid state, or state not started by this browser (gogotex_auth_flow cookie)" }, "409": { "description": "account conflicts with an existing user" } } }
+    },
+    "/auth/device/code": {
+      "post": { "summary": "Start a device login (RFC 8628)", "requestBody": { "content": { "application/x-www-form-urlencoded": { "schema": { "type": "object", "properties": { "client_id": {"type":"string"}, "scope": {"type":"string"} }, "required": ["client_id"] } } } }, "responses": { "200": { "description": "device_code, user_code and verification_uri" }, "401": { "description": "invalid_client" } } }
+    },
+    "/auth/device/token": {
+      "post": { "summary": "Poll for tokens after the user approved the device", "requestBody": { "content": { "application/x-www-form-urlencoded": { "schema": { "type": "object", "properties": { "grant_type": {"type":"string"}, "device_code": {"type":"string"}, "client_id": {"type":"string"} }, "required": ["grant_type","device_code","client_id"] } } } }, "responses": { "200": { "description": "access and refresh token" }, "400": { "description": "authorization_pending, slow_down, access_denied or expired_token" } } }
+    },
+    "/auth/device": {
+      "get": { "summary": "Verification page for entering a device user code", "parameters": [{"name":"user_code","in":"query","schema":{"type":"string"}}], "responses": { "200": { "description": "HTML page" } } }
+    },
+    "/auth/device/approve": {
+      "post": { "summary": "Approve or deny a device user code (requires Bearer token)", "requestBody": { "content": { "application/json": { "schema": { "type": "object", "properties": { "user_code": {"type":"string"}, "approve": {"type":"boolean"} }, "required": ["user_code"] } } } }, "responses": { "200": { "description": "approved or denied" }, "401": { "description": "unauthenticated" }, "403": { "description": "personal access token, guest, service or impersonation token" }, "404": { "description": "unknown or expired code" } } }
+    },
+    "/admin/lockouts/users/{username}": {
+      "delete": { "summary": "Clear failed password logins and the lockout of a username (admin role; audited)", "parameters": [ { "name": "username", "in": "path", "required": true, "schema": {"type":"string"} } ], "responses": { "204": { "description": "lockout cleared" }, "403": { "description": "not an admin" } } }
+    },
+    "/admin/lockouts/ips/{ip}": {
+      "delete": { "summary": "Clear failed password logins and the lockout of a client IP (admin role; audited)", "parameters": [ { "name": "ip", "in": "path", "required": true, "schema": {"type":"string"} } ], "responses": { "204": { "description": "lockout cleared" }, "400": { "description": "invalid IP address" }, "403": { "description": "not an admin" } } }
+    },
+    "/admin/impersonate/{sub}": {
+      "post": { "summary": "Impersonate a user (admin role; short-lived token with an RFC 8693 act claim, every use is audited)", "parameters": [ { "name": "sub", "in": "path", "required": true, "schema": {"type":"string"} } ], "responses": { "200": { "description": "accessToken, expiresIn and sub" }, "403": { "description": "not an admin, target is an admin, or already impersonating" }, "404": { "description": "user not found" } } }
+    },
+    "/auth/token": {
+      "post": { "summary": "Client-credentials token for an internal service (no user, no refresh token)", "requestBody": { "content": { "application/x-www-form-urlencoded": { "schema": { "type": "object", "properties": { "grant_type": {"type":"string","enum":["client_credentials"]}, "scope": {"type":"string"}, "client_id": {"type":"string"}, "client_secret": {"type":"string"} }, "required": ["grant_type"] } } } }, "responses": { "200": { "description": "access_token with client_id and scope claims" }, "400": { "description": "unsupported_grant_type or invalid_scope" }, "401": { "description": "invalid_client" } } }
+    },
+    "/auth/introspect": {
+      "post": { "summary": "Token introspection for internal services (RFC 7662, client credentials via HTTP Basic or form)", "requestBody": { "content": { "application/x-www-form-urlencoded": { "schema": { "type": "object", "properties": { "token": {"type":"string"}, "token_type_hint": {"type":"string"}, "client_id": {"type":"string"}, "client_secret": {"type":"string"} }, "required": ["token"] } } } }, "responses": { "200": { "description": "active flag plus sub, scope, exp and client_id when active" }, "401": { "description": "invalid_client" } } }
+    },
+    "/auth/revoke": {
+      "post": { "summary": "Revoke an access or refresh token (RFC 7009)", "requestBody": { "content": { "application/x-www-form-urlencoded": { "schema": { "type": "object", "properties": { "token": {"type":"string"}, "token_type_hint": {"type":"string","enum":["access_token","refresh_token"]} }, "required": ["token"] } } } }, "responses": { "200": { "description": "revoked (also returned for unknown tokens)" }, "401": { "description": "invalid client credentials" } } }
+    },
+    "/auth/backchannel-logout": {
+      "post": { "summary": "OIDC back-channel logout receiver (called by Keycloak)", "requestBody": { "content": { "application/x-www-form-urlencoded": { "schema": { "type": "object", "properties": { "logout_token": {"type":"string"} }, "required": ["logout_token"] } } } }, "responses": { "200": { "description": "sessions revoked; introspection reports the provider's access tokens of the ended session inactive" }, "400": { "description": "invalid or replayed logout token" } } }
     },
     "/api/v1/me": {
       "get": { "summary": "Get user info", "responses": { "200": { "description": "user or claims" } } }
     },
+    "/api/v1/tokens": {
+      "get": { "summary": "List personal access tokens of the current user", "responses": { "200": { "description": "token metadata (never the secret)" }, "401": { "description": "unauthenticated" } } },
+      "post": { "summary": "Create a personal access token (secret returned once)", "requestBody": { "content": { "application/json": { "schema": { "type": "object", "properties": { "name": {"type":"string"}, "scopes": {"type":"array","items":{"type":"string","enum":["projects:read","projects:write","compile","git"]}}, "expiresInDays": {"type":"integer"} }, "required": ["name","scopes"] } } } }, "responses": { "201": { "description": "token created" }, "400": { "description": "invalid name or scope" }, "403": { "description": "called with a personal access token" } } }
+    },
+    "/api/v1/tokens/{id}": {
+      "delete": { "summary": "Revoke a personal access token", "parameters": [{"name":"id","in":"path","required":true,"schema":{"type":"string"}}], "responses": { "204": { "description": "revoked" }, "404": { "description": "not found" } } }
+    },
+    "/api/v1/sessions": {
+      "get": { "summary": "List active sessions of the current user (created, last used, IP, user agent, device)", "responses": { "200": { "description": "sessions" }, "401": { "description": "unauthenticated" } } },
+      "delete": { "summary": "Sign out everywhere: end all sessions and invalidate previously issued access tokens", "responses": { "204": { "description": "signed out" }, "401": { "description": "unauthenticated" } } }
+    },
+    "/api/v1/sessions/{id}": {
+      "delete": { "summary": "Sign out a session remotely", "parameters": [{"name":"id","in":"path","required":true,"schema":{"type":"string"}}], "responses": { "204": { "description": "signed out" }, "404": { "description": "not found" } } }
+    },
+    "/api/v1/projects/{id}/share-links": {
+      "get": { "summary": "List the share links of a project (owner only)", "parameters": [{"name":"id","in":"path","required":true,"schema":{"type":"string"}}], "responses": { "200": { "description": "links (never the secret or password)" }, "403": { "description": "not the project owner" }, "404": { "description": "project not found" } } },
+      "post": { "summary": "Create a share link for people without an account (secret returned once)", "parameters": [{"name":"id","in":"path","required":true,"schema":{"type":"string"}}], "requestBody": { "content": { "application/json": { "schema": { "type": "object", "properties": { "role": {"type":"string","enum":["viewer","commenter"]}, "expiresInDays": {"type":"integer"}, "password": {"type":"string"} }, "required": ["role","expiresInDays"] } } } }, "responses": { "201": { "description": "token and link" }, "400": { "description": "invalid role, expiry or password" }, "403": { "description": "not the project owner, or a personal access or impersonation token" } } }
+    },
+    "/api/v1/projects/{id}/share-links/{linkId}": {
+      "delete": { "summary": "Revoke a share link; its guests lose access immediately", "parameters": [{"name":"id","in":"path","required":true,"schema":{"type":"string"}},{"name":"linkId","in":"path","required":true,"schema":{"type":"string"}}], "responses": { "204": { "description": "revoked" }, "404": { "description": "not found" } } }
+    },
+    "/api/v1/share-links/redeem": {
+      "post": { "summary": "Redeem a share link for a guest access token (no account needed)", "requestBody": { "content": { "application/json": { "schema": { "type": "object", "properties": { "token": {"type":"string"}, "password": {"type":"string"} }, "required": ["token"] } } } }, "responses": { "200": { "description": "accessToken, expiresIn, projectId and role" }, "401": { "description": "password required or wrong (passwordRequired: true)" }, "404": { "description": "share link not found or expired" } } }
+    },
+    "/api/v1/realtime/ticket": {
+      "post": { "summary": "Single-use WebSocket ticket for the realtime server, bound to one document (about 30 seconds)", "requestBody": { "content": { "application/json": { "schema": { "type": "object", "properties": { "documentId": {"type":"string"} }, "required": ["documentId"] } } } }, "responses": { "200": { "description": "ticket and expiresIn" }, "403": { "description": "no access to document" }, "404": { "description": "document not found" } } }
+    },
+    "/internal/realtime/redeem": {
+      "post": { "summary": "Redeem a realtime ticket (yjs server, client credentials via HTTP Basic)", "requestBody": { "content": { "application/json": { "schema": { "type": "object", "properties": { "ticket": {"type":"string"}, "documentId": {"type":"string"} }, "required": ["ticket","documentId"] } } } }, "responses": { "200": { "description": "sub, name, email, documentId and permission (read, write or owner)" }, "401": { "description": "invalid client or ticket" }, "403": { "description": "no longer has access to the document" } } }
+    },
+    "/.well-known/jwks.json": {
+      "get": { "summary": "Public keys for verifying access tokens (JWKS)", "responses": { "200": { "description": "JSON Web Key Set" } } }
+    },
     "/health": { "get": { "summary": "Liveness check", "responses": { "200": { "description": "healthy" } } } },
     "/ready": { "get": { "summary": "Readiness check", "responses": { "200": { "description": "ready" }, "503": { "description": "not ready" } } } }
   }
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/pats"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+)
+
+// TokensHandler manages personal access tokens of the signed-in user
+type TokensHandler struct {
+	svc *pats.Service
+}
+
+func NewTokensHandler(svc *pats.Service) *TokensHandler {
+	return &TokensHandler{svc: svc}
+}
+
+// createTokenRequest is the body of POST /api/v1/tokens
+type createTokenRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expiresInDays"` // 0 = no expiry
+}
+
+// Register routes under /tokens of the given (API) group; auth authenticates the caller.
+// - GET    /tokens      -> list tokens (metadata only)
+// - POST   /tokens      -> create a token; the secret is returned once
+// - DELETE /tokens/:id  -> revoke a token
+func (h *TokensHandler) Register(rg *gin.RouterGroup, auth gin.HandlerFunc) {
+	t := rg.Group("/tokens", auth, requireInteractiveLogin)
+	t.GET("", h.List)
+	t.POST("", h.Create)
+	t.DELETE("/:id", h.Revoke)
+}
+
+// requireInteractiveLogin keeps personal access tokens and impersonating staff from
+// managing the user's tokens and sessions and from creating credentials that
+// outlive them (device approvals, share links)
+func requireInteractiveLogin(c *gin.Context) {
+	if claimString(c, "token_type") == pats.TokenType {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed with a personal access token"})
+		return
+	}
+	if currentSubject(c) == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing subject"})
+		return
+	}
+	if p, ok := middleware.CurrentPrincipal(c); ok && p.IsImpersonated() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed while impersonating"})
+		return
+	}
+	c.Next()
+}
+
+// claimString returns a string claim set by AuthMiddleware
+func claimString(c *gin.Context, name string) string {
+	v, _ := c.Get("claims")
+	claims, _ := v.(map[string]interface{})
+	s, _ := claims[name].(string)
+	return s
+}
+
+// currentSubject returns the application subject of the caller, which for users of
+// secondary identity providers differs from the `sub` claim
+func currentSubject(c *gin.Context) string {
+	if p, ok := middleware.CurrentPrincipal(c); ok {
+		return p.Subject
+	}
+	return ""
+}
+
+func (h *TokensHandler) List(c *gin.Context) {
+	list, err := h.svc.List(c.Request.Context(), currentSubject(c))
+	if err != nil {
+		logger.Errorf("failed to list personal access tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": list})
+}
+
+func (h *TokensHandler) Create(c *gin.Context) {
+	var req createTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresInDays must not be negative"})
+		return
+	}
+	for _, s := range req.Scopes {
+		if !pats.ValidScope(s) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope", "details": s, "allowed": pats.AllScopes})
+			return
+		}
+	}
+	raw, tok, err := h.svc.Create(c.Request.Context(), currentSubject(c), req.Name, req.Scopes, time.Duration(req.ExpiresInDays)*24*time.Hour)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"token": raw, "pat": tok})
+}
+
+func (h *TokensHandler) Revoke(c *gin.Context) {
+	ok, err := h.svc.Revoke(c.Request.Context(), currentSubject(c), c.Param("id"))
+	if err != nil {
+		logger.Errorf("failed to revoke personal access token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/gogotex/gogotex/backend/go-services/internal/pats"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePatRepo is an in-memory pats.Repository
+type fakePatRepo struct {
+	byID map[string]*pats.Token
+}
+
+func (f *fakePatRepo) Create(ctx context.Context, t *pats.Token) error {
+	if f.byID == nil {
+		f.byID = map[string]*pats.Token{}
+	}
+	f.byID[t.ID] = t
+	return nil
+}
+
+func (f *fakePatRepo) GetByHash(ctx context.Context, hash string) (*pats.Token, error) {
+	for _, t := range f.byID {
+		if t.Hash == hash {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakePatRepo) ListBySub(ctx context.Context, sub string) ([]*pats.Token, error) {
+	out := []*pats.Token{}
+	for _, t := range f.byID {
+		if t.Sub == sub {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakePatRepo) DeleteByID(ctx context.Context, sub, id string) (bool, error) {
+	if t, ok := f.byID[id]; ok && t.Sub == sub {
+		delete(f.byID, id)
+		return true, nil
+	}
+	return false, nil
+}
+
+func (f *fakePatRepo) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	if t, ok := f.byID[id]; ok {
+		t.LastUsedAt = &at
+	}
+	return nil
+}
+
+func doJSON(r *gin.Engine, method, path, bearer, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestTokensHandler_Lifecycle(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "pat-test-secret-32-bytes-xxxxxxxxx"
+	svc := pats.NewService(&fakePatRepo{})
+	auth := middleware.AuthMiddleware(middleware.NewCompositeVerifier(tokens.NewVerifier(cfg), pats.NewVerifier(svc, nil)))
+
+	r := gin.New()
+	api := r.Group("/api/v1")
+	NewTokensHandler(svc).Register(api, auth)
+	api.GET("/whoami", auth, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"sub": claimString(c, "sub"), "scope": claimString(c, "scope")})
+	})
+
+	access, err := tokens.GenerateAccessToken(cfg, &models.User{Sub: "alice"}, time.Minute)
+	require.NoError(t, err)
+
+	w := doJSON(r, "POST", "/api/v1/tokens", access, `{"name":"ci","scopes":["projects:read","compile"],"expiresInDays":30}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created struct {
+		Token string     `json:"token"`
+		Pat   pats.Token `json:"pat"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.True(t, strings.HasPrefix(created.Token, pats.TokenPrefix))
+	require.NotNil(t, created.Pat.ExpiresAt)
+	require.NotContains(t, w.Body.String(), "tokenHash")
+
+	// the token authenticates API requests
+	w = doJSON(r, "GET", "/api/v1/whoami", created.Token, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Contains(t, w.Body.String(), `"sub":"alice"`)
+	require.Contains(t, w.Body.String(), `"scope":"projects:read compile"`)
+
+	// but cannot manage tokens
+	w = doJSON(r, "GET", "/api/v1/tokens", created.Token, "")
+	require.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doJSON(r, "GET", "/api/v1/tokens", access, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"name":"ci"`)
+	require.Contains(t, w.Body.String(), `"lastUsedAt"`)
+
+	w = doJSON(r, "DELETE", "/api/v1/tokens/"+created.Pat.ID, access, "")
+	require.Equal(t, http.StatusNoContent, w.Code)
+	w = doJSON(r, "DELETE", "/api/v1/tokens/"+created.Pat.ID, access, "")
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doJSON(r, "GET", "/api/v1/whoami", created.Token, "")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTokensHandler_RejectsUnknownScope(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "pat-test-secret-32-bytes-xxxxxxxxx"
+	svc := pats.NewService(&fakePatRepo{})
+	r := gin.New()
+	NewTokensHandler(svc).Register(r.Group("/api/v1"), middleware.AuthMiddleware(tokens.NewVerifier(cfg)))
+	access, _ := tokens.GenerateAccessToken(cfg, &models.User{Sub: "alice"}, time.Minute)
+
+	w := doJSON(r, "POST", "/api/v1/tokens", access, `{"name":"x","scopes":["admin"]}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "unknown scope")
+}
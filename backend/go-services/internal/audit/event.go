@@ -0,0 +1,25 @@
+package audit
+
+import "time"
+
+// Actions recorded in the audit log
+const (
+	ActionImpersonationStart   = "impersonation.start"
+	ActionImpersonationRequest = "impersonation.request"
+	ActionLockoutClear         = "lockout.clear"
+)
+
+// Event is one entry of the audit log. Actor is the user who acted, Subject the
+// user acted upon (for impersonation: the impersonated user).
+type Event struct {
+	ID       string    `bson:"_id,omitempty" json:"id"`
+	Time     time.Time `bson:"time" json:"time"`
+	Action   string    `bson:"action" json:"action"`
+	Actor    string    `bson:"actor" json:"actor"`
+	Subject  string    `bson:"subject,omitempty" json:"subject,omitempty"`
+	Method   string    `bson:"method,omitempty" json:"method,omitempty"`
+	Route    string    `bson:"route,omitempty" json:"route,omitempty"`
+	Path     string    `bson:"path,omitempty" json:"path,omitempty"`
+	Status   int       `bson:"status,omitempty" json:"status,omitempty"`
+	ClientIP string    `bson:"clientIp,omitempty" json:"clientIp,omitempty"`
+}
@@ -0,0 +1,26 @@
+package audit
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Repository stores audit events; the log is append-only
+type Repository interface {
+	Insert(ctx context.Context, e *Event) error
+}
+
+// MongoRepository implements Repository using a Mongo collection
+type MongoRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoRepository(col *mongo.Collection) *MongoRepository {
+	return &MongoRepository{col: col}
+}
+
+func (r *MongoRepository) Insert(ctx context.Context, e *Event) error {
+	_, err := r.col.InsertOne(ctx, e)
+	return err
+}
@@ -0,0 +1,113 @@
+package authflow
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Request is the server-side state of one authorization-code flow. It is created by
+// GET /auth/authorize and consumed exactly once by GET /auth/callback.
+type Request struct {
+	State        string    `json:"state"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"codeVerifier"`
+	RedirectURI  string    `json:"redirectUri"`
+	ReturnTo     string    `json:"returnTo,omitempty"`
+	Provider     string    `json:"provider,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// NewRequest creates a flow with fresh random state, nonce and PKCE code verifier.
+func NewRequest(redirectURI, returnTo string) (*Request, error) {
+	state, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomString(48)
+	if err != nil {
+		return nil, err
+	}
+	return &Request{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		RedirectURI:  redirectURI,
+		ReturnTo:     returnTo,
+		CreatedAt:    time.Now().UTC(),
+	}, nil
+}
+
+// CodeChallenge returns the S256 PKCE challenge for the request's code verifier.
+func (r *Request) CodeChallenge() string {
+	return S256Challenge(r.CodeVerifier)
+}
+
+// S256Challenge computes BASE64URL(SHA256(verifier)) as defined in RFC 7636.
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Store persists pending authorization requests keyed by state
+type Store interface {
+	Save(ctx context.Context, r *Request, ttl time.Duration) error
+	// Take returns and deletes the request for state; (nil, nil) when unknown or expired.
+	Take(ctx context.Context, state string) (*Request, error)
+}
+
+// RedisStore implements Store using Redis keys "authflow:<state>" with a TTL.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a Redis-backed store. Prefix may be empty.
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "authflow:"
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) Save(ctx context.Context, r *Request, ttl time.Duration) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.prefix+r.State, b, ttl).Err()
+}
+
+func (s *RedisStore) Take(ctx context.Context, state string) (*Request, error) {
+	// GETDEL makes the state single-use even under concurrent callbacks
+	b, err := s.client.GetDel(ctx, s.prefix+state).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var r Request
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// randomString returns n random bytes encoded as unpadded base64url
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,63 @@
+package authflow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS256Challenge_RFC7636Vector(t *testing.T) {
+	// Appendix B of RFC 7636
+	require.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", S256Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
+
+func TestNewRequest_RandomValues(t *testing.T) {
+	a, err := NewRequest("http://cb", "")
+	require.NoError(t, err)
+	b, err := NewRequest("http://cb", "")
+	require.NoError(t, err)
+	require.NotEqual(t, a.State, b.State)
+	require.NotEqual(t, a.Nonce, b.Nonce)
+	require.GreaterOrEqual(t, len(a.CodeVerifier), 43) // RFC 7636 minimum length
+}
+
+func TestRedisStore_TakeIsSingleUse(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), "")
+	ctx := context.Background()
+
+	r, err := NewRequest("http://cb", "/projects")
+	require.NoError(t, err)
+	require.NoError(t, store.Save(ctx, r, time.Minute))
+
+	got, err := store.Take(ctx, r.State)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	require.Equal(t, r.Nonce, got.Nonce)
+	require.Equal(t, "/projects", got.ReturnTo)
+
+	again, err := store.Take(ctx, r.State)
+	require.NoError(t, err)
+	require.Nil(t, again)
+}
+
+func TestRedisStore_Expires(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), "")
+	ctx := context.Background()
+
+	r, _ := NewRequest("http://cb", "")
+	require.NoError(t, store.Save(ctx, r, time.Second))
+	m.FastForward(2 * time.Second)
+	got, err := store.Take(ctx, r.State)
+	require.NoError(t, err)
+	require.Nil(t, got)
+}
@@ -0,0 +1,111 @@
+package clients
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// secretFilePrefix / secretFileSuffix name the per-client secret files written by
+// scripts/keycloak-setup.sh ("client-secret_<clientID>.txt"). scopesFilePrefix
+// names the optional "client-scopes_<clientID>.txt" file listing the scopes the
+// client may request with the client_credentials grant.
+const (
+	secretFilePrefix = "client-secret_"
+	secretFileSuffix = ".txt"
+	scopesFilePrefix = "client-scopes_"
+)
+
+// Client is a confidential client (internal service) allowed to call the
+// service-to-service auth endpoints.
+type Client struct {
+	ID     string
+	Secret string
+	// Scopes the client may request for its own tokens
+	Scopes []string
+}
+
+// AllowsScope reports whether the client may request scope
+func (c *Client) AllowsScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Registry holds the known confidential clients
+type Registry struct {
+	mu      sync.RWMutex
+	clients map[string]Client
+}
+
+// NewRegistry creates a registry containing clients
+func NewRegistry(clients ...Client) *Registry {
+	r := &Registry{clients: map[string]Client{}}
+	for _, c := range clients {
+		r.Add(c)
+	}
+	return r
+}
+
+// Add registers (or replaces) a client; clients without a secret are ignored.
+func (r *Registry) Add(c Client) {
+	if c.ID == "" || c.Secret == "" {
+		return
+	}
+	r.mu.Lock()
+	r.clients[c.ID] = c
+	r.mu.Unlock()
+}
+
+// LoadDir registers every "client-secret_<id>.txt" file found in dir, with the
+// whitespace-separated scopes of a matching "client-scopes_<id>.txt" file.
+func (r *Registry) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read client secrets dir: %w", err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, secretFilePrefix) || !strings.HasSuffix(name, secretFileSuffix) {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		id := strings.TrimSuffix(strings.TrimPrefix(name, secretFilePrefix), secretFileSuffix)
+		scopes, err := os.ReadFile(filepath.Join(dir, scopesFilePrefix+id+secretFileSuffix))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		r.Add(Client{ID: id, Secret: strings.TrimSpace(string(b)), Scopes: strings.Fields(string(scopes))})
+	}
+	return nil
+}
+
+// Len returns the number of registered clients
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.clients)
+}
+
+// Authenticate checks the client credentials in constant time.
+func (r *Registry) Authenticate(id, secret string) (*Client, bool) {
+	r.mu.RLock()
+	c, ok := r.clients[id]
+	r.mu.RUnlock()
+	if !ok || secret == "" {
+		return nil, false
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Secret), []byte(secret)) != 1 {
+		return nil, false
+	}
+	return &c, true
+}
@@ -0,0 +1,37 @@
+package clients
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_LoadDirAndAuthenticate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "client-secret_yjs-server.txt"), []byte("s3cret\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "client-secret_empty.txt"), []byte("\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "client-scopes_yjs-server.txt"), []byte("projects:read\nprojects:write\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o600))
+
+	r := NewRegistry(Client{ID: "static", Secret: "abc"})
+	require.NoError(t, r.LoadDir(dir))
+	require.Equal(t, 2, r.Len())
+
+	c, ok := r.Authenticate("yjs-server", "s3cret")
+	require.True(t, ok)
+	require.Equal(t, "yjs-server", c.ID)
+	require.Equal(t, []string{"projects:read", "projects:write"}, c.Scopes)
+	require.True(t, c.AllowsScope("projects:write"))
+	require.False(t, c.AllowsScope("compile"))
+
+	_, ok = r.Authenticate("yjs-server", "wrong")
+	require.False(t, ok)
+	_, ok = r.Authenticate("empty", "")
+	require.False(t, ok)
+	_, ok = r.Authenticate("unknown", "abc")
+	require.False(t, ok)
+	_, ok = r.Authenticate("static", "abc")
+	require.True(t, ok)
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strings"
 	"time"
 	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
 
@@ -15,8 +17,19 @@ type Config struct {
 	MongoDB   MongoDBConfig
 	Redis     RedisConfig
 	Keycloak  KeycloakConfig
+	// Providers are identity providers in addition to Keycloak (see IdentityProviders)
+	Providers []ProviderConfig
 	JWT       JWTConfig
 	RateLimit RateLimitConfig
+	Cookies   CookieConfig
+	Device    DeviceConfig
+	Clients   ClientsConfig
+	Outbound  OutboundHTTPConfig
+	Authz     AuthzConfig
+	Realtime  RealtimeConfig
+	Sharing   SharingConfig
+	Notify    NotifyConfig
+	Lockout   LockoutConfig
 }
 
 type ServerConfig struct {
@@ -25,6 +38,10 @@ type ServerConfig struct {
 	Environment  string
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+	// TrustedProxies are the addresses or CIDR ranges of the reverse proxies whose
+	// X-Forwarded-For header is believed (SERVER_TRUSTED_PROXIES, comma-separated).
+	// Empty trusts none: the client IP is the peer address.
+	TrustedProxies []string
 }
 
 type MongoDBConfig struct {
@@ -40,17 +57,189 @@ type RedisConfig struct {
 	DB       int
 }
 
+// KeycloakConfig describes the upstream identity provider.
+// - RedirectURI: this service's /auth/callback URL registered with Keycloak
+// - PostLoginRedirect: where /auth/callback sends the browser after login (tokens in
+//   the URL fragment); when empty the callback sends it to return_to, or responds
+//   with JSON without one
+// - PostLogoutRedirect: post_logout_redirect_uri passed to Keycloak's end-session
+//   endpoint on logout (must be registered as a valid post-logout redirect URI)
 type KeycloakConfig struct {
+	URL               string
+	Realm             string
+	ClientID          string
+	ClientSecret      string
+	RedirectURI       string
+	PostLoginRedirect  string
+	PostLogoutRedirect string
+}
+
+// PrimaryProviderName names the provider described by KeycloakConfig
+const PrimaryProviderName = "keycloak"
+
+// ProviderConfig describes one OpenID Connect identity provider users can log in with.
+// Keycloak realms set URL and Realm; other OIDC providers set Issuer and have their
+// endpoints discovered.
+type ProviderConfig struct {
+	Name         string
 	URL          string
 	Realm        string
+	Issuer       string
 	ClientID     string
 	ClientSecret string
+	RedirectURI  string
+}
+
+// IsKeycloak reports whether the provider is a Keycloak realm
+func (p ProviderConfig) IsKeycloak() bool { return p.Realm != "" }
+
+// IssuerURL returns the issuer identifier tokens of the provider carry in `iss`
+func (p ProviderConfig) IssuerURL() string {
+	if p.Issuer != "" {
+		return p.Issuer
+	}
+	if p.Realm == "" {
+		// older deployments put the realm path into KEYCLOAK_URL
+		return p.URL
+	}
+	return strings.TrimRight(p.URL, "/") + "/realms/" + p.Realm
+}
+
+// IdentityProviders returns every configured provider. The Keycloak block, when
+// set, comes first as the primary provider named PrimaryProviderName.
+func (c *Config) IdentityProviders() []ProviderConfig {
+	var out []ProviderConfig
+	if c.Keycloak.URL != "" {
+		out = append(out, ProviderConfig{
+			Name:         PrimaryProviderName,
+			URL:          c.Keycloak.URL,
+			Realm:        c.Keycloak.Realm,
+			ClientID:     c.Keycloak.ClientID,
+			ClientSecret: c.Keycloak.ClientSecret,
+			RedirectURI:  c.Keycloak.RedirectURI,
+		})
+	}
+	return append(out, c.Providers...)
+}
+
+// Provider returns the provider called name; an empty name selects the primary one
+func (c *Config) Provider(name string) (ProviderConfig, bool) {
+	all := c.IdentityProviders()
+	if name == "" && len(all) > 0 {
+		return all[0], true
+	}
+	for _, p := range all {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return ProviderConfig{}, false
+}
+
+// ProviderByIssuer returns the provider whose tokens carry iss
+func (c *Config) ProviderByIssuer(iss string) (ProviderConfig, bool) {
+	for _, p := range c.IdentityProviders() {
+		if p.IssuerURL() == iss {
+			return p, true
+		}
+	}
+	return ProviderConfig{}, false
 }
 
+// JWTConfig controls how first-party access tokens are signed.
+// - Algorithm: HS256 (shared Secret) or RS256/EdDSA (asymmetric keys, published via JWKS);
+// LoadConfig rejects any other value
+// - KeysDir: directory holding PEM signing keys; generated keys are stored here. Replicas
+// may share it: one at a time rotates (lock file .rotate.lock) and the others reload it
+// - KeyRotationInterval: how often a new signing key is generated (0 disables rotation)
+// - Issuer / Audience: `iss` and `aud` claims written to and required on access tokens
+// - AccessTokenTTL: lifetime of access tokens
+// - RefreshTokenTTL: absolute lifetime of a refresh session, counted from login
+// - SessionIdleTimeout: a session ends when it has not been refreshed for this long
+//   (0 disables the idle timeout)
+// - SessionPolicies: overrides of the three lifetimes per client or role
 type JWTConfig struct {
-	Secret          string
-	AccessTokenTTL  time.Duration
-	RefreshTokenTTL time.Duration
+	Secret              string
+	AccessTokenTTL      time.Duration
+	RefreshTokenTTL     time.Duration
+	SessionIdleTimeout  time.Duration
+	SessionPolicies     []SessionPolicy
+	Algorithm           string
+	KeysDir             string
+	KeyRotationInterval time.Duration
+	Issuer              string
+	Audience            string
+}
+
+// SessionPolicy overrides token and session lifetimes for the logins of one client
+// (ClientID) or of users with one role (Role). Zero durations keep the defaults.
+type SessionPolicy struct {
+	Name           string
+	ClientID       string
+	Role           string
+	AccessTokenTTL time.Duration
+	IdleTimeout    time.Duration
+	MaxLifetime    time.Duration
+}
+
+// matches reports whether the policy applies to a login through clientID by a user
+// with roles
+func (p SessionPolicy) matches(clientID string, roles []string) bool {
+	if p.ClientID != "" && p.ClientID != clientID {
+		return false
+	}
+	if p.Role != "" {
+		for _, r := range roles {
+			if r == p.Role {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// SessionLifetimes returns the access-token TTL, idle timeout and absolute lifetime
+// for a login through clientID by a user with roles: the JWT defaults, overridden by
+// every matching policy in the order they are configured (later ones win).
+func (c *Config) SessionLifetimes(clientID string, roles []string) SessionPolicy {
+	out := SessionPolicy{
+		AccessTokenTTL: c.JWT.AccessTokenTTL,
+		IdleTimeout:    c.JWT.SessionIdleTimeout,
+		MaxLifetime:    c.JWT.RefreshTokenTTL,
+	}
+	for _, p := range c.JWT.SessionPolicies {
+		if !p.matches(clientID, roles) {
+			continue
+		}
+		if p.AccessTokenTTL > 0 {
+			out.AccessTokenTTL = p.AccessTokenTTL
+		}
+		if p.IdleTimeout > 0 {
+			out.IdleTimeout = p.IdleTimeout
+		}
+		if p.MaxLifetime > 0 {
+			out.MaxLifetime = p.MaxLifetime
+		}
+	}
+	return out
+}
+
+// LongestTokenTTL returns the longest lifetime of any token this service signs, i.e.
+// how long a retired signing key must stay published
+func (c *Config) LongestTokenTTL() time.Duration {
+	longest := c.JWT.AccessTokenTTL
+	for _, d := range []time.Duration{c.Clients.TokenTTL, c.Authz.ImpersonationTTL, c.Sharing.GuestTokenTTL} {
+		if d > longest {
+			longest = d
+		}
+	}
+	for _, p := range c.JWT.SessionPolicies {
+		if p.AccessTokenTTL > longest {
+			longest = p.AccessTokenTTL
+		}
+	}
+	return longest
 }
 
 // RateLimitConfig controls the global in-memory rate limiter used by the auth service.
@@ -65,6 +254,111 @@ type RateLimitConfig struct {
 	WindowSeconds int // window size in seconds for Redis fixed-window counter
 }
 
+// CookieConfig controls browser cookie mode for the auth endpoints.
+// - Enabled: refresh tokens are set as HttpOnly cookies (scoped to /auth) instead of
+//   being returned in JSON bodies; a double-submit CSRF cookie accompanies them
+// - Secure / SameSite / Domain: cookie attributes (SameSite: strict|lax|none)
+type CookieConfig struct {
+	Enabled  bool
+	Secure   bool
+	SameSite string
+	Domain   string
+}
+
+// DeviceConfig controls the OAuth 2.0 device authorization grant (RFC 8628).
+// - ClientIDs: public clients (CLI, editor plugins) allowed to start a device login
+// - VerificationURI: page shown to users for entering the code; defaults to
+//   /auth/device on the requesting host
+// - CodeTTL / PollInterval: lifetime of a device code and minimum polling interval
+type DeviceConfig struct {
+	ClientIDs       []string
+	VerificationURI string
+	CodeTTL         time.Duration
+	PollInterval    time.Duration
+}
+
+// ClientsConfig lists the confidential clients (internal services) that may call
+// service-to-service endpoints such as /auth/introspect or obtain their own tokens
+// with the client_credentials grant.
+// - SecretsDir: directory with one "client-secret_<clientID>.txt" file per client
+// - TokenTTL: lifetime of client-credentials access tokens
+type ClientsConfig struct {
+	SecretsDir string
+	TokenTTL   time.Duration
+}
+
+// OutboundHTTPConfig controls the HTTP client used for calls to identity providers.
+// - Timeout: per-attempt timeout
+// - Retries: retries of idempotent requests on transport errors and 502/503/504
+// - BreakerThreshold / BreakerCooldown: consecutive failures that open the circuit
+//   breaker and how long it stays open (threshold 0 disables it)
+// - CAFile: extra PEM CA bundle, e.g. for an internal Keycloak
+// - CertFile / KeyFile: optional client certificate for mutual TLS
+type OutboundHTTPConfig struct {
+	Timeout          time.Duration
+	Retries          int
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	CAFile           string
+	CertFile         string
+	KeyFile          string
+}
+
+// AuthzConfig names the token claims roles, groups and scopes are read from
+// (dot-separated paths, see middleware.ClaimMapping). Empty lists use the default
+// Keycloak mapping for KEYCLOAK_CLIENT_ID.
+// - AdminRole: role required for the /admin endpoints
+// - ImpersonationTTL: lifetime of the tokens issued by /admin/impersonate
+type AuthzConfig struct {
+	RoleClaims       []string
+	GroupClaims      []string
+	ScopeClaims      []string
+	AdminRole        string
+	ImpersonationTTL time.Duration
+}
+
+// RealtimeConfig controls the connection tickets of the realtime (yjs) server.
+// - TicketTTL: how long a ticket may wait to be redeemed
+type RealtimeConfig struct {
+	TicketTTL time.Duration
+}
+
+// SharingConfig controls project share links.
+// - GuestTokenTTL: lifetime of the guest access tokens issued when a link is
+//   redeemed (never beyond the link's own expiry)
+type SharingConfig struct {
+	GuestTokenTTL time.Duration
+}
+
+// NotifyConfig controls user notifications (new sign-in alerts).
+// - NewDeviceAlerts: notify users when they sign in from a device not seen before
+// - SMTPHost / SMTPPort: mail server delivering notifications; without a host they
+//   are only logged
+// - SMTPUsername / SMTPPassword: optional SMTP credentials (PLAIN auth)
+// - MailFrom: sender address of notification mails
+type NotifyConfig struct {
+	NewDeviceAlerts bool
+	SMTPHost        string
+	SMTPPort        int
+	SMTPUsername    string
+	SMTPPassword    string
+	MailFrom        string
+}
+
+// LockoutConfig controls the brute-force protection of password-mode logins
+// (requires Redis).
+// - UserThreshold / IPThreshold: failed logins before a username / client IP is
+//   temporarily locked
+// - BaseDelay / MaxDelay: first lock, doubled with every further failure up to MaxDelay
+// - Window: failures are forgotten after this long without another one
+type LockoutConfig struct {
+	UserThreshold int
+	IPThreshold   int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	Window        time.Duration
+}
+
 // LoadConfig loads configuration from environment variables and .env file
 func LoadConfig() (*Config, error) {
 	_ = godotenv.Load("gogotex-support-services/.env")
@@ -77,6 +371,11 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("MONGODB_TIMEOUT", 10)
 	viper.SetDefault("JWT_ACCESS_TOKEN_TTL", 15)
 	viper.SetDefault("JWT_REFRESH_TOKEN_TTL", 10080)
+	viper.SetDefault("JWT_SESSION_IDLE_TIMEOUT", 4320)
+	viper.SetDefault("JWT_SIGNING_ALG", "HS256")
+	viper.SetDefault("JWT_KEY_ROTATION_HOURS", 0)
+	viper.SetDefault("JWT_ISSUER", "gogotex-auth")
+	viper.SetDefault("JWT_AUDIENCE", "gogotex")
 
 	// Rate limiting defaults
 	viper.SetDefault("RATE_LIMIT_ENABLED", true)
@@ -85,6 +384,34 @@ func LoadConfig() (*Config, error) {
 	// Redis-backed rate limiter defaults
 	viper.SetDefault("RATE_LIMIT_USE_REDIS", false)
 	viper.SetDefault("RATE_LIMIT_WINDOW_SECONDS", 1)
+	// Cookie mode defaults
+	viper.SetDefault("AUTH_COOKIE_MODE", false)
+	viper.SetDefault("AUTH_COOKIE_SECURE", true)
+	viper.SetDefault("AUTH_COOKIE_SAMESITE", "strict")
+	// Device authorization grant defaults
+	viper.SetDefault("AUTH_DEVICE_CLIENT_IDS", "gogotex-cli")
+	viper.SetDefault("AUTH_DEVICE_CODE_TTL", 600)
+	viper.SetDefault("AUTH_DEVICE_POLL_INTERVAL", 5)
+	viper.SetDefault("AUTH_CLIENT_TOKEN_TTL", 300)
+	viper.SetDefault("AUTH_ADMIN_ROLE", "admin")
+	viper.SetDefault("AUTH_IMPERSONATION_TTL", 600)
+	viper.SetDefault("AUTH_REALTIME_TICKET_TTL", 30)
+	viper.SetDefault("AUTH_GUEST_TOKEN_TTL", 3600)
+	// notifications
+	viper.SetDefault("AUTH_NEW_DEVICE_ALERTS", true)
+	viper.SetDefault("AUTH_SMTP_PORT", 587)
+	viper.SetDefault("AUTH_MAIL_FROM", "gogotex <no-reply@gogotex.local>")
+	// password-login lockout
+	viper.SetDefault("AUTH_LOCKOUT_USER_THRESHOLD", 5)
+	viper.SetDefault("AUTH_LOCKOUT_IP_THRESHOLD", 20)
+	viper.SetDefault("AUTH_LOCKOUT_BASE_DELAY", 30)
+	viper.SetDefault("AUTH_LOCKOUT_MAX_DELAY", 900)
+	viper.SetDefault("AUTH_LOCKOUT_WINDOW", 900)
+	// outbound calls to identity providers
+	viper.SetDefault("OUTBOUND_HTTP_TIMEOUT", 10)
+	viper.SetDefault("OUTBOUND_HTTP_RETRIES", 2)
+	viper.SetDefault("OUTBOUND_HTTP_BREAKER_THRESHOLD", 5)
+	viper.SetDefault("OUTBOUND_HTTP_BREAKER_COOLDOWN", 30)
 
 	cfg := &Config{
 		Server: ServerConfig{
@@ -93,6 +420,7 @@ func LoadConfig() (*Config, error) {
 			Environment:  viper.GetString("SERVER_ENVIRONMENT"),
 			ReadTimeout:  30 * time.Second,
 			WriteTimeout: 30 * time.Second,
+			TrustedProxies: splitList(viper.GetString("SERVER_TRUSTED_PROXIES")),
 		},
 		MongoDB: MongoDBConfig{
 			URI:      getEnvOrPanic("MONGODB_URI"),
@@ -106,15 +434,24 @@ func LoadConfig() (*Config, error) {
 			DB:       0,
 		},
 		Keycloak: KeycloakConfig{
-			URL:          viper.GetString("KEYCLOAK_URL"),
-			Realm:        viper.GetString("KEYCLOAK_REALM"),
-			ClientID:     viper.GetString("KEYCLOAK_CLIENT_ID"),
-			ClientSecret: viper.GetString("KEYCLOAK_CLIENT_SECRET"),
+			URL:                viper.GetString("KEYCLOAK_URL"),
+			Realm:              viper.GetString("KEYCLOAK_REALM"),
+			ClientID:           viper.GetString("KEYCLOAK_CLIENT_ID"),
+			ClientSecret:       viper.GetString("KEYCLOAK_CLIENT_SECRET"),
+			RedirectURI:        viper.GetString("KEYCLOAK_REDIRECT_URI"),
+			PostLoginRedirect:  viper.GetString("AUTH_POST_LOGIN_REDIRECT"),
+			PostLogoutRedirect: viper.GetString("AUTH_POST_LOGOUT_REDIRECT"),
 		},
 		JWT: JWTConfig{
-			Secret:          os.Getenv("JWT_SECRET"),
-			AccessTokenTTL:  time.Duration(viper.GetInt("JWT_ACCESS_TOKEN_TTL")) * time.Minute,
-			RefreshTokenTTL: time.Duration(viper.GetInt("JWT_REFRESH_TOKEN_TTL")) * time.Minute,
+			Secret:              os.Getenv("JWT_SECRET"),
+			AccessTokenTTL:      time.Duration(viper.GetInt("JWT_ACCESS_TOKEN_TTL")) * time.Minute,
+			RefreshTokenTTL:     time.Duration(viper.GetInt("JWT_REFRESH_TOKEN_TTL")) * time.Minute,
+			SessionIdleTimeout:  time.Duration(viper.GetInt("JWT_SESSION_IDLE_TIMEOUT")) * time.Minute,
+			Algorithm:           viper.GetString("JWT_SIGNING_ALG"),
+			KeysDir:             viper.GetString("JWT_KEYS_DIR"),
+			KeyRotationInterval: time.Duration(viper.GetInt("JWT_KEY_ROTATION_HOURS")) * time.Hour,
+			Issuer:              viper.GetString("JWT_ISSUER"),
+			Audience:            viper.GetString("JWT_AUDIENCE"),
 		},
 		RateLimit: RateLimitConfig{
 			Enabled:       viper.GetBool("RATE_LIMIT_ENABLED"),
@@ -123,16 +460,142 @@ func LoadConfig() (*Config, error) {
 			UseRedis:      viper.GetBool("RATE_LIMIT_USE_REDIS"),
 			WindowSeconds: viper.GetInt("RATE_LIMIT_WINDOW_SECONDS"),
 		},
+		Cookies: CookieConfig{
+			Enabled:  viper.GetBool("AUTH_COOKIE_MODE"),
+			Secure:   viper.GetBool("AUTH_COOKIE_SECURE"),
+			SameSite: viper.GetString("AUTH_COOKIE_SAMESITE"),
+			Domain:   viper.GetString("AUTH_COOKIE_DOMAIN"),
+		},
+		Device: DeviceConfig{
+			ClientIDs:       splitList(viper.GetString("AUTH_DEVICE_CLIENT_IDS")),
+			VerificationURI: viper.GetString("AUTH_DEVICE_VERIFICATION_URI"),
+			CodeTTL:         time.Duration(viper.GetInt("AUTH_DEVICE_CODE_TTL")) * time.Second,
+			PollInterval:    time.Duration(viper.GetInt("AUTH_DEVICE_POLL_INTERVAL")) * time.Second,
+		},
+		Clients: ClientsConfig{
+			SecretsDir: viper.GetString("AUTH_CLIENT_SECRETS_DIR"),
+			TokenTTL:   time.Duration(viper.GetInt("AUTH_CLIENT_TOKEN_TTL")) * time.Second,
+		},
+		Authz: AuthzConfig{
+			RoleClaims:       splitList(viper.GetString("AUTH_ROLE_CLAIMS")),
+			GroupClaims:      splitList(viper.GetString("AUTH_GROUP_CLAIMS")),
+			ScopeClaims:      splitList(viper.GetString("AUTH_SCOPE_CLAIMS")),
+			AdminRole:        viper.GetString("AUTH_ADMIN_ROLE"),
+			ImpersonationTTL: time.Duration(viper.GetInt("AUTH_IMPERSONATION_TTL")) * time.Second,
+		},
+		Realtime: RealtimeConfig{
+			TicketTTL: time.Duration(viper.GetInt("AUTH_REALTIME_TICKET_TTL")) * time.Second,
+		},
+		Sharing: SharingConfig{
+			GuestTokenTTL: time.Duration(viper.GetInt("AUTH_GUEST_TOKEN_TTL")) * time.Second,
+		},
+		Notify: NotifyConfig{
+			NewDeviceAlerts: viper.GetBool("AUTH_NEW_DEVICE_ALERTS"),
+			SMTPHost:        viper.GetString("AUTH_SMTP_HOST"),
+			SMTPPort:        viper.GetInt("AUTH_SMTP_PORT"),
+			SMTPUsername:    viper.GetString("AUTH_SMTP_USERNAME"),
+			SMTPPassword:    viper.GetString("AUTH_SMTP_PASSWORD"),
+			MailFrom:        viper.GetString("AUTH_MAIL_FROM"),
+		},
+		Lockout: LockoutConfig{
+			UserThreshold: viper.GetInt("AUTH_LOCKOUT_USER_THRESHOLD"),
+			IPThreshold:   viper.GetInt("AUTH_LOCKOUT_IP_THRESHOLD"),
+			BaseDelay:     time.Duration(viper.GetInt("AUTH_LOCKOUT_BASE_DELAY")) * time.Second,
+			MaxDelay:      time.Duration(viper.GetInt("AUTH_LOCKOUT_MAX_DELAY")) * time.Second,
+			Window:        time.Duration(viper.GetInt("AUTH_LOCKOUT_WINDOW")) * time.Second,
+		},
+		Outbound: OutboundHTTPConfig{
+			Timeout:          time.Duration(viper.GetInt("OUTBOUND_HTTP_TIMEOUT")) * time.Second,
+			Retries:          viper.GetInt("OUTBOUND_HTTP_RETRIES"),
+			BreakerThreshold: viper.GetInt("OUTBOUND_HTTP_BREAKER_THRESHOLD"),
+			BreakerCooldown:  time.Duration(viper.GetInt("OUTBOUND_HTTP_BREAKER_COOLDOWN")) * time.Second,
+			CAFile:           viper.GetString("KEYCLOAK_CA_FILE"),
+			CertFile:         viper.GetString("KEYCLOAK_CLIENT_CERT_FILE"),
+			KeyFile:          viper.GetString("KEYCLOAK_CLIENT_KEY_FILE"),
+		},
 	}
+	cfg.Providers = loadProviders(viper.GetString("AUTH_PROVIDERS"), cfg.Keycloak.RedirectURI)
+	cfg.JWT.SessionPolicies = loadSessionPolicies(viper.GetString("AUTH_SESSION_POLICIES"))
 
 	// Basic validation
-	if cfg.JWT.Secret == "" {
+	switch cfg.JWT.Algorithm {
+	case "HS256", "RS256", "EdDSA":
+	default:
+		// a typo must not silently fall back to the shared-secret algorithm
+		return nil, fmt.Errorf("unsupported JWT_SIGNING_ALG %q (want HS256, RS256 or EdDSA)", cfg.JWT.Algorithm)
+	}
+	if cfg.JWT.Secret == "" && cfg.JWT.Algorithm == "HS256" {
 		logger.Warn("JWT_SECRET is not set; set a secure value in production")
 	}
 
 	return cfg, nil
 }
 
+// loadProviders reads the additional identity providers listed in AUTH_PROVIDERS
+// (comma-separated names). Each provider is configured through
+// AUTH_PROVIDER_<NAME>_{URL,REALM,ISSUER,CLIENT_ID,CLIENT_SECRET,REDIRECT_URI};
+// the redirect URI defaults to KEYCLOAK_REDIRECT_URI.
+func loadProviders(names, defaultRedirect string) []ProviderConfig {
+	var out []ProviderConfig
+	for _, name := range splitList(names) {
+		env := "AUTH_PROVIDER_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		p := ProviderConfig{
+			Name:         name,
+			URL:          viper.GetString(env + "URL"),
+			Realm:        viper.GetString(env + "REALM"),
+			Issuer:       viper.GetString(env + "ISSUER"),
+			ClientID:     viper.GetString(env + "CLIENT_ID"),
+			ClientSecret: os.Getenv(env + "CLIENT_SECRET"),
+			RedirectURI:  viper.GetString(env + "REDIRECT_URI"),
+		}
+		if p.RedirectURI == "" {
+			p.RedirectURI = defaultRedirect
+		}
+		if p.IssuerURL() == "" || p.ClientID == "" {
+			logger.Warnf("identity provider %q is missing an issuer or client id; skipping", name)
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// loadSessionPolicies reads the session policies listed in AUTH_SESSION_POLICIES
+// (comma-separated names). Each policy is configured through
+// AUTH_SESSION_POLICY_<NAME>_{CLIENT_ID,ROLE} (what it applies to) and
+// AUTH_SESSION_POLICY_<NAME>_{ACCESS_TOKEN_TTL,IDLE_TIMEOUT,MAX_LIFETIME} (minutes).
+func loadSessionPolicies(names string) []SessionPolicy {
+	var out []SessionPolicy
+	for _, name := range splitList(names) {
+		env := "AUTH_SESSION_POLICY_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		p := SessionPolicy{
+			Name:           name,
+			ClientID:       viper.GetString(env + "CLIENT_ID"),
+			Role:           viper.GetString(env + "ROLE"),
+			AccessTokenTTL: time.Duration(viper.GetInt(env+"ACCESS_TOKEN_TTL")) * time.Minute,
+			IdleTimeout:    time.Duration(viper.GetInt(env+"IDLE_TIMEOUT")) * time.Minute,
+			MaxLifetime:    time.Duration(viper.GetInt(env+"MAX_LIFETIME")) * time.Minute,
+		}
+		if p.ClientID == "" && p.Role == "" {
+			logger.Warnf("session policy %q names neither a client nor a role; skipping", name)
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// splitList parses a comma-separated environment value, dropping empty entries
+func splitList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
 func getEnvOrPanic(key string) string {
 	v := os.Getenv(key)
 	if v == "" {
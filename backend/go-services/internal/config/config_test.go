@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -28,4 +29,123 @@ func TestLoadConfig(t *testing.T) {
 	if !cfg.RateLimit.Enabled || cfg.RateLimit.RPS != 7 || cfg.RateLimit.Burst != 12 {
 		t.Fatalf("rate limit not loaded correctly: %+v", cfg.RateLimit)
 	}
+	if !cfg.Notify.NewDeviceAlerts || cfg.Notify.SMTPHost != "" || cfg.Notify.SMTPPort != 587 {
+		t.Fatalf("unexpected notification defaults: %+v", cfg.Notify)
+	}
+	if len(cfg.Server.TrustedProxies) != 0 {
+		t.Fatalf("no proxy may be trusted by default: %v", cfg.Server.TrustedProxies)
+	}
+
+	os.Setenv("SERVER_TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.2")
+	defer os.Unsetenv("SERVER_TRUSTED_PROXIES")
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if got := cfg.Server.TrustedProxies; len(got) != 2 || got[0] != "10.0.0.0/8" || got[1] != "192.168.1.2" {
+		t.Fatalf("unexpected trusted proxies: %v", got)
+	}
+}
+
+func TestLoadConfig_SigningAlgorithm(t *testing.T) {
+	os.Setenv("MONGODB_URI", "mongodb://localhost:27017/testdb")
+	defer os.Unsetenv("JWT_SIGNING_ALG")
+	for _, alg := range []string{"HS256", "RS256", "EdDSA"} {
+		os.Setenv("JWT_SIGNING_ALG", alg)
+		cfg, err := LoadConfig()
+		if err != nil || cfg.JWT.Algorithm != alg {
+			t.Fatalf("LoadConfig(%s): %+v, %v", alg, cfg, err)
+		}
+	}
+	for _, alg := range []string{"RSA256", "hs256", "none"} {
+		os.Setenv("JWT_SIGNING_ALG", alg)
+		if _, err := LoadConfig(); err == nil {
+			t.Fatalf("JWT_SIGNING_ALG=%s must be rejected", alg)
+		}
+	}
+}
+
+func TestLoadConfig_Providers(t *testing.T) {
+	os.Setenv("MONGODB_URI", "mongodb://localhost:27017/testdb")
+	os.Setenv("KEYCLOAK_URL", "http://kc.local/")
+	os.Setenv("KEYCLOAK_REALM", "university")
+	os.Setenv("KEYCLOAK_CLIENT_ID", "gogotex")
+	os.Setenv("KEYCLOAK_REDIRECT_URI", "http://auth.local/auth/callback")
+	os.Setenv("AUTH_PROVIDERS", "guest, partner-idp, broken")
+	os.Setenv("AUTH_PROVIDER_GUEST_URL", "http://kc.local")
+	os.Setenv("AUTH_PROVIDER_GUEST_REALM", "guests")
+	os.Setenv("AUTH_PROVIDER_GUEST_CLIENT_ID", "gogotex-guest")
+	os.Setenv("AUTH_PROVIDER_PARTNER_IDP_ISSUER", "https://idp.partner.example")
+	os.Setenv("AUTH_PROVIDER_PARTNER_IDP_CLIENT_ID", "gogotex")
+	defer func() {
+		for _, k := range []string{"KEYCLOAK_URL", "KEYCLOAK_REALM", "KEYCLOAK_CLIENT_ID", "KEYCLOAK_REDIRECT_URI", "AUTH_PROVIDERS",
+			"AUTH_PROVIDER_GUEST_URL", "AUTH_PROVIDER_GUEST_REALM", "AUTH_PROVIDER_GUEST_CLIENT_ID",
+			"AUTH_PROVIDER_PARTNER_IDP_ISSUER", "AUTH_PROVIDER_PARTNER_IDP_CLIENT_ID"} {
+			os.Unsetenv(k)
+		}
+	}()
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	all := cfg.IdentityProviders()
+	if len(all) != 3 {
+		t.Fatalf("expected keycloak, guest and partner-idp, got %+v", all)
+	}
+	if p, _ := cfg.Provider(""); p.Name != PrimaryProviderName || p.IssuerURL() != "http://kc.local/realms/university" {
+		t.Fatalf("unexpected primary provider: %+v", p)
+	}
+	guest, ok := cfg.Provider("guest")
+	if !ok || guest.IssuerURL() != "http://kc.local/realms/guests" || guest.RedirectURI != "http://auth.local/auth/callback" {
+		t.Fatalf("unexpected guest provider: %+v", guest)
+	}
+	if p, ok := cfg.ProviderByIssuer("https://idp.partner.example"); !ok || p.Name != "partner-idp" || p.IsKeycloak() {
+		t.Fatalf("unexpected partner provider: %+v", p)
+	}
+	if _, ok := cfg.Provider("broken"); ok {
+		t.Fatal("incomplete provider should be skipped")
+	}
+}
+
+func TestLoadConfig_SessionPolicies(t *testing.T) {
+	os.Setenv("MONGODB_URI", "mongodb://localhost:27017/testdb")
+	os.Setenv("AUTH_SESSION_POLICIES", "cli, admins, broken")
+	os.Setenv("AUTH_SESSION_POLICY_CLI_CLIENT_ID", "gogotex-cli")
+	os.Setenv("AUTH_SESSION_POLICY_CLI_IDLE_TIMEOUT", "43200")
+	os.Setenv("AUTH_SESSION_POLICY_CLI_MAX_LIFETIME", "129600")
+	os.Setenv("AUTH_SESSION_POLICY_ADMINS_ROLE", "admin")
+	os.Setenv("AUTH_SESSION_POLICY_ADMINS_ACCESS_TOKEN_TTL", "5")
+	os.Setenv("AUTH_SESSION_POLICY_ADMINS_IDLE_TIMEOUT", "60")
+	defer func() {
+		for _, k := range []string{"AUTH_SESSION_POLICIES", "AUTH_SESSION_POLICY_CLI_CLIENT_ID", "AUTH_SESSION_POLICY_CLI_IDLE_TIMEOUT",
+			"AUTH_SESSION_POLICY_CLI_MAX_LIFETIME", "AUTH_SESSION_POLICY_ADMINS_ROLE", "AUTH_SESSION_POLICY_ADMINS_ACCESS_TOKEN_TTL",
+			"AUTH_SESSION_POLICY_ADMINS_IDLE_TIMEOUT"} {
+			os.Unsetenv(k)
+		}
+	}()
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.JWT.SessionPolicies) != 2 {
+		t.Fatalf("expected cli and admins policies, got %+v", cfg.JWT.SessionPolicies)
+	}
+
+	web := cfg.SessionLifetimes("gogotex", []string{"student"})
+	if web.AccessTokenTTL != 15*time.Minute || web.IdleTimeout != 72*time.Hour || web.MaxLifetime != 7*24*time.Hour {
+		t.Fatalf("unexpected default lifetimes: %+v", web)
+	}
+	cli := cfg.SessionLifetimes("gogotex-cli", nil)
+	if cli.AccessTokenTTL != 15*time.Minute || cli.IdleTimeout != 30*24*time.Hour || cli.MaxLifetime != 90*24*time.Hour {
+		t.Fatalf("unexpected cli lifetimes: %+v", cli)
+	}
+	// later policies win: an admin on the CLI gets the admin idle timeout
+	admin := cfg.SessionLifetimes("gogotex-cli", []string{"admin"})
+	if admin.AccessTokenTTL != 5*time.Minute || admin.IdleTimeout != time.Hour || admin.MaxLifetime != 90*24*time.Hour {
+		t.Fatalf("unexpected admin lifetimes: %+v", admin)
+	}
+	if got := cfg.LongestTokenTTL(); got != time.Hour {
+		t.Fatalf("expected the guest token TTL to be the longest, got %v", got)
+	}
 }
@@ -0,0 +1,225 @@
+package device
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Status of a device authorization request (RFC 8628)
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusDenied   Status = "denied"
+)
+
+// GrantType is the grant_type value used when polling the token endpoint
+const GrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// userCodeAlphabet avoids vowels (no accidental words) and look-alike characters
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// Authorization is a pending device login. The device polls with DeviceCode while the
+// user enters UserCode on the verification page and approves it.
+type Authorization struct {
+	DeviceCode string    `json:"deviceCode"`
+	UserCode   string    `json:"userCode"`
+	ClientID   string    `json:"clientId"`
+	Scope      string    `json:"scope,omitempty"`
+	Status     Status    `json:"status"`
+	Sub        string    `json:"sub,omitempty"` // set once approved
+	Interval   int       `json:"interval"`      // minimum polling interval in seconds
+	ExpiresAt  time.Time `json:"expiresAt"`
+	LastPollAt time.Time `json:"lastPollAt,omitempty"`
+}
+
+// NewAuthorization creates a pending authorization with random device and user codes.
+func NewAuthorization(clientID, scope string, ttl time.Duration, interval int) (*Authorization, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	uc, err := newUserCode()
+	if err != nil {
+		return nil, err
+	}
+	return &Authorization{
+		DeviceCode: hex.EncodeToString(b),
+		UserCode:   uc,
+		ClientID:   clientID,
+		Scope:      scope,
+		Status:     StatusPending,
+		Interval:   interval,
+		ExpiresAt:  time.Now().UTC().Add(ttl),
+	}, nil
+}
+
+// newUserCode returns a code formatted as XXXX-XXXX
+func newUserCode() (string, error) {
+	var sb strings.Builder
+	for i := 0; i < 8; i++ {
+		if i == 4 {
+			sb.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// NormalizeUserCode makes user input comparable: upper-case, separators removed,
+// re-formatted as XXXX-XXXX.
+func NormalizeUserCode(s string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if r >= 'A' && r <= 'Z' {
+			sb.WriteRune(r)
+		}
+	}
+	c := sb.String()
+	if len(c) != 8 {
+		return c
+	}
+	return c[:4] + "-" + c[4:]
+}
+
+// Store persists device authorizations
+type Store interface {
+	Save(ctx context.Context, a *Authorization) error
+	GetByDeviceCode(ctx context.Context, deviceCode string) (*Authorization, error)
+	GetByUserCode(ctx context.Context, userCode string) (*Authorization, error)
+	// SavePoll stores the polling state (Interval, LastPollAt) of a, unless it was
+	// approved or denied meanwhile; it reports whether a was still pending.
+	SavePoll(ctx context.Context, a *Authorization) (bool, error)
+	// Delete removes a and reports whether it still existed, so concurrent polls
+	// cannot both redeem an approved code.
+	Delete(ctx context.Context, a *Authorization) (bool, error)
+}
+
+// RedisStore implements Store using Redis. Authorizations live under
+// "device:code:<deviceCode>" with a "device:user:<userCode>" index; both expire with
+// the authorization.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a Redis-backed store. Prefix may be empty.
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "device:"
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) codeKey(deviceCode string) string { return s.prefix + "code:" + deviceCode }
+func (s *RedisStore) userKey(userCode string) string   { return s.prefix + "user:" + userCode }
+
+func (s *RedisStore) Save(ctx context.Context, a *Authorization) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(a.ExpiresAt)
+	if ttl <= 0 {
+		ttl = time.Second
+	}
+	_, err = s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Set(ctx, s.codeKey(a.DeviceCode), b, ttl)
+		p.Set(ctx, s.userKey(a.UserCode), a.DeviceCode, ttl)
+		return nil
+	})
+	return err
+}
+
+// SavePoll updates the stored authorization under WATCH, so a poll can never
+// overwrite an approval that lands between loading and saving the authorization.
+func (s *RedisStore) SavePoll(ctx context.Context, a *Authorization) (bool, error) {
+	key := s.codeKey(a.DeviceCode)
+	pending := false
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		b, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var cur Authorization
+		if err := json.Unmarshal(b, &cur); err != nil {
+			return err
+		}
+		if cur.Status != StatusPending {
+			return nil
+		}
+		cur.Interval, cur.LastPollAt = a.Interval, a.LastPollAt
+		nb, err := json.Marshal(&cur)
+		if err != nil {
+			return err
+		}
+		ttl := time.Until(cur.ExpiresAt)
+		if ttl <= 0 {
+			ttl = time.Second
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Set(ctx, key, nb, ttl)
+			return nil
+		})
+		pending = err == nil
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		// changed since it was read: approved, denied or redeemed
+		return false, nil
+	}
+	return pending, err
+}
+
+func (s *RedisStore) GetByDeviceCode(ctx context.Context, deviceCode string) (*Authorization, error) {
+	b, err := s.client.Get(ctx, s.codeKey(deviceCode)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var a Authorization
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (s *RedisStore) GetByUserCode(ctx context.Context, userCode string) (*Authorization, error) {
+	dc, err := s.client.Get(ctx, s.userKey(userCode)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return s.GetByDeviceCode(ctx, dc)
+}
+
+func (s *RedisStore) Delete(ctx context.Context, a *Authorization) (bool, error) {
+	// delete the code key on its own: its removal is what makes redemption single use
+	n, err := s.client.Del(ctx, s.codeKey(a.DeviceCode)).Result()
+	if err != nil {
+		return false, err
+	}
+	if err := s.client.Del(ctx, s.userKey(a.UserCode)).Err(); err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
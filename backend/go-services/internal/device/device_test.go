@@ -0,0 +1,100 @@
+package device
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAuthorization_Codes(t *testing.T) {
+	a, err := NewAuthorization("gogotex-cli", "openid", time.Minute, 5)
+	require.NoError(t, err)
+	require.Len(t, a.DeviceCode, 64)
+	require.Regexp(t, regexp.MustCompile(`^[BCDFGHJKLMNPQRSTVWXZ]{4}-[BCDFGHJKLMNPQRSTVWXZ]{4}$`), a.UserCode)
+	require.Equal(t, StatusPending, a.Status)
+}
+
+func TestNormalizeUserCode(t *testing.T) {
+	require.Equal(t, "BCDF-GHJK", NormalizeUserCode("bcdf ghjk"))
+	require.Equal(t, "BCDF-GHJK", NormalizeUserCode("BCDF-GHJK"))
+	require.Equal(t, "ABC", NormalizeUserCode("a-b-c"))
+}
+
+func TestRedisStore_SaveGetDelete(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), "")
+	ctx := context.Background()
+
+	a, _ := NewAuthorization("cli", "", time.Minute, 5)
+	require.NoError(t, store.Save(ctx, a))
+
+	byUser, err := store.GetByUserCode(ctx, a.UserCode)
+	require.NoError(t, err)
+	require.Equal(t, a.DeviceCode, byUser.DeviceCode)
+
+	a.Status = StatusApproved
+	a.Sub = "user-1"
+	require.NoError(t, store.Save(ctx, a))
+	byDevice, err := store.GetByDeviceCode(ctx, a.DeviceCode)
+	require.NoError(t, err)
+	require.Equal(t, StatusApproved, byDevice.Status)
+
+	deleted, err := store.Delete(ctx, a)
+	require.NoError(t, err)
+	require.True(t, deleted)
+	deleted, err = store.Delete(ctx, a)
+	require.NoError(t, err)
+	require.False(t, deleted)
+	gone, err := store.GetByDeviceCode(ctx, a.DeviceCode)
+	require.NoError(t, err)
+	require.Nil(t, gone)
+
+	// entries expire with the authorization
+	b, _ := NewAuthorization("cli", "", time.Second, 5)
+	require.NoError(t, store.Save(ctx, b))
+	m.FastForward(2 * time.Second)
+	gone, err = store.GetByUserCode(ctx, b.UserCode)
+	require.NoError(t, err)
+	require.Nil(t, gone)
+}
+
+func TestRedisStore_SavePollKeepsApproval(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), "")
+	ctx := context.Background()
+
+	a, _ := NewAuthorization("cli", "", time.Minute, 5)
+	require.NoError(t, store.Save(ctx, a))
+
+	// a poll of a pending code records its polling state
+	poll, _ := store.GetByDeviceCode(ctx, a.DeviceCode)
+	poll.Interval, poll.LastPollAt = 10, time.Now().UTC()
+	pending, err := store.SavePoll(ctx, poll)
+	require.NoError(t, err)
+	require.True(t, pending)
+	got, _ := store.GetByDeviceCode(ctx, a.DeviceCode)
+	require.Equal(t, 10, got.Interval)
+
+	// the user approves between the poll loading and saving the code
+	approved := *got
+	approved.Status, approved.Sub = StatusApproved, "user-1"
+	require.NoError(t, store.Save(ctx, &approved))
+	poll.Interval = 15
+	pending, err = store.SavePoll(ctx, poll)
+	require.NoError(t, err)
+	require.False(t, pending)
+	got, _ = store.GetByDeviceCode(ctx, a.DeviceCode)
+	require.Equal(t, StatusApproved, got.Status)
+	require.Equal(t, "user-1", got.Sub)
+	require.Equal(t, 10, got.Interval)
+	require.InDelta(t, time.Minute.Seconds(), m.TTL(store.codeKey(a.DeviceCode)).Seconds(), 1)
+}
@@ -0,0 +1,270 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/metrics"
+)
+
+// ErrCircuitOpen is returned without contacting the server while the circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+const (
+	defaultTimeout          = 10 * time.Second
+	defaultRetries          = 2
+	defaultMinBackoff       = 100 * time.Millisecond
+	defaultMaxBackoff       = 2 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// Client is an outbound HTTP client for calls to identity providers.
+//
+// Every request is bounded by a timeout. Idempotent requests (GET/HEAD/OPTIONS, or
+// requests marked with Idempotent) are retried with jittered exponential backoff
+// on transport errors and 502/503/504 responses. After a run of consecutive
+// failures against a host its circuit breaker opens and requests to that host fail
+// fast with ErrCircuitOpen until the cooldown has passed and a probe succeeds.
+type Client struct {
+	name       string
+	http       *http.Client
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	mu               sync.Mutex
+	breakers         map[string]*breaker
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithTimeout bounds each attempt (connection, request and response headers)
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.http.Timeout = d }
+}
+
+// WithRetries sets how often an idempotent request is retried and the backoff range
+func WithRetries(n int, min, max time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+// WithBreaker opens the circuit after threshold consecutive failures for cooldown;
+// a threshold of 0 disables the breaker
+func WithBreaker(threshold int, cooldown time.Duration) Option {
+	return func(c *Client) {
+		c.breakerThreshold = threshold
+		c.breakerCooldown = cooldown
+	}
+}
+
+// WithTLSConfig sets the TLS configuration (CA bundle, client certificate)
+func WithTLSConfig(tc *tls.Config) Option {
+	return func(c *Client) {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = tc
+		c.http.Transport = t
+	}
+}
+
+// New creates a client; name labels its metrics
+func New(name string, opts ...Option) *Client {
+	c := &Client{
+		name:             name,
+		http:             &http.Client{Timeout: defaultTimeout, Transport: http.DefaultTransport},
+		retries:          defaultRetries,
+		minBackoff:       defaultMinBackoff,
+		maxBackoff:       defaultMaxBackoff,
+		breakerThreshold: defaultBreakerThreshold,
+		breakerCooldown:  defaultBreakerCooldown,
+		breakers:         map[string]*breaker{},
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// NewFromConfig creates a client from the outbound HTTP configuration
+func NewFromConfig(name string, cfg config.OutboundHTTPConfig) (*Client, error) {
+	opts := []Option{
+		WithTimeout(cfg.Timeout),
+		WithRetries(cfg.Retries, defaultMinBackoff, defaultMaxBackoff),
+		WithBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+	}
+	if cfg.CAFile != "" || cfg.CertFile != "" {
+		tc, err := LoadTLSConfig(cfg.CAFile, cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTLSConfig(tc))
+	}
+	return New(name, opts...), nil
+}
+
+// LoadTLSConfig builds a TLS configuration trusting the system roots plus the PEM
+// bundle in caFile and, when certFile is set, presenting that client certificate.
+func LoadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tc.RootCAs = pool
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+type idempotentKey struct{}
+
+// Idempotent marks req as safe to retry, e.g. a password or client-credentials
+// token request
+func Idempotent(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), idempotentKey{}, true))
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	ok, _ := req.Context().Value(idempotentKey{}).(bool)
+	return ok && (req.Body == nil || req.GetBody != nil)
+}
+
+// Do sends req, retrying and tripping the breaker as described on Client
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	retries := 0
+	if isIdempotent(req) {
+		retries = c.retries
+	}
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+		resp, err := c.do(req)
+		if attempt >= retries || !retryable(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(c.backoff(attempt)):
+		}
+	}
+}
+
+// do sends a single attempt through the breaker and records its metrics
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	b := c.breakerFor(req.URL.Host)
+	if !b.allow() {
+		metrics.OutboundRequests.WithLabelValues(c.name, "circuit_open").Inc()
+		return nil, ErrCircuitOpen
+	}
+	start := time.Now()
+	resp, err := c.http.Do(req)
+	metrics.OutboundRequestDuration.WithLabelValues(c.name).Observe(time.Since(start).Seconds())
+	outcome := "error"
+	if err == nil {
+		outcome = strconv.Itoa(resp.StatusCode)
+	}
+	metrics.OutboundRequests.WithLabelValues(c.name, outcome).Inc()
+	// client errors say nothing about the health of the server
+	failed := err != nil && req.Context().Err() == nil || err == nil && resp.StatusCode >= 500
+	b.record(!failed)
+	metrics.OutboundCircuitOpen.WithLabelValues(c.name, req.URL.Host).Set(boolGauge(b.isOpen()))
+	return resp, err
+}
+
+func (c *Client) breakerFor(host string) *breaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.breakers[host]
+	if !ok {
+		b = newBreaker(c.breakerThreshold, c.breakerCooldown)
+		c.breakers[host] = b
+	}
+	return b
+}
+
+// StandardClient returns an *http.Client whose requests go through c, for
+// libraries that take a plain client (OIDC discovery, JWKS)
+func (c *Client) StandardClient() *http.Client {
+	return &http.Client{Transport: roundTripper{c}}
+}
+
+type roundTripper struct{ c *Client }
+
+func (rt roundTripper) RoundTrip(req *http.Request) (*http.Response, error) { return rt.c.Do(req) }
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrCircuitOpen)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns a random delay in [0, min(maxBackoff, minBackoff*2^attempt)] ("full jitter")
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.minBackoff << attempt
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
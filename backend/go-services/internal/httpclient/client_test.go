@@ -0,0 +1,107 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_RetriesIdempotentRequests(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	c := New("test", WithRetries(2, time.Millisecond, 5*time.Millisecond), WithBreaker(0, 0))
+	ctx := context.Background()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.EqualValues(t, 3, atomic.LoadInt32(&calls))
+
+	// a POST is sent once unless it is marked idempotent
+	atomic.StoreInt32(&calls, 0)
+	req, _ = http.NewRequestWithContext(ctx, "POST", srv.URL, strings.NewReader("a=b"))
+	resp, err = c.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	req, _ = http.NewRequestWithContext(ctx, "POST", srv.URL, strings.NewReader("a=b"))
+	resp, err = c.Do(Idempotent(req))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.EqualValues(t, 3, atomic.LoadInt32(&calls))
+}
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	var calls, healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+	c := New("test", WithRetries(0, 0, 0), WithBreaker(2, time.Minute))
+	now := time.Now()
+	c.breakerFor(strings.TrimPrefix(srv.URL, "http://")).now = func() time.Time { return now }
+	get := func() error {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		resp, err := c.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	require.NoError(t, get())
+	require.NoError(t, get())
+	// two consecutive 500s opened the circuit: the server is not contacted
+	require.True(t, errors.Is(get(), ErrCircuitOpen))
+	require.EqualValues(t, 2, atomic.LoadInt32(&calls))
+
+	// after the cooldown a probe is let through and closes the circuit again
+	atomic.StoreInt32(&healthy, 1)
+	now = now.Add(time.Minute)
+	require.NoError(t, get())
+	require.NoError(t, get())
+	require.EqualValues(t, 4, atomic.LoadInt32(&calls))
+}
+
+func TestLoadTLSConfig_TrustsCABundle(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600))
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	_, err := New("test", WithRetries(0, 0, 0)).Do(req)
+	require.Error(t, err, "self-signed server must not be trusted by default")
+
+	tc, err := LoadTLSConfig(ca, "", "")
+	require.NoError(t, err)
+	resp, err := New("test", WithTLSConfig(tc)).Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = LoadTLSConfig(filepath.Join(t.TempDir(), "missing.pem"), "", "")
+	require.Error(t, err)
+}
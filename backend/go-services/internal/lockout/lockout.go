@@ -0,0 +1,187 @@
+// Package lockout slows down password guessing against the password-mode login.
+// Failed logins are counted per username and per client IP in Redis; once a
+// counter reaches its threshold the username (or IP) is locked, first for
+// BaseDelay and twice as long with every further failure, up to MaxDelay.
+package lockout
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gogotex/gogotex/backend/go-services/pkg/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+// Scopes a failure is counted in
+const (
+	ScopeUser = "user"
+	ScopeIP   = "ip"
+)
+
+// Policy tunes the lockout; zero fields take the defaults below.
+// - UserThreshold / IPThreshold: failures before a username / client IP is locked
+// - BaseDelay / MaxDelay: first and longest lock
+// - Window: failures are forgotten after this long without another one (counted
+// from the end of the lock they caused)
+type Policy struct {
+	UserThreshold int
+	IPThreshold   int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	Window        time.Duration
+}
+
+const (
+	defaultUserThreshold = 5
+	defaultIPThreshold   = 20
+	defaultBaseDelay     = 30 * time.Second
+	defaultMaxDelay      = 15 * time.Minute
+	defaultWindow        = 15 * time.Minute
+)
+
+// Guard keeps the failure counters and locks in Redis
+type Guard struct {
+	client *redis.Client
+	prefix string
+	policy Policy
+}
+
+// NewGuard creates a guard; prefix namespaces its keys (default "lockout:").
+func NewGuard(client *redis.Client, prefix string, p Policy) *Guard {
+	if prefix == "" {
+		prefix = "lockout:"
+	}
+	if p.UserThreshold <= 0 {
+		p.UserThreshold = defaultUserThreshold
+	}
+	if p.IPThreshold <= 0 {
+		p.IPThreshold = defaultIPThreshold
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaultBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaultMaxDelay
+	}
+	if p.MaxDelay < p.BaseDelay {
+		p.MaxDelay = p.BaseDelay
+	}
+	if p.Window <= 0 {
+		p.Window = defaultWindow
+	}
+	return &Guard{client: client, prefix: prefix, policy: p}
+}
+
+func (g *Guard) key(scope, id, kind string) string {
+	return g.prefix + scope + ":" + id + ":" + kind
+}
+
+// normalize makes usernames case-insensitive, as they are at Keycloak
+func normalize(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// Check returns how long a login of username from ip has to wait; 0 when it may
+// proceed. An empty username or ip is not checked.
+func (g *Guard) Check(ctx context.Context, username, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, k := range g.targets(username, ip) {
+		ttl, err := g.client.PTTL(ctx, g.key(k.scope, k.id, "locked")).Result()
+		if err != nil {
+			return 0, err
+		}
+		if ttl > wait {
+			wait = ttl
+		}
+	}
+	return wait, nil
+}
+
+// Fail records a failed login of username from ip and returns the lock now in
+// effect (0 when neither is locked yet).
+func (g *Guard) Fail(ctx context.Context, username, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, k := range g.targets(username, ip) {
+		failsKey := g.key(k.scope, k.id, "fails")
+		var incr *redis.IntCmd
+		_, err := g.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			incr = p.Incr(ctx, failsKey)
+			p.PExpire(ctx, failsKey, g.policy.Window)
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		over := int(incr.Val()) - k.threshold
+		if over < 0 {
+			continue
+		}
+		d := g.delay(over)
+		// the failures must outlive the lock by a full window, or the next failure
+		// after a long lock would start the backoff over at BaseDelay
+		_, err = g.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Set(ctx, g.key(k.scope, k.id, "locked"), 1, d)
+			p.PExpire(ctx, failsKey, d+g.policy.Window)
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		metrics.LoginLockouts.WithLabelValues(k.scope).Inc()
+		if d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// Succeed forgets the failures of username after a successful login. The client
+// IP keeps its count: guessing one valid password must not reset the budget for
+// guessing others.
+func (g *Guard) Succeed(ctx context.Context, username string) error {
+	return g.UnlockUser(ctx, username)
+}
+
+// UnlockUser clears the failures and the lock of username
+func (g *Guard) UnlockUser(ctx context.Context, username string) error {
+	return g.clear(ctx, ScopeUser, normalize(username))
+}
+
+// UnlockIP clears the failures and the lock of a client IP
+func (g *Guard) UnlockIP(ctx context.Context, ip string) error {
+	return g.clear(ctx, ScopeIP, ip)
+}
+
+func (g *Guard) clear(ctx context.Context, scope, id string) error {
+	return g.client.Del(ctx, g.key(scope, id, "fails"), g.key(scope, id, "locked")).Err()
+}
+
+// delay returns the lock after over failures beyond the threshold: BaseDelay
+// doubled over times, at most MaxDelay
+func (g *Guard) delay(over int) time.Duration {
+	d := g.policy.BaseDelay
+	for i := 0; i < over && d < g.policy.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > g.policy.MaxDelay {
+		d = g.policy.MaxDelay
+	}
+	return d
+}
+
+type target struct {
+	scope, id string
+	threshold int
+}
+
+func (g *Guard) targets(username, ip string) []target {
+	var out []target
+	if u := normalize(username); u != "" {
+		out = append(out, target{ScopeUser, u, g.policy.UserThreshold})
+	}
+	if ip != "" {
+		out = append(out, target{ScopeIP, ip, g.policy.IPThreshold})
+	}
+	return out
+}
@@ -0,0 +1,110 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuard_LocksUsernameWithBackoff(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	g := NewGuard(redis.NewClient(&redis.Options{Addr: m.Addr()}), "", Policy{UserThreshold: 3, IPThreshold: 100, BaseDelay: 10 * time.Second, MaxDelay: 30 * time.Second})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		wait, err := g.Fail(ctx, "Alice", "198.51.100.1")
+		require.NoError(t, err)
+		require.Zero(t, wait)
+	}
+	wait, err := g.Check(ctx, "alice", "198.51.100.2")
+	require.NoError(t, err)
+	require.Zero(t, wait)
+
+	// the third failure locks the username (case-insensitively), from any IP
+	wait, err = g.Fail(ctx, "alice", "198.51.100.1")
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Second, wait)
+	wait, err = g.Check(ctx, "ALICE", "198.51.100.2")
+	require.NoError(t, err)
+	require.Equal(t, 10*time.Second, wait)
+	wait, err = g.Check(ctx, "bob", "198.51.100.2")
+	require.NoError(t, err)
+	require.Zero(t, wait)
+
+	// every further failure doubles the lock, up to MaxDelay
+	wait, _ = g.Fail(ctx, "alice", "198.51.100.1")
+	require.Equal(t, 20*time.Second, wait)
+	wait, _ = g.Fail(ctx, "alice", "198.51.100.1")
+	require.Equal(t, 30*time.Second, wait)
+
+	m.FastForward(31 * time.Second)
+	wait, _ = g.Check(ctx, "alice", "")
+	require.Zero(t, wait, "locks expire")
+
+	// an administrator clears the failures
+	require.NoError(t, g.UnlockUser(ctx, "Alice"))
+	wait, _ = g.Fail(ctx, "alice", "198.51.100.1")
+	require.Zero(t, wait)
+}
+
+func TestGuard_BackoffSurvivesLongLocks(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	// the default policy: the longest lock is as long as the window
+	g := NewGuard(redis.NewClient(&redis.Options{Addr: m.Addr()}), "", Policy{UserThreshold: 1, IPThreshold: 100, BaseDelay: 10 * time.Minute, MaxDelay: 15 * time.Minute, Window: 15 * time.Minute})
+	ctx := context.Background()
+
+	wait, _ := g.Fail(ctx, "alice", "198.51.100.1")
+	require.Equal(t, 10*time.Minute, wait)
+	m.FastForward(10 * time.Minute)
+	wait, _ = g.Fail(ctx, "alice", "198.51.100.1")
+	require.Equal(t, 15*time.Minute, wait)
+
+	// failing again right after the longest lock keeps the longest lock
+	m.FastForward(15 * time.Minute)
+	wait, _ = g.Check(ctx, "alice", "")
+	require.Zero(t, wait)
+	wait, _ = g.Fail(ctx, "alice", "198.51.100.1")
+	require.Equal(t, 15*time.Minute, wait)
+
+	// a full window after the lock ended the failures are forgotten
+	m.FastForward(30*time.Minute + time.Second)
+	wait, _ = g.Fail(ctx, "alice", "198.51.100.1")
+	require.Equal(t, 10*time.Minute, wait)
+}
+
+func TestGuard_LocksClientIP(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	g := NewGuard(redis.NewClient(&redis.Options{Addr: m.Addr()}), "", Policy{UserThreshold: 100, IPThreshold: 2})
+	ctx := context.Background()
+
+	_, _ = g.Fail(ctx, "u1", "203.0.113.9")
+	wait, err := g.Fail(ctx, "u2", "203.0.113.9")
+	require.NoError(t, err)
+	require.Equal(t, defaultBaseDelay, wait)
+	wait, _ = g.Check(ctx, "u3", "203.0.113.9")
+	require.Equal(t, defaultBaseDelay, wait, "spraying many usernames from one IP")
+
+	// a successful login does not reset the IP
+	require.NoError(t, g.Succeed(ctx, "u3"))
+	wait, _ = g.Check(ctx, "u3", "203.0.113.9")
+	require.NotZero(t, wait)
+	require.NoError(t, g.UnlockIP(ctx, "203.0.113.9"))
+	wait, _ = g.Check(ctx, "u3", "203.0.113.9")
+	require.Zero(t, wait)
+
+	// failures are forgotten after the window
+	_, _ = g.Fail(ctx, "u1", "203.0.113.9")
+	m.FastForward(defaultWindow + time.Second)
+	wait, _ = g.Fail(ctx, "u1", "203.0.113.9")
+	require.Zero(t, wait)
+}
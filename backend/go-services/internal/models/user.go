@@ -2,13 +2,25 @@ package models
 
 import "time"
 
-// User represents an application user (mapped from Keycloak claims)
+// User represents an application user (mapped from identity provider claims).
+//
+// A user is identified upstream by (Issuer, OIDCId), the `iss` and `sub` of the
+// provider's tokens. Sub is the application-wide subject used in our own tokens,
+// sessions and personal access tokens; for the primary provider it equals the
+// upstream subject.
 type User struct {
 	ID        string    `bson:"_id,omitempty" json:"id"`
-	Sub       string    `bson:"sub" json:"sub"` // OIDC subject
-	OIDCId    string    `bson:"oidcId,omitempty" json:"oidcId,omitempty"`
+	Sub       string    `bson:"sub" json:"sub"` // application subject
+	Issuer    string    `bson:"issuer,omitempty" json:"issuer,omitempty"`
+	OIDCId    string    `bson:"oidcId,omitempty" json:"oidcId,omitempty"` // upstream OIDC subject
 	Email     string    `bson:"email" json:"email"`
 	Name      string    `bson:"name" json:"name"`
 	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
 	UpdatedAt time.Time `bson:"updatedAt" json:"updatedAt"`
+	// Roles and Groups are copied from the provider's claims at every login (see
+	// middleware.ClaimMapping) and carried in our own access tokens
+	Roles  []string `bson:"roles,omitempty" json:"roles,omitempty"`
+	Groups []string `bson:"groups,omitempty" json:"groups,omitempty"`
+	// TokensValidAfter is set by "sign out everywhere": tokens issued before it are rejected
+	TokensValidAfter time.Time `bson:"tokensValidAfter,omitempty" json:"tokensValidAfter,omitempty"`
 }
@@ -0,0 +1,40 @@
+// Package notify delivers notifications about account activity to users.
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+)
+
+// Kinds of notification events
+const (
+	KindNewSignIn = "new_sign_in"
+)
+
+// Event is a notification addressed to one user. For KindNewSignIn, Device, IP and
+// UserAgent describe the device the user signed in from.
+type Event struct {
+	Kind      string
+	Sub       string
+	Email     string
+	Name      string
+	Time      time.Time
+	Device    string
+	IP        string
+	UserAgent string
+}
+
+// Notifier delivers events to users
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// LogNotifier only logs events; it is used when no mail server is configured
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, e Event) error {
+	logger.Infof("notify: %s sub=%s device=%q ip=%s", e.Kind, e.Sub, e.Device, e.IP)
+	return nil
+}
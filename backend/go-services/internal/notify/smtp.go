@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// ErrNoRecipient is returned when the user of an event has no email address
+var ErrNoRecipient = errors.New("notify: user has no email address")
+
+var newSignInMail = template.Must(template.New("new_sign_in").Parse(`Hi {{if .Name}}{{.Name}}{{else}}there{{end}},
+
+your gogotex account was just signed in to from a device we have not seen before:
+
+  Device:     {{.Device}}
+  IP address: {{.IP}}
+  Time:       {{.Time.UTC.Format "2006-01-02 15:04 MST"}}
+
+If this was you, there is nothing to do. Otherwise end that session under
+Account > Sessions and change your password.
+`))
+
+// SMTPNotifier mails events to the user's email address. STARTTLS is used when the
+// server offers it; credentials are only sent over TLS or to localhost (see
+// smtp.PlainAuth).
+type SMTPNotifier struct {
+	host string
+	addr string
+	from *mail.Address
+	auth smtp.Auth
+}
+
+// NewSMTPNotifier creates a notifier delivering through host:port. username may be
+// empty for servers that accept unauthenticated submissions.
+func NewSMTPNotifier(host string, port int, username, password, from string) (*SMTPNotifier, error) {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", from, err)
+	}
+	n := &SMTPNotifier{host: host, addr: net.JoinHostPort(host, strconv.Itoa(port)), from: sender}
+	if username != "" {
+		n.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return n, nil
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, e Event) error {
+	if e.Email == "" {
+		return ErrNoRecipient
+	}
+	to, err := mail.ParseAddress(e.Email)
+	if err != nil {
+		return fmt.Errorf("notify: invalid recipient %q: %w", e.Email, err)
+	}
+	to.Name = e.Name
+	msg, err := n.message(e, to)
+	if err != nil {
+		return err
+	}
+	return n.send(ctx, to.Address, msg)
+}
+
+// message renders the mail for e, headers included
+func (n *SMTPNotifier) message(e Event, to *mail.Address) ([]byte, error) {
+	var subject string
+	var body bytes.Buffer
+	switch e.Kind {
+	case KindNewSignIn:
+		subject = "New sign-in to your gogotex account"
+		if err := newSignInMail.Execute(&body, e); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("notify: no mail template for %q", e.Kind)
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+	b.Write(bytes.ReplaceAll(body.Bytes(), []byte("\n"), []byte("\r\n")))
+	return b.Bytes(), nil
+}
+
+// send delivers msg to rcpt in one SMTP transaction bounded by ctx
+func (n *SMTPNotifier) send(ctx context.Context, rcpt string, msg []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: n.host}); err != nil {
+			return err
+		}
+	}
+	if n.auth != nil {
+		if err := c.Auth(n.auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(n.from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(rcpt); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
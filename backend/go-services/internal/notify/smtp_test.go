@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mailCatcher is a minimal SMTP server standing in for the mail relay; it accepts
+// one message per connection and hands it to the test
+type mailCatcher struct {
+	ln   net.Listener
+	mail chan caughtMail
+}
+
+type caughtMail struct {
+	from, rcpt, data string
+}
+
+func newMailCatcher(t *testing.T) *mailCatcher {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	m := &mailCatcher{ln: ln, mail: make(chan caughtMail, 1)}
+	t.Cleanup(func() { ln.Close() })
+	go m.serve()
+	return m
+}
+
+func (m *mailCatcher) port() int { return m.ln.Addr().(*net.TCPAddr).Port }
+
+func (m *mailCatcher) serve() {
+	for {
+		conn, err := m.ln.Accept()
+		if err != nil {
+			return
+		}
+		go m.handle(conn)
+	}
+}
+
+func (m *mailCatcher) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+	var got caughtMail
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		switch verb := strings.ToUpper(strings.SplitN(cmd, " ", 2)[0]); verb {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case "MAIL":
+			got.from = cmd
+			reply("250 OK")
+		case "RCPT":
+			got.rcpt = cmd
+			reply("250 OK")
+		case "DATA":
+			reply("354 end with <CRLF>.<CRLF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			got.data = data.String()
+			reply("250 queued")
+			m.mail <- got
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPNotifier_NewSignIn(t *testing.T) {
+	catcher := newMailCatcher(t)
+	n, err := NewSMTPNotifier("127.0.0.1", catcher.port(), "", "", "gogotex <no-reply@gogotex.local>")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = n.Notify(ctx, Event{
+		Kind:   KindNewSignIn,
+		Sub:    "u1",
+		Email:  "ada@example.com",
+		Name:   "Ada Lovelace",
+		Time:   time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC),
+		Device: "Firefox on Linux",
+		IP:     "203.0.113.7",
+	})
+	require.NoError(t, err)
+
+	select {
+	case m := <-catcher.mail:
+		require.Equal(t, "MAIL FROM:<no-reply@gogotex.local> BODY=8BITMIME", m.from)
+		require.Equal(t, "RCPT TO:<ada@example.com>", m.rcpt)
+		require.Contains(t, m.data, "To: \"Ada Lovelace\" <ada@example.com>\r\n")
+		require.Contains(t, m.data, "Subject: New sign-in to your gogotex account\r\n")
+		require.Contains(t, m.data, "Hi Ada Lovelace,")
+		require.Contains(t, m.data, "Device:     Firefox on Linux\r\n")
+		require.Contains(t, m.data, "IP address: 203.0.113.7\r\n")
+		require.Contains(t, m.data, "2026-03-01 09:30 UTC")
+	case <-ctx.Done():
+		t.Fatal("no mail delivered")
+	}
+}
+
+func TestSMTPNotifier_Rejects(t *testing.T) {
+	_, err := NewSMTPNotifier("localhost", 25, "", "", "not an address")
+	require.Error(t, err)
+
+	n, err := NewSMTPNotifier("localhost", 25, "", "", "no-reply@gogotex.local")
+	require.NoError(t, err)
+	require.ErrorIs(t, n.Notify(context.Background(), Event{Kind: KindNewSignIn, Sub: "u1"}), ErrNoRecipient)
+	// header injection through the claims-provided address is refused before dialing
+	require.Error(t, n.Notify(context.Background(), Event{Kind: KindNewSignIn, Email: "a@example.com\r\nBcc: x@example.com"}))
+}
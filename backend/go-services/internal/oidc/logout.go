@@ -0,0 +1,65 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+)
+
+// BackchannelLogoutEvent is the `events` member that identifies a logout token
+// (OpenID Connect Back-Channel Logout 1.0)
+const BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// ErrInvalidLogoutToken is returned for tokens that verify but are not logout tokens
+var ErrInvalidLogoutToken = errors.New("invalid logout token")
+
+// LogoutToken holds the claims of a verified logout token. At least one of Sub and
+// SID is set; JTI identifies the token until Expiry, for replay detection.
+type LogoutToken struct {
+	Issuer string
+	Sub    string
+	SID    string
+	JTI    string
+	Expiry time.Time
+}
+
+// VerifyLogoutToken verifies raw with ver (signature, issuer, audience and expiry)
+// and checks the claims the spec requires of a logout token: the back-channel
+// logout event, a jti, a sub and/or sid, and no nonce.
+func VerifyLogoutToken(ctx context.Context, ver middleware.Verifier, raw string) (*LogoutToken, error) {
+	tok, err := ver.Verify(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	var claims struct {
+		Issuer string                 `json:"iss"`
+		Sub    string                 `json:"sub"`
+		SID    string                 `json:"sid"`
+		JTI    string                 `json:"jti"`
+		Exp    int64                  `json:"exp"`
+		Nonce  *string                `json:"nonce"`
+		Events map[string]interface{} `json:"events"`
+	}
+	if err := tok.Claims(&claims); err != nil {
+		return nil, err
+	}
+	if ev, ok := claims.Events[BackchannelLogoutEvent]; !ok {
+		return nil, ErrInvalidLogoutToken
+	} else if _, isObj := ev.(map[string]interface{}); !isObj {
+		return nil, ErrInvalidLogoutToken
+	}
+	// a nonce would allow an ID token to be replayed as a logout token
+	if claims.Nonce != nil {
+		return nil, ErrInvalidLogoutToken
+	}
+	if (claims.Sub == "" && claims.SID == "") || claims.JTI == "" {
+		return nil, ErrInvalidLogoutToken
+	}
+	lt := &LogoutToken{Issuer: claims.Issuer, Sub: claims.Sub, SID: claims.SID, JTI: claims.JTI}
+	if claims.Exp > 0 {
+		lt.Expiry = time.Unix(claims.Exp, 0)
+	}
+	return lt, nil
+}
@@ -0,0 +1,61 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+type claimsToken map[string]interface{}
+
+func (t claimsToken) Claims(v interface{}) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// mapVerifier "verifies" the tokens it knows by name
+type mapVerifier map[string]claimsToken
+
+func (m mapVerifier) Verify(ctx context.Context, raw string) (middleware.Token, error) {
+	if t, ok := m[raw]; ok {
+		return t, nil
+	}
+	return nil, errors.New("bad signature")
+}
+
+func TestVerifyLogoutToken(t *testing.T) {
+	event := map[string]interface{}{BackchannelLogoutEvent: map[string]interface{}{}}
+	ver := mapVerifier{
+		"ok":         {"sub": "u1", "sid": "s1", "jti": "j1", "exp": 1700000000, "events": event},
+		"sid-only":   {"sid": "s1", "jti": "j2", "events": event},
+		"no-jti":     {"sub": "u1", "sid": "s1", "events": event},
+		"no-event":   {"sub": "u1", "sid": "s1"},
+		"bad-event":  {"sub": "u1", "events": map[string]interface{}{BackchannelLogoutEvent: "yes"}},
+		"nonce":      {"sub": "u1", "nonce": "n", "events": event},
+		"no-subject": {"events": event},
+	}
+	ctx := context.Background()
+
+	lt, err := VerifyLogoutToken(ctx, ver, "ok")
+	require.NoError(t, err)
+	require.Equal(t, &LogoutToken{Sub: "u1", SID: "s1", JTI: "j1", Expiry: time.Unix(1700000000, 0)}, lt)
+
+	lt, err = VerifyLogoutToken(ctx, ver, "sid-only")
+	require.NoError(t, err)
+	require.Equal(t, "s1", lt.SID)
+
+	for _, raw := range []string{"no-event", "bad-event", "nonce", "no-subject", "no-jti"} {
+		_, err := VerifyLogoutToken(ctx, ver, raw)
+		require.ErrorIs(t, err, ErrInvalidLogoutToken, raw)
+	}
+	_, err = VerifyLogoutToken(ctx, ver, "forged")
+	require.Error(t, err)
+}
@@ -39,3 +39,19 @@ func (v *Verifier) Verify(ctx context.Context, raw string) (middleware.Token, er
 	}
 	return idToken, nil
 }
+
+// Endpoints lists the provider endpoints published in its discovery document
+type Endpoints struct {
+	Authorization string `json:"authorization_endpoint"`
+	Token         string `json:"token_endpoint"`
+	EndSession    string `json:"end_session_endpoint"`
+}
+
+// Endpoints returns the endpoints discovered for the provider
+func (v *Verifier) Endpoints() (Endpoints, error) {
+	var e Endpoints
+	if err := v.provider.Claims(&e); err != nil {
+		return Endpoints{}, err
+	}
+	return e, nil
+}
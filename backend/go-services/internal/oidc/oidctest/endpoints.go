@@ -0,0 +1,343 @@
+package oidctest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// lifetimes of authorization codes and refresh tokens
+const (
+	codeTTL    = time.Minute
+	refreshTTL = 30 * time.Minute
+)
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// oauthError writes an OAuth 2.0 error response as Keycloak does
+func oauthError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+func (p *Provider) endpoint(name string) string {
+	return p.Issuer() + "/protocol/openid-connect/" + name
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.Issuer(),
+		"authorization_endpoint":                p.endpoint("auth"),
+		"token_endpoint":                        p.endpoint("token"),
+		"jwks_uri":                              p.endpoint("certs"),
+		"end_session_endpoint":                  p.endpoint("logout"),
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"grant_types_supported":                 []string{"authorization_code", "password", "refresh_token"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+		"backchannel_logout_supported":          true,
+	})
+}
+
+// knownClient reports whether clientID may use the provider; with no registered
+// clients every client ID is accepted
+func (p *Provider) knownClient(clientID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.clients) == 0 {
+		return clientID != ""
+	}
+	_, ok := p.clients[clientID]
+	return ok
+}
+
+// authenticateClient checks the client credentials of a token request (HTTP
+// Basic or client_secret_post) and returns the client ID
+func (p *Provider) authenticateClient(r *http.Request) (string, bool) {
+	id, secret, basic := r.BasicAuth()
+	if !basic {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if !p.knownClient(id) {
+		return "", false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if want := p.clients[id]; want != "" && want != secret {
+		return "", false
+	}
+	return id, true
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><head><title>Sign in to {{.Realm}}</title></head>
+<body>
+<h1>Sign in to {{.Realm}} (mock provider)</h1>
+{{if .Error}}<p style="color:#b00">{{.Error}}</p>{{end}}
+<form method="post">
+{{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">
+{{end}}<label>Username <input name="username" autofocus></label>
+<label>Password <input name="password" type="password"></label>
+<button type="submit">Sign in</button>
+</form>
+</body></html>
+`))
+
+// authorize implements the authorization endpoint (code flow only). The user
+// named by login_hint is signed in right away; otherwise a login form is shown.
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.Form
+	if q.Get("response_type") != "code" {
+		http.Error(w, "unsupported response_type", http.StatusBadRequest)
+		return
+	}
+	if !p.knownClient(q.Get("client_id")) {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || !redirect.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	var u User
+	var ok bool
+	if r.Method == http.MethodPost {
+		u, ok = p.user(q.Get("username"))
+		if !ok || u.Password != q.Get("password") {
+			params := url.Values{}
+			for _, k := range []string{"response_type", "client_id", "redirect_uri", "state", "nonce", "code_challenge", "code_challenge_method"} {
+				params[k] = []string{q.Get(k)}
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = loginPage.Execute(w, map[string]interface{}{"Realm": p.realm, "Params": params, "Error": "Invalid username or password."})
+			return
+		}
+	} else if u, ok = p.user(q.Get("login_hint")); !ok {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = loginPage.Execute(w, map[string]interface{}{"Realm": p.realm, "Params": r.URL.Query()})
+		return
+	}
+
+	code, sid := p.issueCode(u, q)
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("session_state", sid)
+	if s := q.Get("state"); s != "" {
+		rq.Set("state", s)
+	}
+	redirect.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// issueCode stores an authorization code for u bound to the parameters of the
+// authorization request
+func (p *Provider) issueCode(u User, params url.Values) (code, sid string) {
+	g := &grant{
+		user:          u,
+		clientID:      params.Get("client_id"),
+		sid:           randomID(),
+		nonce:         params.Get("nonce"),
+		redirectURI:   params.Get("redirect_uri"),
+		challenge:     params.Get("code_challenge"),
+		challengeMeth: params.Get("code_challenge_method"),
+		expiresAt:     time.Now().Add(codeTTL),
+	}
+	code = randomID()
+	p.mu.Lock()
+	p.codes[code] = g
+	p.mu.Unlock()
+	return code, g.sid
+}
+
+// token implements the token endpoint for the password, authorization_code and
+// refresh_token grants
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	clientID, ok := p.authenticateClient(r)
+	if !ok {
+		oauthError(w, http.StatusUnauthorized, "invalid_client", "Invalid client or Invalid client credentials")
+		return
+	}
+	f := r.PostForm
+	var g *grant
+	switch f.Get("grant_type") {
+	case "password":
+		u, ok := p.user(f.Get("username"))
+		if !ok || u.Password != f.Get("password") {
+			oauthError(w, http.StatusUnauthorized, "invalid_grant", "Invalid user credentials")
+			return
+		}
+		g = &grant{user: u, clientID: clientID, sid: randomID()}
+	case "authorization_code":
+		g = p.take(p.codes, f.Get("code"))
+		if g == nil || g.clientID != clientID || g.redirectURI != f.Get("redirect_uri") {
+			oauthError(w, http.StatusBadRequest, "invalid_grant", "Code not valid")
+			return
+		}
+		if !verifyPKCE(g.challenge, g.challengeMeth, f.Get("code_verifier")) {
+			oauthError(w, http.StatusBadRequest, "invalid_grant", "PKCE verification failed")
+			return
+		}
+	case "refresh_token":
+		g = p.take(p.refresh, f.Get("refresh_token"))
+		if g == nil || g.clientID != clientID {
+			oauthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+			return
+		}
+	default:
+		oauthError(w, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant_type")
+		return
+	}
+	resp, err := p.issue(g)
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// take removes and returns the unexpired grant stored under key
+func (p *Provider) take(m map[string]*grant, key string) *grant {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := m[key]
+	if !ok {
+		return nil
+	}
+	delete(m, key)
+	if time.Now().After(g.expiresAt) {
+		return nil
+	}
+	return g
+}
+
+func verifyPKCE(challenge, method, verifier string) bool {
+	if challenge == "" {
+		return true
+	}
+	if method == "plain" {
+		return verifier == challenge
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:]) == challenge
+}
+
+// issue signs the tokens of a token response for g and stores its refresh token
+func (p *Provider) issue(g *grant) (map[string]interface{}, error) {
+	idClaims := p.userClaims(g.user)
+	idClaims["aud"] = g.clientID
+	idClaims["azp"] = g.clientID
+	idClaims["sid"] = g.sid
+	idClaims["typ"] = "ID"
+	if g.nonce != "" {
+		idClaims["nonce"] = g.nonce
+	}
+	idToken, err := p.Sign(idClaims)
+	if err != nil {
+		return nil, err
+	}
+	accessClaims := p.userClaims(g.user)
+	accessClaims["aud"] = "account"
+	accessClaims["azp"] = g.clientID
+	accessClaims["sid"] = g.sid
+	accessClaims["typ"] = "Bearer"
+	accessClaims["scope"] = "openid profile email"
+	access, err := p.Sign(accessClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh := randomID()
+	next := *g
+	next.expiresAt = time.Now().Add(refreshTTL)
+	p.mu.Lock()
+	p.refresh[refresh] = &next
+	p.mu.Unlock()
+	return map[string]interface{}{
+		"access_token":       access,
+		"id_token":           idToken,
+		"refresh_token":      refresh,
+		"token_type":         "Bearer",
+		"expires_in":         int(p.ttl.Seconds()),
+		"refresh_expires_in": int(refreshTTL.Seconds()),
+		"session_state":      g.sid,
+		"scope":              "openid profile email",
+	}, nil
+}
+
+// endSession implements RP-initiated logout: the refresh tokens of the session
+// named by id_token_hint are revoked and the browser is sent to
+// post_logout_redirect_uri.
+func (p *Provider) endSession(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if sid := p.sessionOf(r.Form.Get("id_token_hint")); sid != "" {
+		p.mu.Lock()
+		for k, g := range p.refresh {
+			if g.sid == sid {
+				delete(p.refresh, k)
+			}
+		}
+		p.mu.Unlock()
+	}
+	target, err := url.Parse(r.Form.Get("post_logout_redirect_uri"))
+	if err != nil || !target.IsAbs() {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("You are signed out.\n"))
+		return
+	}
+	if s := r.Form.Get("state"); s != "" {
+		tq := target.Query()
+		tq.Set("state", s)
+		target.RawQuery = tq.Encode()
+	}
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// sessionOf returns the `sid` of an ID token signed by the provider (expired
+// tokens included, as accepted for id_token_hint)
+func (p *Provider) sessionOf(idToken string) string {
+	if idToken == "" {
+		return ""
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		if pub, ok := p.keys.PublicKey(kid); ok {
+			return pub, nil
+		}
+		return nil, jwt.ErrTokenUnverifiable
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return ""
+	}
+	sid, _ := claims["sid"].(string)
+	return sid
+}
@@ -0,0 +1,254 @@
+// Package oidctest is a mock OpenID Connect provider for tests and local
+// development. It is laid out like a Keycloak realm (issuer <url>/realms/<realm>,
+// endpoints under /protocol/openid-connect) and serves discovery, a JWKS and the
+// authorization, token and end-session endpoints for a configurable set of users.
+// Tokens are real RS256 JWTs, so oidc.NewVerifier checks them exactly as it checks
+// Keycloak's.
+//
+// The provider is not secure: redirect URIs are not registered, and the
+// authorization endpoint signs in the user named by login_hint without asking for
+// a password.
+package oidctest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultRealm is the realm served unless WithRealm is given
+const DefaultRealm = "gogotex"
+
+const defaultTokenTTL = 5 * time.Minute
+
+// User is an account of the mock provider. Claims (e.g. email, name,
+// realm_access) are added to its ID and access tokens.
+type User struct {
+	Username string                 `json:"username"`
+	Password string                 `json:"password"`
+	Sub      string                 `json:"sub"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
+}
+
+// Option configures a Provider
+type Option func(*Provider)
+
+// WithRealm sets the realm name in the issuer and endpoint paths
+func WithRealm(realm string) Option {
+	return func(p *Provider) { p.realm = realm }
+}
+
+// WithUser adds an account; Sub defaults to the username
+func WithUser(u User) Option {
+	return func(p *Provider) { p.addUser(u) }
+}
+
+// WithClient registers an OAuth client. Once a client is registered, unknown
+// client IDs and wrong secrets are rejected; an empty secret makes a public client.
+func WithClient(id, secret string) Option {
+	return func(p *Provider) { p.clients[id] = secret }
+}
+
+// WithTokenTTL sets the lifetime of issued ID and access tokens
+func WithTokenTTL(d time.Duration) Option {
+	return func(p *Provider) { p.ttl = d }
+}
+
+// Provider is a mock OpenID Connect provider; it implements http.Handler.
+type Provider struct {
+	baseURL string
+	realm   string
+	path    string // path of the issuer URL
+	ttl     time.Duration
+	keys    *tokens.KeySet
+
+	mu      sync.Mutex
+	users   map[string]User   // by username
+	clients map[string]string // client ID -> secret
+	codes   map[string]*grant // authorization codes
+	refresh map[string]*grant // refresh tokens
+}
+
+// grant is a sign-in the provider can issue tokens for
+type grant struct {
+	user          User
+	clientID      string
+	sid           string
+	nonce         string
+	redirectURI   string
+	challenge     string
+	challengeMeth string
+	expiresAt     time.Time
+}
+
+// NewProvider creates a provider served at baseURL (scheme and host, plus an
+// optional path prefix), with a fresh RSA signing key
+func NewProvider(baseURL string, opts ...Option) (*Provider, error) {
+	keys, err := tokens.NewKeySet(tokens.AlgRS256, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	p := &Provider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		realm:   DefaultRealm,
+		ttl:     defaultTokenTTL,
+		keys:    keys,
+		users:   map[string]User{},
+		clients: map[string]string{},
+		codes:   map[string]*grant{},
+		refresh: map[string]*grant{},
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	iss, err := url.Parse(p.Issuer())
+	if err != nil {
+		return nil, err
+	}
+	p.path = iss.Path
+	return p, nil
+}
+
+// URL returns the base URL (the value of KEYCLOAK_URL for the auth service)
+func (p *Provider) URL() string { return p.baseURL }
+
+// Realm returns the realm name
+func (p *Provider) Realm() string { return p.realm }
+
+// Issuer returns the issuer identifier carried in `iss`
+func (p *Provider) Issuer() string { return p.baseURL + "/realms/" + p.realm }
+
+// AddUser adds or replaces an account
+func (p *Provider) AddUser(u User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.addUser(u)
+}
+
+func (p *Provider) addUser(u User) {
+	if u.Sub == "" {
+		u.Sub = u.Username
+	}
+	p.users[u.Username] = u
+}
+
+func (p *Provider) user(username string) (User, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	u, ok := p.users[username]
+	return u, ok
+}
+
+// Sign signs claims with the provider key; iss and iat are filled in when absent
+func (p *Provider) Sign(claims map[string]interface{}) (string, error) {
+	mc := jwt.MapClaims{"iss": p.Issuer(), "iat": time.Now().Unix()}
+	for k, v := range claims {
+		mc[k] = v
+	}
+	k := p.keys.Active()
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, mc)
+	t.Header["kid"] = k.KID
+	return t.SignedString(k.Private)
+}
+
+// IDToken returns an ID token for the account username issued to clientID, as the
+// token endpoint would; extra claims (e.g. nonce, sid) override the defaults.
+func (p *Provider) IDToken(username, clientID string, extra map[string]interface{}) (string, error) {
+	u, ok := p.user(username)
+	if !ok {
+		return "", fmt.Errorf("oidctest: unknown user %q", username)
+	}
+	claims := p.userClaims(u)
+	claims["aud"] = clientID
+	claims["azp"] = clientID
+	claims["typ"] = "ID"
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return p.Sign(claims)
+}
+
+// Code issues an authorization code for the account username as the
+// authorization endpoint does after a sign-in. params holds the authorization
+// request (client_id, redirect_uri and optionally nonce, code_challenge and
+// code_challenge_method); sid is the provider session the tokens will carry.
+func (p *Provider) Code(username string, params url.Values) (code, sid string, err error) {
+	u, ok := p.user(username)
+	if !ok {
+		return "", "", fmt.Errorf("oidctest: unknown user %q", username)
+	}
+	code, sid = p.issueCode(u, params)
+	return code, sid, nil
+}
+
+// LogoutToken returns a back-channel logout token (OpenID Connect Back-Channel
+// Logout 1.0) ending the provider session sid of sub; either may be empty.
+func (p *Provider) LogoutToken(sub, sid, clientID string) (string, error) {
+	claims := map[string]interface{}{
+		"aud":    clientID,
+		"exp":    time.Now().Add(p.ttl).Unix(),
+		"jti":    randomID(),
+		"events": map[string]interface{}{"http://schemas.openid.net/event/backchannel-logout": map[string]interface{}{}},
+	}
+	if sub != "" {
+		claims["sub"] = sub
+	}
+	if sid != "" {
+		claims["sid"] = sid
+	}
+	return p.Sign(claims)
+}
+
+// userClaims returns the claims every token of u carries
+func (p *Provider) userClaims(u User) map[string]interface{} {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"sub":                u.Sub,
+		"preferred_username": u.Username,
+		"iat":                now.Unix(),
+		"exp":                now.Add(p.ttl).Unix(),
+	}
+	for k, v := range u.Claims {
+		claims[k] = v
+	}
+	return claims
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ServeHTTP routes the realm endpoints
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, ok := strings.CutPrefix(r.URL.Path, p.path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch path {
+	case "/.well-known/openid-configuration":
+		p.discovery(w, r)
+	case "/protocol/openid-connect/certs":
+		writeJSON(w, http.StatusOK, p.keys.JWKS())
+	case "/protocol/openid-connect/auth":
+		p.authorize(w, r)
+	case "/protocol/openid-connect/token":
+		p.token(w, r)
+	case "/protocol/openid-connect/logout":
+		p.endSession(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
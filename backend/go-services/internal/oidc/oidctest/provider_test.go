@@ -0,0 +1,154 @@
+package oidctest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gogotex/gogotex/backend/go-services/internal/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	Error        string `json:"error"`
+}
+
+func postToken(t *testing.T, s *Server, form url.Values) (int, tokenResponse) {
+	t.Helper()
+	resp, err := http.PostForm(s.Issuer()+"/protocol/openid-connect/token", form)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var tr tokenResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&tr))
+	return resp.StatusCode, tr
+}
+
+func newTestServer(t *testing.T) (*Server, *oidc.Verifier) {
+	t.Helper()
+	s := NewServer(t,
+		WithClient("gogotex-backend", "secret"),
+		WithUser(User{Username: "alice", Password: "pw", Sub: "sub-alice", Claims: map[string]interface{}{"email": "alice@example.com"}}),
+	)
+	ver, err := oidc.NewVerifier(context.Background(), s.Issuer(), "gogotex-backend")
+	require.NoError(t, err)
+	return s, ver
+}
+
+func TestProvider_Discovery(t *testing.T) {
+	s, ver := newTestServer(t)
+	ep, err := ver.Endpoints()
+	require.NoError(t, err)
+	assert.Equal(t, s.URL()+"/realms/gogotex/protocol/openid-connect/auth", ep.Authorization)
+	assert.Equal(t, s.URL()+"/realms/gogotex/protocol/openid-connect/token", ep.Token)
+	assert.Equal(t, s.URL()+"/realms/gogotex/protocol/openid-connect/logout", ep.EndSession)
+}
+
+func TestProvider_PasswordGrant(t *testing.T) {
+	s, ver := newTestServer(t)
+
+	status, tr := postToken(t, s, url.Values{"grant_type": {"password"}, "client_id": {"gogotex-backend"}, "client_secret": {"secret"}, "username": {"alice"}, "password": {"pw"}})
+	require.Equal(t, http.StatusOK, status)
+	tok, err := ver.Verify(context.Background(), tr.IDToken)
+	require.NoError(t, err)
+	var claims map[string]interface{}
+	require.NoError(t, tok.Claims(&claims))
+	assert.Equal(t, "sub-alice", claims["sub"])
+	assert.Equal(t, "alice", claims["preferred_username"])
+	assert.Equal(t, "alice@example.com", claims["email"])
+
+	status, tr = postToken(t, s, url.Values{"grant_type": {"password"}, "client_id": {"gogotex-backend"}, "client_secret": {"secret"}, "username": {"alice"}, "password": {"wrong"}})
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, "invalid_grant", tr.Error)
+
+	status, tr = postToken(t, s, url.Values{"grant_type": {"password"}, "client_id": {"gogotex-backend"}, "client_secret": {"nope"}, "username": {"alice"}, "password": {"pw"}})
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, "invalid_client", tr.Error)
+}
+
+func TestProvider_AuthorizationCodeWithPKCE(t *testing.T) {
+	s, ver := newTestServer(t)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	const verifier = "0123456789abcdef0123456789abcdef0123456789a"
+	const challenge = "JjuXQb_IRZi49WiMVIGIfIST1AsLVX3i8vmwMpE5xds"
+	q := url.Values{
+		"response_type": {"code"}, "client_id": {"gogotex-backend"}, "redirect_uri": {"http://app.test/cb"},
+		"state": {"st"}, "nonce": {"n-1"}, "login_hint": {"alice"},
+		"code_challenge": {challenge}, "code_challenge_method": {"S256"},
+	}
+	resp, err := client.Get(s.Issuer() + "/protocol/openid-connect/auth?" + q.Encode())
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(loc.String(), "http://app.test/cb?"))
+	assert.Equal(t, "st", loc.Query().Get("state"))
+	code := loc.Query().Get("code")
+
+	form := url.Values{"grant_type": {"authorization_code"}, "client_id": {"gogotex-backend"}, "client_secret": {"secret"}, "code": {code}, "redirect_uri": {"http://app.test/cb"}, "code_verifier": {"wrong"}}
+	status, tr := postToken(t, s, form)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "invalid_grant", tr.Error)
+
+	// the failed attempt consumed the code
+	resp, err = client.Get(s.Issuer() + "/protocol/openid-connect/auth?" + q.Encode())
+	require.NoError(t, err)
+	resp.Body.Close()
+	loc, _ = url.Parse(resp.Header.Get("Location"))
+	form.Set("code", loc.Query().Get("code"))
+	form.Set("code_verifier", verifier)
+	status, tr = postToken(t, s, form)
+	require.Equal(t, http.StatusOK, status, tr.Error)
+	tok, err := ver.Verify(context.Background(), tr.IDToken)
+	require.NoError(t, err)
+	var claims struct {
+		Nonce string `json:"nonce"`
+		SID   string `json:"sid"`
+	}
+	require.NoError(t, tok.Claims(&claims))
+	assert.Equal(t, "n-1", claims.Nonce)
+	assert.Equal(t, loc.Query().Get("session_state"), claims.SID)
+
+	status, _ = postToken(t, s, form)
+	assert.Equal(t, http.StatusBadRequest, status, "codes are single-use")
+}
+
+func TestProvider_RefreshTokenRotates(t *testing.T) {
+	s, _ := newTestServer(t)
+	creds := url.Values{"client_id": {"gogotex-backend"}, "client_secret": {"secret"}}
+	form := url.Values{"grant_type": {"password"}, "username": {"alice"}, "password": {"pw"}}
+	for k, v := range creds {
+		form[k] = v
+	}
+	_, first := postToken(t, s, form)
+
+	refresh := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {first.RefreshToken}}
+	for k, v := range creds {
+		refresh[k] = v
+	}
+	status, second := postToken(t, s, refresh)
+	require.Equal(t, http.StatusOK, status)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	status, _ = postToken(t, s, refresh)
+	assert.Equal(t, http.StatusBadRequest, status, "the old refresh token is rotated out")
+}
+
+func TestProvider_LogoutToken(t *testing.T) {
+	s, ver := newTestServer(t)
+	raw, err := s.LogoutToken("sub-alice", "sid-1", "gogotex-backend")
+	require.NoError(t, err)
+	lt, err := oidc.VerifyLogoutToken(context.Background(), ver, raw)
+	require.NoError(t, err)
+	assert.Equal(t, "sub-alice", lt.Sub)
+	assert.Equal(t, "sid-1", lt.SID)
+	assert.Equal(t, s.Issuer(), lt.Issuer)
+}
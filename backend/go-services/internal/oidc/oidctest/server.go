@@ -0,0 +1,32 @@
+package oidctest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Server is a Provider listening on a loopback port
+type Server struct {
+	*Provider
+	srv *httptest.Server
+}
+
+// NewServer starts a provider for the test tb; it is stopped when the test ends.
+//
+//	idp := oidctest.NewServer(t, oidctest.WithUser(oidctest.User{Username: "alice", Password: "pw"}))
+//	cfg.Keycloak.URL, cfg.Keycloak.Realm = idp.URL(), idp.Realm()
+func NewServer(tb testing.TB, opts ...Option) *Server {
+	tb.Helper()
+	s := &Server{}
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Provider.ServeHTTP(w, r)
+	}))
+	tb.Cleanup(s.srv.Close)
+	p, err := NewProvider(s.srv.URL, opts...)
+	if err != nil {
+		tb.Fatalf("oidctest: %v", err)
+	}
+	s.Provider = p
+	return s
+}
@@ -0,0 +1,217 @@
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/metrics"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+)
+
+// ErrUnknownProvider is returned for provider names and issuers that are not configured
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+const (
+	defaultMinRetry = time.Second
+	defaultMaxRetry = time.Minute
+	// discoveryTimeout bounds discovery and JWKS requests to a provider
+	discoveryTimeout = 10 * time.Second
+)
+
+// Registry holds one Verifier per configured identity provider.
+//
+// Verifiers are created lazily on first use (or eagerly by Start). When discovery
+// fails the provider is retried in the background with exponential backoff; until
+// it succeeds callers get the last error immediately instead of waiting on an
+// unreachable provider. Signing keys are cached by the verifier and re-fetched
+// when a token carries an unknown `kid`, so key rotation at the provider needs no
+// restart.
+type Registry struct {
+	entries  map[string]*registryEntry
+	names    []string
+	minRetry time.Duration
+	maxRetry time.Duration
+	client   *http.Client
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+type registryEntry struct {
+	provider config.ProviderConfig
+	mu       sync.Mutex
+	ver      *Verifier
+	err      error
+	retrying bool
+}
+
+// RegistryOption configures a Registry
+type RegistryOption func(*Registry)
+
+// WithRetryBackoff sets the initial and maximum delay between discovery retries
+func WithRetryBackoff(min, max time.Duration) RegistryOption {
+	return func(r *Registry) {
+		r.minRetry = min
+		r.maxRetry = max
+	}
+}
+
+// WithHTTPClient sets the client used for discovery and key fetches
+func WithHTTPClient(c *http.Client) RegistryOption {
+	return func(r *Registry) { r.client = c }
+}
+
+// NewRegistry creates a registry for providers; no network calls are made until a
+// verifier is needed or Start is called.
+func NewRegistry(providers []config.ProviderConfig, opts ...RegistryOption) *Registry {
+	r := &Registry{
+		entries:  map[string]*registryEntry{},
+		minRetry: defaultMinRetry,
+		maxRetry: defaultMaxRetry,
+		client:   &http.Client{Timeout: discoveryTimeout},
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	// verifiers keep using this context for key fetches, so it must outlive requests
+	ctx := gooidc.ClientContext(context.Background(), r.client)
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	for _, p := range providers {
+		r.entries[p.Name] = &registryEntry{provider: p}
+		r.names = append(r.names, p.Name)
+	}
+	return r
+}
+
+// Start initialises every provider in the background
+func (r *Registry) Start() {
+	for _, name := range r.names {
+		go func(name string) { _, _ = r.Verifier(name) }(name)
+	}
+}
+
+// Close stops background retries
+func (r *Registry) Close() { r.cancel() }
+
+// Ready reports whether every provider has been discovered
+func (r *Registry) Ready() bool {
+	for _, e := range r.entries {
+		e.mu.Lock()
+		ok := e.ver != nil
+		e.mu.Unlock()
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Verifier returns the verifier of the provider called name
+func (r *Registry) Verifier(name string) (*Verifier, error) {
+	e, ok := r.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ver != nil {
+		return e.ver, nil
+	}
+	if e.retrying {
+		return nil, e.err
+	}
+	ver, err := r.connect(e.provider)
+	if err != nil {
+		e.err = err
+		e.retrying = true
+		logger.Warnf("OIDC discovery for provider %s failed, retrying in the background: %v", name, err)
+		go r.retry(e)
+		return nil, err
+	}
+	e.ver = ver
+	return ver, nil
+}
+
+func (r *Registry) connect(p config.ProviderConfig) (*Verifier, error) {
+	ver, err := NewVerifier(r.ctx, p.IssuerURL(), p.ClientID)
+	if err != nil {
+		metrics.OIDCDiscoveryFailures.WithLabelValues(p.Name).Inc()
+		metrics.OIDCProviderUp.WithLabelValues(p.Name).Set(0)
+		return nil, err
+	}
+	metrics.OIDCProviderUp.WithLabelValues(p.Name).Set(1)
+	return ver, nil
+}
+
+// retry repeats discovery for e until it succeeds or the registry is closed
+func (r *Registry) retry(e *registryEntry) {
+	delay := r.minRetry
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		ver, err := r.connect(e.provider)
+		e.mu.Lock()
+		if err == nil {
+			e.ver, e.err, e.retrying = ver, nil, false
+			e.mu.Unlock()
+			logger.Infof("OIDC discovery for provider %s succeeded", e.provider.Name)
+			return
+		}
+		e.err = err
+		e.mu.Unlock()
+		if delay *= 2; delay > r.maxRetry {
+			delay = r.maxRetry
+		}
+	}
+}
+
+// Verify implements middleware.Verifier: the token is checked by the provider whose
+// issuer matches its (not yet verified) `iss` claim.
+func (r *Registry) Verify(ctx context.Context, raw string) (middleware.Token, error) {
+	iss, err := unverifiedIssuer(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range r.names {
+		if r.entries[name].provider.IssuerURL() != iss {
+			continue
+		}
+		ver, err := r.Verifier(name)
+		if err != nil {
+			return nil, err
+		}
+		return ver.Verify(ctx, raw)
+	}
+	return nil, fmt.Errorf("%w: issuer %q", ErrUnknownProvider, iss)
+}
+
+// unverifiedIssuer reads the `iss` claim from a JWT payload without verifying it
+func unverifiedIssuer(raw string) (string, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return "", errors.New("invalid token format")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", err
+	}
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", err
+	}
+	return claims.Issuer, nil
+}
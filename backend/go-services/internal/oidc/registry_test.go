@@ -0,0 +1,133 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/metrics"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider is a minimal OIDC provider: discovery, JWKS and ID-token signing
+type fakeProvider struct {
+	srv         *httptest.Server
+	keys        *tokens.KeySet
+	down        atomic.Bool
+	discoveries atomic.Int32
+	jwksFetches atomic.Int32
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	ks, err := tokens.NewKeySet(tokens.AlgRS256, "", time.Hour)
+	require.NoError(t, err)
+	fp := &fakeProvider{keys: ks}
+	fp.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fp.discoveries.Add(1)
+			if fp.down.Load() {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"issuer":         fp.srv.URL,
+				"token_endpoint": fp.srv.URL + "/token",
+				"jwks_uri":       fp.srv.URL + "/jwks",
+			})
+		case "/jwks":
+			fp.jwksFetches.Add(1)
+			_ = json.NewEncoder(w).Encode(fp.keys.JWKS())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(fp.srv.Close)
+	return fp
+}
+
+func (fp *fakeProvider) idToken(t *testing.T, aud string) string {
+	t.Helper()
+	k := fp.keys.Active()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": fp.srv.URL, "aud": aud, "sub": "u1",
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+	})
+	tok.Header["kid"] = k.KID
+	s, err := tok.SignedString(k.Private)
+	require.NoError(t, err)
+	return s
+}
+
+func TestRegistry_RetriesUnreachableProviderInBackground(t *testing.T) {
+	fp := newFakeProvider(t)
+	fp.down.Store(true)
+	reg := NewRegistry([]config.ProviderConfig{{Name: "retry-test", Issuer: fp.srv.URL, ClientID: "gogotex"}},
+		WithRetryBackoff(10*time.Millisecond, 20*time.Millisecond))
+	defer reg.Close()
+	failures := testutil.ToFloat64(metrics.OIDCDiscoveryFailures.WithLabelValues("retry-test"))
+
+	_, err := reg.Verifier("retry-test")
+	require.Error(t, err)
+	require.False(t, reg.Ready())
+	require.Greater(t, testutil.ToFloat64(metrics.OIDCDiscoveryFailures.WithLabelValues("retry-test")), failures)
+
+	// once the provider is back the background retry picks it up
+	fp.down.Store(false)
+	require.Eventually(t, reg.Ready, 2*time.Second, 10*time.Millisecond)
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.OIDCProviderUp.WithLabelValues("retry-test")))
+	ver, err := reg.Verifier("retry-test")
+	require.NoError(t, err)
+	_, err = ver.Verify(t.Context(), fp.idToken(t, "gogotex"))
+	require.NoError(t, err)
+
+	// the verifier is cached: no further discovery
+	n := fp.discoveries.Load()
+	_, err = reg.Verifier("retry-test")
+	require.NoError(t, err)
+	require.Equal(t, n, fp.discoveries.Load())
+}
+
+func TestRegistry_VerifyRoutesByIssuerAndRefreshesKeys(t *testing.T) {
+	a, b := newFakeProvider(t), newFakeProvider(t)
+	reg := NewRegistry([]config.ProviderConfig{
+		{Name: "a", Issuer: a.srv.URL, ClientID: "gogotex"},
+		{Name: "b", Issuer: b.srv.URL, ClientID: "gogotex"},
+	})
+	defer reg.Close()
+	ctx := t.Context()
+
+	_, err := reg.Verify(ctx, a.idToken(t, "gogotex"))
+	require.NoError(t, err)
+	_, err = reg.Verify(ctx, b.idToken(t, "gogotex"))
+	require.NoError(t, err)
+	// discovery ran once, on the first token of the provider
+	require.EqualValues(t, 1, a.discoveries.Load())
+
+	// a rotated key (unknown kid) triggers a JWKS refresh instead of a failure
+	fetches := a.jwksFetches.Load()
+	_, err = reg.Verify(ctx, a.idToken(t, "gogotex"))
+	require.NoError(t, err)
+	require.Equal(t, fetches, a.jwksFetches.Load(), "keys should be cached")
+	require.NoError(t, a.keys.Rotate())
+	_, err = reg.Verify(ctx, a.idToken(t, "gogotex"))
+	require.NoError(t, err)
+	require.Greater(t, a.jwksFetches.Load(), fetches)
+
+	_, err = reg.Verify(ctx, a.idToken(t, "other-client"))
+	require.Error(t, err)
+	other := newFakeProvider(t)
+	_, err = reg.Verify(ctx, other.idToken(t, "gogotex"))
+	require.True(t, errors.Is(err, ErrUnknownProvider))
+	_, err = reg.Verifier("missing")
+	require.ErrorIs(t, err, ErrUnknownProvider)
+}
@@ -0,0 +1,70 @@
+package pats
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository provides personal access token persistence
+type Repository interface {
+	Create(ctx context.Context, t *Token) error
+	GetByHash(ctx context.Context, hash string) (*Token, error)
+	ListBySub(ctx context.Context, sub string) ([]*Token, error)
+	// DeleteByID removes the token id owned by sub; it returns false when no such token exists.
+	DeleteByID(ctx context.Context, sub, id string) (bool, error)
+	TouchLastUsed(ctx context.Context, id string, at time.Time) error
+}
+
+// MongoRepository implements Repository using a Mongo collection
+type MongoRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoRepository(col *mongo.Collection) *MongoRepository {
+	return &MongoRepository{col: col}
+}
+
+func (r *MongoRepository) Create(ctx context.Context, t *Token) error {
+	_, err := r.col.InsertOne(ctx, t)
+	return err
+}
+
+func (r *MongoRepository) GetByHash(ctx context.Context, hash string) (*Token, error) {
+	var t Token
+	if err := r.col.FindOne(ctx, bson.M{"tokenHash": hash}).Decode(&t); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *MongoRepository) ListBySub(ctx context.Context, sub string) ([]*Token, error) {
+	cur, err := r.col.Find(ctx, bson.M{"sub": sub}, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	out := []*Token{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *MongoRepository) DeleteByID(ctx context.Context, sub, id string) (bool, error) {
+	res, err := r.col.DeleteOne(ctx, bson.M{"_id": id, "sub": sub})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount == 1, nil
+}
+
+func (r *MongoRepository) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"lastUsedAt": at}})
+	return err
+}
@@ -0,0 +1,154 @@
+package pats
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRepo struct {
+	byID    map[string]*Token
+	touches int
+}
+
+func (f *fakeRepo) Create(ctx context.Context, t *Token) error {
+	if f.byID == nil {
+		f.byID = map[string]*Token{}
+	}
+	cp := *t
+	f.byID[t.ID] = &cp
+	return nil
+}
+
+func (f *fakeRepo) GetByHash(ctx context.Context, hash string) (*Token, error) {
+	for _, t := range f.byID {
+		if t.Hash == hash {
+			cp := *t
+			return &cp, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeRepo) ListBySub(ctx context.Context, sub string) ([]*Token, error) {
+	var out []*Token
+	for _, t := range f.byID {
+		if t.Sub == sub {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) DeleteByID(ctx context.Context, sub, id string) (bool, error) {
+	t, ok := f.byID[id]
+	if !ok || t.Sub != sub {
+		return false, nil
+	}
+	delete(f.byID, id)
+	return true, nil
+}
+
+func (f *fakeRepo) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	f.touches++
+	if t, ok := f.byID[id]; ok {
+		t.LastUsedAt = &at
+	}
+	return nil
+}
+
+func TestCreateAndAuthenticate(t *testing.T) {
+	repo := &fakeRepo{}
+	svc := NewService(repo)
+	ctx := context.Background()
+
+	raw, tok, err := svc.Create(ctx, "user-1", "ci", []string{ScopeProjectsRead, ScopeCompile}, 0)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(raw, TokenPrefix))
+	require.True(t, strings.HasPrefix(raw, tok.Prefix))
+	require.Nil(t, tok.ExpiresAt)
+	// only the hash is stored
+	require.NotContains(t, repo.byID[tok.ID].Hash, raw)
+	require.Equal(t, HashToken(raw), repo.byID[tok.ID].Hash)
+
+	got, err := svc.Authenticate(ctx, raw)
+	require.NoError(t, err)
+	require.Equal(t, "user-1", got.Sub)
+	require.True(t, got.HasScope(ScopeCompile))
+	require.False(t, got.HasScope(ScopeGit))
+	require.NotNil(t, got.LastUsedAt)
+
+	// last-used is written at most once per minute
+	_, err = svc.Authenticate(ctx, raw)
+	require.NoError(t, err)
+	require.Equal(t, 1, repo.touches)
+
+	_, err = svc.Authenticate(ctx, raw+"x")
+	require.ErrorIs(t, err, ErrInvalidToken)
+	_, err = svc.Authenticate(ctx, "eyJhbGciOi.jwt.token")
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestCreate_Validation(t *testing.T) {
+	svc := NewService(&fakeRepo{})
+	ctx := context.Background()
+	_, _, err := svc.Create(ctx, "u", "", []string{ScopeGit}, 0)
+	require.Error(t, err)
+	_, _, err = svc.Create(ctx, "u", "n", nil, 0)
+	require.Error(t, err)
+	_, _, err = svc.Create(ctx, "u", "n", []string{"admin"}, 0)
+	require.Error(t, err)
+}
+
+func TestAuthenticate_Expired(t *testing.T) {
+	repo := &fakeRepo{}
+	svc := NewService(repo)
+	ctx := context.Background()
+	raw, tok, err := svc.Create(ctx, "u", "short", []string{ScopeGit}, time.Hour)
+	require.NoError(t, err)
+	past := time.Now().Add(-time.Minute)
+	repo.byID[tok.ID].ExpiresAt = &past
+	_, err = svc.Authenticate(ctx, raw)
+	require.ErrorIs(t, err, ErrTokenExpired)
+}
+
+func TestRevoke(t *testing.T) {
+	svc := NewService(&fakeRepo{})
+	ctx := context.Background()
+	raw, tok, _ := svc.Create(ctx, "owner", "n", []string{ScopeGit}, 0)
+
+	ok, err := svc.Revoke(ctx, "someone-else", tok.ID)
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = svc.Revoke(ctx, "owner", tok.ID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, err = svc.Authenticate(ctx, raw)
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+type fakeUsers struct{}
+
+func (fakeUsers) GetBySub(ctx context.Context, sub string) (*models.User, error) {
+	return &models.User{Sub: sub, Email: "ci@example.com", Name: "CI"}, nil
+}
+
+func TestVerifier_Claims(t *testing.T) {
+	svc := NewService(&fakeRepo{})
+	raw, tok, _ := svc.Create(context.Background(), "owner", "n", []string{ScopeProjectsRead, ScopeGit}, 0)
+
+	v := NewVerifier(svc, fakeUsers{})
+	vt, err := v.Verify(context.Background(), raw)
+	require.NoError(t, err)
+	var claims map[string]interface{}
+	require.NoError(t, vt.Claims(&claims))
+	require.Equal(t, "owner", claims["sub"])
+	require.Equal(t, "projects:read git", claims["scope"])
+	require.Equal(t, TokenType, claims["token_type"])
+	require.Equal(t, tok.ID, claims["pat_id"])
+	require.Equal(t, "ci@example.com", claims["email"])
+}
@@ -0,0 +1,53 @@
+package pats
+
+import "time"
+
+// Scopes a personal access token can carry
+const (
+	ScopeProjectsRead  = "projects:read"
+	ScopeProjectsWrite = "projects:write"
+	ScopeCompile       = "compile"
+	ScopeGit           = "git"
+)
+
+// AllScopes lists every scope a user may grant to a token
+var AllScopes = []string{ScopeProjectsRead, ScopeProjectsWrite, ScopeCompile, ScopeGit}
+
+// ValidScope reports whether s is a known scope
+func ValidScope(s string) bool {
+	for _, v := range AllScopes {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Token is a named personal access token. Only the SHA-256 hash of the secret is
+// stored; Prefix keeps the first characters so users can tell tokens apart.
+type Token struct {
+	ID         string     `bson:"_id" json:"id"`
+	Sub        string     `bson:"sub" json:"-"`
+	Name       string     `bson:"name" json:"name"`
+	Hash       string     `bson:"tokenHash" json:"-"`
+	Prefix     string     `bson:"prefix" json:"prefix"`
+	Scopes     []string   `bson:"scopes" json:"scopes"`
+	ExpiresAt  *time.Time `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `bson:"createdAt" json:"createdAt"`
+}
+
+// Expired reports whether the token has an expiry in the past
+func (t *Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// HasScope reports whether the token was granted scope
+func (t *Token) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package pats
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
+)
+
+// TokenType is the `token_type` claim set for requests authenticated with a
+// personal access token
+const TokenType = "pat"
+
+// UserLookup resolves the owner of a token (implemented by users.Service)
+type UserLookup interface {
+	GetBySub(ctx context.Context, sub string) (*models.User, error)
+}
+
+type patToken struct {
+	claims map[string]interface{}
+}
+
+func (t *patToken) Claims(v interface{}) error {
+	b, err := json.Marshal(t.claims)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Verifier accepts personal access tokens in AuthMiddleware. The resulting claims
+// carry sub, the owner's name/email, `scope` (space separated), `token_type` "pat"
+// and `pat_id`. It implements middleware.Verifier.
+type Verifier struct {
+	svc   *Service
+	users UserLookup
+}
+
+// NewVerifier creates a verifier; users may be nil, in which case name and email
+// are omitted from the claims.
+func NewVerifier(svc *Service, users UserLookup) *Verifier {
+	return &Verifier{svc: svc, users: users}
+}
+
+func (v *Verifier) Verify(ctx context.Context, raw string) (middleware.Token, error) {
+	t, err := v.svc.Authenticate(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	claims := map[string]interface{}{
+		"sub":        t.Sub,
+		"scope":      strings.Join(t.Scopes, " "),
+		"token_type": TokenType,
+		"pat_id":     t.ID,
+	}
+	if v.users != nil {
+		if u, err := v.users.GetBySub(ctx, t.Sub); err == nil && u != nil {
+			claims["email"] = u.Email
+			claims["name"] = u.Name
+		}
+	}
+	return &patToken{claims: claims}, nil
+}
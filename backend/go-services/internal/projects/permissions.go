@@ -0,0 +1,118 @@
+package projects
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrNotFound is returned for unknown documents and projects
+var ErrNotFound = errors.New("not found")
+
+// Permission is what a user may do with a project and its documents
+type Permission string
+
+const (
+	PermissionNone  Permission = ""
+	PermissionRead  Permission = "read"
+	PermissionWrite Permission = "write"
+	PermissionOwner Permission = "owner"
+)
+
+// CanRead reports whether p allows at least reading
+func (p Permission) CanRead() bool { return p != PermissionNone }
+
+// collaboratorPermission maps the collaborator roles stored on projects
+func collaboratorPermission(role string) Permission {
+	switch role {
+	case "owner":
+		return PermissionOwner
+	case "editor", "write":
+		return PermissionWrite
+	case "viewer", "reviewer", "read":
+		return PermissionRead
+	}
+	return PermissionNone
+}
+
+// Resolver answers permission questions about documents
+type Resolver interface {
+	// DocumentPermission returns sub's permission on the project documentID belongs
+	// to, or ErrNotFound when the document does not exist.
+	DocumentPermission(ctx context.Context, sub, documentID string) (Permission, error)
+	// ProjectPermission returns sub's permission on projectID, or ErrNotFound when
+	// the project does not exist.
+	ProjectPermission(ctx context.Context, sub, projectID string) (Permission, error)
+}
+
+// MongoResolver implements Resolver on the `projects` and `documents` collections.
+// Projects store the owner's subject in `owner` and collaborators as
+// `collaborators: [{userId, role}]`; documents reference their project by `projectId`.
+type MongoResolver struct {
+	projects  *mongo.Collection
+	documents *mongo.Collection
+}
+
+func NewMongoResolver(projects, documents *mongo.Collection) *MongoResolver {
+	return &MongoResolver{projects: projects, documents: documents}
+}
+
+func (r *MongoResolver) DocumentPermission(ctx context.Context, sub, documentID string) (Permission, error) {
+	var doc struct {
+		ProjectID interface{} `bson:"projectId"`
+	}
+	err := r.documents.FindOne(ctx, bson.M{"_id": objectID(documentID)}, options.FindOne().SetProjection(bson.M{"projectId": 1})).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return PermissionNone, ErrNotFound
+		}
+		return PermissionNone, err
+	}
+	projectID := doc.ProjectID
+	if s, ok := projectID.(string); ok {
+		projectID = objectID(s)
+	}
+	return r.permission(ctx, sub, projectID)
+}
+
+func (r *MongoResolver) ProjectPermission(ctx context.Context, sub, projectID string) (Permission, error) {
+	return r.permission(ctx, sub, objectID(projectID))
+}
+
+// permission resolves sub's permission on the project with _id projectID
+func (r *MongoResolver) permission(ctx context.Context, sub string, projectID interface{}) (Permission, error) {
+	var project struct {
+		Owner         string `bson:"owner"`
+		Collaborators []struct {
+			UserID string `bson:"userId"`
+			Role   string `bson:"role"`
+		} `bson:"collaborators"`
+	}
+	if err := r.projects.FindOne(ctx, bson.M{"_id": projectID}).Decode(&project); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return PermissionNone, ErrNotFound
+		}
+		return PermissionNone, err
+	}
+	if project.Owner == sub {
+		return PermissionOwner, nil
+	}
+	for _, c := range project.Collaborators {
+		if c.UserID == sub {
+			return collaboratorPermission(c.Role), nil
+		}
+	}
+	return PermissionNone, nil
+}
+
+// objectID converts hex ids to ObjectIDs; other ids are used as strings
+func objectID(id string) interface{} {
+	if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+		return oid
+	}
+	return id
+}
@@ -0,0 +1,16 @@
+package projects
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollaboratorPermission(t *testing.T) {
+	require.Equal(t, PermissionWrite, collaboratorPermission("editor"))
+	require.Equal(t, PermissionRead, collaboratorPermission("viewer"))
+	require.Equal(t, PermissionOwner, collaboratorPermission("owner"))
+	require.Equal(t, PermissionNone, collaboratorPermission("banned"))
+	require.False(t, PermissionNone.CanRead())
+	require.True(t, PermissionRead.CanRead())
+}
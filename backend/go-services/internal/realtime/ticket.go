@@ -0,0 +1,93 @@
+package realtime
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Ticket authenticates one WebSocket connection to the realtime (yjs) server.
+// Browsers cannot set an Authorization header on a WebSocket upgrade, so the page
+// asks for a ticket over the authenticated API and passes it on the upgrade URL.
+// A ticket is bound to one document and is redeemed at most once.
+type Ticket struct {
+	Sub        string    `json:"sub"`
+	DocumentID string    `json:"documentId"`
+	Name       string    `json:"name,omitempty"`
+	Email      string    `json:"email,omitempty"`
+	IssuedAt   time.Time `json:"issuedAt"`
+}
+
+// Store keeps issued tickets until they are redeemed or expire
+type Store interface {
+	// Issue stores t under a new random ticket value and returns that value
+	Issue(ctx context.Context, t *Ticket, ttl time.Duration) (string, error)
+	// Redeem returns and deletes the ticket; (nil, nil) when unknown, used or expired.
+	Redeem(ctx context.Context, raw string) (*Ticket, error)
+}
+
+// RedisStore implements Store using Redis keys "rtticket:<sha256(ticket)>" with a
+// TTL. Only the hash of the ticket is stored.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a Redis-backed store. Prefix may be empty.
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = "rtticket:"
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) Issue(ctx context.Context, t *Ticket, ttl time.Duration) (string, error) {
+	raw, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	if err := s.client.Set(ctx, s.key(raw), b, ttl).Err(); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+func (s *RedisStore) Redeem(ctx context.Context, raw string) (*Ticket, error) {
+	// GETDEL makes the ticket single-use even when redeemed concurrently
+	b, err := s.client.GetDel(ctx, s.key(raw)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var t Ticket
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (s *RedisStore) key(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return s.prefix + hex.EncodeToString(sum[:])
+}
+
+// randomString returns n random bytes encoded as unpadded base64url
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,40 @@
+package realtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStore_TicketsAreSingleUse(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	st := NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), "")
+	ctx := context.Background()
+
+	raw, err := st.Issue(ctx, &Ticket{Sub: "alice", DocumentID: "doc-1"}, 30*time.Second)
+	require.NoError(t, err)
+	require.Len(t, m.Keys(), 1)
+	require.NotContains(t, m.Keys()[0], raw, "the raw ticket must not be stored")
+
+	got, err := st.Redeem(ctx, raw)
+	require.NoError(t, err)
+	require.Equal(t, "alice", got.Sub)
+	require.Equal(t, "doc-1", got.DocumentID)
+
+	got, err = st.Redeem(ctx, raw)
+	require.NoError(t, err)
+	require.Nil(t, got, "second redemption")
+
+	raw, err = st.Issue(ctx, &Ticket{Sub: "alice", DocumentID: "doc-1"}, 30*time.Second)
+	require.NoError(t, err)
+	m.FastForward(31 * time.Second)
+	got, err = st.Redeem(ctx, raw)
+	require.NoError(t, err)
+	require.Nil(t, got, "expired ticket")
+}
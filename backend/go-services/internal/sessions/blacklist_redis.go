@@ -16,24 +16,70 @@ func SetBlacklistClient(c *redis.Client) {
 	blacklistClient = c
 }
 
-// BlacklistAccessToken stores the given token in Redis blacklist with TTL.
+// blacklistKey is keyed on the token's `jti` claim rather than the raw JWT
+func blacklistKey(jti string) string { return "blacklist:jti:" + jti }
+
+// BlacklistJTI revokes the access token with the given `jti` until ttl elapses
+// (normally the token's remaining lifetime).
 // If no Redis client is configured, this is a no-op and returns nil.
-func BlacklistAccessToken(ctx context.Context, token string, ttl time.Duration) error {
+func BlacklistJTI(ctx context.Context, jti string, ttl time.Duration) error {
+	if blacklistClient == nil || jti == "" {
+		return nil
+	}
+	return blacklistClient.Set(ctx, blacklistKey(jti), "1", ttl).Err()
+}
+
+// logoutTokenKey records a logout token of issuer iss by its `jti` claim
+func logoutTokenKey(iss, jti string) string { return "logout:jti:" + iss + ":" + jti }
+
+// RecordLogoutToken remembers the logout token jti of issuer iss until ttl elapses
+// (normally when the token expires) and reports whether it is seen for the first
+// time; replayed tokens return false.
+// If no Redis client is configured, every token counts as new.
+func RecordLogoutToken(ctx context.Context, iss, jti string, ttl time.Duration) (bool, error) {
 	if blacklistClient == nil {
+		return true, nil
+	}
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+	return blacklistClient.SetNX(ctx, logoutTokenKey(iss, jti), "1", ttl).Result()
+}
+
+// providerSessionKey marks the session sid of identity provider iss as ended
+func providerSessionKey(iss, sid string) string { return "revoked:sid:" + iss + ":" + sid }
+
+// RevokeProviderSID records that the session sid of identity provider iss ended, so
+// access tokens the provider issued for it are refused until ttl elapses (normally
+// the longest access-token lifetime of the provider).
+// If no Redis client is configured, this is a no-op and returns nil.
+func RevokeProviderSID(ctx context.Context, iss, sid string, ttl time.Duration) error {
+	if blacklistClient == nil || sid == "" {
 		return nil
 	}
-	key := "blacklist:access:" + token
-	return blacklistClient.Set(ctx, key, "1", ttl).Err()
+	return blacklistClient.Set(ctx, providerSessionKey(iss, sid), "1", ttl).Err()
+}
+
+// IsProviderSIDRevoked reports whether RevokeProviderSID recorded the session sid of
+// identity provider iss. If no Redis client is configured, returns (false, nil).
+func IsProviderSIDRevoked(ctx context.Context, iss, sid string) (bool, error) {
+	if blacklistClient == nil || sid == "" {
+		return false, nil
+	}
+	exists, err := blacklistClient.Exists(ctx, providerSessionKey(iss, sid)).Result()
+	if err != nil {
+		return false, err
+	}
+	return exists > 0, nil
 }
 
-// IsAccessTokenBlacklisted returns true when the token exists in the Redis blacklist.
+// IsJTIBlacklisted returns true when the jti exists in the Redis blacklist.
 // If no Redis client is configured, returns (false, nil).
-func IsAccessTokenBlacklisted(ctx context.Context, token string) (bool, error) {
-	if blacklistClient == nil {
+func IsJTIBlacklisted(ctx context.Context, jti string) (bool, error) {
+	if blacklistClient == nil || jti == "" {
 		return false, nil
 	}
-	key := "blacklist:access:" + token
-	exists, err := blacklistClient.Exists(ctx, key).Result()
+	exists, err := blacklistClient.Exists(ctx, blacklistKey(jti)).Result()
 	if err != nil {
 		return false, err
 	}
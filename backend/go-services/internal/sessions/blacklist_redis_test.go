@@ -10,7 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestBlacklistAccessToken_IsAccessTokenBlacklisted(t *testing.T) {
+func TestBlacklistJTI_IsJTIBlacklisted(t *testing.T) {
 	m, err := mr.Run()
 	require.NoError(t, err)
 	defer m.Close()
@@ -19,18 +19,19 @@ func TestBlacklistAccessToken_IsAccessTokenBlacklisted(t *testing.T) {
 	SetBlacklistClient(client)
 
 	ctx := context.Background()
-	token := "access-token-1"
+	jti := "jti-1"
 	// blacklist for 2 seconds
-	require.NoError(t, BlacklistAccessToken(ctx, token, 2*time.Second))
+	require.NoError(t, BlacklistJTI(ctx, jti, 2*time.Second))
+	require.True(t, m.Exists("blacklist:jti:jti-1"))
 
-	ok, err := IsAccessTokenBlacklisted(ctx, token)
+	ok, err := IsJTIBlacklisted(ctx, jti)
 	require.NoError(t, err)
 	require.True(t, ok)
 
 	// advance past TTL
 	m.FastForward(3 * time.Second)
 
-	ok2, err := IsAccessTokenBlacklisted(ctx, token)
+	ok2, err := IsJTIBlacklisted(ctx, jti)
 	require.NoError(t, err)
 	require.False(t, ok2)
 }
@@ -40,9 +41,35 @@ func TestBlacklist_NoClient_Noop(t *testing.T) {
 	// ensure no client set
 	SetBlacklistClient(nil)
 	ctx := context.Background()
-	token := "no-client-token"
-	require.NoError(t, BlacklistAccessToken(ctx, token, 1*time.Second))
-	ok, err := IsAccessTokenBlacklisted(ctx, token)
+	jti := "no-client-jti"
+	require.NoError(t, BlacklistJTI(ctx, jti, 1*time.Second))
+	ok, err := IsJTIBlacklisted(ctx, jti)
 	require.NoError(t, err)
 	require.False(t, ok)
 }
+
+func TestRecordLogoutToken_RejectsReplays(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	SetBlacklistClient(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	defer SetBlacklistClient(nil)
+	ctx := context.Background()
+
+	fresh, err := RecordLogoutToken(ctx, "https://kc", "lt-1", time.Minute)
+	require.NoError(t, err)
+	require.True(t, fresh)
+	fresh, err = RecordLogoutToken(ctx, "https://kc", "lt-1", time.Minute)
+	require.NoError(t, err)
+	require.False(t, fresh)
+	// jtis are only unique per issuer
+	fresh, err = RecordLogoutToken(ctx, "https://guests", "lt-1", time.Minute)
+	require.NoError(t, err)
+	require.True(t, fresh)
+
+	// forgotten once the token has expired
+	m.FastForward(2 * time.Minute)
+	fresh, err = RecordLogoutToken(ctx, "https://kc", "lt-1", time.Minute)
+	require.NoError(t, err)
+	require.True(t, fresh)
+}
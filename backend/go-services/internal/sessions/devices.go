@@ -0,0 +1,154 @@
+package sessions
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/gogotex/gogotex/backend/go-services/internal/notify"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// KnownDevice records that a user has signed in from a device (browser profile),
+// identified by its device cookie
+type KnownDevice struct {
+	Sub       string    `bson:"sub" json:"sub"`
+	DeviceID  string    `bson:"deviceId" json:"deviceId"`
+	Device    string    `bson:"device,omitempty" json:"device,omitempty"`
+	IP        string    `bson:"ip,omitempty" json:"ip,omitempty"`
+	FirstSeen time.Time `bson:"firstSeen" json:"firstSeen"`
+	LastSeen  time.Time `bson:"lastSeen" json:"lastSeen"`
+}
+
+// DeviceRepository stores the devices users signed in from
+type DeviceRepository interface {
+	// Remember records a sign-in from d.DeviceID; it reports whether the device was
+	// new for d.Sub.
+	Remember(ctx context.Context, d *KnownDevice) (bool, error)
+	// HasDevices reports whether sub has signed in from any device before
+	HasDevices(ctx context.Context, sub string) (bool, error)
+}
+
+// MongoDeviceRepository implements DeviceRepository using a Mongo collection with a
+// unique (sub, deviceId) index
+type MongoDeviceRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoDeviceRepository(col *mongo.Collection) *MongoDeviceRepository {
+	return &MongoDeviceRepository{col: col}
+}
+
+func (r *MongoDeviceRepository) Remember(ctx context.Context, d *KnownDevice) (bool, error) {
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{"sub": d.Sub, "deviceId": d.DeviceID},
+		bson.M{
+			"$set":         bson.M{"device": d.Device, "ip": d.IP, "lastSeen": d.LastSeen},
+			"$setOnInsert": bson.M{"firstSeen": d.FirstSeen},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.UpsertedCount == 1, nil
+}
+
+func (r *MongoDeviceRepository) HasDevices(ctx context.Context, sub string) (bool, error) {
+	n, err := r.col.CountDocuments(ctx, bson.M{"sub": sub}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+// DeviceTracker remembers the devices users sign in from and notifies them of
+// sign-ins from devices not seen before. A user's very first device is not
+// reported.
+type DeviceTracker struct {
+	repo     DeviceRepository
+	notifier notify.Notifier
+}
+
+// NewDeviceTracker creates a tracker; with a nil notifier devices are only
+// remembered.
+func NewDeviceTracker(r DeviceRepository, n notify.Notifier) *DeviceTracker {
+	return &DeviceTracker{repo: r, notifier: n}
+}
+
+// Track records the device of the new session s of u and sends a new sign-in
+// notification when the device is new. It reports whether a notification was sent.
+// Sessions without a device cookie are ignored.
+func (t *DeviceTracker) Track(ctx context.Context, u *models.User, s *Session) (bool, error) {
+	if s.DeviceID == "" {
+		return false, nil
+	}
+	hadDevices, err := t.repo.HasDevices(ctx, u.Sub)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now().UTC()
+	isNew, err := t.repo.Remember(ctx, &KnownDevice{Sub: u.Sub, DeviceID: s.DeviceID, Device: s.Device, IP: s.IP, FirstSeen: now, LastSeen: now})
+	if err != nil {
+		return false, err
+	}
+	if !isNew || !hadDevices || t.notifier == nil {
+		return false, nil
+	}
+	err = t.notifier.Notify(ctx, notify.Event{
+		Kind:      notify.KindNewSignIn,
+		Sub:       u.Sub,
+		Email:     u.Email,
+		Name:      u.Name,
+		Time:      s.CreatedAt,
+		Device:    s.Device,
+		IP:        s.IP,
+		UserAgent: s.UserAgent,
+	})
+	return err == nil, err
+}
+
+// DeviceLabel derives a readable device description such as "Firefox on Linux"
+// from a User-Agent header
+func DeviceLabel(userAgent string) string {
+	browser := match(userAgent, []string{
+		"Edg/", "Edge",
+		"OPR/", "Opera",
+		"Firefox/", "Firefox",
+		"FxiOS/", "Firefox",
+		"CriOS/", "Chrome",
+		"Chrome/", "Chrome",
+		"Safari/", "Safari",
+		"curl/", "curl",
+		"gogotex-cli", "gogotex CLI",
+	})
+	os := match(userAgent, []string{
+		"iPhone", "iOS",
+		"iPad", "iPadOS",
+		"Android", "Android",
+		"Windows", "Windows",
+		"Mac OS X", "macOS",
+		"CrOS", "ChromeOS",
+		"Linux", "Linux",
+	})
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os + " device"
+	}
+	return "Unknown device"
+}
+
+// match returns the name following the first marker (pairs of marker, name) found
+// in ua
+func match(ua string, pairs []string) string {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if strings.Contains(ua, pairs[i]) {
+			return pairs[i+1]
+		}
+	}
+	return ""
+}
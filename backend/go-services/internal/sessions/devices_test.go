@@ -0,0 +1,76 @@
+package sessions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/gogotex/gogotex/backend/go-services/internal/notify"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryDevices keeps known devices in a map keyed by sub and device id
+type memoryDevices map[[2]string]KnownDevice
+
+func (m memoryDevices) Remember(ctx context.Context, d *KnownDevice) (bool, error) {
+	k := [2]string{d.Sub, d.DeviceID}
+	_, seen := m[k]
+	m[k] = *d
+	return !seen, nil
+}
+
+func (m memoryDevices) HasDevices(ctx context.Context, sub string) (bool, error) {
+	for k := range m {
+		if k[0] == sub {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordingNotifier collects the events it is asked to deliver
+type recordingNotifier []notify.Event
+
+func (r *recordingNotifier) Notify(ctx context.Context, e notify.Event) error {
+	*r = append(*r, e)
+	return nil
+}
+
+func TestDeviceTracker(t *testing.T) {
+	ctx := context.Background()
+	var sent recordingNotifier
+	tr := NewDeviceTracker(memoryDevices{}, &sent)
+	u := &models.User{Sub: "u1", Email: "ada@example.com", Name: "Ada"}
+	login := func(deviceID string) bool {
+		s := &Session{Sub: u.Sub, DeviceID: deviceID}
+		WithClient("203.0.113.7", "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")(s)
+		notified, err := tr.Track(ctx, u, s)
+		require.NoError(t, err)
+		return notified
+	}
+
+	require.False(t, login("laptop"), "the first device of a user is not reported")
+	require.False(t, login("laptop"))
+	require.False(t, login(""), "logins without device cookie are ignored")
+	require.True(t, login("phone"))
+	require.False(t, login("phone"))
+
+	require.Len(t, sent, 1)
+	require.Equal(t, notify.KindNewSignIn, sent[0].Kind)
+	require.Equal(t, "ada@example.com", sent[0].Email)
+	require.Equal(t, "Firefox on Linux", sent[0].Device)
+	require.Equal(t, "203.0.113.7", sent[0].IP)
+}
+
+func TestDeviceLabel(t *testing.T) {
+	for ua, want := range map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0":   "Edge on Windows",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15":              "Safari on macOS",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/126.0 Mobile Safari/604.1": "Chrome on iOS",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36":           "Chrome on Android",
+		"curl/8.5.0": "curl",
+		"":           "Unknown device",
+	} {
+		require.Equal(t, want, DeviceLabel(ua), ua)
+	}
+}
@@ -2,14 +2,25 @@ package sessions
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"sort"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 // RedisRepository implements Repository using Redis as the backing store.
-// Sessions are stored as JSON under key: "session:<refreshToken>" with TTL = expiresAt - now
+// Sessions are stored as JSON under key "session:rt:<sha256(refreshToken)>" with TTL =
+// expiresAt - now (hashing keeps client-supplied tokens out of the index key space).
+// Rotated sessions are kept until the family's absolute expiry so that reuse is
+// detected even after the idle timeout.
+// Members of a token family are indexed in the set "session:family:<familyID>" and
+// every refresh token of a user in "session:sub:<sub>" (stale members are dropped
+// lazily by ListBySub). Sessions created from an identity provider session are also
+// indexed in "session:idp:<iss>:<sid>". Index TTLs are only ever extended, so an index
+// lives as long as its longest-lived member.
 type RedisRepository struct {
 	client *redis.Client
 	prefix string
@@ -24,9 +35,33 @@ func NewRedisRepository(client *redis.Client, prefix string) *RedisRepository {
 }
 
 func (r *RedisRepository) key(refresh string) string {
-	return r.prefix + refresh
+	h := sha256.Sum256([]byte(refresh))
+	return r.prefix + "rt:" + hex.EncodeToString(h[:])
 }
 
+func (r *RedisRepository) familyKey(familyID string) string {
+	return r.prefix + "family:" + familyID
+}
+
+func (r *RedisRepository) subKey(sub string) string {
+	return r.prefix + "sub:" + sub
+}
+
+func (r *RedisRepository) providerKey(iss, sid string) string {
+	return r.prefix + "idp:" + iss + ":" + sid
+}
+
+// extendTTL sets the TTL of KEYS[1] to ARGV[1] milliseconds unless the key already
+// lives longer (a rotated session keeps its family's original expiry, which may be
+// earlier than that of newer sessions in the same index)
+var extendTTL = redis.NewScript(`
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl >= 0 and ttl >= tonumber(ARGV[1]) then
+  return 0
+end
+return redis.call("PEXPIRE", KEYS[1], ARGV[1])
+`)
+
 func (r *RedisRepository) Create(ctx context.Context, s *Session) error {
 	b, err := json.Marshal(s)
 	if err != nil {
@@ -37,7 +72,23 @@ func (r *RedisRepository) Create(ctx context.Context, s *Session) error {
 		// ensure a minimal TTL so Redis won't store expired sessions
 		exp = time.Second
 	}
-	return r.client.Set(ctx, r.key(s.RefreshToken), b, exp).Err()
+	_, err = r.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Set(ctx, r.key(s.RefreshToken), b, exp)
+		if s.FamilyID != "" {
+			p.SAdd(ctx, r.familyKey(s.FamilyID), s.RefreshToken)
+			extendTTL.Eval(ctx, p, []string{r.familyKey(s.FamilyID)}, exp.Milliseconds())
+		}
+		if s.Sub != "" {
+			p.SAdd(ctx, r.subKey(s.Sub), s.RefreshToken)
+			extendTTL.Eval(ctx, p, []string{r.subKey(s.Sub)}, exp.Milliseconds())
+		}
+		if s.ProviderSID != "" {
+			p.SAdd(ctx, r.providerKey(s.ProviderIss, s.ProviderSID), s.RefreshToken)
+			extendTTL.Eval(ctx, p, []string{r.providerKey(s.ProviderIss, s.ProviderSID)}, exp.Milliseconds())
+		}
+		return nil
+	})
+	return err
 }
 
 func (r *RedisRepository) GetByRefresh(ctx context.Context, refresh string) (*Session, error) {
@@ -52,8 +103,9 @@ func (r *RedisRepository) GetByRefresh(ctx context.Context, refresh string) (*Se
 	if err := json.Unmarshal(b, &s); err != nil {
 		return nil, err
 	}
-	// If session expired from perspective of stored value, treat as missing
-	if time.Now().UTC().After(s.ExpiresAt) {
+	// If session expired from perspective of stored value, treat as missing; rotated
+	// sessions stay visible so that reuse is still detected
+	if !s.Rotated && time.Now().UTC().After(s.ExpiresAt) {
 		_ = r.client.Del(ctx, r.key(refresh)).Err()
 		return nil, nil
 	}
@@ -63,3 +115,197 @@ func (r *RedisRepository) GetByRefresh(ctx context.Context, refresh string) (*Se
 func (r *RedisRepository) DeleteByRefresh(ctx context.Context, refresh string) error {
 	return r.client.Del(ctx, r.key(refresh)).Err()
 }
+
+// MarkRotated flips the Rotated flag inside an optimistic transaction (WATCH) so that
+// two concurrent refreshes with the same token cannot both succeed. The rotated
+// session, and the family index pointing at it, are kept until MaxExpiresAt.
+func (r *RedisRepository) MarkRotated(ctx context.Context, refresh string) (bool, error) {
+	key := r.key(refresh)
+	rotated := false
+	err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+		b, err := tx.Get(ctx, key).Bytes()
+		if err != nil {
+			if err == redis.Nil {
+				return nil
+			}
+			return err
+		}
+		var s Session
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		if s.Rotated {
+			return nil
+		}
+		s.Rotated = true
+		nb, err := json.Marshal(&s)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			keep := time.Until(s.MaxExpiresAt)
+			if keep <= time.Until(s.ExpiresAt) {
+				p.Set(ctx, key, nb, redis.KeepTTL)
+				return nil
+			}
+			p.Set(ctx, key, nb, keep)
+			if s.FamilyID != "" {
+				extendTTL.Eval(ctx, p, []string{r.familyKey(s.FamilyID)}, keep.Milliseconds())
+			}
+			return nil
+		})
+		if err == nil {
+			rotated = true
+		}
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		// another client touched the session between WATCH and EXEC
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return rotated, nil
+}
+
+func (r *RedisRepository) DeleteByFamily(ctx context.Context, familyID string) error {
+	fk := r.familyKey(familyID)
+	members, err := r.client.SMembers(ctx, fk).Result()
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(members)+1)
+	for _, m := range members {
+		keys = append(keys, r.key(m))
+	}
+	keys = append(keys, fk)
+	return r.client.Del(ctx, keys...).Err()
+}
+
+func (r *RedisRepository) FamilyActive(ctx context.Context, familyID string) (bool, error) {
+	members, err := r.client.SMembers(ctx, r.familyKey(familyID)).Result()
+	if err != nil {
+		return false, err
+	}
+	now := time.Now().UTC()
+	for _, m := range members {
+		s, err := r.GetByRefresh(ctx, m)
+		if err != nil {
+			return false, err
+		}
+		if s != nil && !s.Rotated && now.Before(s.ExpiresAt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *RedisRepository) ListBySub(ctx context.Context, sub string) ([]*Session, error) {
+	sk := r.subKey(sub)
+	members, err := r.client.SMembers(ctx, sk).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := []*Session{}
+	var stale []interface{}
+	for _, m := range members {
+		s, err := r.GetByRefresh(ctx, m)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			stale = append(stale, m)
+			continue
+		}
+		if !s.Rotated {
+			out = append(out, s)
+		}
+	}
+	if len(stale) > 0 {
+		_ = r.client.SRem(ctx, sk, stale...).Err()
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+func (r *RedisRepository) DeleteByID(ctx context.Context, sub, id string) (bool, error) {
+	members, err := r.client.SMembers(ctx, r.familyKey(id)).Result()
+	if err != nil {
+		return false, err
+	}
+	// make sure the family belongs to sub before deleting it
+	owned := false
+	for _, m := range members {
+		s, err := r.GetByRefresh(ctx, m)
+		if err != nil {
+			return false, err
+		}
+		if s != nil {
+			owned = s.Sub == sub
+			break
+		}
+	}
+	if !owned {
+		return false, nil
+	}
+	if err := r.DeleteByFamily(ctx, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *RedisRepository) DeleteBySub(ctx context.Context, sub string) error {
+	sk := r.subKey(sub)
+	members, err := r.client.SMembers(ctx, sk).Result()
+	if err != nil {
+		return err
+	}
+	keys := []string{sk}
+	for _, m := range members {
+		s, err := r.GetByRefresh(ctx, m)
+		if err != nil {
+			return err
+		}
+		if s != nil && s.FamilyID != "" {
+			keys = append(keys, r.familyKey(s.FamilyID))
+		}
+		keys = append(keys, r.key(m))
+	}
+	return r.client.Del(ctx, keys...).Err()
+}
+
+func (r *RedisRepository) DeleteByProviderSID(ctx context.Context, iss, sub, sid string) error {
+	pk := r.providerKey(iss, sid)
+	members, err := r.client.SMembers(ctx, pk).Result()
+	if err != nil {
+		return err
+	}
+	families := map[string]bool{}
+	var keys []string
+	for _, m := range members {
+		s, err := r.GetByRefresh(ctx, m)
+		if err != nil {
+			return err
+		}
+		if s == nil || s.ProviderIss != iss || (sub != "" && s.Sub != sub) {
+			continue
+		}
+		if s.FamilyID != "" {
+			families[s.FamilyID] = true
+		}
+		keys = append(keys, r.key(m))
+	}
+	for f := range families {
+		if err := r.DeleteByFamily(ctx, f); err != nil {
+			return err
+		}
+	}
+	if sub == "" {
+		keys = append(keys, pk)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.client.Del(ctx, keys...).Err()
+}
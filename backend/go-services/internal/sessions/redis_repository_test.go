@@ -2,6 +2,7 @@ package sessions
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -70,3 +71,249 @@ func TestRedisRepository_TTLExpiry(t *testing.T) {
 	require.NoError(t, err)
 	require.Nil(t, got2)
 }
+
+func TestRedisRepository_MarkRotatedAndDeleteByFamily(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	repo := NewRedisRepository(client, "test:session:")
+
+	ctx := context.Background()
+	exp := time.Now().UTC().Add(time.Minute)
+	require.NoError(t, repo.Create(ctx, &Session{RefreshToken: "f1", FamilyID: "fam", Sub: "s", ExpiresAt: exp}))
+	require.NoError(t, repo.Create(ctx, &Session{RefreshToken: "f2", FamilyID: "fam", Sub: "s", ExpiresAt: exp}))
+	require.NoError(t, repo.Create(ctx, &Session{RefreshToken: "other", FamilyID: "fam-2", Sub: "s", ExpiresAt: exp}))
+
+	active, err := repo.FamilyActive(ctx, "fam")
+	require.NoError(t, err)
+	require.True(t, active)
+
+	ok, err := repo.MarkRotated(ctx, "f1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	// second attempt must report that the token was already rotated
+	ok, err = repo.MarkRotated(ctx, "f1")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	got, err := repo.GetByRefresh(ctx, "f1")
+	require.NoError(t, err)
+	require.True(t, got.Rotated)
+	// TTL must survive the update
+	require.Greater(t, m.TTL(repo.key("f1")), time.Duration(0))
+
+	require.NoError(t, repo.DeleteByFamily(ctx, "fam"))
+	active, err = repo.FamilyActive(ctx, "fam")
+	require.NoError(t, err)
+	require.False(t, active)
+	for _, r := range []string{"f1", "f2"} {
+		s, err := repo.GetByRefresh(ctx, r)
+		require.NoError(t, err)
+		require.Nil(t, s)
+	}
+	s, err := repo.GetByRefresh(ctx, "other")
+	require.NoError(t, err)
+	require.NotNil(t, s)
+}
+
+func TestRedisRepository_ListBySubAndDeleteByID(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+
+	repo := NewRedisRepository(redis.NewClient(&redis.Options{Addr: m.Addr()}), "test:session:")
+	svc := NewService(repo)
+	ctx := context.Background()
+
+	laptop, err := svc.OpenSession(ctx, "alice", time.Hour, WithClient("10.0.0.1", "firefox"))
+	require.NoError(t, err)
+	lab, err := svc.OpenSession(ctx, "alice", time.Hour, WithClient("10.0.0.2", "lab-pc"))
+	require.NoError(t, err)
+	_, err = svc.OpenSession(ctx, "bob", time.Hour)
+	require.NoError(t, err)
+
+	// rotation keeps a single entry per family, carrying the latest client details
+	_, _, err = svc.Rotate(ctx, lab.RefreshToken, WithClient("10.0.0.3", "lab-pc"))
+	require.NoError(t, err)
+
+	list, err := repo.ListBySub(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	byFamily := map[string]*Session{}
+	for _, s := range list {
+		byFamily[s.FamilyID] = s
+	}
+	require.Equal(t, "10.0.0.3", byFamily[lab.FamilyID].IP)
+	require.Equal(t, lab.CreatedAt.Unix(), byFamily[lab.FamilyID].CreatedAt.Unix())
+	require.Equal(t, "firefox", byFamily[laptop.FamilyID].UserAgent)
+
+	// other users cannot delete the session
+	ok, err := repo.DeleteByID(ctx, "bob", lab.FamilyID)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = repo.DeleteByID(ctx, "alice", lab.FamilyID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	list, err = repo.ListBySub(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, laptop.FamilyID, list[0].FamilyID)
+	// stale index members are dropped
+	members, err := m.Members("test:session:sub:alice")
+	require.NoError(t, err)
+	require.Equal(t, []string{laptop.RefreshToken}, members)
+}
+
+func TestRedisRepository_DeleteBySub(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	repo := NewRedisRepository(redis.NewClient(&redis.Options{Addr: m.Addr()}), "test:session:")
+	svc := NewService(repo)
+	ctx := context.Background()
+
+	a1, _ := svc.OpenSession(ctx, "alice", time.Hour)
+	a2, _ := svc.OpenSession(ctx, "alice", time.Hour)
+	b, _ := svc.OpenSession(ctx, "bob", time.Hour)
+	_, _, err = svc.Rotate(ctx, a1.RefreshToken)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.RevokeAll(ctx, "alice"))
+	list, err := repo.ListBySub(ctx, "alice")
+	require.NoError(t, err)
+	require.Empty(t, list)
+	require.False(t, m.Exists("test:session:family:"+a2.FamilyID))
+	got, err := svc.ValidateRefresh(ctx, b.RefreshToken)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+}
+
+func TestRedisRepository_DeleteByProviderSID(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	repo := NewRedisRepository(redis.NewClient(&redis.Options{Addr: m.Addr()}), "test:session:")
+	svc := NewService(repo)
+	ctx := context.Background()
+
+	kc, _ := svc.OpenSession(ctx, "alice", time.Hour, WithProviderSession("https://kc", "kc-sid"))
+	other, _ := svc.OpenSession(ctx, "alice", time.Hour, WithProviderSession("https://kc", "kc-other"))
+	// another provider may hand out the same sid
+	guest, _ := svc.OpenSession(ctx, "bob", time.Hour, WithProviderSession("https://guests", "kc-sid"))
+	// the provider session survives rotation
+	rotated, next, err := svc.Rotate(ctx, kc.RefreshToken)
+	require.NoError(t, err)
+	require.Equal(t, "https://kc", next.ProviderIss)
+	require.Equal(t, "kc-sid", next.ProviderSID)
+
+	// a sub that does not match leaves the session alone
+	require.NoError(t, svc.RevokeProviderSession(ctx, "https://kc", "bob", "kc-sid"))
+	got, err := svc.ValidateRefresh(ctx, rotated)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+
+	require.NoError(t, svc.RevokeProviderSession(ctx, "https://kc", "", "kc-sid"))
+	got, err = svc.ValidateRefresh(ctx, rotated)
+	require.NoError(t, err)
+	require.Nil(t, got)
+	require.False(t, m.Exists("test:session:family:"+kc.FamilyID))
+	require.False(t, m.Exists("test:session:idp:https://kc:kc-sid"))
+	got, err = svc.ValidateRefresh(ctx, other.RefreshToken)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	got, err = svc.ValidateRefresh(ctx, guest.RefreshToken)
+	require.NoError(t, err)
+	require.NotNil(t, got, "sessions of other issuers are not touched")
+
+	// without a sid every session of sub ends
+	require.NoError(t, svc.RevokeProviderSession(ctx, "https://kc", "alice", ""))
+	got, err = svc.ValidateRefresh(ctx, other.RefreshToken)
+	require.NoError(t, err)
+	require.Nil(t, got)
+	require.Error(t, svc.RevokeProviderSession(ctx, "https://kc", "", ""))
+}
+
+func TestRedisRepository_IndexesOutliveShorterSessions(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	repo := NewRedisRepository(redis.NewClient(&redis.Options{Addr: m.Addr()}), "test:session:")
+	svc := NewService(repo)
+	ctx := context.Background()
+
+	old, _ := svc.OpenSession(ctx, "alice", 10*time.Minute, WithProviderSession("https://kc", "kc-sid"))
+	recent, _ := svc.OpenSession(ctx, "alice", 2*time.Hour, WithProviderSession("https://kc", "kc-sid"))
+	// rotation keeps the old family's expiry; it must not shorten the indexes
+	_, _, err = svc.Rotate(ctx, old.RefreshToken)
+	require.NoError(t, err)
+	require.Greater(t, m.TTL("test:session:sub:alice"), time.Hour)
+	require.Greater(t, m.TTL("test:session:idp:https://kc:kc-sid"), time.Hour)
+
+	m.FastForward(20 * time.Minute)
+	list, err := repo.ListBySub(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, recent.FamilyID, list[0].FamilyID)
+
+	require.NoError(t, svc.RevokeAll(ctx, "alice"))
+	require.False(t, m.Exists(repo.key(recent.RefreshToken)))
+}
+
+func TestRedisRepository_RefreshTokensCannotAddressIndexes(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	repo := NewRedisRepository(redis.NewClient(&redis.Options{Addr: m.Addr()}), "test:session:")
+	svc := NewService(repo)
+	ctx := context.Background()
+
+	sess, err := svc.OpenSession(ctx, "alice", time.Hour, WithProviderSession("https://kc", "kc-sid"))
+	require.NoError(t, err)
+	for _, forged := range []string{"family:" + sess.FamilyID, "sub:alice", "idp:https://kc:kc-sid"} {
+		got, err := repo.GetByRefresh(ctx, forged)
+		require.NoError(t, err, forged)
+		require.Nil(t, got, forged)
+		_, _, err = svc.Rotate(ctx, forged)
+		require.NoError(t, err, forged)
+	}
+	got, err := svc.ValidateRefresh(ctx, sess.RefreshToken)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+}
+
+func TestRedisRepository_ReplayAfterIdleTimeoutRevokesFamily(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
+	repo := NewRedisRepository(client, "test:session:")
+	svc := NewService(repo)
+	ctx := context.Background()
+
+	old, err := svc.OpenSession(ctx, "alice", 2*time.Hour, WithIdleTimeout(time.Minute))
+	require.NoError(t, err)
+	_, next, err := svc.Rotate(ctx, old.RefreshToken)
+	require.NoError(t, err)
+	// the rotated session is kept for the family's lifetime, not its idle window
+	require.Greater(t, m.TTL(repo.key(old.RefreshToken)), time.Hour)
+	require.Greater(t, m.TTL(repo.familyKey(old.FamilyID)), time.Hour)
+
+	// let the idle window of the rotated session pass
+	raw, err := client.Get(ctx, repo.key(old.RefreshToken)).Bytes()
+	require.NoError(t, err)
+	var stored Session
+	require.NoError(t, json.Unmarshal(raw, &stored))
+	stored.ExpiresAt = time.Now().UTC().Add(-time.Second)
+	raw, err = json.Marshal(&stored)
+	require.NoError(t, err)
+	require.NoError(t, client.Set(ctx, repo.key(old.RefreshToken), raw, redis.KeepTTL).Err())
+
+	_, _, err = svc.Rotate(ctx, old.RefreshToken)
+	require.ErrorIs(t, err, ErrRefreshTokenReused)
+	got, err := svc.ValidateRefresh(ctx, next.RefreshToken)
+	require.NoError(t, err)
+	require.Nil(t, got)
+}
@@ -6,6 +6,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // Repository provides session persistence operations
@@ -13,6 +14,25 @@ type Repository interface {
 	Create(ctx context.Context, s *Session) error
 	GetByRefresh(ctx context.Context, refresh string) (*Session, error)
 	DeleteByRefresh(ctx context.Context, refresh string) error
+	// MarkRotated atomically flags the session as rotated. It returns false when the
+	// session does not exist or was already rotated by a concurrent caller.
+	MarkRotated(ctx context.Context, refresh string) (bool, error)
+	// DeleteByFamily removes every session (current and rotated) of a token family.
+	DeleteByFamily(ctx context.Context, familyID string) error
+	// FamilyActive reports whether the family still has an unexpired, non-rotated session.
+	FamilyActive(ctx context.Context, familyID string) (bool, error)
+	// ListBySub returns the current (non-rotated, unexpired) session of every family
+	// owned by sub.
+	ListBySub(ctx context.Context, sub string) ([]*Session, error)
+	// DeleteByID removes the session (token family) id if it is owned by sub; it
+	// returns false when no such session exists.
+	DeleteByID(ctx context.Context, sub, id string) (bool, error)
+	// DeleteBySub removes every session of sub
+	DeleteBySub(ctx context.Context, sub string) error
+	// DeleteByProviderSID removes every session (token family) created from the
+	// session sid of identity provider iss. A non-empty sub restricts the match to
+	// that user.
+	DeleteByProviderSID(ctx context.Context, iss, sub, sid string) error
 }
 
 // MongoRepository implements Repository using a Mongo collection
@@ -51,3 +71,76 @@ func (r *MongoRepository) DeleteByRefresh(ctx context.Context, refresh string) e
 	_, err := r.col.DeleteOne(ctx, bson.M{"refreshToken": refresh})
 	return err
 }
+
+// MarkRotated flags the session rotated and keeps it (the TTL index follows
+// expiresAt) until the family's absolute expiry, so reuse is detected after the idle
+// timeout too.
+func (r *MongoRepository) MarkRotated(ctx context.Context, refresh string) (bool, error) {
+	res, err := r.col.UpdateOne(ctx,
+		bson.M{"refreshToken": refresh, "rotated": bson.M{"$ne": true}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"rotated":   true,
+			"expiresAt": bson.M{"$max": bson.A{"$expiresAt", bson.M{"$ifNull": bson.A{"$maxExpiresAt", "$expiresAt"}}}},
+		}}}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+func (r *MongoRepository) DeleteByFamily(ctx context.Context, familyID string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"familyId": familyID})
+	return err
+}
+
+func (r *MongoRepository) FamilyActive(ctx context.Context, familyID string) (bool, error) {
+	n, err := r.col.CountDocuments(ctx, bson.M{
+		"familyId":  familyID,
+		"rotated":   bson.M{"$ne": true},
+		"expiresAt": bson.M{"$gt": time.Now().UTC()},
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *MongoRepository) ListBySub(ctx context.Context, sub string) ([]*Session, error) {
+	cur, err := r.col.Find(ctx, bson.M{
+		"sub":       sub,
+		"rotated":   bson.M{"$ne": true},
+		"expiresAt": bson.M{"$gt": time.Now().UTC()},
+	}, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	out := []*Session{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *MongoRepository) DeleteByID(ctx context.Context, sub, id string) (bool, error) {
+	res, err := r.col.DeleteMany(ctx, bson.M{"sub": sub, "familyId": id})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+func (r *MongoRepository) DeleteBySub(ctx context.Context, sub string) error {
+	_, err := r.col.DeleteMany(ctx, bson.M{"sub": sub})
+	return err
+}
+
+func (r *MongoRepository) DeleteByProviderSID(ctx context.Context, iss, sub, sid string) error {
+	filter := bson.M{"providerIss": iss, "providerSid": sid}
+	if sub != "" {
+		filter["sub"] = sub
+	}
+	// rotated members carry the sid too, so one DeleteMany removes whole families
+	_, err := r.col.DeleteMany(ctx, filter)
+	return err
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"time"
 )
 
+// ErrRefreshTokenReused is returned by Rotate when a refresh token that was already
+// rotated out is presented again. The whole token family is revoked in that case.
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
 // Service wraps repository operations with business logic
 type Service struct {
 	repo Repository
@@ -15,21 +20,53 @@ type Service struct {
 func NewService(r Repository) *Service { return &Service{repo: r} }
 
 // CreateSession stores a new refresh session and returns the refresh token
-func (s *Service) CreateSession(ctx context.Context, sub string, ttl time.Duration) (string, error) {
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
+func (s *Service) CreateSession(ctx context.Context, sub string, ttl time.Duration, opts ...Option) (string, error) {
+	sess, err := s.OpenSession(ctx, sub, ttl, opts...)
+	if err != nil {
 		return "", err
 	}
-	r := hex.EncodeToString(b)
+	return sess.RefreshToken, nil
+}
+
+// OpenSession stores a new refresh session in a fresh token family and returns it.
+// ttl is the absolute lifetime of the session; WithIdleTimeout additionally ends it
+// after a period without refresh. Callers use the FamilyID as the `sid` of access
+// tokens issued for the session.
+func (s *Service) OpenSession(ctx context.Context, sub string, ttl time.Duration, opts ...Option) (*Session, error) {
+	r, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	family, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
 	sess := &Session{
 		RefreshToken: r,
+		FamilyID:     family,
 		Sub:          sub,
-		ExpiresAt:    time.Now().UTC().Add(ttl),
+		MaxExpiresAt: now.Add(ttl),
+		CreatedAt:    now,
+		LastUsedAt:   now,
+	}
+	for _, o := range opts {
+		o(sess)
 	}
+	sess.extend(now)
 	if err := s.repo.Create(ctx, sess); err != nil {
-		return "", err
+		return nil, err
+	}
+	return sess, nil
+}
+
+// SessionActive reports whether the session (token family) sid has not been
+// logged out, revoked or expired.
+func (s *Service) SessionActive(ctx context.Context, sid string) (bool, error) {
+	if sid == "" {
+		return false, nil
 	}
-	return r, nil
+	return s.repo.FamilyActive(ctx, sid)
 }
 
 // ValidateRefresh returns the session if refresh token is valid and not expired
@@ -38,7 +75,7 @@ func (s *Service) ValidateRefresh(ctx context.Context, refresh string) (*Session
 	if err != nil {
 		return nil, err
 	}
-	if sess == nil {
+	if sess == nil || sess.Rotated {
 		return nil, nil
 	}
 	if time.Now().UTC().After(sess.ExpiresAt) {
@@ -49,6 +86,127 @@ func (s *Service) ValidateRefresh(ctx context.Context, refresh string) (*Session
 	return sess, nil
 }
 
+// Rotate exchanges a refresh token for a new one in the same family. The presented
+// token is invalidated; the successor's idle window starts over but never extends
+// beyond the family's absolute expiry (MaxExpiresAt).
+//
+// Returns ("", nil, nil) for unknown or expired tokens. When a rotated-out token is
+// replayed the family is revoked and ErrRefreshTokenReused is returned together with
+// the replayed session so callers can log who was affected. opts update the client
+// details and idle timeout recorded on the successor.
+func (s *Service) Rotate(ctx context.Context, refresh string, opts ...Option) (string, *Session, error) {
+	sess, err := s.repo.GetByRefresh(ctx, refresh)
+	if err != nil {
+		return "", nil, err
+	}
+	if sess == nil {
+		return "", nil, nil
+	}
+	// reuse is checked first: replaying a rotated token after the idle timeout must
+	// still revoke the family
+	if sess.Rotated {
+		return "", sess, s.revokeReused(ctx, sess)
+	}
+	if time.Now().UTC().After(sess.ExpiresAt) {
+		_ = s.repo.DeleteByRefresh(ctx, refresh)
+		return "", nil, nil
+	}
+	ok, err := s.repo.MarkRotated(ctx, refresh)
+	if err != nil {
+		return "", nil, err
+	}
+	if !ok {
+		// lost the race against a concurrent refresh with the same token
+		return "", sess, s.revokeReused(ctx, sess)
+	}
+
+	r, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	next := *sess
+	next.ID = ""
+	next.RefreshToken = r
+	next.Rotated = false
+	next.LastUsedAt = time.Now().UTC()
+	for _, o := range opts {
+		o(&next)
+	}
+	next.extend(next.LastUsedAt)
+	if next.FamilyID == "" {
+		// sessions created before rotation existed start a new family
+		if next.FamilyID, err = randomToken(16); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := s.repo.Create(ctx, &next); err != nil {
+		return "", nil, err
+	}
+	return r, &next, nil
+}
+
+func (s *Service) revokeReused(ctx context.Context, sess *Session) error {
+	if sess.FamilyID == "" {
+		if err := s.repo.DeleteByRefresh(ctx, sess.RefreshToken); err != nil {
+			return err
+		}
+		return ErrRefreshTokenReused
+	}
+	if err := s.repo.DeleteByFamily(ctx, sess.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// DeleteRefresh removes the session for the given refresh token. Sessions that belong
+// to a token family are revoked together with their rotated predecessors.
 func (s *Service) DeleteRefresh(ctx context.Context, refresh string) error {
+	sess, err := s.repo.GetByRefresh(ctx, refresh)
+	if err != nil {
+		return err
+	}
+	if sess != nil && sess.FamilyID != "" {
+		return s.repo.DeleteByFamily(ctx, sess.FamilyID)
+	}
 	return s.repo.DeleteByRefresh(ctx, refresh)
 }
+
+// ListSessions returns the active sessions of sub, newest first
+func (s *Service) ListSessions(ctx context.Context, sub string) ([]*Session, error) {
+	return s.repo.ListBySub(ctx, sub)
+}
+
+// RevokeSession signs sub out of session id (a token family); it returns false
+// when sub has no such session.
+func (s *Service) RevokeSession(ctx context.Context, sub, id string) (bool, error) {
+	if id == "" {
+		return false, nil
+	}
+	return s.repo.DeleteByID(ctx, sub, id)
+}
+
+// RevokeAll deletes every session of sub ("sign out everywhere")
+func (s *Service) RevokeAll(ctx context.Context, sub string) error {
+	return s.repo.DeleteBySub(ctx, sub)
+}
+
+// RevokeProviderSession ends the sessions created from the session sid of identity
+// provider iss, or every session of sub when sid is empty (OIDC back-channel logout).
+func (s *Service) RevokeProviderSession(ctx context.Context, iss, sub, sid string) error {
+	if sid != "" {
+		return s.repo.DeleteByProviderSID(ctx, iss, sub, sid)
+	}
+	if sub == "" {
+		return errors.New("sub or sid required")
+	}
+	return s.repo.DeleteBySub(ctx, sub)
+}
+
+// randomToken returns n random bytes encoded as hex
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
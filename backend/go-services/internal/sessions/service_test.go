@@ -2,6 +2,7 @@ package sessions
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 )
@@ -35,6 +36,70 @@ func (f *fakeRepo) DeleteByRefresh(ctx context.Context, refresh string) error {
 	delete(f.store, refresh)
 	return nil
 }
+func (f *fakeRepo) MarkRotated(ctx context.Context, refresh string) (bool, error) {
+	s, ok := f.store[refresh]
+	if !ok || s.Rotated {
+		return false, nil
+	}
+	s.Rotated = true
+	return true, nil
+}
+func (f *fakeRepo) DeleteByFamily(ctx context.Context, familyID string) error {
+	for k, s := range f.store {
+		if s.FamilyID == familyID {
+			delete(f.store, k)
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepo) ListBySub(ctx context.Context, sub string) ([]*Session, error) {
+	out := []*Session{}
+	for _, s := range f.store {
+		if s.Sub == sub && !s.Rotated && time.Now().Before(s.ExpiresAt) {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRepo) DeleteByID(ctx context.Context, sub, id string) (bool, error) {
+	deleted := false
+	for k, s := range f.store {
+		if s.Sub == sub && s.FamilyID == id {
+			delete(f.store, k)
+			deleted = true
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeRepo) DeleteBySub(ctx context.Context, sub string) error {
+	for k, s := range f.store {
+		if s.Sub == sub {
+			delete(f.store, k)
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepo) DeleteByProviderSID(ctx context.Context, iss, sub, sid string) error {
+	for k, s := range f.store {
+		if s.ProviderIss == iss && s.ProviderSID == sid && (sub == "" || s.Sub == sub) {
+			delete(f.store, k)
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepo) FamilyActive(ctx context.Context, familyID string) (bool, error) {
+	for _, s := range f.store {
+		if s.FamilyID == familyID && !s.Rotated && time.Now().Before(s.ExpiresAt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
 
 func TestCreateAndValidateSession(t *testing.T) {
 	repo := &fakeRepo{}
@@ -84,4 +149,144 @@ func TestValidateRefresh_Expired(t *testing.T) {
 	if _, ok := repo.store["r-exp"]; ok {
 		t.Fatalf("expected expired session to be deleted by ValidateRefresh")
 	}
-}
\ No newline at end of file
+}
+
+func TestRotate_IssuesNewTokenAndInvalidatesOld(t *testing.T) {
+	repo := &fakeRepo{}
+	svc := NewService(repo)
+	ctx := context.Background()
+	r1, err := svc.CreateSession(ctx, "sub-1", time.Hour)
+	if err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	orig, _ := svc.ValidateRefresh(ctx, r1)
+
+	r2, sess, err := svc.Rotate(ctx, r1)
+	if err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	if r2 == "" || r2 == r1 {
+		t.Fatalf("expected a new refresh token, got %q", r2)
+	}
+	if sess.FamilyID == "" || sess.FamilyID != orig.FamilyID {
+		t.Fatalf("expected family to be preserved: got %q want %q", sess.FamilyID, orig.FamilyID)
+	}
+	if !sess.ExpiresAt.Equal(orig.ExpiresAt) {
+		t.Fatalf("expected successor to keep the family expiry")
+	}
+	if old, _ := svc.ValidateRefresh(ctx, r1); old != nil {
+		t.Fatalf("expected rotated token to be invalid")
+	}
+	if cur, _ := svc.ValidateRefresh(ctx, r2); cur == nil {
+		t.Fatalf("expected new token to be valid")
+	}
+}
+
+func TestRotate_ReuseRevokesFamily(t *testing.T) {
+	repo := &fakeRepo{}
+	svc := NewService(repo)
+	ctx := context.Background()
+	r1, _ := svc.CreateSession(ctx, "sub-1", time.Hour)
+	r2, _, err := svc.Rotate(ctx, r1)
+	if err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	// unrelated session must survive
+	other, _ := svc.CreateSession(ctx, "sub-1", time.Hour)
+
+	_, sess, err := svc.Rotate(ctx, r1)
+	if !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+	if sess == nil || sess.Sub != "sub-1" {
+		t.Fatalf("expected replayed session to be returned, got %v", sess)
+	}
+	if cur, _ := svc.ValidateRefresh(ctx, r2); cur != nil {
+		t.Fatalf("expected family member to be revoked")
+	}
+	if o, _ := svc.ValidateRefresh(ctx, other); o == nil {
+		t.Fatalf("expected unrelated session to remain valid")
+	}
+}
+
+func TestSessionActive(t *testing.T) {
+	repo := &fakeRepo{}
+	svc := NewService(repo)
+	ctx := context.Background()
+	sess, err := svc.OpenSession(ctx, "sub-1", time.Hour)
+	if err != nil {
+		t.Fatalf("open session: %v", err)
+	}
+	// rotation keeps the session (family) active
+	if _, _, err := svc.Rotate(ctx, sess.RefreshToken); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	if ok, _ := svc.SessionActive(ctx, sess.FamilyID); !ok {
+		t.Fatalf("expected session to be active")
+	}
+	if err := svc.DeleteRefresh(ctx, sess.RefreshToken); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if ok, _ := svc.SessionActive(ctx, sess.FamilyID); ok {
+		t.Fatalf("expected session to be inactive after logout")
+	}
+	if ok, _ := svc.SessionActive(ctx, ""); ok {
+		t.Fatalf("expected empty sid to be inactive")
+	}
+}
+
+func TestRotate_SlidesIdleWindowUpToAbsoluteExpiry(t *testing.T) {
+	repo := &fakeRepo{}
+	svc := NewService(repo)
+	ctx := context.Background()
+	sess, err := svc.OpenSession(ctx, "sub-1", 3*time.Hour, WithIdleTimeout(time.Hour), WithClientID("gogotex-web"))
+	if err != nil {
+		t.Fatalf("open session: %v", err)
+	}
+	if !sess.MaxExpiresAt.Equal(sess.CreatedAt.Add(3 * time.Hour)) {
+		t.Fatalf("expected absolute expiry 3h after login, got %v", sess.MaxExpiresAt)
+	}
+	if !sess.ExpiresAt.Equal(sess.CreatedAt.Add(time.Hour)) {
+		t.Fatalf("expected idle expiry 1h after login, got %v", sess.ExpiresAt)
+	}
+
+	// pretend the last refresh was 2h50m ago: the next idle window would pass the cap
+	sess.LastUsedAt = sess.LastUsedAt.Add(-170 * time.Minute)
+	sess.MaxExpiresAt = time.Now().UTC().Add(10 * time.Minute)
+	sess.ExpiresAt = sess.MaxExpiresAt
+	_, next, err := svc.Rotate(ctx, sess.RefreshToken)
+	if err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	if !next.ExpiresAt.Equal(sess.MaxExpiresAt) {
+		t.Fatalf("expected expiry capped at the absolute expiry, got %v want %v", next.ExpiresAt, sess.MaxExpiresAt)
+	}
+	if next.ClientID != "gogotex-web" {
+		t.Fatalf("expected client to be kept, got %q", next.ClientID)
+	}
+
+	// a longer idle window passed to Rotate still respects the cap
+	_, again, err := svc.Rotate(ctx, next.RefreshToken, WithIdleTimeout(24*time.Hour))
+	if err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	if !again.ExpiresAt.Equal(sess.MaxExpiresAt) {
+		t.Fatalf("expected expiry capped at the absolute expiry, got %v", again.ExpiresAt)
+	}
+}
+
+func TestRotate_ExtendsIdleWindow(t *testing.T) {
+	repo := &fakeRepo{}
+	svc := NewService(repo)
+	ctx := context.Background()
+	sess, _ := svc.OpenSession(ctx, "sub-1", 24*time.Hour, WithIdleTimeout(time.Hour))
+	// the session was opened a while ago and is about to go idle
+	sess.ExpiresAt = time.Now().UTC().Add(time.Minute)
+	_, next, err := svc.Rotate(ctx, sess.RefreshToken)
+	if err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+	if d := time.Until(next.ExpiresAt); d < 59*time.Minute || d > time.Hour {
+		t.Fatalf("expected idle window to start over, expires in %v", d)
+	}
+}
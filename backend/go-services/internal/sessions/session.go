@@ -3,10 +3,97 @@ package sessions
 import "time"
 
 // Session represents a persistent refresh session stored in MongoDB
+//
+// Every refresh rotates the token: the presented session is marked Rotated and a
+// successor sharing the same FamilyID is created. Rotated sessions are kept until
+// they expire so that a replayed token can be detected and its family revoked.
+//
+// Users see one session per family: the family ID is the stable session id shown by
+// the session listing, CreatedAt is the original login and LastUsedAt/IP/UserAgent
+// describe the most recent refresh.
+//
+// A session ends when it has not been refreshed for IdleTimeout, and at the latest at
+// MaxExpiresAt (the absolute lifetime counted from login): ExpiresAt is LastUsedAt +
+// IdleTimeout capped at MaxExpiresAt, and every refresh moves it forward. Sessions
+// without an IdleTimeout last until MaxExpiresAt. ClientID is the OAuth client the
+// user signed in through; it selects the lifetime policy (see config.SessionPolicy).
+//
+// DeviceID is the device cookie of the browser that signed in (see DeviceTracker)
+// and Device a readable label derived from the user agent, e.g. "Firefox on Linux".
+//
+// ProviderIss and ProviderSID are the issuer and `sid` of the identity provider
+// session (Keycloak) the login came from; back-channel logout uses them to find the
+// sessions to revoke. IDToken is
+// the ID token of that login, sent as id_token_hint when the user logs out so that
+// Keycloak ends its SSO session too.
 type Session struct {
-	ID           string    `bson:"_id,omitempty" json:"id"`
-	RefreshToken string    `bson:"refreshToken" json:"refreshToken"`
-	Sub          string    `bson:"sub" json:"sub"`
-	ExpiresAt    time.Time `bson:"expiresAt" json:"expiresAt"`
-	CreatedAt    time.Time `bson:"createdAt" json:"createdAt"`
+	ID           string        `bson:"_id,omitempty" json:"id"`
+	RefreshToken string        `bson:"refreshToken" json:"refreshToken"`
+	FamilyID     string        `bson:"familyId,omitempty" json:"familyId,omitempty"`
+	Rotated      bool          `bson:"rotated,omitempty" json:"rotated,omitempty"`
+	Sub          string        `bson:"sub" json:"sub"`
+	ClientID     string        `bson:"clientId,omitempty" json:"clientId,omitempty"`
+	ExpiresAt    time.Time     `bson:"expiresAt" json:"expiresAt"`
+	MaxExpiresAt time.Time     `bson:"maxExpiresAt,omitempty" json:"maxExpiresAt,omitempty"`
+	IdleTimeout  time.Duration `bson:"idleTimeout,omitempty" json:"idleTimeout,omitempty"`
+	CreatedAt    time.Time     `bson:"createdAt" json:"createdAt"`
+	LastUsedAt   time.Time     `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	IP           string        `bson:"ip,omitempty" json:"ip,omitempty"`
+	UserAgent    string        `bson:"userAgent,omitempty" json:"userAgent,omitempty"`
+	Device       string        `bson:"device,omitempty" json:"device,omitempty"`
+	DeviceID     string        `bson:"deviceId,omitempty" json:"deviceId,omitempty"`
+	ProviderIss  string        `bson:"providerIss,omitempty" json:"providerIss,omitempty"`
+	ProviderSID  string        `bson:"providerSid,omitempty" json:"providerSid,omitempty"`
+	IDToken      string        `bson:"idToken,omitempty" json:"idToken,omitempty"`
+}
+
+// extend moves the idle expiry to now + IdleTimeout, never beyond MaxExpiresAt
+func (s *Session) extend(now time.Time) {
+	if s.MaxExpiresAt.IsZero() {
+		// sessions created before the absolute lifetime existed keep their expiry as cap
+		s.MaxExpiresAt = s.ExpiresAt
+	}
+	s.ExpiresAt = s.MaxExpiresAt
+	if s.IdleTimeout > 0 && now.Add(s.IdleTimeout).Before(s.MaxExpiresAt) {
+		s.ExpiresAt = now.Add(s.IdleTimeout)
+	}
+}
+
+// Option sets optional session attributes when a session is opened or rotated
+type Option func(*Session)
+
+// WithClient records the client address and user agent of the request
+func WithClient(ip, userAgent string) Option {
+	return func(s *Session) {
+		s.IP = ip
+		s.UserAgent = userAgent
+		s.Device = DeviceLabel(userAgent)
+	}
+}
+
+// WithDevice records the device cookie of the browser that signed in
+func WithDevice(id string) Option {
+	return func(s *Session) { s.DeviceID = id }
+}
+
+// WithClientID records the OAuth client the user signed in through
+func WithClientID(clientID string) Option {
+	return func(s *Session) { s.ClientID = clientID }
+}
+
+// WithIdleTimeout ends the session once it has not been refreshed for d (0 disables
+// the idle timeout). Passed to Rotate it replaces the session's idle window.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(s *Session) { s.IdleTimeout = d }
+}
+
+// WithProviderSession records the issuer and session id (`iss` and `sid` claims of
+// the ID token) of the identity provider session the session was created from
+func WithProviderSession(iss, sid string) Option {
+	return func(s *Session) { s.ProviderIss, s.ProviderSID = iss, sid }
+}
+
+// WithIDToken keeps the raw ID token of the login for RP-initiated logout
+func WithIDToken(idToken string) Option {
+	return func(s *Session) { s.IDToken = idToken }
 }
@@ -0,0 +1,83 @@
+package sessions
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// watermarkCacheTTL is how long a watermark (or its absence) is cached in Redis
+// before it is reloaded from the user store.
+const watermarkCacheTTL = time.Hour
+
+// WatermarkLoader reads a user's token-validity watermark from durable storage
+// (zero time when unset).
+type WatermarkLoader func(ctx context.Context, sub string) (time.Time, error)
+
+var watermarkLoader WatermarkLoader
+
+// SetWatermarkLoader configures where cache misses are loaded from (the users
+// collection). Safe to call with nil to disable watermark checks.
+func SetWatermarkLoader(l WatermarkLoader) {
+	watermarkLoader = l
+}
+
+func watermarkKey(sub string) string { return "watermark:" + sub }
+
+// IssuedBefore reports whether a token issued at iat predates the watermark wm. Token
+// iat claims have whole-second precision, so watermarks are kept (and compared) in
+// whole seconds too: tokens issued in the second of the watermark remain valid.
+func IssuedBefore(iat, wm time.Time) bool {
+	return !wm.IsZero() && iat.Unix() < wm.Unix()
+}
+
+// CacheTokensValidAfter stores a new watermark for sub in the Redis cache. Callers
+// persist it with the user first.
+func CacheTokensValidAfter(ctx context.Context, sub string, t time.Time) error {
+	if blacklistClient == nil {
+		return nil
+	}
+	return blacklistClient.Set(ctx, watermarkKey(sub), strconv.FormatInt(t.Unix(), 10), watermarkCacheTTL).Err()
+}
+
+// TokensValidAfter returns the watermark of sub, truncated to whole seconds: tokens
+// issued before it (see IssuedBefore) must be rejected. The Redis copy is used when
+// present; misses are loaded through the WatermarkLoader and cached. Without Redis
+// every call hits the loader. Returns the zero time when no watermark (or loader) is
+// configured.
+func TokensValidAfter(ctx context.Context, sub string) (time.Time, error) {
+	if watermarkLoader == nil || sub == "" {
+		return time.Time{}, nil
+	}
+	if blacklistClient != nil {
+		v, err := blacklistClient.Get(ctx, watermarkKey(sub)).Result()
+		if err == nil {
+			secs, perr := strconv.ParseInt(v, 10, 64)
+			if perr == nil {
+				if secs == 0 {
+					return time.Time{}, nil
+				}
+				return time.Unix(secs, 0), nil
+			}
+		} else if err != redis.Nil {
+			return time.Time{}, err
+		}
+	}
+	t, err := watermarkLoader(ctx, sub)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !t.IsZero() {
+		t = time.Unix(t.Unix(), 0)
+	}
+	if blacklistClient != nil {
+		var secs int64
+		if !t.IsZero() {
+			secs = t.Unix()
+		}
+		_ = blacklistClient.Set(ctx, watermarkKey(sub), strconv.FormatInt(secs, 10), watermarkCacheTTL).Err()
+	}
+	return t, nil
+}
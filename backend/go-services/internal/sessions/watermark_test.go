@@ -0,0 +1,80 @@
+package sessions
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	mr "github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokensValidAfter_CachesLoaderResults(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	SetBlacklistClient(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	defer SetBlacklistClient(nil)
+
+	loads := 0
+	stored := map[string]time.Time{}
+	SetWatermarkLoader(func(ctx context.Context, sub string) (time.Time, error) {
+		loads++
+		return stored[sub], nil
+	})
+	defer SetWatermarkLoader(nil)
+	ctx := context.Background()
+
+	// no watermark: the absence is cached too
+	wm, err := TokensValidAfter(ctx, "alice")
+	require.NoError(t, err)
+	require.True(t, wm.IsZero())
+	_, _ = TokensValidAfter(ctx, "alice")
+	require.Equal(t, 1, loads)
+
+	now := time.Now().Truncate(time.Second)
+	stored["alice"] = now
+	require.NoError(t, CacheTokensValidAfter(ctx, "alice", now))
+	wm, err = TokensValidAfter(ctx, "alice")
+	require.NoError(t, err)
+	require.True(t, wm.Equal(now))
+	require.Equal(t, 1, loads)
+
+	// after the cache entry expires the loader is consulted again
+	m.FastForward(watermarkCacheTTL + time.Second)
+	wm, err = TokensValidAfter(ctx, "alice")
+	require.NoError(t, err)
+	require.True(t, wm.Equal(now))
+	require.Equal(t, 2, loads)
+}
+
+func TestTokensValidAfter_SameSecondBoundary(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	SetBlacklistClient(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	defer SetBlacklistClient(nil)
+
+	// signed out everywhere 700ms into a second; the store keeps full precision
+	signOut := time.Date(2026, 10, 16, 12, 0, 0, 700*int(time.Millisecond), time.UTC)
+	SetWatermarkLoader(func(ctx context.Context, sub string) (time.Time, error) { return signOut, nil })
+	defer SetWatermarkLoader(nil)
+	ctx := context.Background()
+
+	loaded, err := TokensValidAfter(ctx, "alice")
+	require.NoError(t, err)
+	cached, err := TokensValidAfter(ctx, "alice")
+	require.NoError(t, err)
+	require.True(t, loaded.Equal(cached), "loaded %v, cached %v", loaded, cached)
+
+	second := time.Unix(signOut.Unix(), 0)
+	for _, wm := range []time.Time{loaded, cached, signOut} {
+		require.True(t, IssuedBefore(second.Add(-time.Second), wm))
+		// iat has whole seconds: a token of the same second may be issued after the
+		// sign-out (a fresh login), so it stays valid
+		require.False(t, IssuedBefore(second, wm))
+		require.False(t, IssuedBefore(second.Add(time.Second), wm))
+	}
+	require.False(t, IssuedBefore(second, time.Time{}))
+}
@@ -0,0 +1,49 @@
+package sharelinks
+
+import "time"
+
+// Role is what a guest redeeming a share link may do with the project
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"
+	RoleCommenter Role = "commenter"
+)
+
+// Scopes carried by guest access tokens
+const (
+	ScopeProjectsRead  = "projects:read"
+	ScopeCommentsWrite = "comments:write"
+)
+
+// Scopes returns the token scopes granted to guests with role r
+func (r Role) Scopes() []string {
+	switch r {
+	case RoleViewer:
+		return []string{ScopeProjectsRead}
+	case RoleCommenter:
+		return []string{ScopeProjectsRead, ScopeCommentsWrite}
+	}
+	return nil
+}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool { return r.Scopes() != nil }
+
+// Link is a share link to a project. Only the SHA-256 hash of the link secret and
+// the bcrypt hash of the optional password are stored.
+type Link struct {
+	ID                string     `bson:"_id" json:"id"`
+	ProjectID         string     `bson:"projectId" json:"projectId"`
+	CreatedBy         string     `bson:"createdBy" json:"createdBy"`
+	Role              Role       `bson:"role" json:"role"`
+	Hash              string     `bson:"tokenHash" json:"-"`
+	PasswordHash      string     `bson:"passwordHash,omitempty" json:"-"`
+	PasswordProtected bool       `bson:"passwordProtected" json:"passwordProtected"`
+	ExpiresAt         time.Time  `bson:"expiresAt" json:"expiresAt"`
+	LastUsedAt        *time.Time `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"`
+	CreatedAt         time.Time  `bson:"createdAt" json:"createdAt"`
+}
+
+// Expired reports whether the link expired at or before now
+func (l *Link) Expired(now time.Time) bool { return !now.Before(l.ExpiresAt) }
@@ -0,0 +1,79 @@
+package sharelinks
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Repository provides share link persistence
+type Repository interface {
+	Create(ctx context.Context, l *Link) error
+	GetByHash(ctx context.Context, hash string) (*Link, error)
+	GetByID(ctx context.Context, id string) (*Link, error)
+	ListByProject(ctx context.Context, projectID string) ([]*Link, error)
+	// DeleteByID removes the link id of projectID; it returns false when no such link exists.
+	DeleteByID(ctx context.Context, projectID, id string) (bool, error)
+	TouchLastUsed(ctx context.Context, id string, at time.Time) error
+}
+
+// MongoRepository implements Repository using a Mongo collection
+type MongoRepository struct {
+	col *mongo.Collection
+}
+
+func NewMongoRepository(col *mongo.Collection) *MongoRepository {
+	return &MongoRepository{col: col}
+}
+
+func (r *MongoRepository) Create(ctx context.Context, l *Link) error {
+	_, err := r.col.InsertOne(ctx, l)
+	return err
+}
+
+func (r *MongoRepository) GetByHash(ctx context.Context, hash string) (*Link, error) {
+	return r.findOne(ctx, bson.M{"tokenHash": hash})
+}
+
+func (r *MongoRepository) GetByID(ctx context.Context, id string) (*Link, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *MongoRepository) findOne(ctx context.Context, filter bson.M) (*Link, error) {
+	var l Link
+	if err := r.col.FindOne(ctx, filter).Decode(&l); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (r *MongoRepository) ListByProject(ctx context.Context, projectID string) ([]*Link, error) {
+	cur, err := r.col.Find(ctx, bson.M{"projectId": projectID}, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	out := []*Link{}
+	if err := cur.All(ctx, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *MongoRepository) DeleteByID(ctx context.Context, projectID, id string) (bool, error) {
+	res, err := r.col.DeleteOne(ctx, bson.M{"_id": id, "projectId": projectID})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount == 1, nil
+}
+
+func (r *MongoRepository) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"lastUsedAt": at}})
+	return err
+}
@@ -0,0 +1,143 @@
+package sharelinks
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TokenPrefix marks share link secrets so they can be told apart from other tokens
+const TokenPrefix = "ggs_"
+
+// MaxLifetime bounds how long a share link can be valid
+const MaxLifetime = 365 * 24 * time.Hour
+
+// lastUsedGranularity limits last-used writes to one per link and interval
+const lastUsedGranularity = time.Minute
+
+var (
+	ErrInvalidLink      = errors.New("invalid share link")
+	ErrLinkExpired      = errors.New("share link expired")
+	ErrPasswordRequired = errors.New("share link password required")
+	ErrWrongPassword    = errors.New("wrong share link password")
+)
+
+// Service manages project share links
+type Service struct {
+	repo Repository
+}
+
+func NewService(r Repository) *Service {
+	return &Service{repo: r}
+}
+
+// Create issues a share link to projectID on behalf of createdBy (the project
+// owner). ttl must be positive and at most MaxLifetime; an empty password creates
+// a link anyone holding it can redeem. The raw secret is returned once and never
+// stored.
+func (s *Service) Create(ctx context.Context, createdBy, projectID string, role Role, ttl time.Duration, password string) (string, *Link, error) {
+	if !role.Valid() {
+		return "", nil, fmt.Errorf("unknown role %q", role)
+	}
+	if ttl <= 0 || ttl > MaxLifetime {
+		return "", nil, fmt.Errorf("expiry must be between now and %d days", int(MaxLifetime.Hours()/24))
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	raw := TokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	now := time.Now().UTC()
+	l := &Link{
+		ID:        hex.EncodeToString(id),
+		ProjectID: projectID,
+		CreatedBy: createdBy,
+		Role:      role,
+		Hash:      HashToken(raw),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if password != "" {
+		h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid password: %w", err)
+		}
+		l.PasswordHash = string(h)
+		l.PasswordProtected = true
+	}
+	if err := s.repo.Create(ctx, l); err != nil {
+		return "", nil, err
+	}
+	return raw, l, nil
+}
+
+// List returns the share links of projectID (newest first)
+func (s *Service) List(ctx context.Context, projectID string) ([]*Link, error) {
+	return s.repo.ListByProject(ctx, projectID)
+}
+
+// Revoke deletes the link id of projectID; it returns false when no such link exists.
+func (s *Service) Revoke(ctx context.Context, projectID, id string) (bool, error) {
+	return s.repo.DeleteByID(ctx, projectID, id)
+}
+
+// Redeem resolves a raw link secret, checks the password of protected links and
+// records the use.
+func (s *Service) Redeem(ctx context.Context, raw, password string) (*Link, error) {
+	l, err := s.repo.GetByHash(ctx, HashToken(raw))
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return nil, ErrInvalidLink
+	}
+	now := time.Now().UTC()
+	if l.Expired(now) {
+		return nil, ErrLinkExpired
+	}
+	if l.PasswordHash != "" {
+		if password == "" {
+			return nil, ErrPasswordRequired
+		}
+		if bcrypt.CompareHashAndPassword([]byte(l.PasswordHash), []byte(password)) != nil {
+			return nil, ErrWrongPassword
+		}
+	}
+	if l.LastUsedAt == nil || now.Sub(*l.LastUsedAt) >= lastUsedGranularity {
+		if err := s.repo.TouchLastUsed(ctx, l.ID, now); err != nil {
+			logger.Warnf("sharelinks: failed to record last use of link %s: %v", l.ID, err)
+		} else {
+			l.LastUsedAt = &now
+		}
+	}
+	return l, nil
+}
+
+// Active reports whether the link id still exists and has not expired. Guest
+// tokens are checked against it on every request, so revoking a link locks its
+// guests out immediately.
+func (s *Service) Active(ctx context.Context, id string) (bool, error) {
+	l, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return l != nil && !l.Expired(time.Now()), nil
+}
+
+// HashToken returns the hex SHA-256 digest stored for a raw link secret
+func HashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,140 @@
+package sharelinks
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryRepo keeps links in a map
+type memoryRepo struct {
+	byID    map[string]*Link
+	touches int
+}
+
+func (f *memoryRepo) Create(ctx context.Context, l *Link) error {
+	if f.byID == nil {
+		f.byID = map[string]*Link{}
+	}
+	cp := *l
+	f.byID[l.ID] = &cp
+	return nil
+}
+
+func (f *memoryRepo) GetByHash(ctx context.Context, hash string) (*Link, error) {
+	for _, l := range f.byID {
+		if l.Hash == hash {
+			cp := *l
+			return &cp, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *memoryRepo) GetByID(ctx context.Context, id string) (*Link, error) {
+	if l, ok := f.byID[id]; ok {
+		cp := *l
+		return &cp, nil
+	}
+	return nil, nil
+}
+
+func (f *memoryRepo) ListByProject(ctx context.Context, projectID string) ([]*Link, error) {
+	var out []*Link
+	for _, l := range f.byID {
+		if l.ProjectID == projectID {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func (f *memoryRepo) DeleteByID(ctx context.Context, projectID, id string) (bool, error) {
+	l, ok := f.byID[id]
+	if !ok || l.ProjectID != projectID {
+		return false, nil
+	}
+	delete(f.byID, id)
+	return true, nil
+}
+
+func (f *memoryRepo) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	f.touches++
+	if l, ok := f.byID[id]; ok {
+		l.LastUsedAt = &at
+	}
+	return nil
+}
+
+func TestCreateAndRedeem(t *testing.T) {
+	ctx := context.Background()
+	repo := &memoryRepo{}
+	svc := NewService(repo)
+
+	_, _, err := svc.Create(ctx, "owner", "p1", Role("editor"), time.Hour, "")
+	require.Error(t, err)
+	_, _, err = svc.Create(ctx, "owner", "p1", RoleViewer, 0, "")
+	require.Error(t, err)
+	_, _, err = svc.Create(ctx, "owner", "p1", RoleViewer, MaxLifetime+time.Hour, "")
+	require.Error(t, err)
+
+	raw, l, err := svc.Create(ctx, "owner", "p1", RoleViewer, time.Hour, "")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(raw, TokenPrefix))
+	require.Equal(t, HashToken(raw), repo.byID[l.ID].Hash)
+	require.False(t, l.PasswordProtected)
+
+	got, err := svc.Redeem(ctx, raw, "")
+	require.NoError(t, err)
+	require.Equal(t, "p1", got.ProjectID)
+	require.Equal(t, []string{ScopeProjectsRead}, got.Role.Scopes())
+	_, err = svc.Redeem(ctx, raw+"x", "")
+	require.ErrorIs(t, err, ErrInvalidLink)
+	// last use is recorded at most once per minute
+	_, _ = svc.Redeem(ctx, raw, "")
+	require.Equal(t, 1, repo.touches)
+
+	active, err := svc.Active(ctx, l.ID)
+	require.NoError(t, err)
+	require.True(t, active)
+	ok, err := svc.Revoke(ctx, "p2", l.ID)
+	require.NoError(t, err)
+	require.False(t, ok, "links are revoked through their own project only")
+	ok, err = svc.Revoke(ctx, "p1", l.ID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	active, err = svc.Active(ctx, l.ID)
+	require.NoError(t, err)
+	require.False(t, active)
+	_, err = svc.Redeem(ctx, raw, "")
+	require.ErrorIs(t, err, ErrInvalidLink)
+}
+
+func TestRedeemPasswordAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	repo := &memoryRepo{}
+	svc := NewService(repo)
+
+	raw, l, err := svc.Create(ctx, "owner", "p1", RoleCommenter, time.Hour, "s3cret")
+	require.NoError(t, err)
+	require.True(t, l.PasswordProtected)
+	require.NotContains(t, repo.byID[l.ID].PasswordHash, "s3cret")
+
+	_, err = svc.Redeem(ctx, raw, "")
+	require.ErrorIs(t, err, ErrPasswordRequired)
+	_, err = svc.Redeem(ctx, raw, "guess")
+	require.ErrorIs(t, err, ErrWrongPassword)
+	got, err := svc.Redeem(ctx, raw, "s3cret")
+	require.NoError(t, err)
+	require.Equal(t, RoleCommenter, got.Role)
+
+	repo.byID[l.ID].ExpiresAt = time.Now().Add(-time.Second)
+	_, err = svc.Redeem(ctx, raw, "s3cret")
+	require.ErrorIs(t, err, ErrLinkExpired)
+	active, err := svc.Active(ctx, l.ID)
+	require.NoError(t, err)
+	require.False(t, active)
+}
@@ -0,0 +1,435 @@
+package tokens
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported asymmetric signing algorithms
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningKey is a private key used to sign access tokens. The key id (kid) is
+// written to the JWT header so verifiers can pick the matching public key.
+type SigningKey struct {
+	KID       string
+	Algorithm string
+	Private   crypto.Signer
+	CreatedAt time.Time
+	// RetiredAt is set once a newer key took over signing. Retired keys stay
+	// published in the JWKS until tokens signed with them have expired.
+	RetiredAt time.Time
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// Key directory coordination between replicas
+const (
+	// rotationLockFile in the key directory is held by the replica rotating the key
+	rotationLockFile = ".rotate.lock"
+	// rotationLockStale is when a lock left behind by a crashed replica is broken
+	rotationLockStale = time.Minute
+	// missReloadInterval rate-limits reloads triggered by tokens with an unknown kid
+	missReloadInterval = 5 * time.Second
+)
+
+// errRotationLocked is returned when another replica holds the rotation lock
+var errRotationLocked = errors.New("signing key rotation in progress elsewhere")
+
+// KeySet holds the active signing key plus recently retired keys.
+// Keys are persisted as PKCS#8 PEM files named "<kid>.pem" in dir (when set) so that
+// restarts and other replicas sharing the directory use the same keys.
+type KeySet struct {
+	mu        sync.RWMutex
+	alg       string
+	dir       string
+	retention time.Duration
+	keys      []*SigningKey // ordered by CreatedAt; the last entry is the active key
+
+	missMu     sync.Mutex
+	lastMissAt time.Time // last reload caused by an unknown kid
+}
+
+// NewKeySet loads the keys found in dir, or generates (and stores) a fresh key when
+// none exist. retention is how long a retired key remains published; it should be
+// at least the access-token TTL.
+func NewKeySet(alg, dir string, retention time.Duration) (*KeySet, error) {
+	if alg != AlgRS256 && alg != AlgEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	ks := &KeySet{alg: alg, dir: dir, retention: retention}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	// replicas starting together must not each create a first key
+	missing := func() bool { return ks.Active() == nil }
+	for deadline := time.Now().Add(rotationLockStale); ; {
+		err := ks.rotateIf(missing)
+		if !errors.Is(err, errRotationLocked) {
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(100 * time.Millisecond)
+		if err := ks.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	return ks, nil
+}
+
+// Active returns the key currently used for signing (nil when the set is empty).
+func (ks *KeySet) Active() *SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if len(ks.keys) == 0 {
+		return nil
+	}
+	return ks.keys[len(ks.keys)-1]
+}
+
+// PublicKey returns the public key for kid if it is still published.
+func (ks *KeySet) PublicKey(kid string) (crypto.PublicKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, k := range ks.keys {
+		if k.KID == kid {
+			return k.Private.Public(), true
+		}
+	}
+	return nil, false
+}
+
+// Reload re-reads the key directory. Keys are ordered by file modification time;
+// each key is considered retired when its successor was created.
+func (ks *KeySet) Reload() error {
+	if ks.dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(ks.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read key dir: %w", err)
+	}
+	var loaded []*SigningKey
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".pem") {
+			continue
+		}
+		path := filepath.Join(ks.dir, e.Name())
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		priv, err := readPrivateKey(path)
+		if err != nil {
+			return fmt.Errorf("load %s: %w", path, err)
+		}
+		alg := AlgRS256
+		if _, ok := priv.(ed25519.PrivateKey); ok {
+			alg = AlgEdDSA
+		}
+		if alg != ks.alg {
+			logger.Warnf("tokens: ignoring %s key %s (configured algorithm is %s)", alg, e.Name(), ks.alg)
+			continue
+		}
+		loaded = append(loaded, &SigningKey{
+			KID:       strings.TrimSuffix(e.Name(), ".pem"),
+			Algorithm: alg,
+			Private:   priv,
+			CreatedAt: info.ModTime().UTC(),
+		})
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].CreatedAt.Before(loaded[j].CreatedAt) })
+	for i := 0; i < len(loaded)-1; i++ {
+		loaded[i].RetiredAt = loaded[i+1].CreatedAt
+	}
+	ks.mu.Lock()
+	ks.keys = loaded
+	ks.mu.Unlock()
+	ks.prune(time.Now().UTC())
+	return nil
+}
+
+// reloadOnMiss re-reads the key directory for a token signed with an unknown kid,
+// which another replica may have just created. It reloads at most once per
+// missReloadInterval and reports whether it did.
+func (ks *KeySet) reloadOnMiss() bool {
+	if ks.dir == "" {
+		return false
+	}
+	ks.missMu.Lock()
+	if time.Since(ks.lastMissAt) < missReloadInterval {
+		ks.missMu.Unlock()
+		return false
+	}
+	ks.lastMissAt = time.Now()
+	ks.missMu.Unlock()
+	if err := ks.Reload(); err != nil {
+		logger.Warnf("tokens: reload signing keys: %v", err)
+		return false
+	}
+	return true
+}
+
+// rotateIf rotates the key when due reports true. With a key directory only the
+// replica holding the rotation lock rotates, after re-reading the directory, so
+// replicas never both replace the same key; others get errRotationLocked.
+func (ks *KeySet) rotateIf(due func() bool) error {
+	if !due() {
+		return nil
+	}
+	if ks.dir == "" {
+		return ks.Rotate()
+	}
+	unlock, err := lockKeyDir(ks.dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := ks.Reload(); err != nil {
+		return err
+	}
+	if !due() {
+		return nil
+	}
+	return ks.Rotate()
+}
+
+// lockKeyDir takes the rotation lock of dir, breaking locks older than
+// rotationLockStale. It returns errRotationLocked while another holder is active.
+func lockKeyDir(dir string) (func(), error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, rotationLockFile)
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			_, _ = fmt.Fprintf(f, "%d\n", os.Getpid())
+			_ = f.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("lock key dir: %w", err)
+		}
+		info, statErr := os.Stat(path)
+		if attempt > 0 || statErr != nil || time.Since(info.ModTime()) < rotationLockStale {
+			return nil, errRotationLocked
+		}
+		logger.Warnf("tokens: breaking stale rotation lock %s", path)
+		_ = os.Remove(path)
+	}
+}
+
+// Rotate generates a new active key and retires the current one. Replicas sharing
+// a key directory should rotate through StartRotation, which takes the rotation lock.
+func (ks *KeySet) Rotate() error {
+	k, err := generateKey(ks.alg)
+	if err != nil {
+		return err
+	}
+	if ks.dir != "" {
+		if err := writePrivateKey(filepath.Join(ks.dir, k.KID+".pem"), k.Private); err != nil {
+			return err
+		}
+	}
+	now := time.Now().UTC()
+	k.CreatedAt = now
+	ks.mu.Lock()
+	if n := len(ks.keys); n > 0 {
+		ks.keys[n-1].RetiredAt = now
+	}
+	ks.keys = append(ks.keys, k)
+	ks.mu.Unlock()
+	ks.prune(now)
+	logger.Infof("tokens: rotated signing key (kid=%s alg=%s)", k.KID, k.Algorithm)
+	return nil
+}
+
+// prune drops retired keys whose tokens can no longer be valid.
+func (ks *KeySet) prune(now time.Time) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	kept := ks.keys[:0]
+	for _, k := range ks.keys {
+		if !k.RetiredAt.IsZero() && now.Sub(k.RetiredAt) > ks.retention {
+			if ks.dir != "" {
+				_ = os.Remove(filepath.Join(ks.dir, k.KID+".pem"))
+			}
+			continue
+		}
+		kept = append(kept, k)
+	}
+	ks.keys = kept
+}
+
+// StartRotation rotates the active key once it is older than interval. It also
+// reloads the key directory on every tick so replicas sharing the directory pick
+// up each other's keys; only one of them rotates (see rotateIf). Blocks until ctx
+// is cancelled; run it in a goroutine.
+func (ks *KeySet) StartRotation(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	tick := time.Minute
+	if interval < tick {
+		tick = interval
+	}
+	t := time.NewTicker(tick)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := ks.Reload(); err != nil {
+				logger.Warnf("tokens: reload signing keys: %v", err)
+			}
+			due := func() bool { a := ks.Active(); return a == nil || time.Since(a.CreatedAt) >= interval }
+			if err := ks.rotateIf(due); err != nil && !errors.Is(err, errRotationLocked) {
+				logger.Errorf("tokens: rotate signing key: %v", err)
+			}
+		}
+	}
+}
+
+// JWK is a single JSON Web Key (RFC 7517) describing a public signing key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public part of every published key (active and retired).
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	out := JWKS{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		jwk := JWK{Kid: k.KID, Use: "sig", Alg: k.Algorithm}
+		switch pub := k.Private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		out.Keys = append(out.Keys, jwk)
+	}
+	return out
+}
+
+func generateKey(alg string) (*SigningKey, error) {
+	kidBytes := make([]byte, 8)
+	if _, err := rand.Read(kidBytes); err != nil {
+		return nil, err
+	}
+	k := &SigningKey{KID: hex.EncodeToString(kidBytes), Algorithm: alg}
+	switch alg {
+	case AlgRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		k.Private = priv
+	case AlgEdDSA:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		k.Private = priv
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	return k, nil
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch kk := k.(type) {
+		case *rsa.PrivateKey:
+			return kk, nil
+		case ed25519.PrivateKey:
+			return kk, nil
+		}
+		return nil, fmt.Errorf("unsupported private key type %T", k)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+func writePrivateKey(path string, priv crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+}
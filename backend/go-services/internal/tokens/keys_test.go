@@ -0,0 +1,178 @@
+package tokens
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func keyfunc(ks *KeySet) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		pub, ok := ks.PublicKey(kid)
+		if !ok {
+			return nil, jwt.ErrTokenUnverifiable
+		}
+		return pub, nil
+	}
+}
+
+func TestKeySet_SignsWithKidAndVerifiesWithPublicKey(t *testing.T) {
+	for _, alg := range []string{AlgRS256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			ks, err := NewKeySet(alg, t.TempDir(), time.Hour)
+			if err != nil {
+				t.Fatalf("NewKeySet: %v", err)
+			}
+			SetKeySet(ks)
+			defer SetKeySet(nil)
+
+			tokenStr, err := GenerateAccessToken(&config.Config{}, &models.User{Sub: "u1"}, time.Minute)
+			if err != nil {
+				t.Fatalf("GenerateAccessToken: %v", err)
+			}
+			parsed, err := jwt.Parse(tokenStr, keyfunc(ks), jwt.WithValidMethods([]string{alg}))
+			if err != nil || !parsed.Valid {
+				t.Fatalf("expected token to verify: %v", err)
+			}
+			if parsed.Header["kid"] != ks.Active().KID {
+				t.Fatalf("unexpected kid header: %v", parsed.Header["kid"])
+			}
+		})
+	}
+}
+
+func TestKeySet_PersistsAndReloadsKeys(t *testing.T) {
+	dir := t.TempDir()
+	ks, err := NewKeySet(AlgRS256, dir, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	kid := ks.Active().KID
+	if _, err := os.Stat(filepath.Join(dir, kid+".pem")); err != nil {
+		t.Fatalf("expected key file to be written: %v", err)
+	}
+	again, err := NewKeySet(AlgRS256, dir, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeySet (reload): %v", err)
+	}
+	if again.Active().KID != kid {
+		t.Fatalf("expected reloaded key %s, got %s", kid, again.Active().KID)
+	}
+}
+
+func TestKeySet_RotationKeepsOldKeyPublished(t *testing.T) {
+	ks, err := NewKeySet(AlgEdDSA, t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	SetKeySet(ks)
+	defer SetKeySet(nil)
+
+	oldTok, err := GenerateAccessToken(&config.Config{}, &models.User{Sub: "u1"}, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	oldKID := ks.Active().KID
+	if err := ks.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if ks.Active().KID == oldKID {
+		t.Fatalf("expected a new active key")
+	}
+	if got := len(ks.JWKS().Keys); got != 2 {
+		t.Fatalf("expected 2 published keys, got %d", got)
+	}
+	if _, err := jwt.Parse(oldTok, keyfunc(ks)); err != nil {
+		t.Fatalf("token signed with retired key should still verify: %v", err)
+	}
+
+	// once the retention window has passed the retired key is dropped
+	ks.prune(time.Now().Add(2 * time.Hour))
+	if _, ok := ks.PublicKey(oldKID); ok {
+		t.Fatalf("expected retired key to be pruned")
+	}
+}
+
+func TestKeySet_JWKSFields(t *testing.T) {
+	rs, _ := NewKeySet(AlgRS256, "", time.Hour)
+	k := rs.JWKS().Keys[0]
+	if k.Kty != "RSA" || k.Alg != AlgRS256 || k.N == "" || k.E != "AQAB" || k.Kid == "" {
+		t.Fatalf("unexpected RSA JWK: %+v", k)
+	}
+	ed, _ := NewKeySet(AlgEdDSA, "", time.Hour)
+	k = ed.JWKS().Keys[0]
+	if k.Kty != "OKP" || k.Crv != "Ed25519" || k.X == "" {
+		t.Fatalf("unexpected OKP JWK: %+v", k)
+	}
+}
+
+func TestKeySet_RotationIsSingleWriter(t *testing.T) {
+	dir := t.TempDir()
+	a, err := NewKeySet(AlgEdDSA, dir, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	b, err := NewKeySet(AlgEdDSA, dir, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeySet (replica): %v", err)
+	}
+	first := a.Active().KID
+	if b.Active().KID != first {
+		t.Fatalf("replica should share the first key")
+	}
+	pems := func() int {
+		m, _ := filepath.Glob(filepath.Join(dir, "*.pem"))
+		return len(m)
+	}
+
+	// while another replica holds the lock nobody rotates
+	lock := filepath.Join(dir, rotationLockFile)
+	if err := os.WriteFile(lock, []byte("1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.rotateIf(func() bool { return true }); !errors.Is(err, errRotationLocked) {
+		t.Fatalf("expected errRotationLocked, got %v", err)
+	}
+	if pems() != 1 {
+		t.Fatalf("expected no rotation while locked")
+	}
+
+	// both replicas find the key due; the second sees the first one's key under the lock
+	if err := os.Remove(lock); err != nil {
+		t.Fatal(err)
+	}
+	for _, ks := range []*KeySet{a, b} {
+		ks := ks
+		if err := ks.rotateIf(func() bool { return ks.Active().KID == first }); err != nil {
+			t.Fatalf("rotateIf: %v", err)
+		}
+	}
+	if pems() != 2 || a.Active().KID != b.Active().KID {
+		t.Fatalf("expected exactly one rotation, got %d keys", pems())
+	}
+
+	// a lock left behind by a crashed replica is broken
+	if err := os.WriteFile(lock, []byte("1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * rotationLockStale)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.rotateIf(func() bool { return true }); err != nil {
+		t.Fatalf("rotateIf with stale lock: %v", err)
+	}
+	if pems() != 3 {
+		t.Fatalf("expected rotation after breaking the stale lock")
+	}
+	if _, err := os.Stat(lock); !os.IsNotExist(err) {
+		t.Fatalf("expected the lock to be released")
+	}
+}
@@ -1,6 +1,10 @@
 package tokens
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gogotex/gogotex/backend/go-services/internal/config"
@@ -8,15 +12,147 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// GenerateAccessToken creates a signed JWT access token for the user
-func GenerateAccessToken(cfg *config.Config, u *models.User, ttl time.Duration) (string, error) {
+// package-level key set used for asymmetric signing (optional)
+var (
+	keySetMu sync.RWMutex
+	keySet   *KeySet
+)
+
+// SetKeySet configures the key set used to sign access tokens. When no key set is
+// configured (nil), tokens are signed with HS256 and cfg.JWT.Secret.
+func SetKeySet(ks *KeySet) {
+	keySetMu.Lock()
+	keySet = ks
+	keySetMu.Unlock()
+}
+
+// CurrentKeySet returns the configured key set or nil.
+func CurrentKeySet() *KeySet {
+	keySetMu.RLock()
+	defer keySetMu.RUnlock()
+	return keySet
+}
+
+// Option adds optional claims to an access token
+type Option func(jwt.MapClaims)
+
+// WithSessionID binds the token to a refresh session (token family) via the `sid`
+// claim, so introspection can report it inactive once the session is revoked.
+func WithSessionID(sid string) Option {
+	return func(c jwt.MapClaims) {
+		if sid != "" {
+			c["sid"] = sid
+		}
+	}
+}
+
+// WithActor marks the token as an impersonation token: actorSub acts on behalf of
+// the token's subject (the `act` claim of RFC 8693).
+func WithActor(actorSub string) Option {
+	return func(c jwt.MapClaims) {
+		c["act"] = map[string]interface{}{"sub": actorSub}
+	}
+}
+
+// GenerateAccessToken creates a signed JWT access token for the user,
+// carrying a random `jti` used for revocation and the user's roles and groups.
+func GenerateAccessToken(cfg *config.Config, u *models.User, ttl time.Duration, opts ...Option) (string, error) {
+	jti, err := newJTI()
+	if err != nil {
+		return "", err
+	}
 	claims := jwt.MapClaims{
+		"jti":   jti,
 		"sub":   u.Sub,
 		"name":  u.Name,
 		"email": u.Email,
 		"iat":   time.Now().Unix(),
 		"exp":   time.Now().Add(ttl).Unix(),
 	}
+	if len(u.Roles) > 0 {
+		claims["roles"] = u.Roles
+	}
+	if len(u.Groups) > 0 {
+		claims["groups"] = u.Groups
+	}
+	for _, o := range opts {
+		o(claims)
+	}
+	return sign(cfg, claims)
+}
+
+// ClientTokenType is the `token_type` claim of client-credentials tokens
+const ClientTokenType = "client"
+
+// GenerateClientToken creates a signed JWT for a confidential client acting on its
+// own behalf (client_credentials grant). It carries `client_id` and the granted
+// `scope` but no `sub`, so it can never be mistaken for a user's token.
+func GenerateClientToken(cfg *config.Config, clientID string, scopes []string, ttl time.Duration) (string, error) {
+	jti, err := newJTI()
+	if err != nil {
+		return "", err
+	}
+	claims := jwt.MapClaims{
+		"jti":        jti,
+		"client_id":  clientID,
+		"scope":      strings.Join(scopes, " "),
+		"token_type": ClientTokenType,
+		"iat":        time.Now().Unix(),
+		"exp":        time.Now().Add(ttl).Unix(),
+	}
+	return sign(cfg, claims)
+}
+
+// GuestTokenType is the `token_type` claim of share-link guest tokens
+const GuestTokenType = "guest"
+
+// GenerateGuestToken creates a signed JWT for an anonymous guest who redeemed the
+// share link linkID. It carries no `sub` (there is no backing user) but the
+// `share_link`, `project_id`, `share_role` and granted `scope` claims.
+func GenerateGuestToken(cfg *config.Config, linkID, projectID, role string, scopes []string, ttl time.Duration) (string, error) {
+	jti, err := newJTI()
+	if err != nil {
+		return "", err
+	}
+	claims := jwt.MapClaims{
+		"jti":        jti,
+		"share_link": linkID,
+		"project_id": projectID,
+		"share_role": role,
+		"scope":      strings.Join(scopes, " "),
+		"token_type": GuestTokenType,
+		"iat":        time.Now().Unix(),
+		"exp":        time.Now().Add(ttl).Unix(),
+	}
+	return sign(cfg, claims)
+}
+
+// sign adds the configured iss/aud claims and signs with the active asymmetric key
+// (setting the kid header) or, when no key set is configured, with HS256 and the
+// shared secret.
+func sign(cfg *config.Config, claims jwt.MapClaims) (string, error) {
+	if cfg.JWT.Issuer != "" {
+		claims["iss"] = cfg.JWT.Issuer
+	}
+	if cfg.JWT.Audience != "" {
+		claims["aud"] = cfg.JWT.Audience
+	}
+	if ks := CurrentKeySet(); ks != nil {
+		if k := ks.Active(); k != nil {
+			jt := jwt.NewWithClaims(k.method(), claims)
+			jt.Header["kid"] = k.KID
+			return jt.SignedString(k.Private)
+		}
+	}
 	jt := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return jt.SignedString([]byte(cfg.JWT.Secret))
 }
+
+// newJTI returns a random token identifier
+func newJTI() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
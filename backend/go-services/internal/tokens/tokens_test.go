@@ -1,6 +1,7 @@
 package tokens
 
 import (
+	"encoding/base64"
 	"strings"
 	"testing"
 	"time"
@@ -37,6 +38,13 @@ func TestGenerateAccessToken_ValidAndClaims(t *testing.T) {
 	if claims["sub"] != u.Sub {
 		t.Fatalf("unexpected sub claim: got=%v want=%v", claims["sub"], u.Sub)
 	}
+	if jti, _ := claims["jti"].(string); len(jti) != 32 {
+		t.Fatalf("expected a random jti claim, got %v", claims["jti"])
+	}
+	other, _ := GenerateAccessToken(cfg, u, 2*time.Minute)
+	if other == tokenStr {
+		t.Fatalf("expected distinct tokens (jti) for the same user")
+	}
 }
 
 func TestGenerateAccessToken_Expiry(t *testing.T) {
@@ -82,8 +90,8 @@ func TestParseToken_Malformed(t *testing.T) {
 func TestParseToken_AlgNoneRejected(t *testing.T) {
 	// header {"alg":"none"}
 	payload := `{"sub":"u-none","exp":9999999999}`
-	headerEnc := jwt.EncodeSegment([]byte(`{"alg":"none"}`))
-	payloadEnc := jwt.EncodeSegment([]byte(payload))
+	headerEnc := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payloadEnc := base64.RawURLEncoding.EncodeToString([]byte(payload))
 	tok := headerEnc + "." + payloadEnc + "."
 	_, err := jwt.Parse(tok, func(token *jwt.Token) (interface{}, error) { return []byte("x"), nil })
 	if err == nil {
@@ -105,10 +113,10 @@ func TestParseToken_TamperedPayload(t *testing.T) {
 	if len(parts) != 3 {
 		t.Fatalf("unexpected token parts")
 	}
-	payloadBytes, _ := jwt.DecodeSegment(parts[1])
+	payloadBytes, _ := base64.RawURLEncoding.DecodeString(parts[1])
 	payloadStr := string(payloadBytes)
 	payloadStr = strings.Replace(payloadStr, "user-t", "attacker", 1)
-	parts[1] = jwt.EncodeSegment([]byte(payloadStr))
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(payloadStr))
 	tampered := strings.Join(parts, ".")
 	_, err = jwt.Parse(tampered, func(token *jwt.Token) (interface{}, error) { return []byte(cfg.JWT.Secret), nil })
 	if err == nil {
@@ -0,0 +1,123 @@
+package tokens
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+)
+
+func verifierConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.JWT.Secret = "verifier-test-secret-32-bytes-xxxxx"
+	cfg.JWT.Issuer = "gogotex-auth"
+	cfg.JWT.Audience = "gogotex"
+	return cfg
+}
+
+func TestVerifier_AcceptsOwnToken(t *testing.T) {
+	cfg := verifierConfig()
+	tok, err := GenerateAccessToken(cfg, &models.User{Sub: "u1", Email: "u1@example.com"}, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken: %v", err)
+	}
+	got, err := NewVerifier(cfg).Verify(context.Background(), tok)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	var claims map[string]interface{}
+	if err := got.Claims(&claims); err != nil {
+		t.Fatalf("Claims: %v", err)
+	}
+	if claims["sub"] != "u1" || claims["iss"] != "gogotex-auth" {
+		t.Fatalf("unexpected claims: %v", claims)
+	}
+}
+
+func TestVerifier_RejectsWrongIssuerAudienceAndExpired(t *testing.T) {
+	cfg := verifierConfig()
+	u := &models.User{Sub: "u1"}
+
+	other := verifierConfig()
+	other.JWT.Issuer = "someone-else"
+	badIss, _ := GenerateAccessToken(other, u, time.Minute)
+
+	other = verifierConfig()
+	other.JWT.Audience = "another-service"
+	badAud, _ := GenerateAccessToken(other, u, time.Minute)
+
+	expired, _ := GenerateAccessToken(cfg, u, -time.Minute)
+
+	v := NewVerifier(cfg)
+	for name, tok := range map[string]string{"issuer": badIss, "audience": badAud, "expired": expired} {
+		if _, err := v.Verify(context.Background(), tok); err == nil {
+			t.Fatalf("expected %s check to fail", name)
+		}
+	}
+}
+
+func TestVerifier_KeySetRejectsHS256(t *testing.T) {
+	cfg := verifierConfig()
+	hsTok, _ := GenerateAccessToken(cfg, &models.User{Sub: "u1"}, time.Minute)
+
+	ks, err := NewKeySet(AlgRS256, "", time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	SetKeySet(ks)
+	defer SetKeySet(nil)
+
+	v := NewVerifier(cfg)
+	if _, err := v.Verify(context.Background(), hsTok); err == nil {
+		t.Fatalf("expected HS256 token to be rejected when asymmetric keys are configured")
+	}
+	rsTok, _ := GenerateAccessToken(cfg, &models.User{Sub: "u1"}, time.Minute)
+	if _, err := v.Verify(context.Background(), rsTok); err != nil {
+		t.Fatalf("expected RS256 token to verify: %v", err)
+	}
+}
+
+func TestVerifier_ReloadsKeysOfOtherReplicas(t *testing.T) {
+	dir := t.TempDir()
+	local, err := NewKeySet(AlgEdDSA, dir, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	replica, err := NewKeySet(AlgEdDSA, dir, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeySet (replica): %v", err)
+	}
+	defer SetKeySet(nil)
+	cfg := verifierConfig()
+	// signTo returns a token signed by a key the replica has just rotated to
+	signTo := func() string {
+		t.Helper()
+		if err := replica.Rotate(); err != nil {
+			t.Fatalf("Rotate: %v", err)
+		}
+		SetKeySet(replica)
+		tok, err := GenerateAccessToken(cfg, &models.User{Sub: "u1"}, time.Minute)
+		if err != nil {
+			t.Fatalf("GenerateAccessToken: %v", err)
+		}
+		SetKeySet(local)
+		return tok
+	}
+
+	v := NewVerifier(cfg)
+	if _, err := v.Verify(context.Background(), signTo()); err != nil {
+		t.Fatalf("token of a replica key should verify after reload: %v", err)
+	}
+
+	// unknown kids reload the directory at most once per interval
+	tok := signTo()
+	if _, err := v.Verify(context.Background(), tok); err == nil {
+		t.Fatalf("expected the reload to be rate-limited")
+	}
+	local.lastMissAt = time.Now().Add(-missReloadInterval)
+	if _, err := v.Verify(context.Background(), tok); err != nil {
+		t.Fatalf("Verify after the interval: %v", err)
+	}
+}
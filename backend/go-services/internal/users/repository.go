@@ -2,6 +2,7 @@ package users
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/gogotex/gogotex/backend/go-services/internal/models"
@@ -12,10 +13,18 @@ import (
 
 // UserRepository defines persistence operations for users
 type UserRepository interface {
-	UpsertBySub(ctx context.Context, u *models.User) (*models.User, error)
+	// UpsertByIdentity creates or updates the user with u's (Issuer, OIDCId). Sub is
+	// only written when the user is created.
+	UpsertByIdentity(ctx context.Context, u *models.User) (*models.User, error)
+	GetByIdentity(ctx context.Context, issuer, subject string) (*models.User, error)
 	GetBySub(ctx context.Context, sub string) (*models.User, error)
+	SetTokensValidAfter(ctx context.Context, sub string, t time.Time) error
 }
 
+// ErrIdentityConflict is returned by UpsertByIdentity when the user cannot be stored
+// because another account already holds its application subject
+var ErrIdentityConflict = errors.New("identity conflicts with an existing user")
+
 // MongoUserRepository implements UserRepository using MongoDB
 type MongoUserRepository struct {
 	col *mongo.Collection
@@ -26,24 +35,39 @@ func NewMongoUserRepository(col *mongo.Collection) *MongoUserRepository {
 	return &MongoUserRepository{col: col}
 }
 
-func (r *MongoUserRepository) UpsertBySub(ctx context.Context, u *models.User) (*models.User, error) {
+func (r *MongoUserRepository) UpsertByIdentity(ctx context.Context, u *models.User) (*models.User, error) {
 	now := time.Now().UTC()
 	if u.CreatedAt.IsZero() {
 		u.CreatedAt = now
 	}
 	u.UpdatedAt = now
 
-	filter := bson.M{"sub": u.Sub}
-	repl := bson.M{"$set": bson.M{
-		"oidcId":    u.Sub,
-		"email":     u.Email,
-		"name":      u.Name,
-		"updatedAt": u.UpdatedAt,
-		"createdAt": u.CreatedAt,
-	}}
+	filter := bson.M{"issuer": u.Issuer, "oidcId": u.OIDCId}
+	repl := bson.M{
+		"$set": bson.M{
+			"email":     u.Email,
+			"name":      u.Name,
+			"roles":     u.Roles,
+			"groups":    u.Groups,
+			"updatedAt": u.UpdatedAt,
+		},
+		"$setOnInsert": bson.M{
+			"sub":       u.Sub,
+			"createdAt": u.CreatedAt,
+		},
+	}
 	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
 	var updated models.User
-	if err := r.col.FindOneAndUpdate(ctx, filter, repl, opts).Decode(&updated); err != nil {
+	err := r.col.FindOneAndUpdate(ctx, filter, repl, opts).Decode(&updated)
+	if mongo.IsDuplicateKeyError(err) {
+		// a concurrent first login of the same identity inserted it first; the retry
+		// updates that user. Failing again means another user holds the subject.
+		err = r.col.FindOneAndUpdate(ctx, filter, repl, opts).Decode(&updated)
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrIdentityConflict
+		}
+	}
+	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			// Shouldn't happen because of upsert, but handle gracefully
 			return u, nil
@@ -53,6 +77,58 @@ func (r *MongoUserRepository) UpsertBySub(ctx context.Context, u *models.User) (
 	return &updated, nil
 }
 
+// EnsureIndexes migrates the indexes of the users collection: users are unique per
+// (issuer, oidcId) and per application subject, while the same email may belong to
+// users of several providers. It drops the unique oidcId and email indexes of
+// databases created before multiple providers.
+func (r *MongoUserRepository) EnsureIndexes(ctx context.Context) error {
+	cur, err := r.col.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+	var specs []bson.M
+	if err := cur.All(ctx, &specs); err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		name, _ := spec["name"].(string)
+		unique, _ := spec["unique"].(bool)
+		if name == "oidcId_1" || (name == "email_1" && unique) {
+			if _, err := r.col.Indexes().DropOne(ctx, name); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = r.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "issuer", Value: 1}, {Key: "oidcId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "sub", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "email", Value: 1}}},
+	})
+	return err
+}
+
+func (r *MongoUserRepository) GetByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	var u models.User
+	if err := r.col.FindOne(ctx, bson.M{"issuer": issuer, "oidcId": subject}).Decode(&u); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+// AdoptLegacyUsers assigns issuer to users stored before users were keyed by
+// (issuer, sub); those all came from the primary provider. It returns the number of
+// users updated.
+func (r *MongoUserRepository) AdoptLegacyUsers(ctx context.Context, issuer string) (int64, error) {
+	res, err := r.col.UpdateMany(ctx, bson.M{"issuer": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"issuer": issuer}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
 func (r *MongoUserRepository) GetBySub(ctx context.Context, sub string) (*models.User, error) {
 	var u models.User
 	if err := r.col.FindOne(ctx, bson.M{"sub": sub}).Decode(&u); err != nil {
@@ -63,3 +139,8 @@ func (r *MongoUserRepository) GetBySub(ctx context.Context, sub string) (*models
 	}
 	return &u, nil
 }
+
+func (r *MongoUserRepository) SetTokensValidAfter(ctx context.Context, sub string, t time.Time) error {
+	_, err := r.col.UpdateOne(ctx, bson.M{"sub": sub}, bson.M{"$set": bson.M{"tokensValidAfter": t}})
+	return err
+}
@@ -0,0 +1,69 @@
+package users
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func duplicateKey() bson.D {
+	return mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 11000, Message: "E11000 duplicate key error collection: gogotex.users"})
+}
+
+func TestMongoUserRepository_UpsertDuplicateKey(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("concurrent first login is retried", func(mt *mtest.T) {
+		mt.AddMockResponses(duplicateKey(), bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "sub", Value: "alice-sub"}, {Key: "email", Value: "a@example.com"}}}})
+		u, err := NewMongoUserRepository(mt.Coll).UpsertByIdentity(context.Background(), &models.User{Sub: "alice-sub", Issuer: "https://idp/realms/a", OIDCId: "alice-sub"})
+		require.NoError(t, err)
+		require.Equal(t, "alice-sub", u.Sub)
+	})
+
+	mt.Run("subject held by another user", func(mt *mtest.T) {
+		mt.AddMockResponses(duplicateKey(), duplicateKey())
+		_, err := NewMongoUserRepository(mt.Coll).UpsertByIdentity(context.Background(), &models.User{Sub: "alice-sub", Issuer: "https://idp/realms/a", OIDCId: "alice-sub"})
+		require.ErrorIs(t, err, ErrIdentityConflict)
+	})
+}
+
+func TestMongoUserRepository_EnsureIndexesDropsLegacyUniqueIndexes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("migrate", func(mt *mtest.T) {
+		ns := mt.Coll.Database().Name() + "." + mt.Coll.Name()
+		ok := bson.D{{Key: "ok", Value: 1}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch,
+				bson.D{{Key: "name", Value: "_id_"}},
+				bson.D{{Key: "name", Value: "oidcId_1"}, {Key: "unique", Value: true}},
+				bson.D{{Key: "name", Value: "email_1"}, {Key: "unique", Value: true}},
+				bson.D{{Key: "name", Value: "sub_1"}, {Key: "unique", Value: true}},
+			),
+			ok, ok, ok,
+		)
+		mt.ClearEvents()
+		require.NoError(t, NewMongoUserRepository(mt.Coll).EnsureIndexes(context.Background()))
+
+		var dropped []string
+		for e := mt.GetStartedEvent(); e != nil; e = mt.GetStartedEvent() {
+			if e.CommandName == "dropIndexes" {
+				dropped = append(dropped, e.Command.Lookup("index").StringValue())
+			}
+			if e.CommandName == "createIndexes" {
+				idx, err := e.Command.Lookup("indexes").Array().Values()
+				require.NoError(t, err)
+				require.Len(t, idx, 3)
+				email := idx[2].Document()
+				require.Equal(t, "email_1", email.Lookup("name").StringValue())
+				_, unique := email.Lookup("unique").BooleanOK()
+				require.False(t, unique)
+			}
+		}
+		require.Equal(t, []string{"oidcId_1", "email_1"}, dropped)
+	})
+}
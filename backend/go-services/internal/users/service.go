@@ -2,36 +2,116 @@ package users
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
 
 	"github.com/gogotex/gogotex/backend/go-services/internal/models"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
 )
 
 // Service encapsulates user-related business logic
 type Service struct {
-	repo UserRepository
+	repo          UserRepository
+	primaryIssuer string
+	localIssuer   string
 }
 
-func NewService(r UserRepository) *Service {
-	return &Service{repo: r}
+// Option configures a Service
+type Option func(*Service)
+
+// WithPrimaryIssuer names the issuer whose subjects are used unchanged as
+// application subjects. Users of any other issuer get a derived subject (see
+// SubjectFor). When unset every issuer is treated as primary.
+func WithPrimaryIssuer(iss string) Option {
+	return func(s *Service) { s.primaryIssuer = iss }
+}
+
+// WithLocalIssuer names the issuer of our own access tokens, whose `sub` already is
+// an application subject (see FromClaims)
+func WithLocalIssuer(iss string) Option {
+	return func(s *Service) { s.localIssuer = iss }
+}
+
+func NewService(r UserRepository, opts ...Option) *Service {
+	s := &Service{repo: r}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
 }
 
-// UpsertFromClaims creates or updates a user using OIDC claims map
+// SubjectFor returns the application subject of the user of issuer iss with
+// upstream subject sub. Subjects of secondary issuers are hashed together with the
+// issuer so that equal subjects from different providers cannot collide; our own
+// tokens already carry the application subject.
+func (s *Service) SubjectFor(iss, sub string) string {
+	if iss == "" || s.primaryIssuer == "" || iss == s.primaryIssuer || iss == s.localIssuer {
+		return sub
+	}
+	h := sha256.Sum256([]byte(iss + "\x00" + sub))
+	return hex.EncodeToString(h[:16])
+}
+
+// UpsertFromClaims creates or updates a user using the verified ID-token claims of
+// an identity provider; the user is keyed by the `iss` and `sub` claims. Roles and
+// groups are replaced by those in the claims.
 func (s *Service) UpsertFromClaims(ctx context.Context, claims map[string]interface{}) (*models.User, error) {
 	sub, _ := claims["sub"].(string)
+	iss, _ := claims["iss"].(string)
 	email, _ := claims["email"].(string)
 	name, _ := claims["name"].(string)
 	if sub == "" {
 		return nil, nil
 	}
+	p := middleware.PrincipalFromClaims(claims)
 	u := &models.User{
-		Sub:    sub,
+		Sub:    s.SubjectFor(iss, sub),
+		Issuer: iss,
 		OIDCId: sub,
 		Email:  email,
 		Name:   name,
+		Roles:  p.Roles,
+		Groups: p.Groups,
 	}
-	return s.repo.UpsertBySub(ctx, u)
+	return s.repo.UpsertByIdentity(ctx, u)
+}
+
+// FromClaims returns the user behind verified token claims. Our own access tokens
+// and personal access tokens carry the application subject and are looked up;
+// tokens of an identity provider are upserted like a login.
+func (s *Service) FromClaims(ctx context.Context, claims map[string]interface{}) (*models.User, error) {
+	iss, _ := claims["iss"].(string)
+	if iss == "" || iss == s.localIssuer {
+		sub, _ := claims["sub"].(string)
+		if sub == "" {
+			return nil, nil
+		}
+		return s.repo.GetBySub(ctx, sub)
+	}
+	return s.UpsertFromClaims(ctx, claims)
+}
+
+// GetByIdentity returns the user that subject of issuer logged in as (nil if unknown)
+func (s *Service) GetByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	return s.repo.GetByIdentity(ctx, issuer, subject)
 }
 
 func (s *Service) GetBySub(ctx context.Context, sub string) (*models.User, error) {
 	return s.repo.GetBySub(ctx, sub)
 }
+
+// SetTokensValidAfter records the token-validity watermark of sub
+func (s *Service) SetTokensValidAfter(ctx context.Context, sub string, t time.Time) error {
+	return s.repo.SetTokensValidAfter(ctx, sub, t)
+}
+
+// TokensValidAfter returns the token-validity watermark of sub (zero when unset or
+// the user is unknown).
+func (s *Service) TokensValidAfter(ctx context.Context, sub string) (time.Time, error) {
+	u, err := s.repo.GetBySub(ctx, sub)
+	if err != nil || u == nil {
+		return time.Time{}, err
+	}
+	return u.TokensValidAfter, nil
+}
@@ -11,9 +11,10 @@ import (
 type fakeRepo struct {
 	lastUpsert *models.User
 	upsertErr  error
+	validAfter map[string]time.Time
 }
 
-func (f *fakeRepo) UpsertBySub(ctx context.Context, u *models.User) (*models.User, error) {
+func (f *fakeRepo) UpsertByIdentity(ctx context.Context, u *models.User) (*models.User, error) {
 	f.lastUpsert = u
 	// simulate repository behavior: ensure timestamps are set
 	now := time.Now().UTC()
@@ -27,10 +28,28 @@ func (f *fakeRepo) UpsertBySub(ctx context.Context, u *models.User) (*models.Use
 	return &ret, f.upsertErr
 }
 
+func (f *fakeRepo) GetByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	if f.lastUpsert != nil && f.lastUpsert.Issuer == issuer && f.lastUpsert.OIDCId == subject {
+		return f.lastUpsert, nil
+	}
+	return nil, nil
+}
+
 func (f *fakeRepo) GetBySub(ctx context.Context, sub string) (*models.User, error) {
+	if t, ok := f.validAfter[sub]; ok {
+		return &models.User{Sub: sub, TokensValidAfter: t}, nil
+	}
 	return nil, nil
 }
 
+func (f *fakeRepo) SetTokensValidAfter(ctx context.Context, sub string, t time.Time) error {
+	if f.validAfter == nil {
+		f.validAfter = map[string]time.Time{}
+	}
+	f.validAfter[sub] = t
+	return nil
+}
+
 func TestUpsertFromClaims(t *testing.T) {
 	repo := &fakeRepo{}
 	svc := NewService(repo)
@@ -39,6 +58,9 @@ func TestUpsertFromClaims(t *testing.T) {
 		"sub":   "sub-123",
 		"email": "x@example.com",
 		"name":  "X User",
+		// Keycloak realm roles and group mapper output
+		"realm_access": map[string]interface{}{"roles": []interface{}{"admin"}},
+		"groups":       []interface{}{"/staff"},
 	}
 
 	u, err := svc.UpsertFromClaims(ctx, claims)
@@ -57,8 +79,11 @@ func TestUpsertFromClaims(t *testing.T) {
 	if u.Name != "X User" {
 		t.Fatalf("unexpected name: %s", u.Name)
 	}
+	if len(u.Roles) != 1 || u.Roles[0] != "admin" || len(u.Groups) != 1 || u.Groups[0] != "/staff" {
+		t.Fatalf("roles and groups not copied from claims: %v %v", u.Roles, u.Groups)
+	}
 	if repo.lastUpsert == nil {
-		t.Fatal("expected repository UpsertBySub to be called")
+		t.Fatal("expected repository UpsertByIdentity to be called")
 	}
 	// expect timestamps to be set
 	if repo.lastUpsert.CreatedAt.IsZero() || repo.lastUpsert.UpdatedAt.IsZero() {
@@ -83,3 +108,72 @@ func TestUpsertFromClaims(t *testing.T) {
 		t.Fatalf("expected nil when sub missing, got: %v", u2)
 	}
 }
+
+func TestTokensValidAfter(t *testing.T) {
+	svc := NewService(&fakeRepo{})
+	ctx := context.Background()
+	got, err := svc.TokensValidAfter(ctx, "unknown")
+	if err != nil || !got.IsZero() {
+		t.Fatalf("expected zero watermark for unknown user, got %v (%v)", got, err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := svc.SetTokensValidAfter(ctx, "u1", now); err != nil {
+		t.Fatalf("set watermark: %v", err)
+	}
+	if got, _ := svc.TokensValidAfter(ctx, "u1"); !got.Equal(now) {
+		t.Fatalf("unexpected watermark: got=%v want=%v", got, now)
+	}
+}
+
+func TestUpsertFromClaims_KeysUsersByIssuer(t *testing.T) {
+	repo := &fakeRepo{}
+	svc := NewService(repo, WithPrimaryIssuer("https://kc/realms/university"))
+	ctx := context.Background()
+
+	u, err := svc.UpsertFromClaims(ctx, map[string]interface{}{"iss": "https://kc/realms/university", "sub": "same-sub"})
+	if err != nil || u == nil {
+		t.Fatalf("unexpected result: %v (%v)", u, err)
+	}
+	if u.Sub != "same-sub" || u.OIDCId != "same-sub" || u.Issuer != "https://kc/realms/university" {
+		t.Fatalf("primary users keep their subject: %+v", u)
+	}
+
+	g, err := svc.UpsertFromClaims(ctx, map[string]interface{}{"iss": "https://kc/realms/guests", "sub": "same-sub"})
+	if err != nil || g == nil {
+		t.Fatalf("unexpected result: %v (%v)", g, err)
+	}
+	if g.Sub == "same-sub" || g.Sub != svc.SubjectFor("https://kc/realms/guests", "same-sub") || g.OIDCId != "same-sub" {
+		t.Fatalf("guest subject must not collide with the primary one: %+v", g)
+	}
+	if got, _ := svc.GetByIdentity(ctx, "https://kc/realms/guests", "same-sub"); got == nil || got.Sub != g.Sub {
+		t.Fatalf("GetByIdentity: %+v", got)
+	}
+}
+
+func TestSubjectFor(t *testing.T) {
+	svc := NewService(&fakeRepo{}, WithPrimaryIssuer("https://kc/realms/university"), WithLocalIssuer("gogotex-auth"))
+	for _, iss := range []string{"", "https://kc/realms/university", "gogotex-auth"} {
+		if got := svc.SubjectFor(iss, "app-sub"); got != "app-sub" {
+			t.Fatalf("SubjectFor(%q) = %q, want the subject unchanged", iss, got)
+		}
+	}
+	if got := svc.SubjectFor("https://kc/realms/guests", "app-sub"); got == "app-sub" {
+		t.Fatalf("secondary subjects must be derived, got %q", got)
+	}
+}
+
+func TestFromClaims(t *testing.T) {
+	repo := &fakeRepo{validAfter: map[string]time.Time{"app-sub": {}}}
+	svc := NewService(repo, WithLocalIssuer("gogotex-auth"))
+	ctx := context.Background()
+
+	// our own tokens are looked up, never upserted
+	u, err := svc.FromClaims(ctx, map[string]interface{}{"iss": "gogotex-auth", "sub": "app-sub"})
+	if err != nil || u == nil || u.Sub != "app-sub" || repo.lastUpsert != nil {
+		t.Fatalf("unexpected local lookup: %+v (%v)", u, err)
+	}
+	u, err = svc.FromClaims(ctx, map[string]interface{}{"iss": "https://kc/realms/university", "sub": "kc-sub"})
+	if err != nil || u == nil || repo.lastUpsert == nil || u.OIDCId != "kc-sub" {
+		t.Fatalf("provider tokens must be upserted: %+v (%v)", u, err)
+	}
+}
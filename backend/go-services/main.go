@@ -8,16 +8,27 @@ import (
 	"github.com/gogotex/gogotex/backend/go-services/pkg/logger"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/internal/authflow"
+	"github.com/gogotex/gogotex/backend/go-services/internal/clients"
+	"github.com/gogotex/gogotex/backend/go-services/internal/device"
+	"github.com/gogotex/gogotex/backend/go-services/internal/pats"
+	"github.com/gogotex/gogotex/backend/go-services/internal/projects"
+	"github.com/gogotex/gogotex/backend/go-services/internal/realtime"
+	"github.com/gogotex/gogotex/backend/go-services/internal/audit"
 	"github.com/gogotex/gogotex/backend/go-services/internal/config"
+	"github.com/gogotex/gogotex/backend/go-services/internal/httpclient"
+	"github.com/gogotex/gogotex/backend/go-services/internal/lockout"
+	"github.com/gogotex/gogotex/backend/go-services/internal/notify"
 	"github.com/gogotex/gogotex/backend/go-services/internal/oidc"
 	"github.com/gogotex/gogotex/backend/go-services/pkg/metrics"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"strings"
 	"os"
 	"go.mongodb.org/mongo-driver/mongo"
 	"github.com/gogotex/gogotex/backend/go-services/internal/database"
 	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+	"github.com/gogotex/gogotex/backend/go-services/internal/sharelinks"
+	"github.com/gogotex/gogotex/backend/go-services/internal/tokens"
 	"github.com/gogotex/gogotex/backend/go-services/internal/users"
 	"github.com/gogotex/gogotex/backend/go-services/handlers"
 	"github.com/gogotex/gogotex/backend/go-services/pkg/middleware"
@@ -43,13 +54,18 @@ func main() {
 
 	r := gin.New()
 logger.Infof("MAIN checkpoint: after gin.New()")
+	// client IPs (rate limits, login lockout) only come from X-Forwarded-For when the
+	// request passed through one of our own proxies
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		logger.Fatalf("invalid SERVER_TRUSTED_PROXIES: %v", err)
+	}
 
 	// Lightweight CORS middleware for dev/test: set common headers and respond to OPTIONS.
 	// (Keep this intentionally simple — production should use a stricter policy.)
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-CSRF-Token")
 		c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Length")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(200)
@@ -60,8 +76,14 @@ logger.Infof("MAIN checkpoint: after gin.New()")
 
 	// shared runtime vars used by handlers/readiness
 	var verifier middleware.Verifier
+	var oidcRegistry *oidc.Registry
 	var userSvc *users.Service
 	var sessionsSvc *sessions.Service
+	var patsSvc *pats.Service
+	var auditSvc *audit.Service
+	var projectPerms projects.Resolver
+	var shareLinksSvc *sharelinks.Service
+	var knownDevices *sessions.DeviceTracker
 
 // Global middlewares: logging + recovery
 r.Use(gin.Logger(), gin.Recovery())
@@ -121,8 +143,13 @@ r.GET("/ready", func(c *gin.Context) {
 		deps["users"] = (userSvc != nil)
 	}
 
-	// OIDC readiness: if Keycloak URL was configured we expect a verifier (or ALLOW_INSECURE_TOKEN)
-	if cfg.Keycloak.URL != "" {
+	// OIDC readiness: every configured identity provider must have been discovered
+	if oidcRegistry != nil {
+		deps["oidc"] = oidcRegistry.Ready()
+		if !deps["oidc"] {
+			ready = false
+		}
+	} else if cfg.Keycloak.URL != "" {
 		if verifier == nil {
 			deps["oidc"] = false
 			ready = false
@@ -152,36 +179,46 @@ r.GET("/ready", func(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "ready", "deps": deps, "uptime": fmt.Sprintf("%s", time.Since(startTime))})
 })
 
-// Keycloak OIDC verifier and protected sample endpoint
-ctx := context.Background()
-if cfg.Keycloak.URL != "" && cfg.Keycloak.ClientID != "" && cfg.Keycloak.Realm != "" {
-	issuer := strings.TrimRight(cfg.Keycloak.URL, "/") + "/realms/" + cfg.Keycloak.Realm
-	ver, err := oidc.NewVerifier(ctx, issuer, cfg.Keycloak.ClientID)
-	if err != nil {
-			logger.Warnf("failed to initialize OIDC verifier: %v", err)
-		} else {
-			verifier = ver
-		}
-	} else if cfg.Keycloak.URL != "" && cfg.Keycloak.ClientID != "" {
-		// Fallback: try URL as issuer (older deployments may expose realm path in URL)
-		ver, err := oidc.NewVerifier(ctx, cfg.Keycloak.URL, cfg.Keycloak.ClientID)
-		if err != nil {
-			logger.Warnf("failed to initialize OIDC verifier (fallback): %v", err)
-		} else {
-			verifier = ver
-		}
-	}
+// Roles, groups and scopes for RequireRole / RequireAnyGroup / RequireScope
+claimMapping := middleware.DefaultClaimMapping(cfg.Keycloak.ClientID)
+if len(cfg.Authz.RoleClaims) > 0 {
+	claimMapping.Roles = cfg.Authz.RoleClaims
+}
+if len(cfg.Authz.GroupClaims) > 0 {
+	claimMapping.Groups = cfg.Authz.GroupClaims
+}
+if len(cfg.Authz.ScopeClaims) > 0 {
+	claimMapping.Scopes = cfg.Authz.ScopeClaims
+}
+// roles and groups only count when they come from our own tokens or the primary
+// provider: secondary realms must not be able to mint admins
+claimMapping.RoleIssuers = []string{cfg.JWT.Issuer}
+if p, ok := cfg.Provider(""); ok {
+	claimMapping.RoleIssuers = append(claimMapping.RoleIssuers, p.IssuerURL())
+}
+middleware.SetClaimMapping(claimMapping)
 
-// Optional insecure verifier for integration tests: parse token claims without signature verification
-logger.Infof("MAIN checkpoint: before insecure OIDC verifier check")
-if verifier == nil {
-	val := strings.ToLower(strings.TrimSpace(os.Getenv("ALLOW_INSECURE_TOKEN")))
-	logger.Debugf("ALLOW_INSECURE_TOKEN=%q", val)
-	if val == "true" {
-		logger.Warn("enabling insecure OIDC verifier (integration mode)")
+// OIDC verifiers for Keycloak and any additional identity providers. Discovery runs
+// in the background and is retried while a provider is unreachable.
+ctx := context.Background()
+var providers []config.ProviderConfig
+for _, p := range cfg.IdentityProviders() {
+	if p.ClientID != "" {
+		providers = append(providers, p)
 	}
 }
-logger.Infof("MAIN checkpoint: after insecure OIDC verifier check")
+// Calls to the identity providers share one client (timeouts, retries, circuit
+// breaker and the CA bundle / client certificate of an internal Keycloak)
+idpClient, err := httpclient.NewFromConfig("keycloak", cfg.Outbound)
+if err != nil {
+	logger.Fatalf("invalid outbound HTTP configuration: %v", err)
+}
+if len(providers) > 0 {
+	oidcRegistry = oidc.NewRegistry(providers, oidc.WithHTTPClient(idpClient.StandardClient()))
+	oidcRegistry.Start()
+	defer oidcRegistry.Close()
+	verifier = oidcRegistry
+}
 
 // Connect to MongoDB and initialize user and session services
 
@@ -220,7 +257,38 @@ if cfg.MongoDB.URI != "" {
 		defer func() { _ = client.Disconnect(ctx) }()
 		usersCol := client.Database(cfg.MongoDB.Database).Collection("users")
 		repo := users.NewMongoUserRepository(usersCol)
-		userSvc = users.NewService(repo)
+		// users are keyed by (issuer, sub); subjects of the primary provider are kept as is
+		primaryIssuer := ""
+		if p, ok := cfg.Provider(""); ok {
+			primaryIssuer = p.IssuerURL()
+			if n, err := repo.AdoptLegacyUsers(ctx, primaryIssuer); err != nil {
+				logger.Warnf("failed to assign issuer to existing users: %v", err)
+			} else if n > 0 {
+				logger.Infof("assigned issuer %s to %d existing user(s)", primaryIssuer, n)
+			}
+		}
+		if err := repo.EnsureIndexes(ctx); err != nil {
+			logger.Warnf("failed to migrate user indexes: %v", err)
+		}
+		userSvc = users.NewService(repo, users.WithPrimaryIssuer(primaryIssuer), users.WithLocalIssuer(cfg.JWT.Issuer))
+		// personal access tokens (stored hashed next to users)
+		patsSvc = pats.NewService(pats.NewMongoRepository(client.Database(cfg.MongoDB.Database).Collection("personal_access_tokens")))
+		auditSvc = audit.NewService(audit.NewMongoRepository(client.Database(cfg.MongoDB.Database).Collection("audit_log")))
+		projectPerms = projects.NewMongoResolver(client.Database(cfg.MongoDB.Database).Collection("projects"), client.Database(cfg.MongoDB.Database).Collection("documents"))
+		shareLinksSvc = sharelinks.NewService(sharelinks.NewMongoRepository(client.Database(cfg.MongoDB.Database).Collection("share_links")))
+		// devices users signed in from; logins from new ones are reported to the user
+		var notifier notify.Notifier
+		if cfg.Notify.NewDeviceAlerts {
+			notifier = notify.LogNotifier{}
+			if cfg.Notify.SMTPHost != "" {
+				if n, err := notify.NewSMTPNotifier(cfg.Notify.SMTPHost, cfg.Notify.SMTPPort, cfg.Notify.SMTPUsername, cfg.Notify.SMTPPassword, cfg.Notify.MailFrom); err != nil {
+					logger.Warnf("mail notifications disabled: %v", err)
+				} else {
+					notifier = n
+				}
+			}
+		}
+		knownDevices = sessions.NewDeviceTracker(sessions.NewMongoDeviceRepository(client.Database(cfg.MongoDB.Database).Collection("known_devices")), notifier)
 
 		// only create Mongo-backed session repo when a session service isn't already set
 		if sessionsSvc == nil {
@@ -231,37 +299,139 @@ if cfg.MongoDB.URI != "" {
 	}
 }
 
+// Asymmetric access-token signing: load or generate the key set and publish it as JWKS
+if alg := cfg.JWT.Algorithm; alg == tokens.AlgRS256 || alg == tokens.AlgEdDSA {
+	// retired keys stay published until every token they signed has expired
+	ks, err := tokens.NewKeySet(alg, cfg.JWT.KeysDir, cfg.LongestTokenTTL()+time.Minute)
+	if err != nil {
+		logger.Fatalf("failed to initialize signing keys: %v", err)
+	}
+	if cfg.JWT.KeysDir == "" {
+		logger.Warnf("JWT_KEYS_DIR not set: signing keys are kept in memory and change on restart")
+	}
+	tokens.SetKeySet(ks)
+	go ks.StartRotation(ctx, cfg.JWT.KeyRotationInterval)
+	handlers.RegisterJWKS(r, ks)
+	logger.Infof("access tokens signed with %s (kid=%s)", alg, ks.Active().KID)
+}
+
+// Confidential clients (internal services) authenticated by client secret files
+var clientsReg *clients.Registry
+if cfg.Clients.SecretsDir != "" {
+	reg := clients.NewRegistry()
+	if err := reg.LoadDir(cfg.Clients.SecretsDir); err != nil {
+		logger.Warnf("failed to load client secrets: %v", err)
+	} else {
+		logger.Infof("loaded %d confidential client(s)", reg.Len())
+		clientsReg = reg
+	}
+}
+
 // Register auth handlers if services are available
 logger.Infof("MAIN checkpoint: before registering handlers")
+// Protected endpoints accept our own access tokens first and Keycloak tokens second
+authVerifier := middleware.NewCompositeVerifier(tokens.NewVerifier(cfg), verifier)
+if patsSvc != nil {
+	// personal access tokens ("ggt_" prefix) for CI pipelines and Git clients
+	authVerifier = middleware.NewCompositeVerifier(tokens.NewVerifier(cfg), pats.NewVerifier(patsSvc, userSvc), verifier)
+}
+if userSvc != nil {
+	// "sign out everywhere" watermark, cached in Redis by the auth middleware
+	sessions.SetWatermarkLoader(userSvc.TokensValidAfter)
+	// tokens of secondary providers are keyed by their derived application subject
+	middleware.SetSubjectResolver(userSvc.SubjectFor)
+}
+if auditSvc != nil {
+	// every request made with an impersonation token ends up in the audit log
+	middleware.SetImpersonationAuditor(auditSvc.RecordImpersonatedRequest)
+}
+if shareLinksSvc != nil {
+	// guest tokens stop working as soon as their share link is revoked
+	middleware.SetShareLinkChecker(shareLinksSvc.Active)
+}
+// brute-force protection of password-mode logins (failure counters in Redis)
+var loginGuard *lockout.Guard
+if importedRedis != nil {
+	loginGuard = lockout.NewGuard(importedRedis, "", lockout.Policy{
+		UserThreshold: cfg.Lockout.UserThreshold,
+		IPThreshold:   cfg.Lockout.IPThreshold,
+		BaseDelay:     cfg.Lockout.BaseDelay,
+		MaxDelay:      cfg.Lockout.MaxDelay,
+		Window:        cfg.Lockout.Window,
+	})
+} else {
+	logger.Warnf("Redis unavailable: password logins are not protected by lockout")
+}
 if userSvc != nil && sessionsSvc != nil {
-	h := handlers.NewAuthHandler(cfg, userSvc, sessionsSvc)
+	var opts []handlers.Option
+	if loginGuard != nil {
+		opts = append(opts, handlers.WithLoginGuard(loginGuard))
+	}
+	if importedRedis != nil {
+		// server-side authorization-code flow keeps state/nonce/PKCE verifier in Redis
+		opts = append(opts, handlers.WithAuthFlowStore(authflow.NewRedisStore(importedRedis, "")))
+		// device authorization grant for the CLI and editor plugins
+		opts = append(opts, handlers.WithDeviceStore(device.NewRedisStore(importedRedis, ""), authVerifier))
+	}
+	// token introspection and client-credentials tokens for internal services
+	if clientsReg != nil {
+		opts = append(opts, handlers.WithIntrospection(clientsReg, authVerifier), handlers.WithClientCredentials(clientsReg))
+	}
+	// Keycloak calls /auth/backchannel-logout when a user's SSO session ends there
+	if verifier != nil {
+		opts = append(opts, handlers.WithBackchannelLogout(verifier))
+	}
+	if oidcRegistry != nil {
+		opts = append(opts, handlers.WithProviderRegistry(oidcRegistry))
+	}
+	if knownDevices != nil {
+		opts = append(opts, handlers.WithDeviceTracker(knownDevices))
+	}
+	opts = append(opts, handlers.WithHTTPClient(idpClient))
+	h := handlers.NewAuthHandler(cfg, userSvc, sessionsSvc, opts...)
 	h.Register(r.Group("/"))
 } else {
 	logger.Warnf("auth handlers not registered because user/sessions services are unavailable")
 }// Register minimal Swagger UI + JSON for API documentation (Phase-02 requirement)
 handlers.RegisterSwagger(r)
 logger.Infof("MAIN checkpoint: after registering handlers")
+	if userSvc != nil && auditSvc != nil {
+		handlers.NewImpersonationHandler(cfg, userSvc, auditSvc).Register(r.Group("/"), middleware.AuthMiddleware(authVerifier))
+	}
+	if loginGuard != nil {
+		handlers.NewLockoutHandler(cfg, loginGuard, auditSvc).Register(r.Group("/"), middleware.AuthMiddleware(authVerifier))
+	}
 	api := r.Group("/api/v1")
-	if verifier != nil {
-		api.GET("/me", middleware.AuthMiddleware(verifier), func(c *gin.Context) {
-			claims, _ := c.Get("claims")
-			if userSvc != nil {
-				if cm, ok := claims.(map[string]interface{}); ok {
-					u, err := userSvc.UpsertFromClaims(c.Request.Context(), cm)
-					if err == nil && u != nil {
-						c.JSON(http.StatusOK, gin.H{"user": u})
-						return
-					}
+	if patsSvc != nil {
+		handlers.NewTokensHandler(patsSvc).Register(api, middleware.AuthMiddleware(authVerifier))
+	}
+	if sessionsSvc != nil && userSvc != nil {
+		handlers.NewSessionsHandler(sessionsSvc, userSvc).Register(api, middleware.AuthMiddleware(authVerifier))
+	}
+	// WebSocket connection tickets for the realtime server, redeemed by the yjs server
+	if importedRedis != nil && projectPerms != nil && clientsReg != nil {
+		rt := handlers.NewRealtimeHandler(realtime.NewRedisStore(importedRedis, ""), projectPerms, clientsReg, cfg.Realtime.TicketTTL)
+		rt.Register(api, middleware.AuthMiddleware(authVerifier))
+		rt.RegisterInternal(r.Group("/"))
+	}
+	// read-only share links for people without an account
+	if shareLinksSvc != nil && projectPerms != nil {
+		handlers.NewShareLinksHandler(cfg, shareLinksSvc, projectPerms).Register(api, middleware.AuthMiddleware(authVerifier))
+	}
+	api.GET("/me", middleware.AuthMiddleware(authVerifier), middleware.RequireUser(), func(c *gin.Context) {
+		claims, _ := c.Get("claims")
+		if userSvc != nil {
+			if cm, ok := claims.(map[string]interface{}); ok {
+				u, err := userSvc.FromClaims(c.Request.Context(), cm)
+				if err == nil && u != nil {
+					c.JSON(http.StatusOK, gin.H{"user": u})
+					return
 				}
 			}
-			// fallback: return claims
-			c.JSON(http.StatusOK, gin.H{"claims": claims})
-		})
-	} else {
-		api.GET("/me", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{"message": "OIDC not configured"})
-		})
-	}
+		}
+		// fallback: return claims
+		c.JSON(http.StatusOK, gin.H{"claims": claims})
+	})
 
 // Expose Prometheus metrics
 metrics.RegisterCollectors(prometheus.DefaultRegisterer)
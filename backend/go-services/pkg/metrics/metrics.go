@@ -13,9 +13,44 @@ var (
 		prometheus.CounterOpts{Namespace: "gogotex", Name: "rate_limit_rejected_total", Help: "Number of rejected requests by limiter type."},
 		[]string{"limiter"},
 	)
+	OIDCDiscoveryFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Namespace: "gogotex", Name: "oidc_discovery_failures_total", Help: "Number of failed OIDC discovery attempts by identity provider."},
+		[]string{"provider"},
+	)
+	OIDCProviderUp = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{Namespace: "gogotex", Name: "oidc_provider_up", Help: "Whether discovery for the identity provider has succeeded (1) or is being retried (0)."},
+		[]string{"provider"},
+	)
+	OutboundRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Namespace: "gogotex", Name: "outbound_requests_total", Help: "Number of outbound HTTP attempts by client and status code (or error / circuit_open)."},
+		[]string{"client", "code"},
+	)
+	OutboundRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{Namespace: "gogotex", Name: "outbound_request_duration_seconds", Help: "Duration of outbound HTTP attempts by client.", Buckets: prometheus.DefBuckets},
+		[]string{"client"},
+	)
+	LoginFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Namespace: "gogotex", Name: "login_failures_total", Help: "Number of failed password logins by reason (invalid_credentials or locked)."},
+		[]string{"reason"},
+	)
+	LoginLockouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Namespace: "gogotex", Name: "login_lockouts_total", Help: "Number of login lockouts imposed by scope (user or ip)."},
+		[]string{"scope"},
+	)
+	OutboundCircuitOpen = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{Namespace: "gogotex", Name: "outbound_circuit_open", Help: "Whether the circuit breaker of the outbound client for a host is open (1) or closed (0)."},
+		[]string{"client", "host"},
+	)
 )
 
 func RegisterCollectors(reg prometheus.Registerer) {
 	reg.MustRegister(RateLimitAllowed)
 	reg.MustRegister(RateLimitRejected)
+	reg.MustRegister(OIDCDiscoveryFailures)
+	reg.MustRegister(OIDCProviderUp)
+	reg.MustRegister(OutboundRequests)
+	reg.MustRegister(OutboundRequestDuration)
+	reg.MustRegister(OutboundCircuitOpen)
+	reg.MustRegister(LoginFailures)
+	reg.MustRegister(LoginLockouts)
 }
@@ -2,8 +2,11 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
@@ -20,7 +23,12 @@ type Verifier interface {
 }
 
 // AuthMiddleware returns a Gin middleware that verifies Bearer tokens using the provided verifier
-// It also consults the sessions package blacklist (if configured) and rejects blacklisted tokens.
+// It also consults the sessions package blacklist (if configured) and rejects tokens whose
+// `jti` has been revoked or that were issued before the user's token-validity watermark.
+// The caller is available to later handlers as `claims` and as a Principal (see
+// CurrentPrincipal, RequireRole). Guest tokens are rejected once their share link is
+// gone (see SetShareLinkChecker). Requests made with impersonation tokens are passed
+// to the ImpersonationAuditor once the handler has run.
 func AuthMiddleware(ver Verifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		auth := c.GetHeader("Authorization")
@@ -35,15 +43,6 @@ func AuthMiddleware(ver Verifier) gin.HandlerFunc {
 			return
 		}
 
-		// Check blacklist first (fast, optional)
-		if ok, err := sessions.IsAccessTokenBlacklisted(c.Request.Context(), token); err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "blacklist check failed"})
-			return
-		} else if ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
-			return
-		}
-
 		idToken, err := ver.Verify(c.Request.Context(), token)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token", "details": err.Error()})
@@ -57,7 +56,118 @@ func AuthMiddleware(ver Verifier) gin.HandlerFunc {
 			return
 		}
 
+		// Revoked tokens are blacklisted by jti (cached locally, see revocation.go)
+		if jti, _ := claims["jti"].(string); jti != "" {
+			if revoked, err := revocations.isRevoked(c.Request.Context(), jti, claimTime(claims["exp"])); err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "blacklist check failed"})
+				return
+			} else if revoked {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+				return
+			}
+		}
+
+		p := PrincipalFromClaims(claims)
+		// "Sign out everywhere" rejects tokens issued before the user's watermark
+		if p.Subject != "" {
+			if iat := claimTime(claims["iat"]); !iat.IsZero() {
+				wm, err := sessions.TokensValidAfter(c.Request.Context(), p.Subject)
+				if err != nil {
+					c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "token validity check failed"})
+					return
+				}
+				if sessions.IssuedBefore(iat, wm) {
+					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token revoked"})
+					return
+				}
+			}
+		}
+
+		// guest tokens die with the share link they were redeemed from
+		if p.IsGuest() {
+			active, err := ShareLinkActive(c.Request.Context(), p.ShareLinkID)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "share link check failed"})
+				return
+			}
+			if !active {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "share link revoked or expired"})
+				return
+			}
+		}
 		c.Set("claims", claims)
+		c.Set(principalKey, p)
 		c.Next()
+
+		if p.IsImpersonated() {
+			if audit := currentImpersonationAuditor(); audit != nil {
+				audit(c, p)
+			}
+		}
+	}
+}
+
+// ImpersonationAuditor records a request made with an impersonation token
+type ImpersonationAuditor func(c *gin.Context, p *Principal)
+
+var (
+	auditorMu            sync.RWMutex
+	impersonationAuditor ImpersonationAuditor
+)
+
+// SetImpersonationAuditor sets the function AuthMiddleware reports impersonated
+// requests to (nil disables auditing)
+func SetImpersonationAuditor(fn ImpersonationAuditor) {
+	auditorMu.Lock()
+	impersonationAuditor = fn
+	auditorMu.Unlock()
+}
+
+func currentImpersonationAuditor() ImpersonationAuditor {
+	auditorMu.RLock()
+	defer auditorMu.RUnlock()
+	return impersonationAuditor
+}
+
+// ShareLinkChecker reports whether the share link a guest token was issued for is
+// still active
+type ShareLinkChecker func(ctx context.Context, linkID string) (bool, error)
+
+var (
+	shareLinkMu      sync.RWMutex
+	shareLinkChecker ShareLinkChecker
+)
+
+// SetShareLinkChecker sets the function AuthMiddleware checks guest tokens with
+// (nil accepts guest tokens until they expire)
+func SetShareLinkChecker(fn ShareLinkChecker) {
+	shareLinkMu.Lock()
+	shareLinkChecker = fn
+	shareLinkMu.Unlock()
+}
+
+// ShareLinkActive reports whether guest tokens of linkID are still accepted
+func ShareLinkActive(ctx context.Context, linkID string) (bool, error) {
+	shareLinkMu.RLock()
+	check := shareLinkChecker
+	shareLinkMu.RUnlock()
+	if check == nil {
+		return true, nil
+	}
+	return check(ctx, linkID)
+}
+
+// claimTime converts a numeric JWT date claim (seconds since epoch)
+func claimTime(v interface{}) time.Time {
+	switch n := v.(type) {
+	case float64:
+		return time.Unix(int64(n), 0)
+	case int64:
+		return time.Unix(n, 0)
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return time.Unix(i, 0)
+		}
 	}
+	return time.Time{}
 }
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -36,6 +38,19 @@ func (f *fakeVerifier) Verify(ctx context.Context, raw string) (Token, error) {
 	if raw == "goodtoken" {
 		return &fakeToken{data: map[string]interface{}{"sub": "user1", "email": "test@example.com"}}, nil
 	}
+	if strings.HasPrefix(raw, "iat:") {
+		iat, _ := strconv.ParseInt(strings.TrimPrefix(raw, "iat:"), 10, 64)
+		return &fakeToken{data: map[string]interface{}{"sub": "wm-user", "iat": float64(iat)}}, nil
+	}
+	if strings.HasPrefix(raw, "secondary-iat:") {
+		// a user of another provider whose upstream subject equals wm-user's
+		iat, _ := strconv.ParseInt(strings.TrimPrefix(raw, "secondary-iat:"), 10, 64)
+		return &fakeToken{data: map[string]interface{}{"iss": "https://guests", "sub": "wm-user", "iat": float64(iat)}}, nil
+	}
+	if strings.HasPrefix(raw, "jti:") {
+		exp := float64(time.Now().Add(time.Minute).Unix())
+		return &fakeToken{data: map[string]interface{}{"sub": "user1", "jti": strings.TrimPrefix(raw, "jti:"), "exp": exp}}, nil
+	}
 	return nil, fmt.Errorf("invalid token")
 }
 
@@ -92,18 +107,117 @@ func TestAuthMiddleware_RejectsBlacklistedToken(t *testing.T) {
 	defer m.Close()
 	client := redis.NewClient(&redis.Options{Addr: m.Addr()})
 	sessions.SetBlacklistClient(client)
+	defer sessions.SetBlacklistClient(nil)
 
-	// add token to blacklist
-	token := "black-token"
-	require.NoError(t, sessions.BlacklistAccessToken(context.Background(), token, 5*time.Second))
+	// add the token's jti to the blacklist
+	require.NoError(t, sessions.BlacklistJTI(context.Background(), "black-jti", 5*time.Second))
 
 	g := gin.New()
+	g.GET("/", AuthMiddleware(&fakeVerifier{}), func(c *gin.Context) { c.Status(http.StatusOK) })
+
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
-	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Authorization", "Bearer jti:black-jti")
 	rw := httptest.NewRecorder()
-
-	g.GET("/", AuthMiddleware(&fakeVerifier{}), func(c *gin.Context) { c.Status(http.StatusOK) })
 	g.ServeHTTP(rw, req)
+	require.Equal(t, http.StatusUnauthorized, rw.Code)
 
+	// revoked jtis are served from the local cache without Redis
+	m.Close()
+	rw = httptest.NewRecorder()
+	g.ServeHTTP(rw, req)
 	require.Equal(t, http.StatusUnauthorized, rw.Code)
 }
+
+func TestAuthMiddleware_CachesRevocationLookups(t *testing.T) {
+	m, err := mr.Run()
+	require.NoError(t, err)
+	defer m.Close()
+	sessions.SetBlacklistClient(redis.NewClient(&redis.Options{Addr: m.Addr()}))
+	defer sessions.SetBlacklistClient(nil)
+
+	g := gin.New()
+	g.GET("/", AuthMiddleware(&fakeVerifier{}), func(c *gin.Context) { c.Status(http.StatusOK) })
+	serve := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer jti:cached-jti")
+		rw := httptest.NewRecorder()
+		g.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	require.Equal(t, http.StatusOK, serve())
+
+	// a revocation made elsewhere is only seen after the cache entry expires...
+	require.NoError(t, sessions.BlacklistJTI(context.Background(), "cached-jti", time.Minute))
+	require.Equal(t, http.StatusOK, serve())
+
+	// ...while revocations made in this process apply immediately
+	NoteRevoked("cached-jti", time.Now().Add(time.Minute))
+	require.Equal(t, http.StatusUnauthorized, serve())
+}
+
+func TestAuthMiddleware_RejectsTokensIssuedBeforeWatermark(t *testing.T) {
+	wm := time.Now().Truncate(time.Second)
+	sessions.SetWatermarkLoader(func(ctx context.Context, sub string) (time.Time, error) {
+		if sub == "wm-user" {
+			return wm, nil
+		}
+		return time.Time{}, nil
+	})
+	defer sessions.SetWatermarkLoader(nil)
+
+	g := gin.New()
+	g.GET("/", AuthMiddleware(&fakeVerifier{}), func(c *gin.Context) { c.Status(http.StatusOK) })
+	serve := func(iat time.Time) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer iat:"+strconv.FormatInt(iat.Unix(), 10))
+		rw := httptest.NewRecorder()
+		g.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	require.Equal(t, http.StatusUnauthorized, serve(wm.Add(-time.Minute)))
+	require.Equal(t, http.StatusOK, serve(wm))
+	require.Equal(t, http.StatusOK, serve(wm.Add(time.Minute)))
+}
+
+func TestAuthMiddleware_ResolvesApplicationSubject(t *testing.T) {
+	SetSubjectResolver(func(iss, sub string) string {
+		if iss == "https://guests" {
+			return "guests:" + sub
+		}
+		return sub
+	})
+	defer SetSubjectResolver(nil)
+	wm := time.Now().Truncate(time.Second)
+	sessions.SetWatermarkLoader(func(ctx context.Context, sub string) (time.Time, error) {
+		if sub == "guests:wm-user" {
+			return wm, nil
+		}
+		return time.Time{}, nil
+	})
+	defer sessions.SetWatermarkLoader(nil)
+
+	g := gin.New()
+	g.GET("/", AuthMiddleware(&fakeVerifier{}), func(c *gin.Context) {
+		p, _ := CurrentPrincipal(c)
+		c.String(http.StatusOK, p.Subject)
+	})
+	serve := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rw := httptest.NewRecorder()
+		g.ServeHTTP(rw, req)
+		return rw
+	}
+	before := strconv.FormatInt(wm.Add(-time.Minute).Unix(), 10)
+	after := strconv.FormatInt(wm.Add(time.Minute).Unix(), 10)
+
+	// the secondary user's own watermark applies, not that of the primary wm-user
+	require.Equal(t, http.StatusUnauthorized, serve("secondary-iat:"+before).Code)
+	rw := serve("secondary-iat:" + after)
+	require.Equal(t, http.StatusOK, rw.Code)
+	require.Equal(t, "guests:wm-user", rw.Body.String())
+
+	rw = serve("iat:" + before)
+	require.Equal(t, http.StatusOK, rw.Code)
+	require.Equal(t, "wm-user", rw.Body.String())
+}
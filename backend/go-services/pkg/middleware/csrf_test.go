@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func csrfRouter() *gin.Engine {
+	g := gin.New()
+	g.Use(CSRFMiddleware("session"))
+	g.POST("/p", func(c *gin.Context) { c.Status(http.StatusOK) })
+	g.GET("/p", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return g
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	cases := []struct {
+		name    string
+		method  string
+		cookies map[string]string
+		header  string
+		want    int
+	}{
+		{"no session cookie", "POST", nil, "", http.StatusOK},
+		{"safe method", "GET", map[string]string{"session": "s"}, "", http.StatusOK},
+		{"missing header", "POST", map[string]string{"session": "s", CSRFCookieName: "tok"}, "", http.StatusForbidden},
+		{"missing csrf cookie", "POST", map[string]string{"session": "s"}, "tok", http.StatusForbidden},
+		{"mismatch", "POST", map[string]string{"session": "s", CSRFCookieName: "tok"}, "other", http.StatusForbidden},
+		{"match", "POST", map[string]string{"session": "s", CSRFCookieName: "tok"}, "tok", http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/p", nil)
+			for k, v := range tc.cookies {
+				req.AddCookie(&http.Cookie{Name: k, Value: v})
+			}
+			if tc.header != "" {
+				req.Header.Set(CSRFHeaderName, tc.header)
+			}
+			w := httptest.NewRecorder()
+			csrfRouter().ServeHTTP(w, req)
+			require.Equal(t, tc.want, w.Code)
+		})
+	}
+}
@@ -0,0 +1,339 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principalKey is the gin context key AuthMiddleware stores the Principal under
+const principalKey = "principal"
+
+// ClaimMapping names the claims roles, groups and scopes are read from. Each entry
+// is a dot-separated path into the claims, e.g. "resource_access.gogotex.roles";
+// values may be string arrays or space-separated strings. Values found under
+// several paths are merged.
+//
+// RoleIssuers lists the issuers whose roles and groups are trusted; tokens of any
+// other issuer (secondary identity providers) carry neither. Tokens without an
+// `iss` claim (personal access tokens) are ours and always trusted. Empty trusts
+// every issuer.
+type ClaimMapping struct {
+	Roles       []string
+	Groups      []string
+	Scopes      []string
+	RoleIssuers []string
+}
+
+// trustsRoles reports whether the roles and groups in tokens of iss are trusted
+func (m ClaimMapping) trustsRoles(iss string) bool {
+	return iss == "" || len(m.RoleIssuers) == 0 || contains(m.RoleIssuers, iss)
+}
+
+// DefaultClaimMapping reads Keycloak realm roles, the client roles of clientID,
+// the `groups` claim of Keycloak's group mapper and the standard `scope` claim.
+// The top-level `roles` and `groups` claims are those of our own access tokens.
+func DefaultClaimMapping(clientID string) ClaimMapping {
+	roles := []string{"realm_access.roles", "roles"}
+	if clientID != "" {
+		roles = append(roles, "resource_access."+clientID+".roles")
+	}
+	return ClaimMapping{Roles: roles, Groups: []string{"groups"}, Scopes: []string{"scope", "scp"}}
+}
+
+var (
+	claimMappingMu sync.RWMutex
+	claimMapping   = DefaultClaimMapping("")
+)
+
+// SetClaimMapping sets the mapping used by AuthMiddleware and PrincipalFromClaims
+func SetClaimMapping(m ClaimMapping) {
+	claimMappingMu.Lock()
+	claimMapping = m
+	claimMappingMu.Unlock()
+}
+
+func currentClaimMapping() ClaimMapping {
+	claimMappingMu.RLock()
+	defer claimMappingMu.RUnlock()
+	return claimMapping
+}
+
+// SubjectResolver maps the issuer and `sub` claim of a verified token to the
+// application subject users are keyed by
+type SubjectResolver func(iss, sub string) string
+
+var (
+	subjectResolverMu sync.RWMutex
+	subjectResolver   SubjectResolver
+)
+
+// SetSubjectResolver sets the function PrincipalFromClaims derives Subject with
+// (nil uses the `sub` claim unchanged). Tokens of secondary identity providers
+// must be resolved, or their subjects could collide with those of other users.
+func SetSubjectResolver(fn SubjectResolver) {
+	subjectResolverMu.Lock()
+	subjectResolver = fn
+	subjectResolverMu.Unlock()
+}
+
+// ApplicationSubject returns the application subject of verified token claims
+// (see SetSubjectResolver)
+func ApplicationSubject(claims map[string]interface{}) string {
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return ""
+	}
+	subjectResolverMu.RLock()
+	resolve := subjectResolver
+	subjectResolverMu.RUnlock()
+	if resolve == nil {
+		return sub
+	}
+	iss, _ := claims["iss"].(string)
+	return resolve(iss, sub)
+}
+
+// PrincipalKind tells the kinds of callers apart
+type PrincipalKind string
+
+const (
+	KindUser    PrincipalKind = "user"
+	KindService PrincipalKind = "service"
+	KindGuest   PrincipalKind = "guest"
+)
+
+// guestTokenType is the `token_type` claim of share-link guest tokens
+const guestTokenType = "guest"
+
+// Principal is the authenticated caller of a request: a user (Subject set), a
+// service acting on its own behalf with a client-credentials token (ClientID set)
+// or an anonymous guest who redeemed a share link (ShareLinkID and ProjectID set).
+// Subject is the application subject, not necessarily the `sub` claim (see
+// SetSubjectResolver). For impersonation tokens Subject is the impersonated user and
+// Actor the user acting on their behalf (the `act` claim, RFC 8693).
+type Principal struct {
+	Kind        PrincipalKind
+	Subject     string
+	ClientID    string
+	Actor       string
+	ShareLinkID string
+	ProjectID   string
+	Roles       []string
+	Groups      []string
+	Scopes      []string
+	Claims      map[string]interface{}
+}
+
+// PrincipalFromClaims extracts a Principal from verified token claims using the
+// configured ClaimMapping
+func PrincipalFromClaims(claims map[string]interface{}) *Principal {
+	m := currentClaimMapping()
+	sub := ApplicationSubject(claims)
+	clientID, _ := claims["client_id"].(string)
+	var actor string
+	if act, ok := claims["act"].(map[string]interface{}); ok {
+		actor, _ = act["sub"].(string)
+	}
+	p := &Principal{
+		Kind:     KindUser,
+		Subject:  sub,
+		ClientID: clientID,
+		Actor:    actor,
+		Roles:    claimValues(claims, m.Roles),
+		Groups:   claimValues(claims, m.Groups),
+		Scopes:   claimValues(claims, m.Scopes),
+		Claims:   claims,
+	}
+	if iss, _ := claims["iss"].(string); !m.trustsRoles(iss) {
+		// an admin of some other realm is no admin here
+		p.Roles, p.Groups = nil, nil
+	}
+	switch {
+	case claims["token_type"] == guestTokenType:
+		// guests have no account: whatever sub or roles the claims carry are ignored
+		p.Kind = KindGuest
+		p.Subject, p.ClientID, p.Actor, p.Roles, p.Groups = "", "", "", nil, nil
+		p.ShareLinkID, _ = claims["share_link"].(string)
+		p.ProjectID, _ = claims["project_id"].(string)
+	case clientID != "":
+		// our own client tokens and Keycloak service-account tokens carry `client_id`;
+		// user tokens do not
+		p.Kind = KindService
+	}
+	return p
+}
+
+// IsService reports whether the caller is a service rather than a user
+func (p *Principal) IsService() bool { return p.Kind == KindService }
+
+// IsGuest reports whether the caller is an anonymous share-link guest. Guests may
+// only access ProjectID, within their Scopes.
+func (p *Principal) IsGuest() bool { return p.Kind == KindGuest }
+
+// IsImpersonated reports whether another user acts on behalf of Subject
+func (p *Principal) IsImpersonated() bool { return p.Actor != "" }
+
+// HasRole reports whether the principal has role
+func (p *Principal) HasRole(role string) bool { return contains(p.Roles, role) }
+
+// InGroup reports whether the principal is a member of group. Keycloak reports
+// full group paths ("/staff/course-101"); the leading slash is optional in group.
+func (p *Principal) InGroup(group string) bool {
+	group = strings.TrimPrefix(group, "/")
+	for _, g := range p.Groups {
+		if strings.TrimPrefix(g, "/") == group {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token was granted scope
+func (p *Principal) HasScope(scope string) bool { return contains(p.Scopes, scope) }
+
+// CurrentPrincipal returns the principal AuthMiddleware stored for the request
+func CurrentPrincipal(c *gin.Context) (*Principal, bool) {
+	v, ok := c.Get(principalKey)
+	if !ok {
+		return nil, false
+	}
+	p, ok := v.(*Principal)
+	return p, ok
+}
+
+// RequireUser admits user principals only. It must run after AuthMiddleware.
+func RequireUser() gin.HandlerFunc {
+	return requirePrincipal(func(p *Principal) bool { return p.Kind == KindUser && p.Subject != "" })
+}
+
+// RequireGuest admits share-link guests only. It must run after AuthMiddleware.
+func RequireGuest() gin.HandlerFunc {
+	return requirePrincipal(func(p *Principal) bool { return p.IsGuest() })
+}
+
+// RequireProjectAccess admits users, services and the guests of the project named by
+// the path parameter param; guests of other projects are rejected. It does not
+// check a user's own permissions on the project. It must run after AuthMiddleware.
+func RequireProjectAccess(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requirePrincipal(func(p *Principal) bool { return !p.IsGuest() || p.ProjectID == c.Param(param) })(c)
+	}
+}
+
+// RequireService admits service principals only, optionally restricted to the
+// given client IDs. It must run after AuthMiddleware.
+func RequireService(clientIDs ...string) gin.HandlerFunc {
+	return requirePrincipal(func(p *Principal) bool {
+		return p.IsService() && (len(clientIDs) == 0 || contains(clientIDs, p.ClientID))
+	})
+}
+
+// RequireRole admits callers that have every one of roles. It must run after
+// AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return requirePrincipal(func(p *Principal) bool {
+		for _, r := range roles {
+			if !p.HasRole(r) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequireAnyGroup admits callers that are a member of at least one of groups. It
+// must run after AuthMiddleware.
+func RequireAnyGroup(groups ...string) gin.HandlerFunc {
+	return requirePrincipal(func(p *Principal) bool {
+		for _, g := range groups {
+			if p.InGroup(g) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RequireScope admits callers whose token was granted every one of scopes. It must
+// run after AuthMiddleware.
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return requirePrincipal(func(p *Principal) bool {
+		for _, s := range scopes {
+			if !p.HasScope(s) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func requirePrincipal(allowed func(*Principal) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		p, ok := CurrentPrincipal(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+			return
+		}
+		if !allowed(p) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// claimValues collects the values found under paths, without duplicates
+func claimValues(claims map[string]interface{}, paths []string) []string {
+	var out []string
+	for _, path := range paths {
+		for _, v := range stringList(lookupClaim(claims, path)) {
+			if !contains(out, v) {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
+
+// lookupClaim follows a dot-separated path through nested claim objects
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	var cur interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = obj[part]
+	}
+	return cur
+}
+
+func stringList(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return strings.Fields(t)
+	case []string:
+		return t
+	case []interface{}:
+		out := make([]string, 0, len(t))
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// keycloakVerifier returns Keycloak-shaped access tokens for a few known users
+type keycloakVerifier struct{}
+
+func (keycloakVerifier) Verify(ctx context.Context, raw string) (Token, error) {
+	switch raw {
+	case "admin":
+		return &fakeToken{data: map[string]interface{}{
+			"sub":             "u-admin",
+			"realm_access":    map[string]interface{}{"roles": []interface{}{"admin", "offline_access"}},
+			"resource_access": map[string]interface{}{"gogotex": map[string]interface{}{"roles": []interface{}{"project-owner"}}},
+			"scope":           "openid profile projects:read",
+		}}, nil
+	case "staff":
+		return &fakeToken{data: map[string]interface{}{
+			"sub":    "u-staff",
+			"groups": []interface{}{"/staff/course-101"},
+			"roles":  []interface{}{"teacher"},
+		}}, nil
+	case "guest", "guest-revoked":
+		return &fakeToken{data: map[string]interface{}{
+			"token_type": "guest",
+			"share_link": raw,
+			"project_id": "p1",
+			"scope":      "projects:read",
+			"roles":      []interface{}{"admin"},
+		}}, nil
+	}
+	return nil, fmt.Errorf("invalid token")
+}
+
+func TestPrincipalFromClaims(t *testing.T) {
+	SetClaimMapping(DefaultClaimMapping("gogotex"))
+	defer SetClaimMapping(DefaultClaimMapping(""))
+
+	tok, _ := keycloakVerifier{}.Verify(context.Background(), "admin")
+	var claims map[string]interface{}
+	require.NoError(t, tok.Claims(&claims))
+	p := PrincipalFromClaims(claims)
+	require.Equal(t, "u-admin", p.Subject)
+	require.ElementsMatch(t, []string{"admin", "offline_access", "project-owner"}, p.Roles)
+	require.True(t, p.HasScope("projects:read"))
+
+	// a custom mapping only reads the configured paths
+	SetClaimMapping(ClaimMapping{Roles: []string{"resource_access.gogotex.roles"}})
+	p = PrincipalFromClaims(claims)
+	require.Equal(t, []string{"project-owner"}, p.Roles)
+	require.Empty(t, p.Scopes)
+
+	// roles and groups are only trusted from the configured issuers
+	m := DefaultClaimMapping("gogotex")
+	m.RoleIssuers = []string{"https://kc/realms/university", "gogotex-auth"}
+	SetClaimMapping(m)
+	claims["iss"] = "https://kc/realms/guests"
+	claims["groups"] = []interface{}{"staff"}
+	p = PrincipalFromClaims(claims)
+	require.Empty(t, p.Roles)
+	require.Empty(t, p.Groups)
+	require.True(t, p.HasScope("projects:read"))
+	claims["iss"] = "https://kc/realms/university"
+	p = PrincipalFromClaims(claims)
+	require.Contains(t, p.Roles, "admin")
+	require.Equal(t, []string{"staff"}, p.Groups)
+}
+
+func TestRequireRoleGroupScope(t *testing.T) {
+	SetClaimMapping(DefaultClaimMapping("gogotex"))
+	defer SetClaimMapping(DefaultClaimMapping(""))
+
+	g := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api := g.Group("/", AuthMiddleware(keycloakVerifier{}))
+	api.GET("/admin", RequireRole("admin"), ok)
+	api.GET("/owner-admin", RequireRole("admin", "project-owner"), ok)
+	api.GET("/course", RequireAnyGroup("staff/course-101", "/staff/course-202"), ok)
+	api.GET("/projects", RequireScope("projects:read"), ok)
+	g.GET("/unauthenticated", RequireRole("admin"), ok)
+
+	do := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rw := httptest.NewRecorder()
+		g.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	require.Equal(t, http.StatusOK, do("/admin", "admin"))
+	require.Equal(t, http.StatusOK, do("/owner-admin", "admin"))
+	require.Equal(t, http.StatusForbidden, do("/admin", "staff"))
+	require.Equal(t, http.StatusOK, do("/course", "staff"))
+	require.Equal(t, http.StatusForbidden, do("/course", "admin"))
+	require.Equal(t, http.StatusOK, do("/projects", "admin"))
+	require.Equal(t, http.StatusForbidden, do("/projects", "staff"))
+	// without AuthMiddleware there is no principal
+	require.Equal(t, http.StatusUnauthorized, do("/unauthenticated", "admin"))
+}
+
+func TestGuestPrincipal(t *testing.T) {
+	SetShareLinkChecker(func(ctx context.Context, linkID string) (bool, error) { return linkID == "guest", nil })
+	defer SetShareLinkChecker(nil)
+
+	g := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api := g.Group("/", AuthMiddleware(keycloakVerifier{}))
+	api.GET("/me", RequireUser(), ok)
+	api.GET("/admin", RequireRole("admin"), ok)
+	api.GET("/shared", RequireGuest(), ok)
+	api.GET("/projects/:id", RequireProjectAccess("id"), RequireScope("projects:read"), func(c *gin.Context) {
+		p, _ := CurrentPrincipal(c)
+		require.True(t, p.IsGuest())
+		require.Equal(t, "guest", p.ShareLinkID)
+		require.Empty(t, p.Subject)
+		c.Status(http.StatusOK)
+	})
+
+	do := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rw := httptest.NewRecorder()
+		g.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	require.Equal(t, http.StatusOK, do("/projects/p1", "guest"))
+	require.Equal(t, http.StatusForbidden, do("/projects/p2", "guest"))
+	require.Equal(t, http.StatusOK, do("/shared", "guest"))
+	require.Equal(t, http.StatusForbidden, do("/shared", "staff"))
+	require.Equal(t, http.StatusForbidden, do("/me", "guest"))
+	// roles in a guest token are ignored
+	require.Equal(t, http.StatusForbidden, do("/admin", "guest"))
+	require.Equal(t, http.StatusUnauthorized, do("/shared", "guest-revoked"))
+}
@@ -8,6 +8,8 @@ import (
 
 	mr "github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
+	"github.com/gogotex/gogotex/backend/go-services/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/require"
 )
@@ -43,6 +45,6 @@ func TestRedisRateLimitMiddleware_Basic(t *testing.T) {
 	require.Equal(t, http.StatusOK, w3.Code)
 
 	// verify redis limiter metrics
-	require.Equal(t, 1.0, testutil.ToFloat64(metrics.RateLimitAllowed.WithLabelValues("redis")))
+	require.Equal(t, 2.0, testutil.ToFloat64(metrics.RateLimitAllowed.WithLabelValues("redis")))
 	require.Equal(t, 1.0, testutil.ToFloat64(metrics.RateLimitRejected.WithLabelValues("redis")))
 }
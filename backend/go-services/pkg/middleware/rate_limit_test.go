@@ -38,22 +38,27 @@ func TestRateLimitMiddleware_BlocksWhenExceeded(t *testing.T) {
 	// very low rate to force rejections
 	r.Use(RateLimitMiddleware(0.5, 1))
 	r.GET("/limited", func(c *gin.Context) { c.JSON(200, gin.H{"ok": true}) })
+	// limiters are keyed per client IP across the package; use a dedicated address
+	const remote = "198.51.100.7:1234"
 
 	// first request -> allowed
 	rq1 := httptest.NewRequest("GET", "/limited", nil)
+	rq1.RemoteAddr = remote
 	w1 := httptest.NewRecorder()
 	r.ServeHTTP(w1, rq1)
 	require.Equal(t, http.StatusOK, w1.Code)
 
 	// immediate second request -> should be rate-limited
 	rq2 := httptest.NewRequest("GET", "/limited", nil)
+	rq2.RemoteAddr = remote
 	w2 := httptest.NewRecorder()
 	r.ServeHTTP(w2, rq2)
 	require.Equal(t, http.StatusTooManyRequests, w2.Code)
 
-	// wait for half a second (0.5s) to replenish one token and it should be allowed
-	time.Sleep(600 * time.Millisecond)
+	// at 0.5 rps one token is replenished every 2s; afterwards it should be allowed
+	time.Sleep(2100 * time.Millisecond)
 	rq3 := httptest.NewRequest("GET", "/limited", nil)
+	rq3.RemoteAddr = remote
 	w3 := httptest.NewRecorder()
 	r.ServeHTTP(w3, rq3)
 	require.Equal(t, http.StatusOK, w3.Code)
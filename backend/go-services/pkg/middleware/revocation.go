@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gogotex/gogotex/backend/go-services/internal/sessions"
+)
+
+// revocationCacheTTL bounds how long a "not revoked" answer is reused, i.e. how late
+// other replicas may notice a revocation. Revoked jtis are remembered until the
+// token expires.
+const revocationCacheTTL = 5 * time.Second
+
+// maxRevocationEntries triggers a sweep of expired entries
+const maxRevocationEntries = 10000
+
+type revocationEntry struct {
+	revoked bool
+	until   time.Time
+}
+
+// revocationCache keeps recent blacklist lookups so most authenticated requests
+// do not need a Redis round trip.
+type revocationCache struct {
+	mu      sync.Mutex
+	entries map[string]revocationEntry
+}
+
+var revocations = &revocationCache{entries: map[string]revocationEntry{}}
+
+// NoteRevoked records a revocation made by this process so it takes effect
+// immediately instead of after the cache TTL. until is the token's expiry.
+func NoteRevoked(jti string, until time.Time) {
+	if jti == "" {
+		return
+	}
+	revocations.put(jti, revocationEntry{revoked: true, until: until})
+}
+
+// isRevoked consults the cache, falling back to the Redis blacklist
+func (rc *revocationCache) isRevoked(ctx context.Context, jti string, exp time.Time) (bool, error) {
+	now := time.Now()
+	rc.mu.Lock()
+	e, ok := rc.entries[jti]
+	rc.mu.Unlock()
+	if ok && now.Before(e.until) {
+		return e.revoked, nil
+	}
+	revoked, err := sessions.IsJTIBlacklisted(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+	e = revocationEntry{revoked: revoked, until: now.Add(revocationCacheTTL)}
+	if revoked && exp.After(e.until) {
+		e.until = exp
+	}
+	rc.put(jti, e)
+	return revoked, nil
+}
+
+func (rc *revocationCache) put(jti string, e revocationEntry) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.entries) >= maxRevocationEntries {
+		now := time.Now()
+		for k, v := range rc.entries {
+			if !now.Before(v.until) {
+				delete(rc.entries, k)
+			}
+		}
+	}
+	rc.entries[jti] = e
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+)
+
+// CompositeVerifier tries each verifier in order and returns the first token that
+// verifies. It lets a route accept first-party access tokens as well as Keycloak tokens.
+type CompositeVerifier struct {
+	verifiers []Verifier
+}
+
+// NewCompositeVerifier builds a CompositeVerifier; nil verifiers are skipped.
+func NewCompositeVerifier(vs ...Verifier) *CompositeVerifier {
+	c := &CompositeVerifier{}
+	for _, v := range vs {
+		if v != nil {
+			c.verifiers = append(c.verifiers, v)
+		}
+	}
+	return c
+}
+
+func (c *CompositeVerifier) Verify(ctx context.Context, raw string) (Token, error) {
+	if len(c.verifiers) == 0 {
+		return nil, errors.New("no token verifier configured")
+	}
+	var errs []error
+	for _, v := range c.verifiers {
+		tok, err := v.Verify(ctx, raw)
+		if err == nil {
+			return tok, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
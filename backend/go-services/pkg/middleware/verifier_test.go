@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type staticVerifier struct {
+	accept string
+	sub    string
+}
+
+func (s *staticVerifier) Verify(ctx context.Context, raw string) (Token, error) {
+	if raw == s.accept {
+		return &fakeToken{data: map[string]interface{}{"sub": s.sub}}, nil
+	}
+	return nil, fmt.Errorf("%s: invalid token", s.sub)
+}
+
+func TestCompositeVerifier_TriesInOrder(t *testing.T) {
+	first := &staticVerifier{accept: "own", sub: "first-party"}
+	second := &staticVerifier{accept: "kc", sub: "keycloak"}
+	c := NewCompositeVerifier(first, nil, second)
+
+	for raw, want := range map[string]string{"own": "first-party", "kc": "keycloak"} {
+		tok, err := c.Verify(context.Background(), raw)
+		require.NoError(t, err)
+		var claims map[string]interface{}
+		require.NoError(t, tok.Claims(&claims))
+		require.Equal(t, want, claims["sub"])
+	}
+
+	_, err := c.Verify(context.Background(), "neither")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "first-party")
+	require.Contains(t, err.Error(), "keycloak")
+}
+
+func TestCompositeVerifier_Empty(t *testing.T) {
+	_, err := NewCompositeVerifier().Verify(context.Background(), "x")
+	require.Error(t, err)
+}
@@ -1,5 +1,6 @@
 import React from 'react'
 import { Link } from 'react-router-dom'
+import { authService } from './services/authService'
 
 export default function App() {
   return (
@@ -11,7 +12,7 @@ export default function App() {
         callback.
       </p>
       <p>
-        <a href={`${import.meta.env.VITE_KEYCLOAK_URL}/realms/${import.meta.env.VITE_KEYCLOAK_REALM}/protocol/openid-connect/auth?client_id=${import.meta.env.VITE_KEYCLOAK_CLIENT_ID}&response_type=code&redirect_uri=${encodeURIComponent(import.meta.env.VITE_REDIRECT_URI || 'http://localhost:3000/auth/callback')}`}>
+        <a href={authService.loginUrl('/')}>
           Sign in with Keycloak
         </a>
       </p>
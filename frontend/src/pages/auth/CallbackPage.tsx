@@ -1,10 +1,9 @@
 import React, { useEffect, useState } from 'react'
-import { useSearchParams, useNavigate } from 'react-router-dom'
+import { useNavigate } from 'react-router-dom'
 import { useAuthStore } from '../../stores/authStore'
 import { authService } from '../../services/authService'
 
 export const CallbackPage: React.FC = () => {
-  const [searchParams] = useSearchParams()
   const navigate = useNavigate()
   const setAuth = useAuthStore((s) => s.setAuth)
   const [error, setError] = useState<string | null>(null)
@@ -12,24 +11,24 @@ export const CallbackPage: React.FC = () => {
   useEffect(() => {
     const handleCallback = async () => {
       try {
-        const code = searchParams.get('code')
-        const state = searchParams.get('state')
-        if (!code) throw new Error('Missing authorization code')
+        // the auth service delivers the tokens in the fragment, never in the query
+        const fragment = window.location.hash
+        if (!fragment) throw new Error('Missing login result')
 
-        const data = await authService.handleCallback(code, state || '')
+        const data = await authService.handleCallback(fragment)
         setAuth({
           user: data.user,
           accessToken: data.accessToken,
           refreshToken: data.refreshToken,
         })
-        navigate('/', { replace: true })
+        navigate(data.returnTo, { replace: true })
       } catch (err) {
         console.error('Auth callback error:', err)
         setError(err instanceof Error ? err.message : 'Authentication failed')
       }
     }
     handleCallback()
-  }, [searchParams, setAuth, navigate])
+  }, [setAuth, navigate])
 
   if (error) return <div style={{padding:20}}>Auth callback error: {error}</div>
   return <div style={{padding:20}}>Processing login... please wait.</div>
@@ -1,21 +1,44 @@
 export interface LoginResponse {
   accessToken: string
-  refreshToken: string
+  refreshToken: string | null
+  expiresIn: number
+  returnTo: string
   user: any
 }
 
+const authURL = () => import.meta.env.VITE_AUTH_URL || 'http://localhost:8081'
+
+// isRelativePath accepts same-origin paths only (no "//host" or absolute URLs)
+const isRelativePath = (p: string) => p.startsWith('/') && !p.startsWith('//') && !p.includes('\\')
+
 export const authService = {
-  // Exchange authorization code with the backend auth service
-  async handleCallback(code: string, _state: string): Promise<LoginResponse> {
-    const resp = await fetch((import.meta.env.VITE_AUTH_URL || 'http://localhost:8081') + '/auth/login', {
-      method: 'POST',
-      headers: { 'Content-Type': 'application/json' },
-      body: JSON.stringify({ mode: 'auth_code', code, redirect_uri: import.meta.env.VITE_REDIRECT_URI || 'http://localhost:3000/auth/callback' }),
+  // Sign-in URL. The auth service keeps state, nonce and PKCE verifier itself, lets
+  // the user sign in at Keycloak and sends the browser back to /auth/callback
+  // (AUTH_POST_LOGIN_REDIRECT) with the tokens in the URL fragment.
+  loginUrl(returnTo = '/'): string {
+    return `${authURL()}/auth/authorize?return_to=${encodeURIComponent(returnTo)}`
+  },
+
+  // Read the tokens from the callback fragment and load the signed-in user
+  async handleCallback(fragment: string): Promise<LoginResponse> {
+    const params = new URLSearchParams(fragment.replace(/^#/, ''))
+    const accessToken = params.get('access_token')
+    if (!accessToken) throw new Error('Missing access token')
+    const resp = await fetch(authURL() + '/api/v1/me', {
+      headers: { Authorization: `Bearer ${accessToken}` },
     })
     if (!resp.ok) {
       const body = await resp.text()
       throw new Error(`Auth service error: ${resp.status} ${body}`)
     }
-    return resp.json()
+    const me = await resp.json()
+    const returnTo = params.get('return_to') || '/'
+    return {
+      accessToken,
+      refreshToken: params.get('refresh_token'),
+      expiresIn: Number(params.get('expires_in') || 0),
+      returnTo: isRelativePath(returnTo) ? returnTo : '/',
+      user: me.user ?? me.claims,
+    }
   },
 }
@@ -2,31 +2,30 @@ import { test, expect } from '@playwright/test'
 
 // Test does an end-to-end browser flow against Keycloak + frontend + backend.
 // Expectations:
-// - Keycloak is reachable at PLAYWRIGHT_KEYCLOAK (or http://keycloak-keycloak:8080)
+// - Keycloak is reachable from the browser at the KEYCLOAK_URL of the auth service
 // - Frontend is reachable at PLAYWRIGHT_BASE_URL (default http://localhost:3000 or http://frontend when run inside docker network)
-// - Redirect URI used will be PLAYWRIGHT_REDIRECT_URI or `${baseURL}/auth/callback`
+// - The auth service is reachable at PLAYWRIGHT_AUTH_URL and sends the browser to
+//   PLAYWRIGHT_REDIRECT_URI or `${baseURL}/auth/callback` after login
 // - TEST_USER and TEST_PASS must be provided via env
 
-const KEYCLOAK = process.env.PLAYWRIGHT_KEYCLOAK || 'http://keycloak-keycloak:8080'
-const CLIENT_ID = process.env.PLAYWRIGHT_KC_CLIENT || 'gogotex-backend'
-const REALM = process.env.PLAYWRIGHT_KC_REALM || 'gogotex'
+const AUTH = process.env.PLAYWRIGHT_AUTH_URL || 'http://gogotex-auth-integration:8081'
 const TEST_USER = process.env.TEST_USER || 'testuser'
 const TEST_PASS = process.env.TEST_PASS || 'Test123!'
 
-test('auth-code E2E: browser -> Keycloak -> frontend callback -> backend exchange', async ({ page, baseURL }) => {
+test('auth-code E2E: browser -> auth service -> Keycloak -> auth callback -> frontend', async ({ page, baseURL }) => {
   const redirectUri = process.env.PLAYWRIGHT_REDIRECT_URI || `${baseURL}/auth/callback`
-  const authUrl = `${KEYCLOAK}/realms/${REALM}/protocol/openid-connect/auth?client_id=${CLIENT_ID}&response_type=code&scope=openid&redirect_uri=${encodeURIComponent(
-    redirectUri,
-  )}`
+  // start where the Sign-in link does: the auth service keeps state, nonce and PKCE,
+  // sends the browser to Keycloak and finally to the frontend callback
+  const authUrl = `${AUTH}/auth/authorize?return_to=${encodeURIComponent('/')}`
 
-  // Intercept the POST to /auth/login so we can verify backend response body
-  let loginResponseBody: any = null
+  // Intercept the /api/v1/me call the callback page makes with the delivered token
+  let meResponseBody: any = null
   page.on('response', async (response) => {
     try {
       const req = response.request()
-      if (req.method() === 'POST' && req.url().includes('/auth/login')) {
+      if (req.method() === 'GET' && req.url().includes('/api/v1/me')) {
         if (response.status() === 200) {
-          loginResponseBody = await response.json()
+          meResponseBody = await response.json()
         }
       }
     } catch (err) {
@@ -34,7 +33,7 @@ test('auth-code E2E: browser -> Keycloak -> frontend callback -> backend exchang
     }
   })
 
-  // Start at the Keycloak auth endpoint (simulate clicking the Sign-in link)
+  // Start at the Sign-in link
   await page.goto(authUrl)
   // Fill Keycloak login form
   await page.fill('input[name="username"]', TEST_USER)
@@ -45,9 +44,8 @@ test('auth-code E2E: browser -> Keycloak -> frontend callback -> backend exchang
     page.click('button[type=submit], input[type=submit], button#kc-login'),
   ])
 
-  // After redirect the frontend should POST the code to /auth/login — wait for that response
-  await page.waitForTimeout(500) // brief pause to let callback handler run
-  expect(loginResponseBody).not.toBeNull()
-  expect(loginResponseBody.accessToken).toBeTruthy()
-  expect(loginResponseBody.user).toBeTruthy()
+  // After redirect the callback page loads the user with the token from the fragment
+  await page.waitForURL((u) => !u.pathname.startsWith('/auth/callback'), { timeout: 10000 })
+  expect(meResponseBody).not.toBeNull()
+  expect(meResponseBody.user || meResponseBody.claims).toBeTruthy()
 })
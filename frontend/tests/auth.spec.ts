@@ -1,8 +1,7 @@
 import { test, expect } from '@playwright/test'
 
 const KEYCLOAK = process.env.PLAYWRIGHT_KEYCLOAK || 'http://keycloak-keycloak:8080'
-const CLIENT_ID = process.env.PLAYWRIGHT_KC_CLIENT || 'gogotex-backend'
-const REALM = process.env.PLAYWRIGHT_KC_REALM || 'gogotex'
+const AUTH = process.env.PLAYWRIGHT_AUTH_URL || 'http://gogotex-auth-integration:8081'
 const TEST_USER = process.env.TEST_USER || 'testuser'
 let TEST_PASS = process.env.TEST_PASS || 'Test123!'
 // If the repository provides a test user password file (used by CI), prefer that
@@ -15,27 +14,27 @@ try {
   }
 } catch (e) { /* ignore */ }
 
-test('auth-code E2E: browser -> Keycloak -> frontend callback -> backend exchange', async ({ page, baseURL }) => {
+test('auth-code E2E: browser -> auth service -> Keycloak -> auth callback -> frontend', async ({ page, baseURL }) => {
   test.setTimeout(120000)
   page.on('console', (c) => console.log('PAGE>', c.type(), c.text()))
 
   const redirectUri = process.env.PLAYWRIGHT_REDIRECT_URI || `${baseURL}/auth/callback`
-  const authUrl = `${KEYCLOAK}/realms/${REALM}/protocol/openid-connect/auth?client_id=${CLIENT_ID}&response_type=code&scope=openid&redirect_uri=${encodeURIComponent(
-    redirectUri,
-  )}`
+  // start where the Sign-in link does: the auth service keeps state, nonce and PKCE,
+  // sends the browser to Keycloak and finally to the frontend callback
+  const authUrl = `${AUTH}/auth/authorize?return_to=${encodeURIComponent('/')}`
 
-  let loginResponseBody: any = null
+  let meResponseBody: any = null
   page.on('response', async (response) => {
     try {
       const req = response.request()
-      if (req.method() === 'POST' && req.url().includes('/auth/login')) {
+      if (req.method() === 'GET' && req.url().includes('/api/v1/me')) {
         // capture response body for both success and failure to aid debugging
         const status = response.status()
         let body = null
         try { body = await response.text() } catch (e) { /* ignore */ }
-        console.log('DEBUG: /auth/login -> status=' + status + ' body=' + (body || '<empty>'))
+        console.log('DEBUG: /api/v1/me -> status=' + status + ' body=' + (body || '<empty>'))
         if (status === 200) {
-          loginResponseBody = JSON.parse(body || '{}')
+          meResponseBody = JSON.parse(body || '{}')
         }
       }
     } catch (err) {
@@ -78,27 +77,19 @@ test('auth-code E2E: browser -> Keycloak -> frontend callback -> backend exchang
     throw err
   }
 
-  // DEBUG: print the callback URL (includes authorization code) so CI logs can reproduce token exchanges
-  console.log('DEBUG: callback URL ->', page.url())
+  // the callback carries the tokens in the fragment only, never a code in the query
+  const callbackUrl = new URL(page.url())
+  expect(callbackUrl.searchParams.get('code')).toBeNull()
+  expect(new URLSearchParams(callbackUrl.hash.slice(1)).get('access_token')).toBeTruthy()
 
-  // Assert frontend POST to /auth/login contains required mode field (prevents regressions)
+  // the frontend must not fall back to posting a code to /auth/login
   let sawAuthLoginRequest = false
   page.on('request', (req) => {
-    try {
-      if (req.method() === 'POST' && req.url().includes('/auth/login')) {
-        const pd = req.postData() || ''
-        if (pd.includes('"mode":"auth_code"')) {
-          sawAuthLoginRequest = true
-        }
-      }
-    } catch (e) {
-      /* ignore */
-    }
+    if (req.method() === 'POST' && req.url().includes('/auth/login')) sawAuthLoginRequest = true
   })
 
-  await page.waitForTimeout(500)
-  expect(sawAuthLoginRequest).toBeTruthy()
-  expect(loginResponseBody).not.toBeNull()
-  expect(loginResponseBody.accessToken).toBeTruthy()
-  expect(loginResponseBody.user).toBeTruthy()
+  await page.waitForURL((u) => !u.pathname.startsWith('/auth/callback'), { timeout: 10000 })
+  expect(sawAuthLoginRequest).toBeFalsy()
+  expect(meResponseBody).not.toBeNull()
+  expect(meResponseBody.user || meResponseBody.claims).toBeTruthy()
 })
@@ -1,8 +1,6 @@
 import { test, expect } from '@playwright/test'
 
-const KEYCLOAK = process.env.PLAYWRIGHT_KEYCLOAK || 'http://keycloak-keycloak:8080'
-const CLIENT_ID = process.env.PLAYWRIGHT_KC_CLIENT || 'gogotex-backend'
-const REALM = process.env.PLAYWRIGHT_KC_REALM || 'gogotex'
+const AUTH = process.env.PLAYWRIGHT_AUTH_URL || 'http://gogotex-auth-integration:8081'
 const TEST_USER = process.env.TEST_USER || 'testuser'
 let TEST_PASS = process.env.TEST_PASS || 'Test123!'
 try {
@@ -15,9 +13,9 @@ try {
 
 async function performOidcLogin(page: any, baseURL: string) {
   const redirectUri = process.env.PLAYWRIGHT_REDIRECT_URI || `${baseURL}/auth/callback`
-  const authUrl = `${KEYCLOAK}/realms/${REALM}/protocol/openid-connect/auth?client_id=${CLIENT_ID}&response_type=code&scope=openid&redirect_uri=${encodeURIComponent(
-    redirectUri,
-  )}`
+  // start where the Sign-in link does: the auth service keeps state, nonce and PKCE,
+  // sends the browser to Keycloak and finally to the frontend callback
+  const authUrl = `${AUTH}/auth/authorize?return_to=${encodeURIComponent('/')}`
 
   await page.goto(authUrl)
   await page.waitForSelector('input[name="username"]', { timeout: 10000 })
@@ -0,0 +1,2 @@
+#!/bin/bash
+docker compose down mailpit-mailpit
\ No newline at end of file
@@ -0,0 +1,2 @@
+#!/bin/bash
+docker logs -f mailpit-mailpit
\ No newline at end of file
@@ -8,8 +8,12 @@ db = db.getSiblingDB('gogotex');
 if (!db.getCollectionNames().includes('users')) {
   db.createCollection('users');
 }
-db.users.createIndex({ 'oidcId': 1 }, { unique: true });
-db.users.createIndex({ 'email': 1 }, { unique: true });
+// Users are keyed by identity provider and subject; 'sub' is the application subject
+db.users.createIndex({ 'issuer': 1, 'oidcId': 1 }, { unique: true });
+db.users.createIndex({ 'sub': 1 }, { unique: true });
+// the same email may sign in through several realms; the auth service drops the
+// unique oidcId and email indexes of older databases on startup
+db.users.createIndex({ 'email': 1 });
 db.users.createIndex({ 'createdAt': 1 });
 
 // Create projects collection with indexes
@@ -37,6 +41,40 @@ db.sessions.createIndex({ 'expiresAt': 1 }, { expireAfterSeconds: 0 });
 db.sessions.createIndex({ 'userId': 1 });
 // Index the refresh token field (code uses 'refreshToken')
 db.sessions.createIndex({ 'refreshToken': 1 }, { unique: true });
+// Token families (refresh rotation / reuse detection)
+db.sessions.createIndex({ 'familyId': 1 });
+// Session listing per user
+db.sessions.createIndex({ 'sub': 1, 'createdAt': -1 });
+// Keycloak session id (back-channel logout)
+db.sessions.createIndex({ 'providerSid': 1 }, { sparse: true });
+
+// Create personal_access_tokens collection (only SHA-256 hashes are stored)
+if (!db.getCollectionNames().includes('personal_access_tokens')) {
+  db.createCollection('personal_access_tokens');
+}
+db.personal_access_tokens.createIndex({ 'tokenHash': 1 }, { unique: true });
+db.personal_access_tokens.createIndex({ 'sub': 1, 'createdAt': -1 });
+
+// Create share_links collection (only hashes of link secrets and passwords are stored)
+if (!db.getCollectionNames().includes('share_links')) {
+  db.createCollection('share_links');
+}
+db.share_links.createIndex({ 'tokenHash': 1 }, { unique: true });
+db.share_links.createIndex({ 'projectId': 1, 'createdAt': -1 });
+
+// Create known_devices collection (devices users signed in from; forgotten after a year unused)
+if (!db.getCollectionNames().includes('known_devices')) {
+  db.createCollection('known_devices');
+}
+db.known_devices.createIndex({ 'sub': 1, 'deviceId': 1 }, { unique: true });
+db.known_devices.createIndex({ 'lastSeen': 1 }, { expireAfterSeconds: 31536000 });
+
+// Create audit_log collection (admin impersonation and other privileged actions)
+if (!db.getCollectionNames().includes('audit_log')) {
+  db.createCollection('audit_log');
+}
+db.audit_log.createIndex({ 'actor': 1, 'time': -1 });
+db.audit_log.createIndex({ 'subject': 1, 'time': -1 });
 
 // Create activity_logs collection with indexes
 if (!db.getCollectionNames().includes('activity_logs')) {
@@ -47,4 +85,4 @@ db.activity_logs.createIndex({ 'userId': 1, 'timestamp': -1 });
 db.activity_logs.createIndex({ 'timestamp': -1 });
 
 print('✅ GoGoTeX database initialized successfully');
-print('Collections created: users, projects, documents, sessions, activity_logs');
\ No newline at end of file
+print('Collections created: users, projects, documents, sessions, personal_access_tokens, share_links, known_devices, audit_log, activity_logs');
\ No newline at end of file
@@ -61,13 +61,15 @@ docker build \
   --build-arg VITE_KEYCLOAK_REALM=gogotex \
   --build-arg VITE_KEYCLOAK_CLIENT_ID=gogotex-backend \
   --build-arg VITE_AUTH_URL=http://gogotex-auth-integration:8081 \
-  --build-arg VITE_REDIRECT_URI=http://frontend/auth/callback \
   -t gogotex-frontend:local "$ROOT_DIR/frontend"
 
-# Quick regression guard: ensure built frontend contains required auth payload (mode=auth_code)
-# Accept either minified/unquoted property output (mode:"auth_code") or explicit JSON string ("mode":"auth_code").
-if ! docker run --rm gogotex-frontend:local sh -c "cat /usr/share/nginx/html/assets/index-*.js | grep -E -q '(\"mode\":\"auth_code\"|mode:\"auth_code\")'"; then
-    echo 'ERROR: built frontend bundle missing "mode":"auth_code" (regression)' >&2
+# Quick regression guard: the built frontend must sign in through the auth service
+# (/auth/authorize), never by posting a raw authorization code to /auth/login
+if ! docker run --rm gogotex-frontend:local sh -c "cat /usr/share/nginx/html/assets/index-*.js | grep -q '/auth/authorize'"; then
+    echo 'ERROR: built frontend bundle does not use /auth/authorize (regression)' >&2
+fi
+if docker run --rm gogotex-frontend:local sh -c "cat /usr/share/nginx/html/assets/index-*.js | grep -E -q '(\"mode\":\"auth_code\"|mode:\"auth_code\")'"; then
+    echo 'ERROR: built frontend bundle still posts mode=auth_code (regression)' >&2
 fi
 
 echo "Starting frontend service for E2E auth-code test..."
@@ -246,11 +248,12 @@ if [ "$AUTH_CONTAINER_NAME" = "gogotex-auth" ]; then
     docker rm -f "$AUTH_CONTAINER_NAME" >/dev/null 2>&1 || true
     # Start the container (no host port publishing — tests run inside the same Docker network)
     if ! docker run -d --name "$AUTH_CONTAINER_NAME" --network "$NET" -e KC_INSECURE=true \
-      -e ALLOW_INSECURE_TOKEN=true \
       -e KEYCLOAK_URL=http://keycloak-keycloak:8080/sso \
       -e KEYCLOAK_REALM=gogotex \
       -e KEYCLOAK_CLIENT_ID=gogotex-backend \
       -e KEYCLOAK_CLIENT_SECRET="$CLIENT_SECRET" \
+      -e KEYCLOAK_REDIRECT_URI="http://$AUTH_CONTAINER_NAME:8081/auth/callback" \
+      -e AUTH_POST_LOGIN_REDIRECT=http://frontend/auth/callback \
       -e MONGODB_URI=mongodb://mongodb-mongodb:27017 \
       -e MONGODB_DATABASE=gogotex \
       -e SERVER_HOST=0.0.0.0 -e SERVER_PORT=8081 \
@@ -504,415 +507,101 @@ if [ "${START_TEXLIVE:-false}" = "true" ] || [ -n "${DOCKER_TEX_IMAGE:-}" ]; the
   fi
 fi
 
-# --- Start auth-code E2E flow: perform headless login to capture code or fallback to callback sink ---
-# perform headless login using a small Python script (runs in-network)
+# --- Start auth-code E2E flow: headless login through /auth/authorize and /auth/callback ---
+# The auth service owns state, nonce and PKCE; the script only plays the browser.
 TEST_PASS_FILE="$ROOT_DIR/gogotex-support-services/keycloak-service/testuser_password.txt"
 TEST_PASS="$(cat "$TEST_PASS_FILE")"
-# initialize capture variables (avoid unbound-variable under set -u)
-CODE=""
-REDIRECT_URI=""
 
-# Option: FORCE_CB_SINK=true will use an HTTP callback sink (cb-sink) to capture the authorization code
 # Determine which doc service to call for smoke tests: external service takes precedence
 DOC_SERVICE_HOST="$AUTH_HOST"
 if [ "${DOC_SERVICE_EXTERNAL:-false}" = "true" ]; then
   DOC_SERVICE_HOST="gogotex-go-document:5010"
 fi
 
-if [ "${FORCE_CB_SINK:-false}" = "true" ]; then
-  echo "FORCE_CB_SINK=true: using callback sink to capture authorization code"
-  docker rm -f cb-sink >/dev/null 2>&1 || true
-  # Run callback sink on the internal network (no host port publishing required)
-  docker run -d --name cb-sink --network "$NET" python:3.11-slim sh -c "python -u -m http.server 3000" >/dev/null
-  # trigger the auth request (headless login will POST credentials and Keycloak will redirect to cb-sink)
-  # perform a headless Python POST that follows redirects so Keycloak will redirect to cb-sink (reliable for required-action flows)
-  docker run --rm --network "$NET" -e TEST_USER="$TEST_USER" -e TEST_PASS="$TEST_PASS" python:3.11-slim sh -s <<'PY' || true
-pip install requests bs4 >/dev/null 2>&1
-python - <<'P'
-import os, requests
-from bs4 import BeautifulSoup
-s = requests.Session()
-auth_url = 'http://keycloak-keycloak:8080/sso/realms/gogotex/protocol/openid-connect/auth?client_id=gogotex-backend&response_type=code&scope=openid&redirect_uri=http://cb-sink:3000/callback'
-resp = s.get(auth_url, verify=False)
-soup = BeautifulSoup(resp.text, 'html.parser')
-form = soup.find('form')
-if not form:
-    raise SystemExit(1)
-action = form.get('action')
-if action and 'localhost' in action:
-    action = action.replace('localhost:8080','keycloak-keycloak:8080')
-payload = {inp['name']: inp.get('value','') for inp in form.find_all('input') if inp.get('name')}
-payload['username'] = os.environ['TEST_USER']
-payload['password'] = os.environ['TEST_PASS']
-# submit and follow redirects so cb-sink receives the GET
-resp = s.post(action, data=payload, allow_redirects=True, verify=False)
-print(resp.status_code)
-P
-PY
-  for i in {1..30}; do
-    LOGS=$(docker logs cb-sink 2>/dev/null || true)
-    CODE=$(echo "$LOGS" | grep -o 'code=[^ &"]*' | head -n1 | sed 's/^code=//') || true
-    if [ -n "$CODE" ]; then
-      echo "Captured code from cb-sink: $CODE"; break
-    fi
-    sleep 1
-  done
-  if [ -z "$CODE" ]; then
-    echo "Failed to capture authorization code via cb-sink"
-    # Persist diagnostics
-    echo "--- cb-sink logs ---" > "$DIAG_DIR/cb-sink.log" || true
-    docker logs cb-sink 2>/dev/null | sed -n '1,200p' >> "$DIAG_DIR/cb-sink.log" || true
-    docker logs keycloak-keycloak 2>/dev/null | sed -n '1,400p' > "$DIAG_DIR/keycloak.log" || true
-    echo "Saved diagnostics to $DIAG_DIR/* (cb-sink, keycloak)"
-    docker rm -f "$AUTH_CONTAINER_NAME" >/dev/null 2>&1 || true
-    exit 6
-  fi
-else
-  echo "Performing headless login to obtain authorization code (captures code from redirect)..."
-  # ensure callback sink (cb-sink) is available **before** following redirects
-  docker rm -f cb-sink >/dev/null 2>&1 || true
-  echo "Starting callback sink (cb-sink) on network $NET (preheadless)..."
-  docker rm -f cb-sink >/dev/null 2>&1 || true
-  # Run callback sink on the internal network (no host port publishing required)
-  docker run -d --name cb-sink --network "$NET" python:3.11-slim sh -c "python -u -m http.server 3000" >/dev/null
-  # Wait until cb-sink shows as Up (Docker may need a moment to register DNS)
-  for i in {1..6}; do
-    STATUS=$(docker ps --filter name=cb-sink --format '{{.Status}}' || true)
-    if echo "$STATUS" | grep -q '^Up'; then
-      echo "cb-sink is running ($STATUS)"; break
-    fi
-    echo "waiting for cb-sink DNS/ready... ($i)"; sleep 1
-  done
-  if ! echo "$STATUS" | grep -q '^Up'; then
-    echo "Warning: cb-sink did not start properly (status='$STATUS')" || true
-  fi
-
-  # The Python script will detect the authorization code and the redirect URI used in Location headers during redirects
-  # It prints the values as: <code>|||<redirect_uri>
-  # Save Keycloak login HTML for diagnostics (helps when headless capture fails)
-  KEYCLOAK_LOGIN_URL='http://keycloak-keycloak:8080/sso/realms/gogotex/protocol/openid-connect/auth?client_id=gogotex-backend&response_type=code&scope=openid&redirect_uri=http://cb-sink:3000/callback'
-  docker run --rm --network "$NET" curlimages/curl -sS "$KEYCLOAK_LOGIN_URL" > "$DIAG_DIR/keycloak_login.html" || true
-
-  # --- try server-side non-follow POST to capture Location header (primary, reliable) ---
-  LOCATION_HDR=$(docker run --rm --network "$NET" curlimages/curl -sS "$DIAG_DIR/keycloak_login.html":/tmp/kc.html true 2>/dev/null || true)
-  # extract form action and POST credentials without following redirects
-  ACTION=$(sed -n '1,400p' "$DIAG_DIR/keycloak_login.html" | grep -o 'action="[^"]*"' | head -n1 | sed -E 's/action="([^"]*)"/\1/' | sed 's/localhost:8080/keycloak-keycloak:8080/g' || true)
-  if [ -n "$ACTION" ]; then
-    LOCATION_HDR=$(docker run --rm --network "$NET" curlimages/curl -sS -D - -o /dev/null -X POST --data "username=$TEST_USER&password=$TEST_PASS" "$ACTION" | sed -n 's/Location: \(.*\)/\1/ip' | tr -d '\r' || true)
-    if printf '%s' "$LOCATION_HDR" | grep -q 'code='; then
-      echo "Captured code in Location header (server-side): $LOCATION_HDR"
-      CODE=$(printf '%s' "$LOCATION_HDR" | sed -n 's/.*[?&]code=\([^&]*\).*/\1/p') || true
-      REDIRECT_URI=$(printf '%s' "$LOCATION_HDR" | sed -n 's/\(https*:\/\/[^?]*\).*/\1/p') || true
-    fi
-  fi
-
-  # Try the robust 'fresh GET + non-follow POST' first (same session) to capture Location header
-  if [ -z "$CODE" ]; then
-    echo "Trying fresh GET+non-follow POST (robust primary attempt)..."
-    FRESH_LOC=$(docker run --rm --network "$NET" -e TEST_USER="$TEST_USER" -e TEST_PASS="$TEST_PASS" python:3.11-slim /bin/sh -c "pip install requests bs4 >/dev/null 2>&1; python - <<'PY'
-import os, requests
-from bs4 import BeautifulSoup
-s = requests.Session()
-url = 'http://keycloak-keycloak:8080/sso/realms/gogotex/protocol/openid-connect/auth?client_id=gogotex-backend&response_type=code&scope=openid&redirect_uri=http://cb-sink:3000/callback'
-resp = s.get(url, verify=False)
-soup = BeautifulSoup(resp.text, 'html.parser')
-form = soup.find('form')
-if not form:
-    print('')
-else:
-    action = form.get('action')
-    if 'localhost' in action:
-        action = action.replace('localhost:8080','keycloak-keycloak:8080')
-    inputs = {inp.get('name'): inp.get('value','') for inp in form.find_all('input') if inp.get('name')}
-    inputs['username'] = os.environ.get('TEST_USER')
-    inputs['password'] = os.environ.get('TEST_PASS')
-    r = s.post(action, data=inputs, allow_redirects=False, verify=False)
-    print(r.headers.get('Location','') or '')
-PY" || true)
-    if printf '%s' "$FRESH_LOC" | grep -q 'code='; then
-      echo "Captured code from fresh GET+POST: $FRESH_LOC"
-      CODE=$(printf '%s' "$FRESH_LOC" | sed -n 's/.*[?&]code=\([^&]*\).*/\1/p') || true
-      REDIRECT_URI=$(printf '%s' "$FRESH_LOC" | sed -n 's/\(https*:\/\/[^?]*\).*/\1/p') || true
-    fi
-  fi
-
-  # Only run headless flow if CODE still empty
-  if [ -z "$CODE" ]; then
-    # Persist headless output for diagnostics so intermittent failures can be inspected
-    HEADLESS_OUT="$DIAG_DIR/headless_raw_$(date +%Y%m%d-%H%M%S).txt"
-    echo "Running headless flow (output -> $HEADLESS_OUT)"
-    docker run --rm --network "$NET" -e TEST_USER="$TEST_USER" -e TEST_PASS="$TEST_PASS" python:3.11-slim sh -s >"$HEADLESS_OUT" 2>&1 <<'SH'
-python - <<'PY'
-import os, time, requests
-from bs4 import BeautifulSoup
-from urllib.parse import urlparse, parse_qs
-s = requests.Session()
-
-auth_url = 'http://keycloak-keycloak:8080/sso/realms/gogotex/protocol/openid-connect/auth?client_id=gogotex-backend&response_type=code&scope=openid&redirect_uri=http://cb-sink:3000/callback'
-resp = s.get(auth_url, verify=False)
-soup = BeautifulSoup(resp.text, 'html.parser')
-form = soup.find('form')
-if not form:
-    print('|||')
-    raise SystemExit(0)
-
-action = form.get('action')
-if action and 'localhost' in action:
-    action = action.replace('localhost:8080','keycloak-keycloak:8080')
-
-payload = {inp['name']: inp.get('value','') for inp in form.find_all('input') if inp.get('name')}
-payload['username'] = os.environ['TEST_USER']
-payload['password'] = os.environ['TEST_PASS']
-
-# submit and follow redirects so Keycloak will redirect to cb-sink if configured
-try:
-    resp = s.post(action, data=payload, allow_redirects=True, verify=False)
-except requests.exceptions.ConnectionError:
-    # connection to cb-sink may fail during redirect; fallthrough and inspect history/body
-    resp = s.get(auth_url, verify=False)
-
-# If Keycloak returns a required-action (e.g. VERIFY_PROFILE), complete it automatically
-if 'required-action' in resp.url or 'VERIFY_PROFILE' in resp.url or 'required-action' in resp.text:
-    soup2 = BeautifulSoup(resp.text, 'html.parser')
-    form2 = soup2.find('form')
-    if form2:
-        action2 = form2.get('action')
-        payload2 = {inp['name']: inp.get('value','') for inp in form2.find_all('input') if inp.get('name')}
-        # populate common profile fields if empty
-        payload2.setdefault('firstName', 'Test')
-        payload2.setdefault('lastName', 'User')
-        payload2.setdefault('email', os.environ.get('TEST_USER_EMAIL','testuser@gogotex.local'))
-        resp = s.post(action2, data=payload2, allow_redirects=True, verify=False)
-        # small delay to allow Keycloak to perform redirect to cb-sink
-        time.sleep(1)
-
-# Check final URL and redirect chain for code
-if 'code=' in resp.url:
-    parsed = urlparse(resp.url)
-    q = parse_qs(parsed.query)
-    if 'code' in q:
-        print(q['code'][0] + '|||' + parsed.scheme + '://' + parsed.netloc + parsed.path)
-        raise SystemExit(0)
-
-# fallback: search HTML for callback URL with code
-import re
-m = re.search(r'(https?://[^\s"\']*/callback)[^\s"\']*.*code=([^\s\"\'\&]+)', resp.text)
-if m:
-    print(m.group(2) + '|||' + m.group(1))
-    raise SystemExit(0)
-print('|||')
-PY
-SH
-  fi
-
-  # copy headless output into DIAG_DIR/headless_latest.txt for quick access (only if headless ran)
-  if [ -n "${HEADLESS_OUT:-}" ] && [ -s "$HEADLESS_OUT" ]; then
-    cp -f "$HEADLESS_OUT" "$DIAG_DIR/headless_latest.txt" || true
-    CODE_REDIRECT="$(sed -n '1p' "$HEADLESS_OUT" || true)"
-  else
-    CODE_REDIRECT=""
-  fi
-  # persist the login HTML we saved earlier (already written to $DIAG_DIR)
-  if [ -f "$DIAG_DIR/keycloak_login.html" ]; then
-    echo "Saved Keycloak login page to $DIAG_DIR/keycloak_login.html"
-  fi
-
-if [ -z "${CODE:-}" ]; then
-  CODE="$(echo "$CODE_REDIRECT" | sed -n '1p' | cut -d'|' -f1)"
-  REDIRECT_URI="$(echo "$CODE_REDIRECT" | sed -n '1p' | sed 's/.*|||//')"
-fi
-
-  if [ -n "$CODE" ]; then
-    echo "Captured code directly: $CODE"
-  else
-    # Fallback #1: perform a non-following POST to Keycloak's login action and inspect the Location header for the code
-    echo "Attempting non-follow POST to capture Location header (fast fallback, posts full form)..."
-    if [ -f "$DIAG_DIR/keycloak_login.html" ]; then
-      # Extract form inputs from saved HTML and POST them (uses Python to parse hidden inputs)
-      LOCATION_HDR=$(docker run --rm --network "$NET" -v "$DIAG_DIR":/diag -e TEST_USER="$TEST_USER" -e TEST_PASS="$TEST_PASS" python:3.11-slim /bin/sh -c "pip install requests bs4 >/dev/null 2>&1; python - <<'PY'
-import os, sys, requests
-from bs4 import BeautifulSoup
-html = open('/diag/keycloak_login.html','r',encoding='utf-8').read()
-S = BeautifulSoup(html,'html.parser')
-form = S.find('form')
-if not form:
-    sys.exit(2)
-action = form.get('action').replace('localhost:8080','keycloak-keycloak:8080')
-inputs = {inp.get('name'): inp.get('value','') for inp in form.find_all('input') if inp.get('name')}
-inputs['username'] = os.environ.get('TEST_USER')
-inputs['password'] = os.environ.get('TEST_PASS')
-r = requests.post(action, data=inputs, allow_redirects=False, verify=False)
-print(r.headers.get('Location','') or '')
-PY" || true)
-      if printf '%s' "$LOCATION_HDR" | grep -q 'code='; then
-        echo "Captured code in Location header: $LOCATION_HDR"
-        CODE=$(printf '%s' "$LOCATION_HDR" | sed -n 's/.*[?&]code=\([^&]*\).*/\1/p') || true
-        REDIRECT_URI=$(printf '%s' "$LOCATION_HDR" | sed -n 's/\(https*:\/\/[^?]*\).*/\1/p') || true
-      fi
-    fi
-
-    if [ -z "$CODE" ]; then
-      # Fallback (strong): do a fresh GET -> POST (no redirect) inside the Docker network and inspect Location header
-      echo "Attempting fresh GET+non-follow POST inside Docker network (strong fallback)..."
-      FRESH_LOC=$(docker run --rm --network "$NET" -e TEST_USER="$TEST_USER" -e TEST_PASS="$TEST_PASS" python:3.11-slim /bin/sh -c "pip install requests bs4 >/dev/null 2>&1; python - <<'PY'\nimport os, requests\nfrom bs4 import BeautifulSoup\nfrom urllib.parse import urlparse, parse_qs\ns = requests.Session()\nurl = 'http://keycloak-keycloak:8080/sso/realms/gogotex/protocol/openid-connect/auth?client_id=gogotex-backend&response_type=code&scope=openid&redirect_uri=http://cb-sink:3000/callback'\nresp = s.get(url, verify=False)\nsoup = BeautifulSoup(resp.text, 'html.parser')\nform = soup.find('form')\nif not form:\n    print('')\nelse:\n    action = form.get('action')\n    if 'localhost' in action:\n        action = action.replace('localhost:8080','keycloak-keycloak:8080')\n    inputs = {inp.get('name'): inp.get('value','') for inp in form.find_all('input') if inp.get('name')}\n    inputs['username'] = os.environ.get('TEST_USER')\n    inputs['password'] = os.environ.get('TEST_PASS')\n    # initial post (do not follow redirects)
-    r = s.post(action, data=inputs, allow_redirects=False, verify=False)\n    loc = r.headers.get('Location','')\n    # if required-action page returned in body, complete it and then inspect Location
-    if 'required-action' in r.text or 'VERIFY_PROFILE' in r.text:\n        soup2 = BeautifulSoup(r.text, 'html.parser')\n        form2 = soup2.find('form')\n        if form2:\n            action2 = form2.get('action')\n            inputs2 = {inp.get('name'): inp.get('value','') for inp in form2.find_all('input') if inp.get('name')}\n            inputs2.setdefault('firstName','Test')\n            inputs2.setdefault('lastName','User')\n            inputs2.setdefault('email', os.environ.get('TEST_USER_EMAIL','testuser@gogotex.local'))\n            r2 = s.post(action2, data=inputs2, allow_redirects=False, verify=False)\n            loc = r2.headers.get('Location','') or loc\n    print(loc)\nPY" 2>/dev/null || true)
-      if printf '%s' "$FRESH_LOC" | grep -q 'code='; then
-        echo "Captured code from fresh non-follow POST: $FRESH_LOC"
-        CODE=$(printf '%s' "$FRESH_LOC" | sed -n 's/.*[?&]code=\([^&]*\).*/\1/p') || true
-        REDIRECT_URI=$(printf '%s' "$FRESH_LOC" | sed -n 's/\(https*:\/\/[^?]*\).*/\1/p') || true
-      fi
-    fi
-  fi
-  if [ -z "$CODE" ]; then
-    echo "Failed to capture authorization code (no code from headless flow and no cb-sink fallback)."
-    docker logs cb-sink 2>/dev/null || true
-    docker rm -f "$AUTH_CONTAINER_NAME" >/dev/null 2>&1 || true
-    exit 6
-  fi
-fi
-
-echo "Captured code: $CODE"
-
-# Optional diagnostic: try exchanging the captured code directly with Keycloak token endpoint when DEBUG_KC_EXCHANGE=true
-if [ "${DEBUG_KC_EXCHANGE:-false}" = "true" ]; then
-  echo "Attempting direct token exchange with Keycloak (diagnostic)..."
-  KC_TOKEN_RESP=$(docker run --rm --network "$NET" curlimages/curl -sS -X POST -d "grant_type=authorization_code" -d "client_id=gogotex-backend" -d "client_secret=$CLIENT_SECRET" -d "code=$CODE" -d "redirect_uri=$REDIRECT_URI" http://keycloak-keycloak:8080/sso/realms/gogotex/protocol/openid-connect/token || true)
-  echo "Keycloak token response: $KC_TOKEN_RESP"
-  # DEBUG_KC_EXCHANGE consumes the authorization code at Keycloak. obtain a fresh code
-  # for the actual auth-service exchange so we don't submit an already-used code.
-  echo "DEBUG_KC_EXCHANGE=true: re-capturing fresh authorization code and redirect_uri"
-  # Re-capture using the robust "fresh GET + non-follow POST" approach (same as primary capture)
-  echo "Re-running fresh GET+non-follow POST to obtain a new code..."
-  FRESH_LOC_RECAP=$(docker run --rm --network "$NET" -e TEST_USER="$TEST_USER" -e TEST_PASS="$TEST_PASS" python:3.11-slim /bin/sh -c "pip install requests bs4 >/dev/null 2>&1; python - <<'PY'
-import os, requests
-from bs4 import BeautifulSoup
-s = requests.Session()
-url = 'http://keycloak-keycloak:8080/sso/realms/gogotex/protocol/openid-connect/auth?client_id=gogotex-backend&response_type=code&scope=openid&redirect_uri=http://cb-sink:3000/callback'
-resp = s.get(url, verify=False)
-soup = BeautifulSoup(resp.text, 'html.parser')
-form = soup.find('form')
-if not form:
-    print('')
-else:
-    action = form.get('action')
-    if 'localhost' in action:
-        action = action.replace('localhost:8080','keycloak-keycloak:8080')
-    inputs = {inp.get('name'): inp.get('value','') for inp in form.find_all('input') if inp.get('name')}
-    inputs['username'] = os.environ.get('TEST_USER')
-    inputs['password'] = os.environ.get('TEST_PASS')
-    r = s.post(action, data=inputs, allow_redirects=False, verify=False)
-    print(r.headers.get('Location','') or '')
-PY" || true)
-  if printf '%s' "$FRESH_LOC_RECAP" | grep -q 'code='; then
-    CODE=$(printf '%s' "$FRESH_LOC_RECAP" | sed -n 's/.*[?&]code=\([^&]*\).*/\1/p' || true)
-    REDIRECT_URI=$(printf '%s' "$FRESH_LOC_RECAP" | sed -n "s/\(https*:\/\/[^?]*\).*/\1/p" || true)
-  fi
-  echo "Re-captured code: $CODE redirect_uri: $REDIRECT_URI"
-fi
-
-# POST code to auth service (use auth service's /auth/login with mode=auth_code)
-# Retry the full headless-capture -> exchange sequence to mitigate transient 'code not valid' or timing races
-# Number of attempts to exchange an authorization code with the auth service
+# Number of attempts of the full browser flow
 MAX_ATTEMPTS=${MAX_ATTEMPTS:-5}
 # Whether to fail the entire script when auth-code E2E fails
 FAIL_ON_AUTH_CODE=${FAIL_ON_AUTH_CODE:-true}
-# Directory to write diagnostics when auth-code flow is flaky (initialized earlier)
 # DIAG_DIR initialized near the top of the script
 
 EXCHANGE_SUCCESS=false
 for attempt in $(seq 1 $MAX_ATTEMPTS); do
-  echo "Exchanging code via auth service (attempt $attempt/$MAX_ATTEMPTS)..."
-LOGIN_RESP=$(docker run --rm --network "$NET" curlimages/curl -sS -X POST -H "Content-Type: application/json" -d '{"mode":"auth_code","code":"'"$CODE"'"'","redirect_uri":"'"$REDIRECT_URI"'"'}' http://$AUTH_HOST/auth/login || true)"$CODE"'"","redirect_uri":"'"$REDIRECT_URI"'"'}' http://$AUTH_CONTAINER_NAME:8081/auth/login || true)
-  if echo "$LOGIN_RESP" | jq -e '.access_token' >/dev/null 2>&1; then
-    echo "✅ Auth-code E2E: auth service exchanged code and returned tokens"
-    echo "$LOGIN_RESP" | jq .
-    EXCHANGE_SUCCESS=true
-    break
-  else
-    echo "Auth-code exchange failed on attempt $attempt: $LOGIN_RESP"
-
-    # write diagnostics for this failure
-    TS=$(date +%Y%m%d-%H%M%S)
-    mkdir -p "$DIAG_DIR" || true
-    echo "$LOGIN_RESP" > "$DIAG_DIR/login_response_$TS.json" || true
-    docker logs "$AUTH_CONTAINER_NAME" 2>/dev/null | sed -n '1,400p' > "$DIAG_DIR/auth_container_$TS.log" || true
-    docker logs keycloak-keycloak 2>/dev/null | sed -n '1,800p' > "$DIAG_DIR/keycloak_$TS.log" || true
-    docker logs cb-sink 2>/dev/null | sed -n '1,200p' > "$DIAG_DIR/cb_sink_$TS.log" || true
-    echo "Saved diagnostics to $DIAG_DIR/*_$TS.*"
-
-    if [ $attempt -lt $MAX_ATTEMPTS ]; then
-      # exponential backoff (cap at 16s)
-      sleep_time=$((2 ** (attempt - 1)))
-      if [ $sleep_time -gt 16 ]; then sleep_time=16; fi
-      echo "Will retry headless flow to obtain a fresh code after ${sleep_time}s..."
-      sleep $sleep_time
-
-      # attempt headless capture again (follows redirects)
-      CODE_REDIRECT=$(docker run --rm --network "$NET" -e TEST_USER="$TEST_USER" -e TEST_PASS="$TEST_PASS" python:3.11-slim sh -s <<'SH'
+  echo "Signing in through the auth service (attempt $attempt/$MAX_ATTEMPTS)..."
+  # the redirect URI registered for the auth service uses the container name, so the
+  # flow cookie must be set for that host as well
+  LOGIN_RESP=$(docker run --rm --network "$NET" -e TEST_USER="$TEST_USER" -e TEST_PASS="$TEST_PASS" -e AUTH_BASE="http://$AUTH_CONTAINER_NAME:8081" python:3.11-slim sh -s <<'SH' || true
+pip install -q requests beautifulsoup4 >/dev/null 2>&1
 python - <<'PY'
-import os, requests
+import json, os, requests
 from bs4 import BeautifulSoup
-from urllib.parse import urlparse, parse_qs
+from urllib.parse import urljoin, urlparse, parse_qs
+
 s = requests.Session()
 
-auth_url = 'http://keycloak-keycloak:8080/sso/realms/gogotex/protocol/openid-connect/auth?client_id=gogotex-backend&response_type=code&scope=openid&redirect_uri=http://cb-sink:3000/callback'
-resp = s.get(auth_url, verify=False)
-form = BeautifulSoup(resp.text, 'html.parser').find('form')
-if not form:
-    print('|||')
-    raise SystemExit(0)
-action = form.get('action')
-if action and 'localhost' in action:
-    action = action.replace('localhost:8080','keycloak-keycloak:8080')
-
-payload = {inp['name']: inp.get('value','') for inp in form.find_all('input') if inp.get('name')}
-payload['username'] = os.environ['TEST_USER']
-payload['password'] = os.environ['TEST_PASS']
-resp = s.post(action, data=payload, allow_redirects=True, verify=False)
-
-# If Keycloak requires profile verification, submit that form programmatically
-if 'required-action' in resp.url or 'VERIFY_PROFILE' in resp.url or 'required-action' in resp.text:
-    soup2 = BeautifulSoup(resp.text, 'html.parser')
-    form2 = soup2.find('form')
-    if form2:
-        action2 = form2.get('action')
-        payload2 = {inp['name']: inp.get('value','') for inp in form2.find_all('input') if inp.get('name')}
-        payload2.setdefault('firstName','Test')
-        payload2.setdefault('lastName','User')
-        payload2.setdefault('email', os.environ.get('TEST_USER_EMAIL','testuser@gogotex.local'))
-        resp = s.post(action2, data=payload2, allow_redirects=True, verify=False)
-
-# check final URL
-if 'code=' in resp.url:
-    parsed = urlparse(resp.url)
-    q = parse_qs(parsed.query)
-    if 'code' in q:
-        print(q['code'][0] + '|||' + parsed.scheme + '://' + parsed.netloc + parsed.path)
-        raise SystemExit(0)
-# fallback: search HTML
-import re
-m = re.search(r'(https?://[^\s"\']*/callback)[^\s"\']*.*code=([^\s\"\'\&]+)', resp.text)
-if m:
-    print(m.group(2) + '|||' + m.group(1))
-    raise SystemExit(0)
-print('|||')
+def follow(resp):
+    # follow redirects by hand: the last hop goes to the frontend with the tokens in
+    # the fragment (AUTH_POST_LOGIN_REDIRECT), which a plain GET would drop
+    for _ in range(10):
+        loc = resp.headers.get('Location')
+        if not loc:
+            return resp, None
+        if '#' in loc:
+            frag = parse_qs(urlparse(loc).fragment)
+            if 'access_token' in frag:
+                return resp, {k: v[0] for k, v in frag.items()}
+        resp = s.get(urljoin(resp.url, loc), allow_redirects=False)
+    return resp, None
+
+def submit(resp, extra):
+    form = BeautifulSoup(resp.text, 'html.parser').find('form')
+    if not form:
+        return None
+    payload = {inp['name']: inp.get('value', '') for inp in form.find_all('input') if inp.get('name')}
+    payload.update(extra)
+    return s.post(urljoin(resp.url, form.get('action')), data=payload, allow_redirects=False)
+
+resp, tokens = follow(s.get(os.environ['AUTH_BASE'] + '/auth/authorize?return_to=/', allow_redirects=False))
+if tokens is None:
+    resp, tokens = follow(submit(resp, {'username': os.environ['TEST_USER'], 'password': os.environ['TEST_PASS']}) or resp)
+# Keycloak may ask for required actions (e.g. VERIFY_PROFILE) before redirecting
+if tokens is None and resp.status_code == 200 and 'login-actions' in resp.url:
+    nxt = submit(resp, {'firstName': 'Test', 'lastName': 'User', 'email': os.environ.get('TEST_USER_EMAIL', 'testuser@gogotex.local')})
+    if nxt is not None:
+        resp, tokens = follow(nxt)
+if tokens is None:
+    # /auth/callback answers with JSON when no post-login redirect is configured
+    try:
+        tokens = resp.json()
+    except ValueError:
+        tokens = {'error': 'no tokens', 'status': resp.status_code, 'url': resp.url}
+print(json.dumps(tokens))
 PY
 SH
 )
-# parse into CODE and REDIRECT_URI
-CODE="$(printf '%s' "$CODE_REDIRECT" | sed -n '1p' | cut -d'|' -f1)"
-REDIRECT_URI="$(printf '%s' "$CODE_REDIRECT" | sed -n '1p' | sed 's/.*|||//')"
-      continue
-    else
-      echo "Auth-code exchange failed after $MAX_ATTEMPTS attempts.";
-      break
-    fi
+  if echo "$LOGIN_RESP" | jq -e '.access_token' >/dev/null 2>&1; then
+    echo "✅ Auth-code E2E: /auth/callback completed the login and returned tokens"
+    echo "$LOGIN_RESP" | jq 'with_entries(if (.key | test("token")) then .value = "<redacted>" else . end)'
+    EXCHANGE_SUCCESS=true
+    break
   fi
-done
+  echo "Auth-code E2E failed on attempt $attempt: $LOGIN_RESP"
 
-# cleanup cb-sink
-docker rm -f cb-sink >/dev/null 2>&1 || true
+  # write diagnostics for this failure
+  TS=$(date +%Y%m%d-%H%M%S)
+  mkdir -p "$DIAG_DIR" || true
+  echo "$LOGIN_RESP" > "$DIAG_DIR/login_response_$TS.json" || true
+  docker logs "$AUTH_CONTAINER_NAME" 2>/dev/null | sed -n '1,400p' > "$DIAG_DIR/auth_container_$TS.log" || true
+  docker logs keycloak-keycloak 2>/dev/null | sed -n '1,800p' > "$DIAG_DIR/keycloak_$TS.log" || true
+  echo "Saved diagnostics to $DIAG_DIR/*_$TS.*"
+
+  if [ $attempt -lt $MAX_ATTEMPTS ]; then
+    # exponential backoff (cap at 16s)
+    sleep_time=$((2 ** (attempt - 1)))
+    if [ $sleep_time -gt 16 ]; then sleep_time=16; fi
+    echo "Will retry the browser flow after ${sleep_time}s..."
+    sleep $sleep_time
+  fi
+done
 
 if [ "$EXCHANGE_SUCCESS" != "true" ]; then
   if [ "$FAIL_ON_AUTH_CODE" = "true" ]; then
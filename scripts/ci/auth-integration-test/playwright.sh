@@ -17,6 +17,7 @@ fi
 # environment defaults (can be overridden by caller)
 PLAYWRIGHT_BASE_URL=${PLAYWRIGHT_BASE_URL:-http://frontend}
 PLAYWRIGHT_KEYCLOAK=${PLAYWRIGHT_KEYCLOAK:-http://keycloak-keycloak:8080/sso}
+PLAYWRIGHT_AUTH_URL=${PLAYWRIGHT_AUTH_URL:-http://gogotex-auth-integration:8081}
 PLAYWRIGHT_REDIRECT_URI=${PLAYWRIGHT_REDIRECT_URI:-http://frontend/auth/callback}
 TEST_USER=${TEST_USER:-testuser}
 TEST_PASS=${TEST_PASS:-$(cat "$ROOT_DIR/gogotex-support-services/keycloak-service/testuser_password.txt" 2>/dev/null || echo "Test123!")}
@@ -29,7 +30,7 @@ PLAYWRIGHT_PER_TEST_TIMEOUT=${PLAYWRIGHT_PER_TEST_TIMEOUT:-120000}
 PLAYWRIGHT_TRACE=${PLAYWRIGHT_TRACE:-off}
 
 # Diagnostic summary (stderr only)
-echo "Playwright: base_url=$PLAYWRIGHT_BASE_URL kc=$PLAYWRIGHT_KEYCLOAK redirect=$PLAYWRIGHT_REDIRECT_URI user=$TEST_USER reporter=$PLAYWRIGHT_REPORTER per_test_timeout=${PLAYWRIGHT_PER_TEST_TIMEOUT}ms trace=$PLAYWRIGHT_TRACE" >&2
+echo "Playwright: base_url=$PLAYWRIGHT_BASE_URL kc=$PLAYWRIGHT_KEYCLOAK auth=$PLAYWRIGHT_AUTH_URL redirect=$PLAYWRIGHT_REDIRECT_URI user=$TEST_USER reporter=$PLAYWRIGHT_REPORTER per_test_timeout=${PLAYWRIGHT_PER_TEST_TIMEOUT}ms trace=$PLAYWRIGHT_TRACE" >&2
 
 # Build the inner command; keep output visible when verbosity is requested
 if [ "$PLAYWRIGHT_VERBOSE" = "true" ]; then
@@ -85,6 +86,7 @@ fi
 docker run --rm $DOCKER_RUN_ENTRYPOINT --network "$NET" \
   -e PLAYWRIGHT_BASE_URL="$PLAYWRIGHT_BASE_URL" \
   -e PLAYWRIGHT_KEYCLOAK="$PLAYWRIGHT_KEYCLOAK" \
+  -e PLAYWRIGHT_AUTH_URL="$PLAYWRIGHT_AUTH_URL" \
   -e PLAYWRIGHT_REDIRECT_URI="$PLAYWRIGHT_REDIRECT_URI" \
   -e TEST_USER="$TEST_USER" \
   -e TEST_PASS="$TEST_PASS" \